@@ -21,6 +21,7 @@ import (
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/apic"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/ppssh"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 )
 
@@ -62,6 +63,7 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		secureComms          bool
 		secureCommsInbounds  string
 		secureCommsOutbounds string
+		secureCommsTransport string
 		tlsConfig            tlsutil.TLSConfig
 		services             []cmd.Service
 	)
@@ -81,6 +83,7 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		flags.BoolVar(&secureComms, "secure-comms", false, "Use SSH to secure communication between cluster and peer pods")
 		flags.StringVar(&secureCommsInbounds, "secure-comms-inbounds", "", "Inbound tags for secure communication tunnels")
 		flags.StringVar(&secureCommsOutbounds, "secure-comms-outbounds", "", "Outbound tags for secure communication tunnels")
+		flags.StringVar(&secureCommsTransport, "secure-comms-transport", "", "Transport of secure communication tunnels: ssh, or quic for QUIC with mutual TLS (default ssh)")
 	})
 
 	cmd.ShowVersion(programName)
@@ -130,7 +133,17 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		outbounds = append([]string{"KUBERNETES_PHASE:KATAAGENT:" + port}, strings.Split(secureCommsOutbounds, ",")...)
 		outbounds = append(outbounds, strings.Split(cfg.daemonConfig.SecureCommsOutbounds, ",")...)
 
-		services = append(services, ppssh.NewSshServer(inbounds, outbounds, ppSecrets, sshutil.SSHPORT))
+		if secureCommsTransport == "" {
+			secureCommsTransport = cfg.daemonConfig.SecureCommsTransport
+		}
+		transport, err := sshproxy.ParseTransport(secureCommsTransport)
+		if err != nil {
+			return nil, err
+		}
+
+		sshServer := ppssh.NewSshServer(inbounds, outbounds, ppSecrets, sshutil.SSHPORT)
+		sshServer.SetTransport(transport)
+		services = append(services, sshServer)
 	} else {
 		if !disableTLS {
 			cfg.tlsConfig = &tlsConfig
@@ -141,7 +154,12 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 
 	podNode := podnetwork.NewPodNode(cfg.podNamespace, cfg.HostInterface, cfg.daemonConfig.PodNetwork)
 
-	services = append(services, daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode))
+	var monitor podnetwork.Monitor
+	if cfg.daemonConfig.TunnelMonitorInterval > 0 {
+		monitor = podnetwork.NewPodNodeMonitor(podNode, cfg.podNamespace, cfg.daemonConfig.PodNetwork, cfg.daemonConfig.TunnelMonitorInterval, nil)
+	}
+
+	services = append(services, daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode, monitor))
 
 	return cmd.NewStarter(services...), nil
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor"
@@ -18,6 +19,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler/vxlan"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 
@@ -32,6 +34,7 @@ const (
 type daemonConfig struct {
 	serverConfig  cloud.ServerConfig
 	networkConfig tunneler.NetworkConfig
+	probeChecks   []probe.Check
 }
 
 func printHelp(out io.Writer) {
@@ -90,6 +93,13 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		secureCommsPpInbounds  string
 		secureCommsPpOutbounds string
 		secureCommsKbsAddr     string
+		secureCommsKeyRotation time.Duration
+		secureCommsKbsCACert   string
+		secureCommsRateLimits  string
+		secureCommsTransport   string
+
+		secureCommsAnnotationAllowlist string
+		secureCommsAnnotationInterval  time.Duration
 	)
 
 	cmd.Parse(programName, os.Args[1:], func(flags *flag.FlagSet) {
@@ -116,14 +126,28 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		flags.StringVar(&secureCommsPpInbounds, "secure-comms-pp-inbounds", "", "PP Inbound tags for secure communication tunnels")
 		flags.StringVar(&secureCommsPpOutbounds, "secure-comms-pp-outbounds", "", "PP Outbound tags for secure communication tunnels")
 		flags.StringVar(&secureCommsKbsAddr, "secure-comms-kbs", "kbs-service.trustee-operator-system:8080", "Address of a Trustee Service for Secure-Comms")
+		flags.StringVar(&secureCommsKbsCACert, "secure-comms-kbs-ca-cert", "", "CA certificate file of a Trustee Service using HTTPS for Secure-Comms")
+		flags.DurationVar(&secureCommsKeyRotation, "secure-comms-key-rotation", 0, "Interval of Secure-Comms SSH key rotation (0 disables it)")
+		flags.StringVar(&secureCommsTransport, "secure-comms-transport", "ssh", "Transport of Secure-Comms tunnels: ssh, or quic for QUIC with mutual TLS")
+		flags.StringVar(&secureCommsRateLimits, "secure-comms-rate-limits", "", "Rate limits of Secure-Comms tunnels in bytes per second, such as \"DEBUG:1Mi,LOGS:500Ki\"")
+		flags.StringVar(&secureCommsAnnotationAllowlist, "secure-comms-annotation-allowlist", "", "WN Inbound and Outbound tags which pods may request using annotations")
+		flags.DurationVar(&secureCommsAnnotationInterval, "secure-comms-annotation-interval", adaptor.DefaultSecureCommsAnnotationInterval, "Interval of checks for changes of the Secure-Comms tunnel annotations of pods (0 disables them)")
 		flags.DurationVar(&cfg.serverConfig.ProxyTimeout, "proxy-timeout", proxy.DefaultProxyTimeout, "Maximum timeout in minutes for establishing agent proxy connection")
 
 		flags.StringVar(&cfg.networkConfig.TunnelType, "tunnel-type", podnetwork.DefaultTunnelType, "Tunnel provider")
 		flags.StringVar(&cfg.networkConfig.HostInterface, "host-interface", "", "Host Interface")
+		flags.StringVar(&cfg.networkConfig.FirewallBackend, "firewall-backend", string(netops.FirewallBackendAuto), "Firewall backend for tunnel rules: auto, nftables or iptables")
+		flags.DurationVar(&cfg.serverConfig.TunnelMonitorInterval, "tunnel-monitor-interval", podnetwork.DefaultMonitorInterval, "Interval of pod network tunnel health checks and repairs (0 disables it)")
+		flags.DurationVar(&cfg.serverConfig.SpotCheckInterval, "spot-check-interval", adaptor.DefaultSpotCheckInterval, "Interval of checks for the preemption of spot pod VMs (0 disables them)")
+		flags.IntVar(&cfg.networkConfig.MTU.Underlay, "underlay-mtu", 0, "MTU of the network between worker nodes and pod VMs if it is smaller than the MTU of the host interface")
+		flags.IntVar(&cfg.networkConfig.MTU.ExtraOverhead, "tunnel-extra-overhead", 0, "Size of additional encapsulation of tunnel traffic on the network between worker nodes and pod VMs")
+		flags.BoolVar(&cfg.networkConfig.MTU.Probe, "mtu-probe", false, "Verify the tunnel MTU by sending a packet with the DF bit set to pod VMs")
 		flags.IntVar(&cfg.networkConfig.VXLAN.Port, "vxlan-port", vxlan.DefaultVXLANPort, "VXLAN UDP port number (VXLAN tunnel mode only")
 		flags.IntVar(&cfg.networkConfig.VXLAN.MinID, "vxlan-min-id", vxlan.DefaultVXLANMinID, "Minimum VXLAN ID (VXLAN tunnel mode only")
 		flags.StringVar(&cfg.serverConfig.Initdata, "initdata", "", "Default initdata for all Pods")
 		flags.BoolVar(&cfg.serverConfig.EnableCloudConfigVerify, "cloud-config-verify", false, "Enable cloud config verify - should use it for production")
+		flags.StringVar(&cfg.serverConfig.UserDataSigningKey, "userdata-signing-key", "", "PEM file of an Ed25519 private key signing the cloud-config of pod VMs")
+		flags.StringVar(&cfg.serverConfig.UserDataEncryptionKey, "userdata-encryption-key", "", "PEM file of an X25519 public key of pod VMs encrypting the sensitive files of the cloud-config")
 		flags.IntVar(&cfg.serverConfig.PeerPodsLimitPerNode, "peerpods-limit-per-node", 10, "peer pods limit per node (default=10)")
 
 		cloud.ParseCmd(flags)
@@ -146,6 +170,12 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		cfg.serverConfig.SecureCommsPpInbounds = secureCommsPpInbounds
 		cfg.serverConfig.SecureCommsPpOutbounds = secureCommsPpOutbounds
 		cfg.serverConfig.SecureCommsKbsAddress = secureCommsKbsAddr
+		cfg.serverConfig.SecureCommsKeyRotation = secureCommsKeyRotation
+		cfg.serverConfig.SecureCommsKbsCACert = secureCommsKbsCACert
+		cfg.serverConfig.SecureCommsRateLimits = secureCommsRateLimits
+		cfg.serverConfig.SecureCommsTransport = secureCommsTransport
+		cfg.serverConfig.SecureCommsAnnotationAllowlist = secureCommsAnnotationAllowlist
+		cfg.serverConfig.SecureCommsAnnotationInterval = secureCommsAnnotationInterval
 	} else {
 		if !disableTLS {
 			cfg.serverConfig.TLSConfig = &tlsConfig
@@ -165,6 +195,7 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 	}
 
 	server := adaptor.NewServer(provider, &cfg.serverConfig, workerNode)
+	cfg.probeChecks = server.ProbeChecks()
 
 	return cmd.NewStarter(server), nil
 }
@@ -181,7 +212,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go probe.Start(config.serverConfig.SocketPath)
+	go probe.Start(config.serverConfig.SocketPath, config.probeChecks...)
 
 	if err := starter.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
@@ -0,0 +1,124 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+	"github.com/spf13/cobra"
+)
+
+// readInitdata reads an initdata document, or its base64 encoded annotation value, from a file or stdin
+func readInitdata(path string) ([]byte, *initdata.InitData, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	annotation := strings.TrimSpace(string(content))
+	if _, err := base64.StdEncoding.DecodeString(annotation); err == nil {
+		return initdata.Decode(annotation)
+	}
+	data, err := initdata.Parse(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, data, nil
+}
+
+func newInitdataCmd() *cobra.Command {
+	var initdataCmd = &cobra.Command{
+		Use:   "initdata",
+		Short: "Build, validate and digest initdata",
+	}
+
+	var algorithm string
+	var files []string
+	var raw bool
+	var buildCmd = &cobra.Command{
+		Use:     "build",
+		Short:   "Build initdata from files and print its annotation value",
+		Example: fmt.Sprintf("  %s initdata build --file aa.toml=./aa.toml --file cdh.toml=./cdh.toml --file policy.rego=./policy.rego", programName),
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			data := map[string]string{}
+			for _, file := range files {
+				key, path, ok := strings.Cut(file, "=")
+				if !ok {
+					return fmt.Errorf("invalid file %q, expected key=path", file)
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				data[key] = string(content)
+			}
+			doc, err := initdata.Build(algorithm, data)
+			if err != nil {
+				return err
+			}
+			if raw {
+				fmt.Fprint(cmd.OutOrStdout(), string(doc))
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), initdata.Encode(doc))
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+	buildCmd.Flags().StringVar(&algorithm, "algorithm", "sha384", fmt.Sprintf("Digest algorithm, one of %s", strings.Join(initdata.SupportedAlgorithms, ", ")))
+	buildCmd.Flags().StringArrayVar(&files, "file", nil, fmt.Sprintf("Data file as key=path, key is one of %s", strings.Join(initdata.KnownKeys, ", ")))
+	buildCmd.Flags().BoolVar(&raw, "raw", false, "Print the TOML document instead of the annotation value")
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate <file>",
+		Short: "Validate initdata, read from a file or - for stdin, as TOML or as annotation value",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, data, err := readInitdata(args[0])
+			if err != nil {
+				return err
+			}
+			if err := data.Validate(); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "initdata is valid")
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	var digestCmd = &cobra.Command{
+		Use:   "digest <file>",
+		Short: "Print the digest of initdata, read from a file or - for stdin, as TOML or as annotation value",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, data, err := readInitdata(args[0])
+			if err != nil {
+				return err
+			}
+			digest, err := initdata.Digest(doc, data.Algorithm)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), digest)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	initdataCmd.AddCommand(buildCmd, validateCmd, digestCmd)
+	return initdataCmd
+}
@@ -32,6 +32,8 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	var fetchTimeout int
+	var verificationKey, decryptionKey, allowlist string
+	var requireSigned bool
 	rootCmd.PersistentFlags().BoolVarP(&versionFlag, "version", "v", false, "Print the version")
 
 	var provisionFilesCmd = &cobra.Command{
@@ -39,12 +41,23 @@ func init() {
 		Short: "Provision required files based on user data",
 		RunE: func(_ *cobra.Command, _ []string) error {
 			cfg := userdata.NewConfig(fetchTimeout)
+			if err := cfg.LoadAllowlist(allowlist); err != nil {
+				return err
+			}
+			if err := cfg.SetUserDataKeys(verificationKey, decryptionKey, requireSigned); err != nil {
+				return err
+			}
 			return userdata.ProvisionFiles(cfg)
 		},
 		SilenceUsage: true, // Silence usage on error
 	}
 	provisionFilesCmd.Flags().IntVarP(&fetchTimeout, "user-data-fetch-timeout", "t", 180, "Timeout (in secs) for fetching user data")
+	provisionFilesCmd.Flags().StringVar(&verificationKey, "user-data-verification-key", "", "PEM file of the Ed25519 public key verifying the user data signature")
+	provisionFilesCmd.Flags().StringVar(&decryptionKey, "user-data-decryption-key", "", "PEM file of the X25519 private key decrypting sealed user data files")
+	provisionFilesCmd.Flags().StringVar(&allowlist, "allowlist", userdata.AllowlistPath, "YAML file listing the files to write from user data and initdata")
+	provisionFilesCmd.Flags().BoolVar(&requireSigned, "require-signed-user-data", false, "Refuse user data without a valid signature")
 	rootCmd.AddCommand(provisionFilesCmd)
+	rootCmd.AddCommand(newInitdataCmd())
 }
 
 func main() {
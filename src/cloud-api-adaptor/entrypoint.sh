@@ -18,6 +18,12 @@ optionals+=""
 [[ "${PAUSE_IMAGE}" ]] && optionals+="-pause-image ${PAUSE_IMAGE} "
 [[ "${TUNNEL_TYPE}" ]] && optionals+="-tunnel-type ${TUNNEL_TYPE} "
 [[ "${VXLAN_PORT}" ]] && optionals+="-vxlan-port ${VXLAN_PORT} "
+[[ "${FIREWALL_BACKEND}" ]] && optionals+="-firewall-backend ${FIREWALL_BACKEND} "
+[[ "${TUNNEL_MONITOR_INTERVAL}" ]] && optionals+="-tunnel-monitor-interval ${TUNNEL_MONITOR_INTERVAL} "
+[[ "${SPOT_CHECK_INTERVAL}" ]] && optionals+="-spot-check-interval ${SPOT_CHECK_INTERVAL} "
+[[ "${UNDERLAY_MTU}" ]] && optionals+="-underlay-mtu ${UNDERLAY_MTU} "
+[[ "${TUNNEL_EXTRA_OVERHEAD}" ]] && optionals+="-tunnel-extra-overhead ${TUNNEL_EXTRA_OVERHEAD} "
+[[ "${MTU_PROBE}" == "true" ]] && optionals+="-mtu-probe "
 [[ "${CACERT_FILE}" ]] && optionals+="-ca-cert-file ${CACERT_FILE} "
 [[ "${CERT_FILE}" ]] && [[ "${CERT_KEY}" ]] && optionals+="-cert-file ${CERT_FILE} -cert-key ${CERT_KEY} "
 [[ "${TLS_SKIP_VERIFY}" ]] && optionals+="-tls-skip-verify "
@@ -25,6 +31,8 @@ optionals+=""
 [[ "${INITDATA}" ]] && optionals+="-initdata ${INITDATA} "
 [[ "${FORWARDER_PORT}" ]] && optionals+="-forwarder-port ${FORWARDER_PORT} "
 [[ "${CLOUD_CONFIG_VERIFY}" == "true" ]] && optionals+="-cloud-config-verify "
+[[ "${USERDATA_SIGNING_KEY}" ]] && optionals+="-userdata-signing-key ${USERDATA_SIGNING_KEY} "
+[[ "${USERDATA_ENCRYPTION_KEY}" ]] && optionals+="-userdata-encryption-key ${USERDATA_ENCRYPTION_KEY} "
 [[ "${SECURE_COMMS}" == "true" ]] && optionals+="-secure-comms "
 [[ "${SECURE_COMMS_NO_TRUSTEE}" == "true" ]] && optionals+="-secure-comms-no-trustee "
 [[ "${SECURE_COMMS_INBOUNDS}" ]] && optionals+="-secure-comms-inbounds ${SECURE_COMMS_INBOUNDS} "
@@ -32,6 +40,12 @@ optionals+=""
 [[ "${SECURE_COMMS_PP_INBOUNDS}" ]] && optionals+="-secure-comms-pp-inbounds ${SECURE_COMMS_PP_INBOUNDS} "
 [[ "${SECURE_COMMS_PP_OUTBOUNDS}" ]] && optionals+="-secure-comms-pp-outbounds ${SECURE_COMMS_PP_OUTBOUNDS} "
 [[ "${SECURE_COMMS_KBS_ADDR}" ]] && optionals+="-secure-comms-kbs ${SECURE_COMMS_KBS_ADDR} "
+[[ "${SECURE_COMMS_KBS_CA_CERT}" ]] && optionals+="-secure-comms-kbs-ca-cert ${SECURE_COMMS_KBS_CA_CERT} "
+[[ "${SECURE_COMMS_KEY_ROTATION}" ]] && optionals+="-secure-comms-key-rotation ${SECURE_COMMS_KEY_ROTATION} "
+[[ "${SECURE_COMMS_RATE_LIMITS}" ]] && optionals+="-secure-comms-rate-limits ${SECURE_COMMS_RATE_LIMITS} "
+[[ "${SECURE_COMMS_TRANSPORT}" ]] && optionals+="-secure-comms-transport ${SECURE_COMMS_TRANSPORT} "
+[[ "${SECURE_COMMS_ANNOTATION_ALLOWLIST}" ]] && optionals+="-secure-comms-annotation-allowlist ${SECURE_COMMS_ANNOTATION_ALLOWLIST} "
+[[ "${SECURE_COMMS_ANNOTATION_INTERVAL}" ]] && optionals+="-secure-comms-annotation-interval ${SECURE_COMMS_ANNOTATION_INTERVAL} "
 [[ "${PEERPODS_LIMIT_PER_NODE}" ]] && optionals+="-peerpods-limit-per-node ${PEERPODS_LIMIT_PER_NODE} "
 
 test_vars() {
@@ -103,8 +117,22 @@ gcp() {
     [[ "${GCP_PROJECT_ID}" ]] && optionals+="-gcp-project-id ${GCP_PROJECT_ID} "
     [[ "${GCP_ZONE}" ]] && optionals+="-zone ${GCP_ZONE} "                         # if not set retrieved from IMDS
     [[ "${GCP_MACHINE_TYPE}" ]] && optionals+="-machine-type ${GCP_MACHINE_TYPE} " # default e2-medium
+    [[ "${GCP_MACHINE_TYPES}" ]] && optionals+="-machine-types ${GCP_MACHINE_TYPES} "
+    [[ "${GCP_ACCELERATOR_TYPE}" ]] && optionals+="-accelerator-type ${GCP_ACCELERATOR_TYPE} "
     [[ "${GCP_NETWORK}" ]] && optionals+="-network ${GCP_NETWORK} "                # defaults to 'default'
     [[ "${GCP_DISK_TYPE}" ]] && optionals+="-disk-type ${GCP_DISK_TYPE} "          # defaults to 'pd-standard'
+    [[ "${GCP_DISK_SIZE}" ]] && optionals+="-disk-size ${GCP_DISK_SIZE} "          # defaults to 20 (GiB)
+    [[ "${GCP_SUBNETWORK}" ]] && optionals+="-subnetwork ${GCP_SUBNETWORK} "
+    [[ "${GCP_NETWORK_TIER}" ]] && optionals+="-network-tier ${GCP_NETWORK_TIER} "   # defaults to 'STANDARD'
+    [[ "${GCP_NETWORK_TAGS}" ]] && optionals+="-network-tags ${GCP_NETWORK_TAGS} "
+    [[ "${GCP_DISABLE_PUBLIC_IP}" == "true" ]] && optionals+="-disable-public-ip "
+    [[ "${GCP_LABELS}" ]] && optionals+="-labels ${GCP_LABELS} "
+    [[ "${GCP_SERVICE_ACCOUNT}" ]] && optionals+="-service-account ${GCP_SERVICE_ACCOUNT} "
+    [[ "${GCP_SERVICE_ACCOUNT_SCOPES}" ]] && optionals+="-service-account-scopes ${GCP_SERVICE_ACCOUNT_SCOPES} "
+    [[ "${GCP_CONFIDENTIAL_TYPE}" ]] && optionals+="-confidential-type ${GCP_CONFIDENTIAL_TYPE} "
+    [[ "${GCP_ENABLE_SECURE_BOOT}" == "true" ]] && optionals+="-enable-secure-boot "
+    [[ "${GCP_DISABLE_VTPM}" == "true" ]] && optionals+="-disable-vtpm "
+    [[ "${GCP_DISABLE_INTEGRITY_MONITORING}" == "true" ]] && optionals+="-disable-integrity-monitoring "
 
     set -x
     exec cloud-api-adaptor gcp \
@@ -182,6 +210,12 @@ vsphere() {
     [[ "${GOVC_HOST}" ]] && optionals+="-host ${GOVC_HOST} "
     [[ "${GOVC_DRS}" ]] && optionals+="-drs ${GOVC_DRS} "
     [[ "${GOVC_DATASTORE}" ]] && optionals+="-data-store ${GOVC_DATASTORE} "
+    [[ "${PODVM_INSTANCE_TYPE}" ]] && optionals+="-instance-type ${PODVM_INSTANCE_TYPE} "
+    [[ "${PODVM_INSTANCE_TYPES}" ]] && optionals+="-instance-types ${PODVM_INSTANCE_TYPES} "
+    [[ "${PODVM_MIN_VCPUS}" ]] && optionals+="-min-vcpus ${PODVM_MIN_VCPUS} "
+    [[ "${PODVM_MAX_VCPUS}" ]] && optionals+="-max-vcpus ${PODVM_MAX_VCPUS} "
+    [[ "${PODVM_MIN_MEMORY}" ]] && optionals+="-min-memory ${PODVM_MIN_MEMORY} "
+    [[ "${PODVM_MAX_MEMORY}" ]] && optionals+="-max-memory ${PODVM_MAX_MEMORY} "
 
     set -x
     exec cloud-api-adaptor vsphere \
@@ -5,15 +5,16 @@ package cloud
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,15 +25,16 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	. "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/wnssh"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	putil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
-	toml "github.com/pelletier/go-toml/v2"
 )
 
 const (
@@ -40,12 +42,6 @@ const (
 	Version         = "0.0.0"
 )
 
-type InitData struct {
-	Algorithm string            `toml:"algorithm"`
-	Version   string            `toml:"version"`
-	Data      map[string]string `toml:"data,omitempty"`
-}
-
 type ServerConfig struct {
 	TLSConfig               *tlsutil.TLSConfig
 	SocketPath              string
@@ -62,7 +58,19 @@ type ServerConfig struct {
 	SecureCommsPpInbounds   string
 	SecureCommsPpOutbounds  string
 	SecureCommsKbsAddress   string
+	SecureCommsKbsCACert    string
+	SecureCommsKeyRotation  time.Duration
+	SecureCommsRateLimits   string
+	SecureCommsTransport    string
+	UserDataSigningKey      string
+	UserDataEncryptionKey   string
 	PeerPodsLimitPerNode    int
+	TunnelMonitorInterval   time.Duration
+	SpotCheckInterval       time.Duration
+	// SecureCommsAnnotationAllowlist holds the comma separated WN tags which pods may request using annotations
+	SecureCommsAnnotationAllowlist string
+	// SecureCommsAnnotationInterval is the interval of checks for changes of the tunnel annotations of pods
+	SecureCommsAnnotationInterval time.Duration
 }
 
 var logger = log.New(log.Writer(), "[adaptor/cloud] ", log.LstdFlags|log.Lmsgprefix)
@@ -114,13 +122,40 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 		var outbounds []string
 		outbounds = append(outbounds, strings.Split(serverConfig.SecureCommsOutbounds, ",")...)
 		if serverConfig.SecureCommsTrustee {
-			outbounds = append(outbounds, "BOTH_PHASES:KBS:"+serverConfig.SecureCommsKbsAddress)
+			kbsHostPort, err := wnssh.KbsHostPort(serverConfig.SecureCommsKbsAddress)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			outbounds = append(outbounds, "BOTH_PHASES:KBS:"+kbsHostPort)
+		}
+
+		var kbsCACert []byte
+		if serverConfig.SecureCommsTrustee && serverConfig.SecureCommsKbsCACert != "" {
+			kbsCACert, err = os.ReadFile(serverConfig.SecureCommsKbsCACert)
+			if err != nil {
+				log.Fatalf("failed to read KBS CA certificate: %v", err)
+			}
+		}
+
+		transport, err := sshproxy.ParseTransport(serverConfig.SecureCommsTransport)
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
+		serverConfig.SecureCommsTransport = transport
 
-		sshClient, err = wnssh.InitSshClient(inbounds, outbounds, serverConfig.SecureCommsTrustee, serverConfig.SecureCommsKbsAddress, sshport)
+		sshClient, err = wnssh.InitSshClient(inbounds, outbounds, serverConfig.SecureCommsTrustee, serverConfig.SecureCommsKbsAddress, kbsCACert, sshport, transport)
 		if err != nil {
 			log.Fatalf("InitSshClient %v", err)
 		}
+		rateLimits, err := sshproxy.ParseRateLimits(serverConfig.SecureCommsRateLimits)
+		if err != nil {
+			log.Fatalf("failed to parse secure comms rate limits: %v", err)
+		}
+		sshClient.SetRateLimits(rateLimits)
+		sshClient.StartPpSecretSweep(context.Background(), wnssh.PpSecretSweepInterval)
+		if serverConfig.SecureCommsKeyRotation > 0 {
+			sshClient.StartKeyRotation(context.Background(), serverConfig.SecureCommsKeyRotation)
+		}
 	}
 
 	s := &cloudService{
@@ -131,6 +166,33 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 		workerNode:   workerNode,
 		sshClient:    sshClient,
 	}
+	if serverConfig.UserDataSigningKey != "" {
+		data, err := os.ReadFile(serverConfig.UserDataSigningKey)
+		if err != nil {
+			log.Fatalf("failed to read userdata signing key: %v", err)
+		}
+		if s.userDataSigningKey, err = cloudinit.ParseSigningKey(data); err != nil {
+			log.Fatalf("failed to parse userdata signing key: %v", err)
+		}
+	}
+	if serverConfig.UserDataEncryptionKey != "" {
+		data, err := os.ReadFile(serverConfig.UserDataEncryptionKey)
+		if err != nil {
+			log.Fatalf("failed to read userdata encryption key: %v", err)
+		}
+		if s.userDataEncryptionKey, err = cloudinit.ParseEncryptionKey(data); err != nil {
+			log.Fatalf("failed to parse userdata encryption key: %v", err)
+		}
+	}
+	if serverConfig.Initdata != "" {
+		_, data, err := initdata.Decode(serverConfig.Initdata)
+		if err == nil {
+			err = data.Validate()
+		}
+		if err != nil {
+			log.Fatalf("global initdata: %v", err)
+		}
+	}
 	s.cond = sync.NewCond(&s.mutex)
 	s.ppService, err = k8sops.NewPeerPodService()
 	if err != nil {
@@ -148,6 +210,48 @@ func (s *cloudService) ConfigVerifier() error {
 	return s.provider.ConfigVerifier()
 }
 
+// CheckProvider checks that the cloud API is reachable if the cloud provider supports it,
+// or else verifies the configuration of the cloud provider
+func (s *cloudService) CheckProvider(ctx context.Context) error {
+	if checker, ok := s.provider.(provider.HealthChecker); ok {
+		return checker.CheckHealth(ctx)
+	}
+	return s.provider.ConfigVerifier()
+}
+
+// CheckTunnels returns an error if the latest check of the pod network tunnel of any sandbox failed
+func (s *cloudService) CheckTunnels(ctx context.Context) error {
+	s.mutex.Lock()
+	monitors := map[string]podnetwork.Monitor{}
+	for _, sandbox := range s.sandboxes {
+		if sandbox.tunnelMonitor != nil {
+			monitors[sandbox.podNamespace+"/"+sandbox.podName] = sandbox.tunnelMonitor
+		}
+	}
+	s.mutex.Unlock()
+
+	var unhealthy []string
+	for pod, monitor := range monitors {
+		status := monitor.Status()
+		if !status.LastCheck.IsZero() && !status.Healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", pod, status.LastError))
+		}
+	}
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		return fmt.Errorf("unhealthy pod network tunnels: %s", strings.Join(unhealthy, ", "))
+	}
+	return nil
+}
+
+// CheckSecureComms checks that the Trustee service of Secure-Comms is reachable, if it is used
+func (s *cloudService) CheckSecureComms(ctx context.Context) error {
+	if s.sshClient == nil {
+		return nil
+	}
+	return s.sshClient.CheckKbs(ctx)
+}
+
 func (s *cloudService) setInstance(sid sandboxID, instanceID, instanceName string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -190,6 +294,45 @@ func (s *cloudService) GetInstanceID(ctx context.Context, podNamespace, podName
 	}
 }
 
+// GetTunnelStats returns the current traffic counters of the pod network tunnel of a pod.
+// It returns nil if no sandbox of the pod exists. The pod VM side counters are nil if the pod VM does not respond.
+func (s *cloudService) GetTunnelStats(ctx context.Context, podNamespace, podName string) (*TunnelStats, error) {
+	s.mutex.Lock()
+	var found *sandbox
+	for _, sandbox := range s.sandboxes {
+		if sandbox.podNamespace == podNamespace && sandbox.podName == podName {
+			found = sandbox
+			break
+		}
+	}
+	s.mutex.Unlock()
+
+	if found == nil {
+		return nil, nil
+	}
+
+	return s.readTunnelStats(ctx, found)
+}
+
+func (s *cloudService) readTunnelStats(ctx context.Context, sandbox *sandbox) (*TunnelStats, error) {
+
+	workerNode, err := s.workerNode.Stats(sandbox.netNSPath, sandbox.podNetwork)
+	if err != nil {
+		return nil, fmt.Errorf("getting tunnel statistics on netns %s: %w", sandbox.netNSPath, err)
+	}
+
+	stats := &TunnelStats{WorkerNode: workerNode}
+
+	podVM, err := sandbox.agentProxy.PodVMTunnelStats(ctx)
+	if err != nil {
+		logger.Printf("getting tunnel statistics of sandbox %s from pod VM: %v", sandbox.id, err)
+	} else {
+		stats.PodVM = podVM
+	}
+
+	return stats, nil
+}
+
 func (s *cloudService) Version(ctx context.Context, req *pb.VersionRequest) (*pb.VersionResponse, error) {
 	return &pb.VersionResponse{Version: Version}, nil
 }
@@ -217,6 +360,25 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		return nil, fmt.Errorf("namespace name %s is missing in annotations", annotations.SandboxNamespace)
 	}
 
+	// Reject malformed initdata before creating any resources for the pod VM
+	initdataStr := util.GetInitdataFromAnnotation(req.Annotations)
+	logger.Printf("initdata in Pod annotation: %s", initdataStr)
+
+	if initdataStr == "" {
+		logger.Printf("initdata in pod annotation is empty, use global initdata: %s", s.serverConfig.Initdata)
+		initdataStr = s.serverConfig.Initdata
+	}
+
+	if initdataStr != "" {
+		_, data, err := initdata.Decode(initdataStr)
+		if err == nil {
+			err = data.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pod %s/%s: %w", namespace, pod, err)
+		}
+	}
+
 	// Get Pod VM instance type from annotations
 	instanceType := util.GetInstanceTypeFromAnnotation(req.Annotations)
 
@@ -226,6 +388,16 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	// Get Pod VM image from annotations
 	image := util.GetImageFromAnnotation(req.Annotations)
 
+	spot, err := util.GetSpotInstanceFromAnnotation(req.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	diskSize, err := util.GetDiskSizeFromAnnotation(req.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
 	// Pod VM spec
 	vmSpec := provider.InstanceTypeSpec{
 		InstanceType: instanceType,
@@ -233,6 +405,9 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		Memory:       memory,
 		GPUs:         gpus,
 		Image:        image,
+		Spot:         spot,
+		DiskSize:     diskSize,
+		PodNamespace: namespace,
 	}
 
 	// TODO: server name is also generated in each cloud provider, and possibly inconsistent
@@ -245,6 +420,11 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		return nil, fmt.Errorf("failed to inspect netns %s: %w", netNSPath, err)
 	}
 
+	podNetworkConfig.IngressBandwidth, podNetworkConfig.EgressBandwidth, err = util.GetPodBandwidthFromAnnotation(req.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
 	podDir := filepath.Join(s.serverConfig.PodsDir, string(sid))
 	if err := os.MkdirAll(podDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("creating a pod directory: %s, %w", podDir, err)
@@ -270,6 +450,8 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		PodName:      pod,
 		PodNetwork:   podNetworkConfig,
 		TLSClientCA:  string(agentProxy.ClientCA()),
+
+		TunnelMonitorInterval: s.serverConfig.TunnelMonitorInterval,
 	}
 
 	if caService := agentProxy.CAService(); caService != nil {
@@ -283,13 +465,26 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	}
 
 	var sshCi *wnssh.SshClientInstance
+	var wnTunnels, ppTunnels sshproxy.Tunnels
 
 	if s.sshClient != nil {
+		wnTunnels, ppTunnels, err = s.podTunnels(req.Annotations)
+		if err != nil {
+			return nil, err
+		}
+
 		var ppPrivateKey []byte
-		sshCi, ppPrivateKey = s.sshClient.InitPP(context.Background(), string(sid))
+		sshCi, ppPrivateKey = s.sshClient.InitPP(context.Background(), string(sid), pod, namespace)
 		if sshCi == nil {
 			return nil, fmt.Errorf("failed sshClient.InitPP")
 		}
+
+		if err := sshCi.UpdateTunnels(wnTunnels, ppTunnels); err != nil {
+			return nil, fmt.Errorf("adding secure comms tunnels from annotations: %w", err)
+		}
+		if s.serverConfig.SecureCommsTransport == sshproxy.QUIC {
+			daemonConfig.SecureCommsTransport = sshproxy.QUIC
+		}
 		if !s.serverConfig.SecureCommsTrustee {
 			daemonConfig.WnPublicKey = s.sshClient.GetWnPublicKey()
 			daemonConfig.PpPrivateKey = ppPrivateKey
@@ -314,46 +509,53 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	cloudConfig := &cloudinit.CloudConfig{
 		WriteFiles: []cloudinit.WriteFile{
 			{
-				Path:    forwarder.DefaultConfigPath,
-				Content: string(daemonJSON),
+				Path:        forwarder.DefaultConfigPath,
+				Content:     string(daemonJSON),
+				Permissions: "0600",
+				Sensitive:   true,
 			},
 		},
 	}
 
+	// The user data size limit of the cloud provider is enforced when the instance is created
 	if authJSON != nil {
-		if len(authJSON) > cloudinit.DefaultAuthfileLimit {
-			logger.Printf("Credentials file is too large to be included in cloud-config")
-		} else {
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
+			Path:        AuthFilePath,
+			Content:     string(authJSON),
+			Permissions: "0600",
+			Sensitive:   true,
+		})
+	}
+
+	var cloudConfigGenerator cloudinit.CloudConfigGenerator = cloudConfig
+	if s.userDataSigningKey != nil || s.userDataEncryptionKey != nil {
+		// Sealed user data is a single cloud-config, so initdata is one of its files
+		if initdataStr != "" {
 			cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
-				Path:    AuthFilePath,
-				Content: string(authJSON),
+				Path:    InitDataPath,
+				Content: initdataStr,
 			})
 		}
-	}
-
-	initdataStr := util.GetInitdataFromAnnotation(req.Annotations)
-	logger.Printf("initdata in Pod annotation: %s", initdataStr)
-
-	if initdataStr == "" {
-		logger.Printf("initdata in pod annotation is empty, use global initdata: %s", s.serverConfig.Initdata)
-		initdataStr = s.serverConfig.Initdata
-	}
-
-	if initdataStr != "" {
-		decodedBytes, err := base64.StdEncoding.DecodeString(initdataStr)
-		if err != nil {
-			return nil, fmt.Errorf("error base64 decode initdata: %w", err)
+		cloudConfigGenerator = &cloudinit.SealedCloudConfig{
+			CloudConfig:   cloudConfig,
+			SigningKey:    s.userDataSigningKey,
+			EncryptionKey: s.userDataEncryptionKey,
 		}
-		initdata := InitData{}
-		err = toml.Unmarshal(decodedBytes, &initdata)
-		if err != nil {
-			return nil, fmt.Errorf("error unmarshalling initdata: %w", err)
+	} else if initdataStr != "" {
+		// initdata is provided by the pod, so it is passed in a cloud-config part of its own
+		cloudConfigGenerator = &cloudinit.MultiPartCloudConfig{
+			Parts: []cloudinit.CloudConfigGenerator{
+				cloudConfig,
+				&cloudinit.CloudConfig{
+					WriteFiles: []cloudinit.WriteFile{
+						{
+							Path:    InitDataPath,
+							Content: initdataStr,
+						},
+					},
+				},
+			},
 		}
-
-		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
-			Path:    InitDataPath,
-			Content: initdataStr,
-		})
 	}
 
 	sandbox := &sandbox{
@@ -363,9 +565,11 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		netNSPath:     netNSPath,
 		agentProxy:    agentProxy,
 		podNetwork:    podNetworkConfig,
-		cloudConfig:   cloudConfig,
+		cloudConfig:   cloudConfigGenerator,
 		spec:          vmSpec,
 		sshClientInst: sshCi,
+		wnTunnels:     wnTunnels,
+		ppTunnels:     ppTunnels,
 	}
 
 	if err := s.addSandbox(sid, sandbox); err != nil {
@@ -456,6 +660,39 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 
 	logger.Print("agent proxy is ready")
 
+	if s.serverConfig.TunnelMonitorInterval > 0 {
+		var lookupIPs func(context.Context) ([]netip.Addr, error)
+		if getter, ok := s.provider.(provider.InstanceIPsGetter); ok {
+			lookupIPs = func(ctx context.Context) ([]netip.Addr, error) {
+				return getter.GetInstanceIPs(ctx, instance.ID)
+			}
+		}
+		sandbox.tunnelMonitor = podnetwork.NewWorkerNodeMonitor(s.workerNode, sandbox.netNSPath, instance.IPs, lookupIPs, sandbox.podNetwork, s.serverConfig.TunnelMonitorInterval, sandbox.updateTunnelMetrics())
+		sandbox.tunnelMonitor.Start(context.Background())
+		defer func() {
+			if err != nil {
+				sandbox.tunnelMonitor.Stop()
+				sandbox.deleteMetrics()
+			}
+		}()
+	}
+
+	if checker, ok := s.provider.(provider.InstanceChecker); ok && sandbox.spec.Spot && s.serverConfig.SpotCheckInterval > 0 {
+		var watchCtx context.Context
+		watchCtx, sandbox.stopPreemptionWatch = context.WithCancel(context.Background())
+		go s.watchPreemption(watchCtx, sandbox, checker)
+	}
+
+	if sandbox.sshClientInst != nil && s.serverConfig.SecureCommsAnnotationInterval > 0 {
+		var watchCtx context.Context
+		watchCtx, sandbox.stopTunnelsWatch = context.WithCancel(context.Background())
+		go s.watchTunnels(watchCtx, sandbox)
+	}
+
+	tunnelStats.add(sandbox, func(ctx context.Context) (*TunnelStats, error) {
+		return s.readTunnelStats(ctx, sandbox)
+	})
+
 	return &pb.StartVMResponse{}, nil
 }
 
@@ -469,6 +706,13 @@ func (s *cloudService) StopVM(ctx context.Context, req *pb.StopVMRequest) (*pb.S
 		return nil, err
 	}
 
+	if sandbox.stopPreemptionWatch != nil {
+		sandbox.stopPreemptionWatch()
+	}
+	if sandbox.stopTunnelsWatch != nil {
+		sandbox.stopTunnelsWatch()
+	}
+
 	if err := sandbox.agentProxy.Shutdown(); err != nil {
 		logger.Printf("stopping agent proxy: %v", err)
 	}
@@ -485,6 +729,13 @@ func (s *cloudService) StopVM(ctx context.Context, req *pb.StopVMRequest) (*pb.S
 		}
 	}
 
+	tunnelStats.remove(sandbox)
+
+	if sandbox.tunnelMonitor != nil {
+		sandbox.tunnelMonitor.Stop()
+		sandbox.deleteMetrics()
+	}
+
 	if err := s.workerNode.Teardown(sandbox.netNSPath, sandbox.podNetwork); err != nil {
 		logger.Printf("tearing down netns %s: %v", sandbox.netNSPath, err)
 	}
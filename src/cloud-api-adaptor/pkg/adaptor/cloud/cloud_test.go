@@ -6,19 +6,31 @@ package cloud
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/netip"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/ppssh"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
@@ -56,6 +68,7 @@ func (p *mockProvider) SelectInstanceType(ctx context.Context, vCPU int64, memor
 type mockProxy struct {
 	readyCh    chan struct{}
 	stopCh     chan struct{}
+	stopOnce   sync.Once
 	socketPath string
 }
 
@@ -70,7 +83,9 @@ func (p *mockProxy) Ready() chan struct{} {
 }
 
 func (p *mockProxy) Shutdown() error {
-	close(p.stopCh)
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
 	return nil
 }
 
@@ -82,6 +97,13 @@ func (p *mockProxy) CAService() tlsutil.CAService {
 	return nil
 }
 
+func (p *mockProxy) PodVMTunnelStats(ctx context.Context) (*tunneler.Stats, error) {
+	return &tunneler.Stats{
+		Interface:      "eth0",
+		LinkStatistics: netops.LinkStatistics{RxBytes: 2000, TxBytes: 1000},
+	}, nil
+}
+
 type mockProxyFactory struct {
 	podsDir string
 }
@@ -97,7 +119,7 @@ func (f *mockProxyFactory) New(serverName, socketPath string) proxy.AgentProxy {
 type mockWorkerNode struct{}
 
 func (n mockWorkerNode) Inspect(nsPath string) (*tunneler.Config, error) {
-	return nil, nil
+	return &tunneler.Config{}, nil
 }
 
 func (n *mockWorkerNode) Setup(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) error {
@@ -108,6 +130,17 @@ func (n *mockWorkerNode) Teardown(nsPath string, config *tunneler.Config) error
 	return nil
 }
 
+func (n *mockWorkerNode) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+	return nil, nil
+}
+
+func (n *mockWorkerNode) Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error) {
+	return &tunneler.Stats{
+		Interface:      "vxlan1",
+		LinkStatistics: netops.LinkStatistics{RxBytes: 1000, TxBytes: 2000},
+	}, nil
+}
+
 func TestCloudService(t *testing.T) {
 
 	ctx := context.Background()
@@ -151,10 +184,183 @@ func TestCloudService(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, res2)
 
+	stats, err := s.GetTunnelStats(ctx, sandboxNS, sandboxName)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "vxlan1", stats.WorkerNode.Interface)
+	assert.Equal(t, uint64(1000), stats.WorkerNode.RxBytes)
+	assert.Equal(t, "eth0", stats.PodVM.Interface)
+	assert.Equal(t, uint64(2000), stats.PodVM.RxBytes)
+
+	// 8 counters for each of the worker node side and the pod VM side
+	assert.Equal(t, 16, testutil.CollectAndCount(tunnelStats))
+
+	stats, err = s.GetTunnelStats(ctx, sandboxNS, "otherpod")
+
+	assert.NoError(t, err)
+	assert.Nil(t, stats)
+
 	res3, err := s.StopVM(ctx, &pb.StopVMRequest{Id: sandboxID})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, res3)
+
+	assert.Equal(t, 0, testutil.CollectAndCount(tunnelStats))
+}
+
+func TestCloudServiceInitdata(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := &ServerConfig{
+		PodsDir:       dir,
+		ForwarderPort: forwarder.DefaultListenPort,
+	}
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, cfg, "")
+
+	valid, err := initdata.Build("sha256", map[string]string{initdata.PolicyKey: "package agent_policy\n"})
+	assert.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		initdata string
+		err      string
+	}{
+		"valid":       {initdata: initdata.Encode(valid)},
+		"not base64":  {initdata: "not base64!", err: "invalid initdata: base64 decode"},
+		"bad version": {initdata: initdata.Encode([]byte("algorithm = \"sha256\"\nversion = \"0.0.1\"\n")), err: "unsupported version"},
+		"unknown key": {initdata: initdata.Encode([]byte("algorithm = \"sha256\"\nversion = \"0.1.0\"\n[data]\n\"foo\" = \"bar\"\n"))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := &pb.CreateVMRequest{
+				Id: "initdata-" + strings.ReplaceAll(name, " ", "-"),
+				Annotations: map[string]string{
+					cri.SandboxNamespace:   "default",
+					cri.SandboxName:        "mypod",
+					initdata.AnnotationKey: tc.initdata,
+				},
+			}
+			_, err := s.CreateVM(ctx, req)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			// initdata is passed in a cloud-config part of its own
+			sandbox, err := s.(*cloudService).getSandbox(sandboxID(req.Id))
+			assert.NoError(t, err)
+			assert.IsType(t, &cloudinit.MultiPartCloudConfig{}, sandbox.cloudConfig)
+			userData, err := sandbox.cloudConfig.Generate()
+			assert.NoError(t, err)
+			assert.Contains(t, userData, paths.InitDataPath)
+		})
+	}
+}
+
+type mockSpotProvider struct {
+	mockProvider
+	spot chan bool
+}
+
+func (p *mockSpotProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	p.spot <- spec.Spot
+	return p.mockProvider.CreateInstance(ctx, podName, sandboxID, cloudConfig, spec)
+}
+
+func (p *mockSpotProvider) CheckInstance(ctx context.Context, instanceID string) error {
+	return fmt.Errorf("instance %s not found: %w", instanceID, provider.ErrInstancePreempted)
+}
+
+func TestCloudServicePreemption(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := &ServerConfig{
+		PodsDir:           dir,
+		ForwarderPort:     forwarder.DefaultListenPort,
+		SpotCheckInterval: 10 * time.Millisecond,
+	}
+	p := &mockSpotProvider{spot: make(chan bool, 1)}
+	s := NewService(p, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, cfg, "")
+
+	req := &pb.CreateVMRequest{
+		Id: "spot",
+		Annotations: map[string]string{
+			cri.SandboxNamespace:        "default",
+			cri.SandboxName:             "mypod",
+			util.SpotInstanceAnnotation: "true",
+		},
+	}
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	_, err = s.StartVM(ctx, &pb.StartVMRequest{Id: "spot"})
+	assert.NoError(t, err)
+	assert.True(t, <-p.spot)
+
+	// The agent proxy of a preempted pod VM is shut down
+	sandbox, err := s.(*cloudService).getSandbox("spot")
+	assert.NoError(t, err)
+	select {
+	case <-sandbox.agentProxy.(*mockProxy).stopCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent proxy of the preempted pod VM is not shut down")
+	}
+
+	_, err = s.StopVM(ctx, &pb.StopVMRequest{Id: "spot"})
+	assert.NoError(t, err)
+
+	req.Annotations[util.SpotInstanceAnnotation] = "yes please"
+	_, err = s.CreateVM(ctx, req)
+	assert.ErrorContains(t, err, "invalid "+util.SpotInstanceAnnotation+" annotation")
+}
+
+type mockMonitor struct {
+	podnetwork.Monitor
+	status podnetwork.MonitorStatus
+}
+
+func (m *mockMonitor) Status() podnetwork.MonitorStatus {
+	return m.status
+}
+
+type mockHealthProvider struct {
+	mockProvider
+}
+
+func (p *mockHealthProvider) CheckHealth(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func TestCloudServiceCheckProvider(t *testing.T) {
+	s := &cloudService{provider: &mockProvider{}}
+	assert.NoError(t, s.CheckProvider(context.Background()))
+
+	// the context of the probe is passed to the cloud API
+	ctx, cancel := context.WithCancel(context.Background())
+	s.provider = &mockHealthProvider{}
+	assert.NoError(t, s.CheckProvider(ctx))
+	cancel()
+	assert.ErrorIs(t, s.CheckProvider(ctx), context.Canceled)
+}
+
+func TestCloudServiceCheckTunnels(t *testing.T) {
+
+	ctx := context.Background()
+	s := &cloudService{
+		sandboxes: map[sandboxID]*sandbox{
+			"1": {podNamespace: "default", podName: "pod1", tunnelMonitor: &mockMonitor{status: podnetwork.MonitorStatus{Healthy: true, LastCheck: time.Now()}}},
+			"2": {podNamespace: "default", podName: "pod2", tunnelMonitor: &mockMonitor{}},
+			"3": {podNamespace: "default", podName: "pod3"},
+		},
+	}
+	assert.NoError(t, s.CheckTunnels(ctx))
+	assert.NoError(t, s.CheckSecureComms(ctx))
+
+	s.sandboxes["4"] = &sandbox{podNamespace: "default", podName: "pod4", tunnelMonitor: &mockMonitor{status: podnetwork.MonitorStatus{LastCheck: time.Now(), LastError: "missing route"}}}
+	assert.EqualError(t, s.CheckTunnels(ctx), "unhealthy pod network tunnels: default/pod4: missing route")
 }
 
 func TestCloudServiceWithSecureComms(t *testing.T) {
@@ -193,6 +399,9 @@ func TestCloudServiceWithSecureComms(t *testing.T) {
 		PodsDir:               dir,
 		ForwarderPort:         forwarder.DefaultListenPort,
 		SecureCommsKbsAddress: "127.0.0.1:9009",
+
+		SecureCommsAnnotationAllowlist: "KUBERNETES_PHASE:DEBUG:7222, KUBERNETES_PHASE:DEBUG:7223",
+		SecureCommsAnnotationInterval:  10 * time.Millisecond,
 	}
 
 	s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, cfg, sshport)
@@ -206,8 +415,9 @@ func TestCloudServiceWithSecureComms(t *testing.T) {
 	req := &pb.CreateVMRequest{
 		Id: sandboxID,
 		Annotations: map[string]string{
-			cri.SandboxNamespace: sandboxNS,
-			cri.SandboxName:      sandboxName,
+			cri.SandboxNamespace:               sandboxNS,
+			cri.SandboxName:                    sandboxName,
+			util.SecureCommsInboundsAnnotation: "KUBERNETES_PHASE:DEBUG:7222",
 		},
 	}
 
@@ -216,14 +426,56 @@ func TestCloudServiceWithSecureComms(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, res1)
 	assert.Contains(t, res1.AgentSocketPath, dir)
+	assert.True(t, listening("7222"))
+
+	_, err = s.CreateVM(ctx, &pb.CreateVMRequest{
+		Id: "456",
+		Annotations: map[string]string{
+			cri.SandboxNamespace:                sandboxNS,
+			cri.SandboxName:                     "otherpod",
+			util.SecureCommsOutboundsAnnotation: "KUBERNETES_PHASE:IMDS:169.254.169.254:80",
+		},
+	})
+	assert.ErrorContains(t, err, "not allowed")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sandboxName,
+			Namespace: sandboxNS,
+			Annotations: map[string]string{
+				util.SecureCommsInboundsAnnotation: "KUBERNETES_PHASE:DEBUG:7223",
+			},
+		},
+	}
+	pod, err = kubemgr.KubeMgr.Client.CoreV1().Pods(sandboxNS).Create(ctx, pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
 
 	res2, err := s.StartVM(ctx, &pb.StartVMRequest{Id: sandboxID})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, res2)
 
+	// The changed annotation replaces the DEBUG inbound
+	assert.Eventually(t, func() bool { return listening("7223") && !listening("7222") }, 5*time.Second, 10*time.Millisecond)
+
+	pod.Annotations = nil
+	_, err = kubemgr.KubeMgr.Client.CoreV1().Pods(sandboxNS).Update(ctx, pod, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return !listening("7223") }, 5*time.Second, 10*time.Millisecond)
+
 	res3, err := s.StopVM(ctx, &pb.StopVMRequest{Id: sandboxID})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, res3)
 }
+
+// listening reports whether a local port is in use
+// It does not connect to the port, since no peer takes the connections of inbounds in tests
+func listening(port string) bool {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return true
+	}
+	listener.Close()
+	return false
+}
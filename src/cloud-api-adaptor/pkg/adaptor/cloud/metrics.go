@@ -0,0 +1,199 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
+)
+
+const metricsNamespace = "cloud_api_adaptor"
+
+var sandboxLabels = []string{"pod", "namespace", "sandbox"}
+
+// tunnelStatsTimeout is the maximum time to read traffic counters of a sandbox on a scrape
+const tunnelStatsTimeout = 3 * time.Second
+
+var (
+	tunnelHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_healthy",
+		Help:      "Whether the pod network tunnel state was verified or repaired successfully in the latest check (1) or not (0)",
+	}, sandboxLabels)
+
+	tunnelReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_reachable",
+		Help:      "Whether the pod VM responded to a probe over the pod network tunnel in the latest check (1) or not (0)",
+	}, sandboxLabels)
+
+	tunnelRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_repairs_total",
+		Help:      "Number of missing or stale pod network tunnel state re-applied by the tunnel monitor",
+	}, sandboxLabels)
+
+	tunnelCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_check_failures_total",
+		Help:      "Number of pod network tunnel checks that failed to verify or repair the tunnel state",
+	}, sandboxLabels)
+)
+
+var tunnelStats = newTunnelStatsCollector()
+
+func init() {
+	prometheus.MustRegister(tunnelHealthy, tunnelReachable, tunnelRepairs, tunnelCheckFailures, tunnelStats)
+	sshproxy.RegisterMetrics(prometheus.DefaultRegisterer)
+}
+
+func (s *sandbox) metricLabels() prometheus.Labels {
+	return prometheus.Labels{
+		"pod":       s.podName,
+		"namespace": s.podNamespace,
+		"sandbox":   string(s.id),
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// updateTunnelMetrics returns a function that records tunnel monitor status of a sandbox
+func (s *sandbox) updateTunnelMetrics() func(podnetwork.MonitorStatus) {
+
+	labels := s.metricLabels()
+	var last podnetwork.MonitorStatus
+
+	return func(status podnetwork.MonitorStatus) {
+		tunnelHealthy.With(labels).Set(boolToFloat(status.Healthy))
+		tunnelReachable.With(labels).Set(boolToFloat(status.Reachable))
+		tunnelRepairs.With(labels).Add(float64(status.Repairs - last.Repairs))
+		tunnelCheckFailures.With(labels).Add(float64(status.Failures - last.Failures))
+		last = status
+	}
+}
+
+func (s *sandbox) deleteMetrics() {
+
+	labels := s.metricLabels()
+	for _, vec := range []*prometheus.MetricVec{tunnelHealthy.MetricVec, tunnelReachable.MetricVec, tunnelRepairs.MetricVec, tunnelCheckFailures.MetricVec} {
+		vec.Delete(labels)
+	}
+}
+
+// tunnelStatsCollector reads traffic counters of the pod network tunnels of running sandboxes on each scrape.
+// Counters are labelled with side="worker-node" for the vxlan interface on a worker node,
+// and side="pod-vm" for the vxlan interface on a pod VM.
+type tunnelStatsCollector struct {
+	descs   map[string]*prometheus.Desc
+	readers map[sandboxID]tunnelStatsReader
+	mutex   sync.Mutex
+}
+
+type tunnelStatsReader struct {
+	labels []string
+	read   func(ctx context.Context) (*TunnelStats, error)
+}
+
+var tunnelStatsMetrics = []struct {
+	name  string
+	help  string
+	value func(*tunneler.Stats) uint64
+}{
+	{"tunnel_receive_bytes_total", "Number of bytes received on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.RxBytes }},
+	{"tunnel_receive_packets_total", "Number of packets received on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.RxPackets }},
+	{"tunnel_receive_errors_total", "Number of receive errors on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.RxErrors }},
+	{"tunnel_receive_dropped_total", "Number of received packets dropped on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.RxDropped }},
+	{"tunnel_transmit_bytes_total", "Number of bytes transmitted on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.TxBytes }},
+	{"tunnel_transmit_packets_total", "Number of packets transmitted on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.TxPackets }},
+	{"tunnel_transmit_errors_total", "Number of transmit errors on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.TxErrors }},
+	{"tunnel_transmit_dropped_total", "Number of transmitted packets dropped on the pod network tunnel interface", func(s *tunneler.Stats) uint64 { return s.TxDropped }},
+}
+
+func newTunnelStatsCollector() *tunnelStatsCollector {
+
+	c := &tunnelStatsCollector{
+		descs:   map[string]*prometheus.Desc{},
+		readers: map[sandboxID]tunnelStatsReader{},
+	}
+
+	labels := append(append([]string{}, sandboxLabels...), "side")
+	for _, m := range tunnelStatsMetrics {
+		c.descs[m.name] = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", m.name), m.help, labels, nil)
+	}
+
+	return c
+}
+
+func (c *tunnelStatsCollector) add(s *sandbox, read func(ctx context.Context) (*TunnelStats, error)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.readers[s.id] = tunnelStatsReader{
+		labels: []string{s.podName, s.podNamespace, string(s.id)},
+		read:   read,
+	}
+}
+
+func (c *tunnelStatsCollector) remove(s *sandbox) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.readers, s.id)
+}
+
+func (c *tunnelStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *tunnelStatsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.mutex.Lock()
+	readers := make([]tunnelStatsReader, 0, len(c.readers))
+	for _, r := range c.readers {
+		readers = append(readers, r)
+	}
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelStatsTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r tunnelStatsReader) {
+			defer wg.Done()
+
+			stats, err := r.read(ctx)
+			if err != nil {
+				logger.Printf("failed to read tunnel statistics of sandbox %s: %v", r.labels[2], err)
+				return
+			}
+
+			for side, linkStats := range map[string]*tunneler.Stats{"worker-node": stats.WorkerNode, "pod-vm": stats.PodVM} {
+				if linkStats == nil {
+					continue
+				}
+				labels := append(append([]string{}, r.labels...), side)
+				for _, m := range tunnelStatsMetrics {
+					ch <- prometheus.MustNewConstMetric(c.descs[m.name], prometheus.CounterValue, float64(m.value(linkStats)), labels...)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	v1 "k8s.io/api/core/v1"
+)
+
+// watchPreemption checks the spot instance of a sandbox until ctx is done. When the instance
+// is preempted, it records a pod event and shuts down the agent proxy, so that the shim fails
+// the pod instead of waiting for a pod VM which is gone.
+func (s *cloudService) watchPreemption(ctx context.Context, sandbox *sandbox, checker provider.InstanceChecker) {
+	ticker := time.NewTicker(s.serverConfig.SpotCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := checker.CheckInstance(ctx, sandbox.instanceID)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		if !errors.Is(err, provider.ErrInstancePreempted) {
+			logger.Printf("checking instance %s of sandbox %s: %v", sandbox.instanceName, sandbox.id, err)
+			continue
+		}
+
+		logger.Printf("instance %s of sandbox %s was preempted: %v", sandbox.instanceName, sandbox.id, err)
+		if s.ppService != nil {
+			message := "Spot pod VM " + sandbox.instanceName + " was preempted: " + err.Error()
+			if err := s.ppService.RecordPodEvent(sandbox.podName, sandbox.podNamespace, v1.EventTypeWarning, "Preempted", message); err != nil {
+				logger.Printf("failed to record preemption event of pod %s: %v", sandbox.podName, err)
+			}
+		}
+		if err := sandbox.agentProxy.Shutdown(); err != nil {
+			logger.Printf("stopping agent proxy: %v", err)
+		}
+		return
+	}
+}
@@ -0,0 +1,92 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podTunnels returns the secure comms tunnels requested by the annotations of a pod.
+// WN tunnels listen at, and connect from, the network of the worker node, such that
+// their tags must be allowed by SecureCommsAnnotationAllowlist.
+func (s *cloudService) podTunnels(annotations map[string]string) (wnTunnels, ppTunnels sshproxy.Tunnels, err error) {
+	inbounds, outbounds, ppInbounds, ppOutbounds := util.GetSecureCommsTagsFromAnnotation(annotations)
+
+	allowlist := strings.Split(s.serverConfig.SecureCommsAnnotationAllowlist, ",")
+	for i := range allowlist {
+		allowlist[i] = strings.TrimSpace(allowlist[i])
+	}
+	for _, tag := range append(slices.Clone(inbounds), outbounds...) {
+		if !slices.Contains(allowlist, tag) {
+			return wnTunnels, ppTunnels, fmt.Errorf("secure comms tag %q of the pod annotations is not allowed", tag)
+		}
+	}
+
+	wnTunnels = sshproxy.Tunnels{Inbounds: inbounds, Outbounds: outbounds}
+	ppTunnels = sshproxy.Tunnels{Inbounds: ppInbounds, Outbounds: ppOutbounds}
+	return wnTunnels, ppTunnels, nil
+}
+
+// watchTunnels checks the annotations of the pod of a sandbox until ctx is done, and
+// adds and removes the secure comms tunnels of the pod VM when the annotations change.
+func (s *cloudService) watchTunnels(ctx context.Context, sandbox *sandbox) {
+	ticker := time.NewTicker(s.serverConfig.SecureCommsAnnotationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pod, err := kubemgr.KubeMgr.Client.CoreV1().Pods(sandbox.podNamespace).Get(ctx, sandbox.podName, metav1.GetOptions{})
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Printf("getting pod %s of sandbox %s: %v", sandbox.podName, sandbox.id, err)
+			}
+			continue
+		}
+		if err := s.updateTunnels(sandbox, pod.Annotations); err != nil {
+			logger.Printf("updating secure comms tunnels of pod %s: %v", sandbox.podName, err)
+		}
+	}
+}
+
+// updateTunnels applies the change of the tunnels requested by the pod annotations
+func (s *cloudService) updateTunnels(sandbox *sandbox, annotations map[string]string) error {
+	wnTunnels, ppTunnels, err := s.podTunnels(annotations)
+	if err != nil {
+		return err
+	}
+
+	wnDiff, err := sshproxy.DiffTunnels(sandbox.wnTunnels, wnTunnels)
+	if err != nil {
+		return err
+	}
+	ppDiff, err := sshproxy.DiffTunnels(sandbox.ppTunnels, ppTunnels)
+	if err != nil {
+		return err
+	}
+	if wnDiff.IsEmpty() && ppDiff.IsEmpty() {
+		return nil
+	}
+
+	if err := sandbox.sshClientInst.UpdateTunnels(wnDiff, ppDiff); err != nil {
+		return err
+	}
+	sandbox.wnTunnels, sandbox.ppTunnels = wnTunnels, ppTunnels
+	logger.Printf("updated secure comms tunnels of pod %s: WN %v, PP %v", sandbox.podName, wnDiff, ppDiff)
+
+	return nil
+}
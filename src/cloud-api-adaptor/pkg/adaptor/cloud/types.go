@@ -5,6 +5,8 @@ package cloud
 
 import (
 	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"sync"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
@@ -15,13 +17,18 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/wnssh"
 )
 
 type Service interface {
 	pb.HypervisorService
 	GetInstanceID(ctx context.Context, podNamespace, podName string, wait bool) (string, error)
+	GetTunnelStats(ctx context.Context, podNamespace, podName string) (*TunnelStats, error)
 	ConfigVerifier() error
+	CheckProvider(ctx context.Context) error
+	CheckTunnels(ctx context.Context) error
+	CheckSecureComms(ctx context.Context) error
 	Teardown() error
 }
 
@@ -35,14 +42,23 @@ type cloudService struct {
 	ppService    *k8sops.PeerPodService
 	sshClient    *wnssh.SshClient
 	serverConfig *ServerConfig
+	// userDataSigningKey and userDataEncryptionKey seal the cloud-config of pod VMs when set
+	userDataSigningKey    ed25519.PrivateKey
+	userDataEncryptionKey *ecdh.PublicKey
 }
 
 type sandboxID string
 
+// TunnelStats is a set of traffic counters of the pod network tunnel of a peer pod on both ends
+type TunnelStats struct {
+	WorkerNode *tunneler.Stats
+	PodVM      *tunneler.Stats
+}
+
 type sandbox struct {
 	agentProxy    proxy.AgentProxy
 	podNetwork    *tunneler.Config
-	cloudConfig   *cloudinit.CloudConfig
+	cloudConfig   cloudinit.CloudConfigGenerator
 	id            sandboxID
 	podName       string
 	podNamespace  string
@@ -51,4 +67,12 @@ type sandbox struct {
 	netNSPath     string
 	spec          provider.InstanceTypeSpec
 	sshClientInst *wnssh.SshClientInstance
+	tunnelMonitor podnetwork.Monitor
+	// stopPreemptionWatch stops the checks for the preemption of a spot instance
+	stopPreemptionWatch context.CancelFunc
+	// wnTunnels and ppTunnels are the tunnels requested by the annotations of the pod
+	wnTunnels sshproxy.Tunnels
+	ppTunnels sshproxy.Tunnels
+	// stopTunnelsWatch stops the checks for changes of the tunnel annotations of the pod
+	stopTunnelsWatch context.CancelFunc
 }
@@ -127,3 +127,38 @@ func (s *PeerPodService) ReleasePeerPod(podname string, podns string, instanceID
 	logger.Printf("%s's owned PeerPod object can now be deleted", podname)
 	return nil
 }
+
+// RecordPodEvent records an event of a pod
+func (s *PeerPodService) RecordPodEvent(podname string, podns string, eventType, reason, message string) error {
+	pod, err := s.getPod(podname, podns)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "Pod",
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Source: v1.EventSource{
+			Component: "cloud-api-adaptor",
+			Host:      os.Getenv("NODE_NAME"),
+		},
+	}
+	_, err = s.client.CoreV1().Events(pod.Namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
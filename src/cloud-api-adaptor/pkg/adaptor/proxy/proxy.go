@@ -17,7 +17,10 @@ import (
 	"time"
 
 	"github.com/avast/retry-go/v4"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+	pbinfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
 )
@@ -39,6 +42,7 @@ type AgentProxy interface {
 	Shutdown() error
 	CAService() tlsutil.CAService
 	ClientCA() (certPEM []byte)
+	PodVMTunnelStats(ctx context.Context) (*tunneler.Stats, error)
 }
 
 type agentProxy struct {
@@ -51,6 +55,7 @@ type agentProxy struct {
 	pauseImage   string
 	proxyTimeout time.Duration
 	stopOnce     sync.Once
+	service      *proxyService
 }
 
 func NewAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil.TLSConfig, caService tlsutil.CAService, proxyTimeout time.Duration) AgentProxy {
@@ -164,6 +169,8 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 		return fmt.Errorf("failed to create TTRPC server: %w", err)
 	}
 
+	p.service = proxyService
+
 	pb.RegisterAgentServiceService(ttrpcServer, proxyService)
 	pb.RegisterHealthService(ttrpcServer, proxyService)
 
@@ -179,6 +186,10 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 		}
 	}()
 	defer func() {
+		// Shutdown waits for in-flight requests, so fail the requests to a pod VM which may be gone first
+		if err := proxyService.Close(); err != nil {
+			logger.Printf("error closing agent proxy connection: %v", err)
+		}
 		if err := ttrpcServer.Shutdown(ctx); err != nil {
 			logger.Printf("error shutting down TTRPC server: %v", err)
 		}
@@ -226,3 +237,41 @@ func (p *agentProxy) ClientCA() (certPEM []byte) {
 
 	return p.tlsConfig.CertData
 }
+
+// PodVMTunnelStats returns traffic counters of the tunnel interface on the pod VM.
+// The request is sent to agent-protocol-forwarder over the established agent proxy connection.
+func (p *agentProxy) PodVMTunnelStats(ctx context.Context) (*tunneler.Stats, error) {
+
+	select {
+	case <-p.readyCh:
+	default:
+		return nil, errors.New("agent proxy connection is not established")
+	}
+
+	client, err := p.service.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := pbinfo.NewPodVMInfoClient(client).GetTunnelStats(ctx, &pbinfo.GetTunnelStatsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tunnel statistics from pod VM: %w", err)
+	}
+	if res.PodVM == nil {
+		return nil, errors.New("no tunnel statistics returned from pod VM")
+	}
+
+	return &tunneler.Stats{
+		Interface: res.PodVM.Interface,
+		LinkStatistics: netops.LinkStatistics{
+			RxBytes:   res.PodVM.RxBytes,
+			RxPackets: res.PodVM.RxPackets,
+			RxErrors:  res.PodVM.RxErrors,
+			RxDropped: res.PodVM.RxDropped,
+			TxBytes:   res.PodVM.TxBytes,
+			TxPackets: res.PodVM.TxPackets,
+			TxErrors:  res.PodVM.TxErrors,
+			TxDropped: res.PodVM.TxDropped,
+		},
+	}, nil
+}
@@ -5,11 +5,13 @@ package adaptor
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/containerd/ttrpc"
 	pbHypervisor "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
@@ -19,6 +21,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/vminfo"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/probe"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 	pbPodVMInfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
@@ -29,12 +32,19 @@ var logger = log.New(log.Writer(), "[adaptor] ", log.LstdFlags|log.Lmsgprefix)
 const (
 	DefaultSocketPath = "/run/peerpod/hypervisor.sock"
 	DefaultPodsDir    = "/run/peerpod/pods"
+	// DefaultSpotCheckInterval is the interval of checks for the preemption of spot pod VMs
+	DefaultSpotCheckInterval = 30 * time.Second
+	// DefaultSecureCommsAnnotationInterval is the interval of checks for changes of the tunnel annotations of pods
+	DefaultSecureCommsAnnotationInterval = 15 * time.Second
+	// providerCheckTTL limits how often the readiness probe verifies the cloud provider
+	providerCheckTTL = time.Minute
 )
 
 type Server interface {
 	Start(ctx context.Context) error
 	Shutdown() error
 	Ready() chan struct{}
+	ProbeChecks() []probe.Check
 }
 
 type server struct {
@@ -47,6 +57,7 @@ type server struct {
 	socketPath              string
 	stopOnce                sync.Once
 	enableCloudConfigVerify bool
+	secureCommsTrustee      bool
 	PeerPodsLimitPerNode    int
 }
 
@@ -66,15 +77,15 @@ func NewServer(provider provider.Provider, cfg *cloud.ServerConfig, workerNode p
 		readyCh:                 make(chan struct{}),
 		stopCh:                  make(chan struct{}),
 		enableCloudConfigVerify: cfg.EnableCloudConfigVerify,
+		secureCommsTrustee:      cfg.SecureComms && cfg.SecureCommsTrustee,
 		PeerPodsLimitPerNode:    cfg.PeerPodsLimitPerNode,
 	}
 }
 
 func (s *server) Start(ctx context.Context) (err error) {
 	if s.enableCloudConfigVerify {
-		verifierErr := s.cloudService.ConfigVerifier()
-		if verifierErr != nil {
-			return err
+		if err := s.cloudService.ConfigVerifier(); err != nil {
+			return fmt.Errorf("verifying cloud provider configuration: %w", err)
 		}
 	}
 	// Advertise node resources
@@ -145,3 +156,15 @@ func (s *server) Shutdown() error {
 func (s *server) Ready() chan struct{} {
 	return s.readyCh
 }
+
+// ProbeChecks returns the readiness checks of the cloud provider, the pod network tunnels and Secure-Comms
+func (s *server) ProbeChecks() []probe.Check {
+	checks := []probe.Check{
+		probe.NewCachedCheck(probe.NewCheck("provider", s.cloudService.CheckProvider), providerCheckTTL),
+		probe.NewCheck("tunnels", s.cloudService.CheckTunnels),
+	}
+	if s.secureCommsTrustee {
+		checks = append(checks, probe.NewCheck("kbs", s.cloudService.CheckSecureComms))
+	}
+	return checks
+}
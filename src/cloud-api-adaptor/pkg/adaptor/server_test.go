@@ -10,12 +10,14 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/probe"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 	"github.com/containerd/containerd/pkg/cri/annotations"
@@ -37,6 +39,26 @@ func TestServerStartAndShutdown(t *testing.T) {
 	}
 }
 
+func TestServerProbeChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, dir, socketPath, _, serverErrCh := testServerStart(t, ctx)
+	defer testServerShutdown(t, s, socketPath, dir, serverErrCh)
+
+	checks := append([]probe.Check{probe.TtrpcCheck(socketPath)}, s.ProbeChecks()...)
+	var names []string
+	for _, check := range checks {
+		names = append(names, check.Name())
+		if err := check.Check(context.Background()); err != nil {
+			t.Errorf("%s check failed: %v", check.Name(), err)
+		}
+	}
+	if e, a := "ttrpc provider tunnels", strings.Join(names, " "); e != a {
+		t.Errorf("Expect %q checks, got %q", e, a)
+	}
+}
+
 func TestCreateStartAndStop(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -192,6 +214,14 @@ func (n *mockWorkerNode) Teardown(nsPath string, config *tunneler.Config) error
 	return nil
 }
 
+func (n *mockWorkerNode) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+	return nil, nil
+}
+
+func (n *mockWorkerNode) Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error) {
+	return &tunneler.Stats{}, nil
+}
+
 type mockProvider struct {
 	primaryIP   string
 	secondaryIP string
@@ -167,7 +167,7 @@ func startDaemon(t *testing.T, ctx context.Context, agentSocketPath string, port
 	nsPath := os.Getenv("AGENT_PROTOCOL_FORWARDER_NAMESPACE")
 	interceptor := interceptor.NewInterceptor(agentSocketPath, nsPath)
 
-	d := daemon.NewDaemon(config, "127.0.0.1:0", nil, interceptor, &mockPodNode{})
+	d := daemon.NewDaemon(config, "127.0.0.1:0", nil, interceptor, &mockPodNode{}, nil)
 
 	daemonErr := make(chan error)
 	go func() {
@@ -546,3 +546,11 @@ func (n *mockPodNode) Setup() error {
 func (n *mockPodNode) Teardown() error {
 	return nil
 }
+
+func (n *mockPodNode) Reconcile() ([]string, error) {
+	return nil, nil
+}
+
+func (n *mockPodNode) Stats() (*tunneler.Stats, error) {
+	return &tunneler.Stats{}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	pb "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -35,3 +36,39 @@ func (s *podVMInfoService) GetInfo(ctx context.Context, req *pb.GetInfoRequest)
 
 	return nil, status.Errorf(codes.NotFound, "VM ID for %s:%s was not found", req.PodNamespace, req.PodName)
 }
+
+func (s *podVMInfoService) GetTunnelStats(ctx context.Context, req *pb.GetTunnelStatsRequest) (*pb.GetTunnelStatsResponse, error) {
+
+	stats, err := s.cloudService.GetTunnelStats(ctx, req.PodNamespace, req.PodName)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "getting tunnel statistics for %s:%s: %s", req.PodNamespace, req.PodName, err.Error())
+	}
+
+	if stats == nil {
+		return nil, status.Errorf(codes.NotFound, "tunnel for %s:%s was not found", req.PodNamespace, req.PodName)
+	}
+
+	return &pb.GetTunnelStatsResponse{
+		WorkerNode: linkStats(stats.WorkerNode),
+		PodVM:      linkStats(stats.PodVM),
+	}, nil
+}
+
+func linkStats(stats *tunneler.Stats) *pb.LinkStats {
+
+	if stats == nil {
+		return nil
+	}
+
+	return &pb.LinkStats{
+		Interface: stats.Interface,
+		RxBytes:   stats.RxBytes,
+		RxPackets: stats.RxPackets,
+		RxErrors:  stats.RxErrors,
+		RxDropped: stats.RxDropped,
+		TxBytes:   stats.TxBytes,
+		TxPackets: stats.TxPackets,
+		TxErrors:  stats.TxErrors,
+		TxDropped: stats.TxDropped,
+	}
+}
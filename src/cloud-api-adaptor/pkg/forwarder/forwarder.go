@@ -11,6 +11,7 @@ import (
 	"log"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
@@ -19,6 +20,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+	pbinfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 )
 
 var logger = log.New(log.Writer(), "[forwarder] ", log.LstdFlags|log.Lmsgprefix)
@@ -48,6 +50,9 @@ type Config struct {
 	SecureCommsInbounds  string `json:"sc-inbounds,omitempty"`
 	SecureCommsOutbounds string `json:"sc-outbounds,omitempty"`
 	SecureComms          bool   `json:"sc,omitempty"`
+	SecureCommsTransport string `json:"sc-transport,omitempty"`
+
+	TunnelMonitorInterval time.Duration `json:"tunnel-monitor-interval,omitempty"`
 }
 
 type Daemon interface {
@@ -61,13 +66,14 @@ type daemon struct {
 	tlsConfig   *tlsutil.TLSConfig
 	interceptor interceptor.Interceptor
 	podNode     podnetwork.PodNode
+	monitor     podnetwork.Monitor
 	readyCh     chan struct{}
 	stopCh      chan struct{}
 	listenAddr  string
 	stopOnce    sync.Once
 }
 
-func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode) Daemon {
+func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode, monitor podnetwork.Monitor) Daemon {
 
 	if tlsConfig != nil && !tlsConfig.HasCertAuth() {
 		tlsConfig.CertData = []byte(spec.TLSServerCert)
@@ -83,6 +89,7 @@ func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, in
 		tlsConfig:   tlsConfig,
 		interceptor: interceptor,
 		podNode:     podNode,
+		monitor:     monitor,
 		readyCh:     make(chan struct{}),
 		stopCh:      make(chan struct{}),
 	}
@@ -103,6 +110,11 @@ func (d *daemon) Start(ctx context.Context) error {
 		}
 	}()
 
+	if d.monitor != nil {
+		d.monitor.Start(ctx)
+		defer d.monitor.Stop()
+	}
+
 	// Set up agent protocol interceptor
 
 	var listener net.Listener
@@ -141,6 +153,7 @@ func (d *daemon) Start(ctx context.Context) error {
 
 	pb.RegisterAgentServiceService(ttrpcServer, d.interceptor)
 	pb.RegisterHealthService(ttrpcServer, d.interceptor)
+	pbinfo.RegisterPodVMInfoService(ttrpcServer, &podVMInfoService{podNode: d.podNode})
 
 	ttrpcServerErr := make(chan error)
 	go func() {
@@ -9,8 +9,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containerd/ttrpc"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/agentproto"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+	pbinfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
 )
 
 type mockConn struct{}
@@ -33,7 +38,7 @@ func TestNew(t *testing.T) {
 	config := &Config{}
 	tlsConfig := tlsutil.TLSConfig{}
 
-	ret := NewDaemon(config, DefaultListenAddr, &tlsConfig, agentproto.NewRedirector(dummyDialer), &mockPodNode{})
+	ret := NewDaemon(config, DefaultListenAddr, &tlsConfig, agentproto.NewRedirector(dummyDialer), &mockPodNode{}, nil)
 	if ret == nil {
 		t.Fatal("Expect non nil, got nil")
 	}
@@ -100,3 +105,63 @@ func (n *mockPodNode) Setup() error {
 func (n *mockPodNode) Teardown() error {
 	return nil
 }
+
+func (n *mockPodNode) Reconcile() ([]string, error) {
+	return nil, nil
+}
+
+func (n *mockPodNode) Stats() (*tunneler.Stats, error) {
+	return &tunneler.Stats{
+		Interface:      "eth0",
+		LinkStatistics: netops.LinkStatistics{RxBytes: 1000, RxPackets: 10, TxBytes: 2000, TxPackets: 20},
+	}, nil
+}
+
+func TestGetTunnelStats(t *testing.T) {
+
+	d := &daemon{
+		interceptor: agentproto.NewRedirector(dummyDialer),
+		podNode:     &mockPodNode{},
+		listenAddr:  "127.0.0.1:0",
+		readyCh:     make(chan struct{}),
+		stopCh:      make(chan struct{}),
+	}
+
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+
+		if err := d.Start(context.Background()); err != nil {
+			errCh <- err
+		}
+	}()
+	defer func() {
+		if err := d.Shutdown(); err != nil {
+			t.Fatalf("Expect no error, got %q", err)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("Expect no error, got %q", err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", d.Addr())
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	res, err := pbinfo.NewPodVMInfoClient(client).GetTunnelStats(context.Background(), &pbinfo.GetTunnelStatsRequest{})
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	if res.PodVM == nil {
+		t.Fatal("Expect pod VM statistics, got nil")
+	}
+	if e, a := "eth0", res.PodVM.Interface; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	if res.PodVM.RxBytes != 1000 || res.PodVM.RxPackets != 10 || res.PodVM.TxBytes != 2000 || res.PodVM.TxPackets != 20 {
+		t.Fatalf("Expect counters of the pod node, got %#v", res.PodVM)
+	}
+}
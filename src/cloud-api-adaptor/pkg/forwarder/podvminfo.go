@@ -0,0 +1,46 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
+	pbinfo "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/proto/podvminfo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// podVMInfoService serves the pod VM side of the PodVMInfo service to cloud-api-adaptor
+type podVMInfoService struct {
+	podNode podnetwork.PodNode
+}
+
+func (s *podVMInfoService) GetInfo(ctx context.Context, req *pbinfo.GetInfoRequest) (*pbinfo.GetInfoResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "GetInfo is served by cloud-api-adaptor")
+}
+
+func (s *podVMInfoService) GetTunnelStats(ctx context.Context, req *pbinfo.GetTunnelStatsRequest) (*pbinfo.GetTunnelStatsResponse, error) {
+
+	stats, err := s.podNode.Stats()
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "getting tunnel statistics: %s", err.Error())
+	}
+
+	res := &pbinfo.GetTunnelStatsResponse{
+		PodVM: &pbinfo.LinkStats{
+			Interface: stats.Interface,
+			RxBytes:   stats.RxBytes,
+			RxPackets: stats.RxPackets,
+			RxErrors:  stats.RxErrors,
+			RxDropped: stats.RxDropped,
+			TxBytes:   stats.TxBytes,
+			TxPackets: stats.TxPackets,
+			TxErrors:  stats.TxErrors,
+			TxDropped: stats.TxDropped,
+		},
+	}
+
+	return res, nil
+}
@@ -1,7 +1,218 @@
 package initdata
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Ref: https://github.com/confidential-containers/trustee/blob/main/kbs/docs/initdata.md
+
+const (
+	// AnnotationKey is the pod annotation carrying the base64 encoded initdata
+	AnnotationKey = "io.katacontainers.config.runtime.cc_init_data"
+	Version       = "0.1.0"
+
+	AAConfigKey  = "aa.toml"
+	CDHConfigKey = "cdh.toml"
+	PolicyKey    = "policy.rego"
+)
+
+var logger = log.New(log.Writer(), "[initdata] ", log.LstdFlags|log.Lmsgprefix)
+
+// SupportedVersions are the initdata spec versions supported by peer pods
+var SupportedVersions = []string{Version}
+
+// SupportedAlgorithms are the digest algorithms supported by peer pods
+var SupportedAlgorithms = []string{"sha256", "sha384", "sha512"}
+
+// KnownKeys are the data keys provisioned in peer pod VMs
+var KnownKeys = []string{AAConfigKey, CDHConfigKey, PolicyKey}
+
 type InitData struct {
 	Algorithm string            `toml:"algorithm"`
 	Version   string            `toml:"version"`
 	Data      map[string]string `toml:"data,omitempty"`
 }
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses an initdata document and checks its version and algorithm
+func Parse(raw []byte) (*InitData, error) {
+	var initdata InitData
+	decoder := toml.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&initdata); err != nil {
+		return nil, fmt.Errorf("invalid initdata: %w", err)
+	}
+	if !contains(SupportedVersions, initdata.Version) {
+		return nil, fmt.Errorf("invalid initdata: unsupported version %q, supported versions: %s", initdata.Version, strings.Join(SupportedVersions, ", "))
+	}
+	if !contains(SupportedAlgorithms, initdata.Algorithm) {
+		return nil, fmt.Errorf("invalid initdata: unsupported algorithm %q, supported algorithms: %s", initdata.Algorithm, strings.Join(SupportedAlgorithms, ", "))
+	}
+	return &initdata, nil
+}
+
+// Decode decodes and parses a base64 encoded initdata annotation, and returns the initdata document
+func Decode(annotation string) ([]byte, *InitData, error) {
+	raw, err := base64.StdEncoding.DecodeString(annotation)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid initdata: base64 decode: %w", err)
+	}
+	initdata, err := Parse(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, initdata, nil
+}
+
+// DecodeLenient decodes a base64 encoded initdata annotation without checking its version or
+// unknown fields. It is used in peer pod VMs, whose image may be older than cloud-api-adaptor,
+// which checks the initdata strictly at CreateVM.
+func DecodeLenient(annotation string) ([]byte, *InitData, error) {
+	raw, err := base64.StdEncoding.DecodeString(annotation)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid initdata: base64 decode: %w", err)
+	}
+	var initdata InitData
+	if err := toml.Unmarshal(raw, &initdata); err != nil {
+		return nil, nil, fmt.Errorf("invalid initdata: %w", err)
+	}
+	return raw, &initdata, nil
+}
+
+// Encode encodes an initdata document as an annotation value
+func Encode(raw []byte) string {
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// Validate checks that the contents of the data keys known to peer pods are valid
+// Unknown keys are skipped, as they are not provisioned in peer pod VMs.
+func (i *InitData) Validate() error {
+	keys := make([]string, 0, len(i.Data))
+	for key := range i.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := i.Data[key]
+		switch key {
+		case AAConfigKey, CDHConfigKey:
+			var config map[string]any
+			if err := toml.Unmarshal([]byte(value), &config); err != nil {
+				return fmt.Errorf("invalid initdata: %s: %w", key, err)
+			}
+		case PolicyKey:
+			if err := checkPolicy(value); err != nil {
+				return fmt.Errorf("invalid initdata: %s: %w", key, err)
+			}
+		default:
+			logger.Printf("skipping unknown initdata key %q, known keys: %s", key, strings.Join(KnownKeys, ", "))
+		}
+	}
+	return nil
+}
+
+// checkPolicy checks that a policy is a rego module of the kata agent policy package
+func checkPolicy(policy string) error {
+	for _, line := range strings.Split(policy, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "package" {
+			return fmt.Errorf("policy must start with a package declaration")
+		}
+		if len(fields) != 2 || fields[1] != "agent_policy" {
+			return fmt.Errorf("policy package must be agent_policy, got %q", line)
+		}
+		return nil
+	}
+	return fmt.Errorf("policy is empty")
+}
+
+// Digest returns the hex encoded digest of an initdata document
+func Digest(raw []byte, algorithm string) (string, error) {
+	switch algorithm {
+	case "sha256":
+		hash := sha256.Sum256(raw)
+		return hex.EncodeToString(hash[:]), nil
+	case "sha384":
+		hash := sha512.Sum384(raw)
+		return hex.EncodeToString(hash[:]), nil
+	case "sha512":
+		hash := sha512.Sum512(raw)
+		return hex.EncodeToString(hash[:]), nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, supported algorithms: %s", algorithm, strings.Join(SupportedAlgorithms, ", "))
+	}
+}
+
+// Build returns an initdata document with the given data, such as the contents of aa.toml, cdh.toml and policy.rego
+func Build(algorithm string, data map[string]string) ([]byte, error) {
+	for key := range data {
+		if !slices.Contains(KnownKeys, key) {
+			return nil, fmt.Errorf("unknown key %q, known keys: %s", key, strings.Join(KnownKeys, ", "))
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "algorithm = %q\nversion = %q\n", algorithm, Version)
+
+	if len(data) > 0 {
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("\n[data]\n")
+		for _, key := range keys {
+			value := data[key]
+			// Multi-line literal strings keep the files readable, unless they contain the delimiter
+			if !strings.Contains(value, "'''") && !strings.HasSuffix(value, "'") && !strings.ContainsRune(value, '\r') {
+				fmt.Fprintf(&buf, "%q = '''\n%s'''\n", key, value)
+				continue
+			}
+			encoded, err := toml.Marshal(map[string]string{key: value})
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(encoded)
+		}
+	}
+
+	raw := buf.Bytes()
+	initdata, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := initdata.Validate(); err != nil {
+		return nil, err
+	}
+	for key, value := range data {
+		if initdata.Data[key] != value {
+			return nil, fmt.Errorf("failed to encode %s in initdata", key)
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,167 @@
+package initdata
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPolicy = `package agent_policy
+
+default ExecProcessRequest := false
+`
+
+const testAAConfig = `[token_configs]
+[token_configs.kbs]
+url = 'http://127.0.0.1:8080'
+cert = """
+-----BEGIN CERTIFICATE-----
+-----END CERTIFICATE-----
+"""
+`
+
+func TestParse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		raw string
+		err string
+	}{
+		"valid":             {raw: "algorithm = \"sha384\"\nversion = \"0.1.0\"\n[data]\n\"policy.rego\" = '''\npackage agent_policy\n'''\n"},
+		"no data":           {raw: "algorithm = \"sha256\"\nversion = \"0.1.0\"\n"},
+		"invalid toml":      {raw: "algorithm = sha256\n", err: "invalid initdata"},
+		"unknown field":     {raw: "algorithm = \"sha256\"\nversion = \"0.1.0\"\nfoo = 1\n", err: "invalid initdata"},
+		"missing version":   {raw: "algorithm = \"sha256\"\n", err: "unsupported version \"\""},
+		"unknown version":   {raw: "algorithm = \"sha256\"\nversion = \"0.2.0\"\n", err: "unsupported version \"0.2.0\""},
+		"unknown algorithm": {raw: "algorithm = \"md5\"\nversion = \"0.1.0\"\n", err: "unsupported algorithm \"md5\""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.raw))
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Expect no error, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Expect error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	for name, tc := range map[string]struct {
+		annotation string
+		err        string
+	}{
+		"valid":           {annotation: Encode([]byte("algorithm = \"sha256\"\nversion = \"0.1.0\"\n"))},
+		"unknown field":   {annotation: Encode([]byte("algorithm = \"sha256\"\nversion = \"0.1.0\"\nfoo = 1\n"))},
+		"unknown version": {annotation: Encode([]byte("algorithm = \"sha256\"\nversion = \"0.2.0\"\n"))},
+		"not base64":      {annotation: "not base64!", err: "base64 decode"},
+		"invalid toml":    {annotation: Encode([]byte("algorithm = sha256\n")), err: "invalid initdata"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, data, err := DecodeLenient(tc.annotation)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Expect no error, got %v", err)
+				}
+				if data.Algorithm != "sha256" {
+					t.Fatalf("Expect algorithm sha256, got %s", data.Algorithm)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Expect error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data map[string]string
+		err  string
+	}{
+		"valid":              {data: map[string]string{AAConfigKey: testAAConfig, CDHConfigKey: "socket = 'unix:///run/cdh.sock'\n", PolicyKey: testPolicy}},
+		"empty":              {data: nil},
+		"unknown key":        {data: map[string]string{"../etc/passwd": "root", PolicyKey: testPolicy}},
+		"invalid aa.toml":    {data: map[string]string{AAConfigKey: "[token_configs"}, err: "aa.toml"},
+		"invalid cdh.toml":   {data: map[string]string{CDHConfigKey: "socket = "}, err: "cdh.toml"},
+		"empty policy":       {data: map[string]string{PolicyKey: "# only a comment\n"}, err: "policy is empty"},
+		"no package":         {data: map[string]string{PolicyKey: "default ExecProcessRequest := false\n"}, err: "package declaration"},
+		"wrong package":      {data: map[string]string{PolicyKey: "package foo\n"}, err: "must be agent_policy"},
+		"commented package":  {data: map[string]string{PolicyKey: "# agent policy\n\npackage agent_policy\n"}},
+		"policy not package": {data: map[string]string{PolicyKey: "package agent_policy.foo\n"}, err: "must be agent_policy"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := (&InitData{Algorithm: "sha256", Version: Version, Data: tc.data}).Validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Expect no error, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Expect error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestDigest(t *testing.T) {
+	raw := []byte("algorithm = \"sha256\"\nversion = \"0.1.0\"\n")
+	for algorithm, expected := range map[string]string{
+		"sha256": "9587b4ad22499533c6429bce83f2ccc27ad82e94d0f0b3e31fc9720905718385",
+		"sha384": "2a8e448763e62b1d0cb89785a08400a7bddbb205d76c6fa88616e9d048f90fa25782395a500aa8d7e2b00d3e14f9b086",
+		"sha512": "019d689b5f420955fa1567e44ee601348eef06d5d5b855b22f4c41a2ec152a72c84dca605d04d53642140ec885ceb77c01d909e854f5e6ac168a12882b8989a7",
+	} {
+		digest, err := Digest(raw, algorithm)
+		if err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if digest != expected {
+			t.Fatalf("Expect %s digest %s, got %s", algorithm, expected, digest)
+		}
+	}
+	if _, err := Digest(raw, "md5"); err == nil {
+		t.Fatal("Expect error for unsupported algorithm")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	data := map[string]string{
+		AAConfigKey:  testAAConfig,
+		CDHConfigKey: "socket = 'unix:///run/cdh.sock'",
+		PolicyKey:    testPolicy,
+	}
+	raw, err := Build("sha384", data)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !strings.Contains(string(raw), "\"policy.rego\" = '''\n"+testPolicy+"'''\n") {
+		t.Fatalf("Expect policy.rego as literal string, got %s", raw)
+	}
+
+	_, decoded, err := Decode(Encode(raw))
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if decoded.Algorithm != "sha384" || decoded.Version != Version {
+		t.Fatalf("Expect sha384 %s, got %s %s", Version, decoded.Algorithm, decoded.Version)
+	}
+	for key, value := range data {
+		if decoded.Data[key] != value {
+			t.Fatalf("Expect %s %q, got %q", key, value, decoded.Data[key])
+		}
+	}
+
+	// Contents which cannot be literal strings are escaped
+	data[PolicyKey] = "package agent_policy\n# '''\n"
+	raw, err = Build("sha256", data)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if _, decoded, err = Decode(Encode(raw)); err != nil || decoded.Data[PolicyKey] != data[PolicyKey] {
+		t.Fatalf("Expect %q, got %q, %v", data[PolicyKey], decoded.Data[PolicyKey], err)
+	}
+
+	if _, err := Build("md5", nil); err == nil {
+		t.Fatal("Expect error for unsupported algorithm")
+	}
+	if _, err := Build("sha256", map[string]string{"foo": "bar"}); err == nil {
+		t.Fatal("Expect error for unknown key")
+	}
+}
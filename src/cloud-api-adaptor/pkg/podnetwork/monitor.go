@@ -0,0 +1,247 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
+)
+
+const (
+	DefaultMonitorInterval = 30 * time.Second
+	monitorProbeTimeout    = 3 * time.Second
+	monitorLookupTimeout   = 30 * time.Second
+)
+
+// MonitorStatus is the result of the latest tunnel check
+type MonitorStatus struct {
+	// Healthy is true if the tunnel state was verified, or repaired successfully
+	Healthy bool `json:"healthy"`
+	// Reachable is true if the other end of the tunnel responded to a probe
+	Reachable bool      `json:"reachable"`
+	LastCheck time.Time `json:"last-check"`
+	LastError string    `json:"last-error,omitempty"`
+	Repairs   int       `json:"repairs"`
+	Failures  int       `json:"failures"`
+}
+
+// Monitor periodically verifies the tunnel state of a pod, and re-applies missing state
+type Monitor interface {
+	Start(ctx context.Context)
+	Stop()
+	Status() MonitorStatus
+}
+
+type monitor struct {
+	name      string
+	interval  time.Duration
+	reconcile func() ([]string, error)
+	probeNS   string
+	probeAddr netip.Addr
+	onUpdate  func(MonitorStatus)
+	status    MonitorStatus
+	mutex     sync.Mutex
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewWorkerNodeMonitor returns a monitor that checks the tunnel of a pod on the worker node.
+// The pod VM is probed by sending ICMP echo requests to the pod IP over the tunnel.
+// If lookupIPs is not nil, the IP addresses of the pod VM are looked up after a failed check,
+// so that the tunnel is re-applied to the new addresses of a pod VM whose IP addresses changed.
+// onUpdate is called with the status after each check if it is not nil.
+func NewWorkerNodeMonitor(workerNode WorkerNode, nsPath string, podNodeIPs []netip.Addr, lookupIPs func(context.Context) ([]netip.Addr, error), config *tunneler.Config, interval time.Duration, onUpdate func(MonitorStatus)) Monitor {
+
+	m := newMonitor(nsPath, interval, onUpdate)
+	m.reconcile = func() ([]string, error) {
+		if lookupIPs != nil && m.failed() {
+			podNodeIPs = m.lookupIPs(podNodeIPs, lookupIPs)
+		}
+		return workerNode.Reconcile(nsPath, podNodeIPs, config)
+	}
+	m.probeAddr = config.PodIP.Addr()
+
+	return m
+}
+
+// NewPodNodeMonitor returns a monitor that checks the tunnel of a pod on the pod VM.
+// The worker node is probed by sending ICMP echo requests to the gateway of the pod network over the tunnel.
+// onUpdate is called with the status after each check if it is not nil.
+func NewPodNodeMonitor(podNode PodNode, nsPath string, config *tunneler.Config, interval time.Duration, onUpdate func(MonitorStatus)) Monitor {
+
+	m := newMonitor(nsPath, interval, onUpdate)
+	m.reconcile = podNode.Reconcile
+	m.probeNS = nsPath
+	for _, route := range config.Routes {
+		if route.GW.IsValid() {
+			m.probeAddr = route.GW
+			break
+		}
+	}
+
+	return m
+}
+
+func newMonitor(name string, interval time.Duration, onUpdate func(MonitorStatus)) *monitor {
+
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+
+	return &monitor{
+		name:     name,
+		interval: interval,
+		onUpdate: onUpdate,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// Start starts checking the tunnel periodically in the background until ctx is done or Stop is called
+func (m *monitor) Start(ctx context.Context) {
+
+	m.startOnce.Do(func() {
+		go m.run(ctx)
+	})
+}
+
+// Stop stops checking the tunnel, and waits for an ongoing check to complete
+func (m *monitor) Stop() {
+
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+
+	started := true
+	m.startOnce.Do(func() {
+		started = false
+	})
+	if started {
+		<-m.doneCh
+	}
+}
+
+func (m *monitor) Status() MonitorStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.status
+}
+
+// failed returns true if the latest check failed, or the other end of the tunnel was not reachable
+func (m *monitor) failed() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.status.LastCheck.IsZero() {
+		return false
+	}
+	return !m.status.Healthy || (m.probeAddr.IsValid() && !m.status.Reachable)
+}
+
+// lookupIPs returns the current IP addresses of the pod VM, or the known addresses if the lookup fails
+func (m *monitor) lookupIPs(known []netip.Addr, lookup func(context.Context) ([]netip.Addr, error)) []netip.Addr {
+
+	ctx, cancel := context.WithTimeout(context.Background(), monitorLookupTimeout)
+	defer cancel()
+
+	ips, err := lookup(ctx)
+	if err != nil {
+		logger.Printf("tunnel monitor %s: failed to look up pod VM IP addresses: %v", m.name, err)
+		return known
+	}
+	if len(ips) == 0 {
+		return known
+	}
+	if !slices.Equal(ips, known) {
+		logger.Printf("tunnel monitor %s: pod VM IP addresses changed from %v to %v", m.name, known, ips)
+	}
+
+	return ips
+}
+
+func (m *monitor) run(ctx context.Context) {
+	defer close(m.doneCh)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		m.check()
+	}
+}
+
+func (m *monitor) check() {
+
+	repaired, err := m.reconcile()
+
+	if len(repaired) > 0 {
+		logger.Printf("tunnel monitor %s: repaired %s", m.name, strings.Join(repaired, ", "))
+	}
+	if err != nil {
+		logger.Printf("tunnel monitor %s: %v", m.name, err)
+	}
+
+	var reachable bool
+	if m.probeAddr.IsValid() {
+		if perr := m.probe(); perr != nil {
+			logger.Printf("tunnel monitor %s: %s is not reachable: %v", m.name, m.probeAddr, perr)
+		} else {
+			reachable = true
+		}
+	}
+
+	m.mutex.Lock()
+	m.status.LastCheck = time.Now()
+	m.status.Healthy = err == nil
+	m.status.Reachable = reachable
+	m.status.Repairs += len(repaired)
+	if err != nil {
+		m.status.LastError = err.Error()
+		m.status.Failures++
+	} else {
+		m.status.LastError = ""
+	}
+	status := m.status
+	m.mutex.Unlock()
+
+	if m.onUpdate != nil {
+		m.onUpdate(status)
+	}
+}
+
+func (m *monitor) probe() error {
+
+	var ns netops.Namespace
+	var err error
+
+	if m.probeNS == "" {
+		ns, err = netops.OpenCurrentNamespace()
+	} else {
+		ns, err = netops.OpenNamespace(m.probeNS)
+	}
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+
+	return ns.Ping(m.probeAddr, monitorProbeTimeout)
+}
@@ -0,0 +1,141 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+)
+
+func TestMonitor(t *testing.T) {
+
+	results := []struct {
+		repaired []string
+		err      error
+	}{
+		{nil, nil},
+		{[]string{"firewall rules", "vxlan interface vxlan1"}, nil},
+		{nil, errors.New("reconcile failed")},
+		{nil, nil},
+	}
+
+	updateCh := make(chan MonitorStatus)
+
+	m := newMonitor("test", 10*time.Millisecond, func(status MonitorStatus) {
+		updateCh <- status
+	})
+
+	var count int
+	m.reconcile = func() ([]string, error) {
+		r := results[count%len(results)]
+		count++
+		return r.repaired, r.err
+	}
+
+	m.Start(context.Background())
+
+	expected := []MonitorStatus{
+		{Healthy: true},
+		{Healthy: true, Repairs: 2},
+		{Healthy: false, Repairs: 2, Failures: 1, LastError: "reconcile failed"},
+		{Healthy: true, Repairs: 2, Failures: 1},
+	}
+
+	for i, e := range expected {
+		status := <-updateCh
+		if status.LastCheck.IsZero() {
+			t.Fatalf("Expect last check time to be set at check %d", i)
+		}
+		status.LastCheck = time.Time{}
+		if status != e {
+			t.Fatalf("Expect %#v at check %d, got %#v", e, i, status)
+		}
+	}
+
+	go func() {
+		for range updateCh {
+		}
+	}()
+
+	m.Stop()
+	m.Stop()
+	close(updateCh)
+
+	if status := m.Status(); status.Failures < 1 {
+		t.Fatalf("Expect at least 1 failure, got %d", status.Failures)
+	}
+}
+
+func TestMonitorStopWithoutStart(t *testing.T) {
+
+	m := newMonitor("test", time.Second, nil)
+	m.reconcile = func() ([]string, error) {
+		return nil, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expect Stop to return without Start")
+	}
+}
+
+type monitorWorkerNode struct {
+	WorkerNode
+	reconcileCh chan []netip.Addr
+}
+
+func (n *monitorWorkerNode) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+	n.reconcileCh <- podNodeIPs
+	if podNodeIPs[0] != netip.MustParseAddr("192.0.2.2") {
+		return nil, errors.New("pod VM is not reachable")
+	}
+	return nil, nil
+}
+
+func TestWorkerNodeMonitorLookupIPs(t *testing.T) {
+
+	oldIPs := []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	newIPs := []netip.Addr{netip.MustParseAddr("192.0.2.2")}
+
+	workerNode := &monitorWorkerNode{reconcileCh: make(chan []netip.Addr)}
+
+	var lookups int
+	lookupIPs := func(ctx context.Context) ([]netip.Addr, error) {
+		lookups++
+		return newIPs, nil
+	}
+
+	m := NewWorkerNodeMonitor(workerNode, "/run/netns/test", oldIPs, lookupIPs, &tunneler.Config{}, 10*time.Millisecond, nil)
+	m.Start(context.Background())
+
+	// The IPs are looked up only after the first check failed with the old IPs
+	for i, e := range [][]netip.Addr{oldIPs, newIPs, newIPs} {
+		if ips := <-workerNode.reconcileCh; ips[0] != e[0] {
+			t.Fatalf("Expect %s at check %d, got %s", e[0], i, ips[0])
+		}
+	}
+
+	go func() {
+		for range workerNode.reconcileCh {
+		}
+	}()
+	m.Stop()
+	close(workerNode.reconcileCh)
+
+	if lookups != 1 {
+		t.Fatalf("Expect 1 lookup, got %d", lookups)
+	}
+}
@@ -15,12 +15,15 @@ import (
 type PodNode interface {
 	Setup() error
 	Teardown() error
+	Reconcile() ([]string, error)
+	Stats() (*tunneler.Stats, error)
 }
 
 type podNode struct {
 	config        *tunneler.Config
 	nsPath        string
 	hostInterface string
+	podNodeIPs    []netip.Addr
 }
 
 func NewPodNode(nsPath string, hostInterface string, config *tunneler.Config) PodNode {
@@ -94,6 +97,7 @@ func (n *podNode) Setup() error {
 	if err := tun.Setup(n.nsPath, podNodeIPs, n.config); err != nil {
 		return fmt.Errorf("failed to set up tunnel %q: %w", n.config.TunnelType, err)
 	}
+	n.podNodeIPs = podNodeIPs
 
 	if !n.config.PodIP.IsSingleIP() {
 		// Delete the nRoute that was automatically added by kernel for eth0
@@ -154,6 +158,133 @@ func (n *podNode) Setup() error {
 	return nil
 }
 
+// Reconcile verifies the tunnel, routes and neighbors set up by Setup, and re-applies missing state.
+// It returns descriptions of repaired state.
+func (n *podNode) Reconcile() ([]string, error) {
+
+	tun, err := tunneler.PodNodeTunneler(n.config.TunnelType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tunneler: %w", err)
+	}
+
+	var repaired []string
+
+	if r, ok := tun.(tunneler.Reconciler); ok {
+		repaired, err = r.Reconcile(n.nsPath, n.podNodeIPs, n.config)
+		if err != nil {
+			return repaired, fmt.Errorf("failed to reconcile tunnel %q: %w", n.config.TunnelType, err)
+		}
+	}
+
+	podNS, err := netops.OpenNamespace(n.nsPath)
+	if err != nil {
+		return repaired, fmt.Errorf("failed to open network namespace %q: %w", n.nsPath, err)
+	}
+	defer func() {
+		if err := podNS.Close(); err != nil {
+			logger.Printf("failed to close a network namespace: %q", podNS.Path())
+		}
+	}()
+
+	current, err := podNS.RouteList()
+	if err != nil {
+		return repaired, err
+	}
+
+	hasRoute := func(route *tunneler.Route) bool {
+		dst := route.Dst
+		if !dst.IsValid() {
+			dst = netops.DefaultPrefix
+		}
+		for _, r := range current {
+			if r.Destination == dst && r.Gateway == route.GW && (route.Dev == "" || r.Device == route.Dev) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Routes without gateway address are processed first as in Setup
+	var first, second []*tunneler.Route
+	for _, route := range n.config.Routes {
+		if !route.GW.IsValid() {
+			first = append(first, route)
+		} else {
+			second = append(second, route)
+		}
+	}
+
+	for _, route := range append(first, second...) {
+		if hasRoute(route) {
+			continue
+		}
+		nRoute := netops.Route{
+			Destination: route.Dst,
+			Gateway:     route.GW,
+			Device:      route.Dev,
+			Protocol:    route.Protocol,
+			Scope:       route.Scope,
+		}
+		if err := podNS.RouteAdd(&nRoute); err != nil {
+			return repaired, fmt.Errorf("failed to add a route to %s via %s on pod network namespace %s: %w", route.Dst, route.GW, podNS.Path(), err)
+		}
+		repaired = append(repaired, fmt.Sprintf("route to %s via %s", route.Dst, route.GW))
+	}
+
+	for _, neighbor := range n.config.Neighbors {
+
+		list, err := podNS.NeighborList(&netops.Neighbor{Dev: neighbor.Dev, State: neighbor.State})
+		if err != nil {
+			return repaired, err
+		}
+		var found bool
+		for _, nb := range list {
+			if nb.IP == neighbor.IP && nb.HardwareAddr == neighbor.HardwareAddr {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		nNeigh := netops.Neighbor{
+			IP:           neighbor.IP,
+			Dev:          neighbor.Dev,
+			HardwareAddr: neighbor.HardwareAddr,
+			State:        neighbor.State,
+		}
+		if err := podNS.NeighborAdd(&nNeigh); err != nil {
+			return repaired, fmt.Errorf("failed to add an ARP entry: %s dev %s lladdr %s %s on pod network namespace %s: %w",
+				neighbor.IP, neighbor.Dev, neighbor.HardwareAddr, neighbor.State, podNS.Path(), err)
+		}
+		repaired = append(repaired, fmt.Sprintf("ARP entry %s dev %s", neighbor.IP, neighbor.Dev))
+	}
+
+	return repaired, nil
+}
+
+// Stats returns traffic counters of the tunnel interface set up by Setup
+func (n *podNode) Stats() (*tunneler.Stats, error) {
+
+	tun, err := tunneler.PodNodeTunneler(n.config.TunnelType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tunneler: %w", err)
+	}
+
+	r, ok := tun.(tunneler.StatsReader)
+	if !ok {
+		return nil, fmt.Errorf("tunnel %q does not support traffic statistics", n.config.TunnelType)
+	}
+
+	stats, err := r.Stats(n.nsPath, n.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic statistics of tunnel %q: %w", n.config.TunnelType, err)
+	}
+
+	return stats, nil
+}
+
 func (n *podNode) Teardown() error {
 
 	tun, err := tunneler.PodNodeTunneler(n.config.TunnelType)
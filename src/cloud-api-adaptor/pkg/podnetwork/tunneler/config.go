@@ -9,9 +9,20 @@ type TunnelerConfigurator interface {
 }
 
 type NetworkConfig struct {
-	TunnelType    string
-	HostInterface string
-	VXLAN         VXLANConfig
+	TunnelType      string
+	HostInterface   string
+	FirewallBackend string
+	VXLAN           VXLANConfig
+	MTU             MTUConfig
+}
+
+type MTUConfig struct {
+	// Underlay is the MTU of the network path between worker nodes and pod VMs if it is smaller than the MTU of the host interface
+	Underlay int
+	// ExtraOverhead is the size of additional encapsulation of tunnel traffic on the underlay network
+	ExtraOverhead int
+	// Probe enables verification of the MTU by sending a packet with the DF bit set to a pod VM after setup
+	Probe bool
 }
 
 type VXLANConfig struct {
@@ -15,6 +15,23 @@ type Tunneler interface {
 	Teardown(nsPath, hostInterface string, config *Config) error
 }
 
+// Reconciler is implemented by tunnelers that can verify the state created by Setup,
+// and re-apply missing or stale state. Reconcile returns descriptions of repaired state.
+type Reconciler interface {
+	Reconcile(nsPath string, podNodeIPs []netip.Addr, config *Config) ([]string, error)
+}
+
+// StatsReader is implemented by tunnelers that can read traffic counters of the tunnel interface of a pod
+type StatsReader interface {
+	Stats(nsPath string, config *Config) (*Stats, error)
+}
+
+// Stats is a set of traffic counters of the tunnel interface of a pod
+type Stats struct {
+	Interface string
+	netops.LinkStatistics
+}
+
 type Config struct {
 	PodIP         netip.Prefix `json:"podip"`
 	PodHwAddr     string       `json:"pod-hw-addr"`
@@ -24,10 +41,15 @@ type Config struct {
 	Routes        []*Route     `json:"routes"`
 	Neighbors     []*Neighbor  `json:"neighbors"`
 	MTU           int          `json:"mtu"`
+	UnderlayMTU   int          `json:"underlay-mtu,omitempty"`
 	Index         int          `json:"index"`
 	VXLANPort     int          `json:"vxlan-port,omitempty"`
 	VXLANID       int          `json:"vxlan-id,omitempty"`
 	Dedicated     bool         `json:"dedicated"`
+
+	// IngressBandwidth and EgressBandwidth are rate limits of the pod traffic in bits per second. Zero means no limit.
+	IngressBandwidth uint64 `json:"ingress-bandwidth,omitempty"`
+	EgressBandwidth  uint64 `json:"egress-bandwidth,omitempty"`
 }
 
 type Route struct {
@@ -0,0 +1,88 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vxlan
+
+import (
+	"fmt"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
+)
+
+const (
+	// burstPerSecond is the ratio of a burst size to a rate. A burst of 100ms allows TCP to reach the rate.
+	burstPerSecond = 10
+	minBurst       = 64 * 1024
+)
+
+func tokenBucket(bandwidth uint64) *netops.TokenBucket {
+
+	rate := bandwidth / 8
+	burst := rate / burstPerSecond
+	if burst < minBurst {
+		burst = minBurst
+	}
+
+	return &netops.TokenBucket{Rate: rate, Burst: uint32(burst)}
+}
+
+// bandwidthSetup applies the bandwidth limits of a pod to the tunnel in the pod network namespace.
+// Traffic to the pod is shaped when it is sent out through the vxlan interface,
+// and traffic from the pod is shaped when it is redirected from the vxlan interface to the pod interface.
+func bandwidthSetup(ns netops.Namespace, config *tunneler.Config) error {
+
+	if config.IngressBandwidth > 0 {
+		logger.Printf("Limit ingress bandwidth of pod %s to %d bps on %s", config.PodIP, config.IngressBandwidth, secondPodInterface)
+		if err := ns.ShapingAdd(secondPodInterface, tokenBucket(config.IngressBandwidth)); err != nil {
+			return fmt.Errorf("failed to limit ingress bandwidth on %s: %w", secondPodInterface, err)
+		}
+	}
+
+	if config.EgressBandwidth > 0 {
+		logger.Printf("Limit egress bandwidth of pod %s to %d bps on %s", config.PodIP, config.EgressBandwidth, config.InterfaceName)
+		if err := ns.ShapingAdd(config.InterfaceName, tokenBucket(config.EgressBandwidth)); err != nil {
+			return fmt.Errorf("failed to limit egress bandwidth on %s: %w", config.InterfaceName, err)
+		}
+	}
+
+	return nil
+}
+
+// bandwidthTeardown deletes the bandwidth limits of a pod
+func bandwidthTeardown(ns netops.Namespace, config *tunneler.Config) error {
+
+	if err := ns.ShapingDel(secondPodInterface); err != nil {
+		return err
+	}
+
+	if err := ns.ShapingDel(config.InterfaceName); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// bandwidthCheck returns true if the bandwidth limits of a pod are applied as bandwidthSetup applies them
+func bandwidthCheck(ns netops.Namespace, config *tunneler.Config) (bool, error) {
+
+	for dev, bandwidth := range map[string]uint64{
+		secondPodInterface:   config.IngressBandwidth,
+		config.InterfaceName: config.EgressBandwidth,
+	} {
+		var expected uint64
+		if bandwidth > 0 {
+			expected = tokenBucket(bandwidth).Rate
+		}
+
+		rate, err := ns.ShapingGet(dev)
+		if err != nil {
+			return false, err
+		}
+		if rate != expected {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
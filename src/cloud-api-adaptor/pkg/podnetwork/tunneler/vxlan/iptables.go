@@ -6,53 +6,29 @@ package vxlan
 import (
 	"fmt"
 	"net/netip"
-	"strconv"
-	"strings"
 	"sync"
 
-	"github.com/coreos/go-iptables/iptables"
-
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 )
 
-const (
-	iptablesOutputChainName     = "peerpod-OUTPUT"
-	iptablesPreRoutingChainName = "peerpod-PREROUTING"
-)
-
-type iptablesRule struct {
-	table string
-	base  string
-	chain string
-	spec  []string
+func firewallComment(vxlanID int) string {
+	return fmt.Sprintf("peerpod [vni:%d]", vxlanID)
 }
 
-func iptablesRules(addr, port, id string) []*iptablesRule {
-
-	comment := fmt.Sprintf("peerpod [vni:%s]", id)
+func firewallRules(addr netip.Addr, port int) []*netops.FirewallRule {
 
-	return []*iptablesRule{
+	return []*netops.FirewallRule{
 		{
-			table: "raw",
-			base:  "OUTPUT",
-			chain: iptablesOutputChainName,
-			spec: []string{
-				"-m", "comment", "--comment", comment,
-				"-d", addr,
-				"-p", "udp", "-m", "udp", "--dport", port,
-				"-j", "NOTRACK",
-			},
+			Chain:       netops.FirewallChainOutput,
+			Destination: addr,
+			Protocol:    "udp",
+			DstPort:     port,
 		},
 		{
-			table: "raw",
-			base:  "PREROUTING",
-			chain: iptablesPreRoutingChainName,
-			spec: []string{
-				"-m", "comment", "--comment", comment,
-				"-s", addr,
-				"-p", "udp", "-m", "udp", "--dport", port,
-				"-j", "NOTRACK",
-			},
+			Chain:    netops.FirewallChainPrerouting,
+			Source:   addr,
+			Protocol: "udp",
+			DstPort:  port,
 		},
 	}
 }
@@ -64,42 +40,16 @@ func iptablesSetup(ns netops.Namespace, dstAddr netip.Addr, dstPort, vxlanID int
 	iptablesMutex.Lock()
 	defer iptablesMutex.Unlock()
 
-	addr := dstAddr.String()
-	port := strconv.Itoa(dstPort)
-	id := strconv.Itoa(vxlanID)
-
-	return ns.Run(func() error {
-
-		ipt, err := iptables.New(iptables.IPFamily(iptables.ProtocolIPv4))
-		if err != nil {
-			return fmt.Errorf("failed to initialize iptables: %w", err)
-		}
-
-		for _, rule := range iptablesRules(addr, port, id) {
-
-			exists, err := ipt.ChainExists(rule.table, rule.chain)
-			if err != nil {
-				return fmt.Errorf("failed to check the existence of iptables chain %q: %w", rule.chain, err)
-			}
-
-			if !exists {
-				// Add "-N <chain>"
-				if err := ipt.NewChain(rule.table, rule.chain); err != nil {
-					return fmt.Errorf("failed to create iptables chain %s on table %s: %w", rule.chain, rule.table, err)
-				}
-				// Add "-A <base> -j <chain>"
-				if err := ipt.AppendUnique(rule.table, rule.base, "-j", rule.chain); err != nil {
-					return fmt.Errorf("failed to add iptables rule \"-t %s -A %s -j %s\": %w", rule.table, rule.chain, rule.chain, err)
-				}
-			}
+	fw, err := netops.NewFirewall(ns)
+	if err != nil {
+		return fmt.Errorf("failed to initialize firewall: %w", err)
+	}
 
-			if err := ipt.AppendUnique(rule.table, rule.chain, rule.spec...); err != nil {
-				return fmt.Errorf("failed to add iptables rule \"-t %s -A %s %s\": %w", rule.table, rule.chain, strings.Join(rule.spec, " "), err)
-			}
-		}
+	if err := fw.RuleSync(firewallComment(vxlanID), firewallRules(dstAddr, dstPort)); err != nil {
+		return fmt.Errorf("failed to set up %s rules for vxlan %d: %w", fw.Backend(), vxlanID, err)
+	}
 
-		return nil
-	})
+	return nil
 }
 
 func iptablesTeardown(ns netops.Namespace, dstAddr netip.Addr, dstPort, vxlanID int) error {
@@ -107,43 +57,53 @@ func iptablesTeardown(ns netops.Namespace, dstAddr netip.Addr, dstPort, vxlanID
 	iptablesMutex.Lock()
 	defer iptablesMutex.Unlock()
 
-	addr := dstAddr.String()
-	port := strconv.Itoa(dstPort)
-	id := strconv.Itoa(vxlanID)
+	fw, err := netops.NewFirewall(ns)
+	if err != nil {
+		return fmt.Errorf("failed to initialize firewall: %w", err)
+	}
 
-	return ns.Run(func() error {
+	if err := fw.RuleDel(firewallComment(vxlanID)); err != nil {
+		return fmt.Errorf("failed to delete %s rules for vxlan %d (remote %s:%d): %w", fw.Backend(), vxlanID, dstAddr, dstPort, err)
+	}
 
-		ipt, err := iptables.New(iptables.IPFamily(iptables.ProtocolIPv4))
-		if err != nil {
-			return fmt.Errorf("failed to initialize iptables: %w", err)
-		}
+	return nil
+}
 
-		for _, rule := range iptablesRules(addr, port, id) {
+// iptablesCheck returns true if the firewall rules for the vxlan exist exactly as iptablesSetup creates them
+func iptablesCheck(ns netops.Namespace, dstAddr netip.Addr, dstPort, vxlanID int) (bool, error) {
 
-			if err := ipt.Delete(rule.table, rule.chain, rule.spec...); err != nil {
-				return fmt.Errorf("failed to delete iptables rule \"-t %s -A %s %s\": %w", rule.table, rule.chain, strings.Join(rule.spec, " "), err)
-			}
+	iptablesMutex.Lock()
+	defer iptablesMutex.Unlock()
 
-			list, err := ipt.List(rule.table, rule.chain)
-			if err != nil {
-				return fmt.Errorf("failed to list rules in chain %s on table %s: %w", rule.chain, rule.table, err)
-			}
+	fw, err := netops.NewFirewall(ns)
+	if err != nil {
+		return false, fmt.Errorf("failed to initialize firewall: %w", err)
+	}
 
-			if len(list) > 1 {
-				// There are remaining rules other than "-N <chain>"
-				continue
-			}
+	comment := firewallComment(vxlanID)
 
-			// Delete "-A <base> -j <chain>"
-			if err := ipt.DeleteIfExists(rule.table, rule.base, "-j", rule.chain); err != nil {
-				return fmt.Errorf("failed to delete iptables rule \"-t %s -A %s -j %s\": %w", rule.table, rule.chain, rule.chain, err)
-			}
-			// Delete "-N <chain>"
-			if err := ipt.DeleteChain(rule.table, rule.chain); err != nil {
-				return fmt.Errorf("failed to delete iptables chain %s on table %s: %w", rule.chain, rule.table, err)
+	current, err := fw.RuleList(comment)
+	if err != nil {
+		return false, fmt.Errorf("failed to get %s rules for vxlan %d: %w", fw.Backend(), vxlanID, err)
+	}
+
+	desired := firewallRules(dstAddr, dstPort)
+	if len(current) != len(desired) {
+		return false, nil
+	}
+	for _, d := range desired {
+		d.Comment = comment
+		var found bool
+		for _, c := range current {
+			if *c == *d {
+				found = true
+				break
 			}
 		}
+		if !found {
+			return false, nil
+		}
+	}
 
-		return nil
-	})
+	return true, nil
 }
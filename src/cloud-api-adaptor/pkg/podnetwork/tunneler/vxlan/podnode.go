@@ -14,7 +14,9 @@ import (
 
 const (
 	hostVxlanInterface = "vxlan0"
-	maxMTU             = 1450
+	// maxMTU is used when a worker node does not provide the underlay MTU
+	maxMTU = 1450
+	minMTU = 576
 )
 
 type podNodeTunneler struct {
@@ -81,7 +83,7 @@ func (t *podNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, config *
 	}
 
 	mtu := int(config.MTU)
-	if mtu > maxMTU {
+	if config.UnderlayMTU == 0 && mtu > maxMTU {
 		mtu = maxMTU
 	}
 	if err := vxlan.SetMTU(mtu); err != nil {
@@ -144,3 +146,76 @@ func (t *podNodeTunneler) Teardown(nsPath, hostInterface string, config *tunnele
 
 	return nil
 }
+
+// Reconcile verifies the vxlan interface and firewall rules on a pod VM, and re-applies missing state
+func (t *podNodeTunneler) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+
+	nodeAddr := config.WorkerNodeIP.Addr()
+
+	hostNS, err := netops.OpenCurrentNamespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host network namespace: %w", err)
+	}
+	defer hostNS.Close()
+
+	podNS, err := netops.OpenNamespace(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a pod network namespace: %s: %w", nsPath, err)
+	}
+	defer podNS.Close()
+
+	var repaired []string
+
+	ok, err := iptablesCheck(hostNS, nodeAddr, config.VXLANPort, config.VXLANID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := iptablesSetup(hostNS, nodeAddr, config.VXLANPort, config.VXLANID); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "firewall rules")
+	}
+
+	vxlan, reason := findVXLAN(podNS, config.InterfaceName, nodeAddr, config)
+	if reason != "" {
+		logger.Printf("recreating vxlan interface %s on %s: %s", config.InterfaceName, nsPath, reason)
+
+		if vxlan != nil {
+			if err := vxlan.Delete(); err != nil {
+				return repaired, err
+			}
+		}
+		if err := t.Setup(nsPath, podNodeIPs, config); err != nil {
+			return repaired, err
+		}
+		return append(repaired, "vxlan interface "+config.InterfaceName), nil
+	}
+
+	addrs, err := vxlan.GetAddr()
+	if err != nil {
+		return repaired, err
+	}
+	var found bool
+	for _, addr := range addrs {
+		if addr == config.PodIP {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if err := vxlan.AddAddr(config.PodIP); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, fmt.Sprintf("pod IP %s on %s", config.PodIP, config.InterfaceName))
+	}
+
+	if !vxlan.IsUp() {
+		if err := vxlan.SetUp(); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "link state of "+config.InterfaceName)
+	}
+
+	return repaired, nil
+}
@@ -0,0 +1,43 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vxlan
+
+import (
+	"fmt"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
+)
+
+// Stats returns traffic counters of the vxlan interface of a pod on a worker node.
+// The interface is created as ppvxlanN, and renamed to vxlan1 when it is moved to the pod network namespace.
+func (t *workerNodeTunneler) Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error) {
+	return linkStats(nsPath, secondPodInterface)
+}
+
+// Stats returns traffic counters of the vxlan interface of a pod on a pod VM
+func (t *podNodeTunneler) Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error) {
+	return linkStats(nsPath, config.InterfaceName)
+}
+
+func linkStats(nsPath, name string) (*tunneler.Stats, error) {
+
+	ns, err := netops.OpenNamespace(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a pod network namespace: %s: %w", nsPath, err)
+	}
+	defer ns.Close()
+
+	link, err := ns.LinkFind(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find vxlan interface %q on netns %s: %w", name, nsPath, err)
+	}
+
+	stats, err := link.GetStatistics()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tunneler.Stats{Interface: name, LinkStatistics: *stats}, nil
+}
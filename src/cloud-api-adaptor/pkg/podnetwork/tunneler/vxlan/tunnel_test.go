@@ -6,6 +6,7 @@ package vxlan
 import (
 	"testing"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tuntest"
 )
 
@@ -14,3 +15,46 @@ func TestVXLAN(t *testing.T) {
 	tuntest.RunTunnelTest(t, "vxlan", NewWorkerNodeTunneler, NewPodNodeTunneler, false)
 
 }
+func TestConfigureMTU(t *testing.T) {
+
+	for _, tc := range []struct {
+		name          string
+		mtu           int
+		underlayMTU   int
+		extraOverhead int
+		expected      int
+		expectErr     bool
+	}{
+		{name: "pod MTU fits", mtu: 1400, underlayMTU: 1500, expected: 1400},
+		{name: "pod MTU lowered", mtu: 1500, underlayMTU: 1500, expected: 1450},
+		{name: "jumbo frame underlay", mtu: 8951, underlayMTU: 9001, expected: 8951},
+		{name: "small underlay", mtu: 1500, underlayMTU: 1460, expected: 1410},
+		{name: "extra overhead", mtu: 1500, underlayMTU: 1500, extraOverhead: 60, expected: 1390},
+		{name: "unknown underlay", mtu: 1500, expected: 1500},
+		{name: "too small underlay", mtu: 1500, underlayMTU: 600, expectErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tun, _ := NewWorkerNodeTunneler()
+
+			n := &tunneler.NetworkConfig{
+				VXLAN: tunneler.VXLANConfig{Port: DefaultVXLANPort, MinID: DefaultVXLANMinID},
+				MTU:   tunneler.MTUConfig{ExtraOverhead: tc.extraOverhead},
+			}
+			config := &tunneler.Config{MTU: tc.mtu, UnderlayMTU: tc.underlayMTU}
+
+			err := tun.(tunneler.TunnelerConfigurator).Configure(n, config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expect error, got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			if config.MTU != tc.expected {
+				t.Fatalf("Expect MTU %d, got %d", tc.expected, config.MTU)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/netip"
 	"os"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
@@ -21,9 +22,14 @@ const (
 	DefaultVXLANMinID        = 555000
 	hostVxlanInterfacePrefix = "ppvxlan"
 	secondPodInterface       = "vxlan1"
+
+	// vxlanOverhead is the size of outer IPv4, UDP and VXLAN headers, and an inner Ethernet header
+	vxlanOverhead   = 20 + 8 + 8 + 14
+	mtuProbeTimeout = 3 * time.Second
 )
 
 type workerNodeTunneler struct {
+	mtuProbe bool
 }
 
 func NewWorkerNodeTunneler() (tunneler.Tunneler, error) {
@@ -35,25 +41,46 @@ func (t *workerNodeTunneler) Configure(n *tunneler.NetworkConfig, config *tunnel
 	config.VXLANPort = n.VXLAN.Port
 	config.VXLANID = n.VXLAN.MinID + config.Index
 
+	if config.UnderlayMTU > 0 {
+		mtu := config.UnderlayMTU - vxlanOverhead - n.MTU.ExtraOverhead
+		if mtu < minMTU {
+			return fmt.Errorf("underlay MTU %d is too small for vxlan (overhead: %d, extra overhead: %d)", config.UnderlayMTU, vxlanOverhead, n.MTU.ExtraOverhead)
+		}
+		if config.MTU == 0 {
+			config.MTU = mtu
+		} else if config.MTU > mtu {
+			logger.Printf("Warning: MTU of pod interface %s is lowered from %d to %d to fit in underlay MTU %d (overhead: %d, extra overhead: %d)",
+				config.InterfaceName, config.MTU, mtu, config.UnderlayMTU, vxlanOverhead, n.MTU.ExtraOverhead)
+			config.MTU = mtu
+		}
+	}
+
+	t.mtuProbe = n.MTU.Probe
+
 	return nil
 }
 
-func (t *workerNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) error {
-
-	var dstAddr netip.Addr
+func destinationAddr(podNodeIPs []netip.Addr, config *tunneler.Config) (netip.Addr, error) {
 
 	numIPs := len(podNodeIPs)
 	if numIPs == 0 {
-		return fmt.Errorf("pod node has no IPs")
+		return netip.Addr{}, fmt.Errorf("pod node has no IPs")
 	}
 
 	if config.Dedicated {
 		if numIPs < 2 {
-			return fmt.Errorf("dedicated tunnel missing destination address")
+			return netip.Addr{}, fmt.Errorf("dedicated tunnel missing destination address")
 		}
-		dstAddr = podNodeIPs[1]
-	} else {
-		dstAddr = podNodeIPs[0]
+		return podNodeIPs[1], nil
+	}
+	return podNodeIPs[0], nil
+}
+
+func (t *workerNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) error {
+
+	dstAddr, err := destinationAddr(podNodeIPs, config)
+	if err != nil {
+		return err
 	}
 
 	hostNS, err := netops.OpenCurrentNamespace()
@@ -138,6 +165,15 @@ func (t *workerNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, confi
 		return fmt.Errorf("failed to change vxlan interface name %s on netns %s to %s: %w", hostVxlanInterface, podNS.Path(), secondPodInterface, err)
 	}
 
+	if config.MTU > 0 {
+		if err := setMTU(podNS, secondPodInterface, config.MTU); err != nil {
+			return err
+		}
+		if err := setMTU(podNS, config.InterfaceName, config.MTU); err != nil {
+			return err
+		}
+	}
+
 	if err := podVxlanInterface.SetUp(); err != nil {
 		return err
 	}
@@ -154,9 +190,41 @@ func (t *workerNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, confi
 		return fmt.Errorf("failed to add a tc redirect filter from %s to %s: %w", secondPodInterface, podInterface, err)
 	}
 
+	if err := bandwidthSetup(podNS, config); err != nil {
+		return err
+	}
+
+	if t.mtuProbe && config.MTU > 0 {
+		size := config.MTU + vxlanOverhead
+		if err := hostNS.ProbeMTU(dstAddr, size, mtuProbeTimeout); err != nil {
+			logger.Printf("Warning: MTU probe of %d bytes to pod VM %s failed. Large packets may be dropped on the tunnel: %v", size, dstAddr, err)
+		} else {
+			logger.Printf("MTU probe of %d bytes to pod VM %s succeeded", size, dstAddr)
+		}
+	}
+
 	return nil
 }
 
+// setMTU sets the MTU of an interface if it is different
+func setMTU(ns netops.Namespace, name string, mtu int) error {
+
+	link, err := ns.LinkFind(name)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %q on netns %s: %w", name, ns.Path(), err)
+	}
+
+	current, err := link.GetMTU()
+	if err != nil {
+		return fmt.Errorf("failed to get MTU size of %s: %w", name, err)
+	}
+	if current == mtu {
+		return nil
+	}
+
+	return link.SetMTU(mtu)
+}
+
 func (t *workerNodeTunneler) Teardown(nsPath, hostInterface string, config *tunneler.Config) error {
 
 	hostNS, err := netops.OpenCurrentNamespace()
@@ -189,6 +257,10 @@ func (t *workerNodeTunneler) Teardown(nsPath, hostInterface string, config *tunn
 		return fmt.Errorf("failed to delete a tc redirect filter from %s to %s: %w", secondPodInterface, config.InterfaceName, err)
 	}
 
+	if err := bandwidthTeardown(podNS, config); err != nil {
+		return fmt.Errorf("failed to delete bandwidth limits in the network namespace %s: %w", nsPath, err)
+	}
+
 	logger.Printf("Delete vxlan interface %s in the network namespace %s", secondPodInterface, nsPath)
 
 	podVxlanInterface, err := podNS.LinkFind(secondPodInterface)
@@ -220,3 +292,133 @@ func (t *workerNodeTunneler) Teardown(nsPath, hostInterface string, config *tunn
 
 	return nil
 }
+
+// Reconcile verifies the vxlan interface, tc redirect filters and firewall rules of a pod, and re-applies missing state
+func (t *workerNodeTunneler) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+
+	dstAddr, err := destinationAddr(podNodeIPs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	hostNS, err := netops.OpenCurrentNamespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current network namespace: %w", err)
+	}
+	defer hostNS.Close()
+
+	podNS, err := netops.OpenNamespace(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a network namespace: %s: %w", nsPath, err)
+	}
+	defer podNS.Close()
+
+	var repaired []string
+
+	ok, err := iptablesCheck(hostNS, dstAddr, config.VXLANPort, config.VXLANID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := iptablesSetup(hostNS, dstAddr, config.VXLANPort, config.VXLANID); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "firewall rules")
+	}
+
+	podVxlanInterface, reason := findVXLAN(podNS, secondPodInterface, dstAddr, config)
+	if reason != "" {
+		logger.Printf("recreating vxlan interface %s on %s: %s", secondPodInterface, nsPath, reason)
+
+		// Remove stale redirect filters that may point to a deleted interface
+		if err := podNS.RedirectDel(config.InterfaceName); err != nil {
+			logger.Printf("failed to delete a tc redirect filter on %s: %v", config.InterfaceName, err)
+		}
+		if podVxlanInterface != nil {
+			// Remove the firewall rules of a previous remote, such as the old IP address of the pod VM
+			if device, err := podVxlanInterface.GetDevice(); err == nil {
+				if old, ok := device.(*netops.VXLAN); ok && old.Group != dstAddr {
+					if err := iptablesTeardown(hostNS, old.Group, old.Port, old.ID); err != nil {
+						logger.Printf("failed to delete firewall rules for %s: %v", old.Group, err)
+					}
+				}
+			}
+			if err := podVxlanInterface.Delete(); err != nil {
+				return repaired, err
+			}
+		}
+		if err := t.Setup(nsPath, podNodeIPs, config); err != nil {
+			return repaired, err
+		}
+		return append(repaired, "vxlan interface "+secondPodInterface), nil
+	}
+
+	if !podVxlanInterface.IsUp() {
+		if err := podVxlanInterface.SetUp(); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "link state of "+secondPodInterface)
+	}
+
+	for _, redirect := range [][2]string{{config.InterfaceName, secondPodInterface}, {secondPodInterface, config.InterfaceName}} {
+		src, dst := redirect[0], redirect[1]
+
+		current, err := podNS.RedirectGet(src)
+		if err != nil {
+			return repaired, err
+		}
+		if current == dst {
+			continue
+		}
+		// Delete stale filters and an ingress qdisc that may remain without filters
+		if err := podNS.RedirectDel(src); err != nil {
+			logger.Printf("failed to delete a tc redirect filter on %s: %v", src, err)
+		}
+		if err := podNS.RedirectAdd(src, dst); err != nil {
+			return repaired, fmt.Errorf("failed to add a tc redirect filter from %s to %s: %w", src, dst, err)
+		}
+		repaired = append(repaired, fmt.Sprintf("tc redirect filter from %s to %s", src, dst))
+	}
+
+	ok, err = bandwidthCheck(podNS, config)
+	if err != nil {
+		return repaired, err
+	}
+	if !ok {
+		if err := bandwidthTeardown(podNS, config); err != nil {
+			return repaired, err
+		}
+		if err := bandwidthSetup(podNS, config); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, "bandwidth limits")
+	}
+
+	return repaired, nil
+}
+
+// findVXLAN finds a vxlan interface, and returns a reason why it needs to be recreated if it is missing or has unexpected parameters
+func findVXLAN(ns netops.Namespace, name string, group netip.Addr, config *tunneler.Config) (netops.Link, string) {
+
+	link, err := ns.LinkFind(name)
+	if err != nil {
+		return nil, "interface not found"
+	}
+
+	device, err := link.GetDevice()
+	if err != nil {
+		return link, err.Error()
+	}
+
+	vxlanDevice, ok := device.(*netops.VXLAN)
+	if !ok {
+		return link, "not a VXLAN interface"
+	}
+
+	if vxlanDevice.Group != group || vxlanDevice.ID != config.VXLANID || vxlanDevice.Port != config.VXLANPort {
+		return link, fmt.Sprintf("remote %s:%d (id: %d) is expected, but got %s:%d (id: %d)",
+			group, config.VXLANPort, config.VXLANID, vxlanDevice.Group, vxlanDevice.Port, vxlanDevice.ID)
+	}
+
+	return link, ""
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/netip"
 	"testing"
+	"time"
 
 	testutils "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/internal/testing"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
@@ -49,6 +50,8 @@ func RunTunnelTest(t *testing.T, tunnelType string, newWorkerNodeTunneler, newPo
 		gatewayAddr         = gatewayIP + "/24"
 		workerPrimaryAddr   = "10.10.0.1/16"
 		workerSecondaryAddr = "192.168.0.1/24"
+		bandwidth           = 8 * 1000 * 1000
+		transferSize        = 2 * 1000 * 1000
 	)
 
 	pods := []*testPod{
@@ -133,12 +136,19 @@ func RunTunnelTest(t *testing.T, tunnelType string, newWorkerNodeTunneler, newPo
 			PodHwAddr:     pod.podHwAddr,
 			Routes:        []*tunneler.Route{{GW: netip.MustParseAddr("10.128.0.1")}},
 			InterfaceName: "eth0",
-			MTU:           1500,
+			MTU:           1450,
+			UnderlayMTU:   1500,
 			TunnelType:    tunnelType,
 			Dedicated:     dedicated,
 			Index:         i,
 		}
 
+		// Limit bandwidth of the first pod only
+		if i == 0 {
+			pod.config.IngressBandwidth = bandwidth
+			pod.config.EgressBandwidth = bandwidth
+		}
+
 		if tunnelType == "vxlan" {
 			pod.config.VXLANPort = 4789     // vxlan.DefaultVXLANPort
 			pod.config.VXLANID = 555000 + i // vxlan.DefaultVXLANMinID + index
@@ -162,6 +172,15 @@ func RunTunnelTest(t *testing.T, tunnelType string, newWorkerNodeTunneler, newPo
 			t.Fatalf("Expect no error, got %v", err)
 		}
 
+		for _, podNodeIP := range podNodeIPs {
+			if err := workerNS.ProbeMTU(podNodeIP, pod.config.UnderlayMTU, 3*time.Second); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			if err := workerNS.ProbeMTU(podNodeIP, pod.config.UnderlayMTU+1, 3*time.Second); err == nil {
+				t.Fatalf("Expect an error on a packet larger than the underlay MTU, got no error")
+			}
+		}
+
 		go func() {
 			if err := pod.podNodeNS.Run(func() error {
 				httpServer := http.Server{
@@ -192,6 +211,61 @@ func RunTunnelTest(t *testing.T, tunnelType string, newWorkerNodeTunneler, newPo
 		ConnectToHTTPServer(t, pod.podNS, netip.AddrPortFrom(getIP(t, pods[(i+1)%len(pods)].podAddr), 8080), netip.AddrPortFrom(getIP(t, pod.podAddr), 0))
 	}
 
+	for i, pod := range pods {
+		podAddrPort := netip.AddrPortFrom(getIP(t, pod.podAddr), 8081)
+		gatewayAddrPort := netip.AddrPortFrom(getIP(t, gatewayAddr), 8081)
+
+		ingress := MeasureTransferRate(t, workerNS, pod.podNS, podAddrPort, transferSize)
+		egress := MeasureTransferRate(t, pod.podNS, workerNS, gatewayAddrPort, transferSize)
+		t.Logf("pod %d: ingress %d bps, egress %d bps", i, ingress, egress)
+
+		if pod.config.IngressBandwidth == 0 {
+			if ingress < 2*bandwidth || egress < 2*bandwidth {
+				t.Fatalf("Expect unlimited bandwidth, got ingress %d bps and egress %d bps", ingress, egress)
+			}
+			continue
+		}
+		for _, rate := range []uint64{ingress, egress} {
+			if rate > bandwidth*5/4 || rate < bandwidth/4 {
+				t.Fatalf("Expect bandwidth close to %d bps, got %d bps", bandwidth, rate)
+			}
+		}
+	}
+
+	for i, pod := range pods {
+
+		workerNodeStats, ok := pod.workerNodeTunneler.(tunneler.StatsReader)
+		if !ok {
+			break
+		}
+		podNodeStats, ok := pod.podNodeTunneler.(tunneler.StatsReader)
+		if !ok {
+			break
+		}
+
+		var workerStats, podStats *tunneler.Stats
+		if err := workerNS.Run(func() (err error) {
+			workerStats, err = workerNodeStats.Stats(pod.workerPodNS.Path(), pod.config)
+			return err
+		}); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if err := pod.podNodeNS.Run(func() (err error) {
+			podStats, err = podNodeStats.Stats(pod.podNS.Path(), pod.config)
+			return err
+		}); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		t.Logf("pod %d: worker node %s %#v, pod node %s %#v", i, workerStats.Interface, workerStats.LinkStatistics, podStats.Interface, podStats.LinkStatistics)
+
+		// Both ends have carried at least one ingress and one egress transfer
+		for _, stats := range []*tunneler.Stats{workerStats, podStats} {
+			if stats.RxBytes < transferSize || stats.TxBytes < transferSize {
+				t.Fatalf("Expect at least %d bytes received and transmitted on %s, got %d and %d", transferSize, stats.Interface, stats.RxBytes, stats.TxBytes)
+			}
+		}
+	}
+
 	for _, pod := range pods {
 
 		if err := workerNS.Run(func() error {
@@ -276,3 +276,62 @@ func ConnectToHTTPServer(t *testing.T, ns netops.Namespace, addr, localAddr neti
 		t.Fatalf("failed to run a HTTP client at a network namespace: %v", err)
 	}
 }
+
+// MeasureTransferRate sends size bytes over a TCP connection from srcNS to dst in dstNS, and returns the transfer rate in bits per second
+func MeasureTransferRate(t *testing.T, srcNS, dstNS netops.Namespace, dst netip.AddrPort, size int) uint64 {
+	t.Helper()
+
+	var listener net.Listener
+	if err := dstNS.Run(func() error {
+		var err error
+		listener, err = net.ListenTCP("tcp", net.TCPAddrFromAddrPort(dst))
+		return err
+	}); err != nil {
+		t.Fatalf("failed to listen on %s at %s: %v", dst, dstNS.Path(), err)
+	}
+	defer listener.Close()
+
+	type result struct {
+		n        int64
+		received time.Time
+		err      error
+	}
+	resultCh := make(chan result, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		n, err := io.Copy(io.Discard, conn)
+		resultCh <- result{n: n, received: time.Now(), err: err}
+	}()
+
+	var conn net.Conn
+	if err := srcNS.Run(func() error {
+		var err error
+		conn, err = net.DialTimeout("tcp", dst.String(), 5*time.Second)
+		return err
+	}); err != nil {
+		t.Fatalf("failed to connect to %s from %s: %v", dst, srcNS.Path(), err)
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, size)); err != nil {
+		conn.Close()
+		t.Fatalf("failed to send data to %s from %s: %v", dst, srcNS.Path(), err)
+	}
+	conn.Close()
+
+	r := <-resultCh
+	if r.err != nil {
+		t.Fatalf("failed to receive data at %s on %s: %v", dst, dstNS.Path(), r.err)
+	}
+	if r.n != int64(size) {
+		t.Fatalf("expect %d bytes to be received at %s, got %d", size, dst, r.n)
+	}
+
+	return uint64(float64(size*8) / r.received.Sub(start).Seconds())
+}
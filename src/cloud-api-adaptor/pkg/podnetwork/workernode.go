@@ -18,6 +18,8 @@ type WorkerNode interface {
 	Inspect(nsPath string) (*tunneler.Config, error)
 	Setup(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) error
 	Teardown(nsPath string, config *tunneler.Config) error
+	Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error)
+	Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error)
 }
 
 type workerNode struct {
@@ -45,6 +47,12 @@ func (p *podIndex) Get() int {
 
 func NewWorkerNode(networkConfig *tunneler.NetworkConfig) (WorkerNode, error) {
 
+	if networkConfig.FirewallBackend != "" {
+		if err := netops.SetFirewallBackend(netops.FirewallBackend(networkConfig.FirewallBackend)); err != nil {
+			return nil, err
+		}
+	}
+
 	t, err := tunneler.WorkerNodeTunneler(networkConfig.TunnelType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tunneler: %w", err)
@@ -97,6 +105,15 @@ func (n *workerNode) Inspect(nsPath string) (*tunneler.Config, error) {
 		return nil, fmt.Errorf("failed to find host interface %q on netns %s: %w", hostInterface, hostNS.Path(), err)
 	}
 
+	hostMTU, err := hostLink.GetMTU()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MTU size of %s: %w", hostInterface, err)
+	}
+	config.UnderlayMTU = hostMTU
+	if n.MTU.Underlay > 0 && n.MTU.Underlay < hostMTU {
+		config.UnderlayMTU = n.MTU.Underlay
+	}
+
 	addrs, err := hostLink.GetAddr()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get IP address on %s (netns: %s): %w", hostInterface, hostNS.Path(), err)
@@ -212,6 +229,39 @@ func (n *workerNode) Setup(nsPath string, podNodeIPs []netip.Addr, config *tunne
 	return nil
 }
 
+// Reconcile verifies the tunnel state of a pod set up by Setup, and re-applies missing state.
+// It returns descriptions of repaired state.
+func (n *workerNode) Reconcile(nsPath string, podNodeIPs []netip.Addr, config *tunneler.Config) ([]string, error) {
+
+	r, ok := n.tunneler.(tunneler.Reconciler)
+	if !ok {
+		return nil, nil
+	}
+
+	repaired, err := r.Reconcile(nsPath, podNodeIPs, config)
+	if err != nil {
+		return repaired, fmt.Errorf("failed to reconcile tunnel %q: %w", config.TunnelType, err)
+	}
+
+	return repaired, nil
+}
+
+// Stats returns traffic counters of the tunnel interface of a pod set up by Setup
+func (n *workerNode) Stats(nsPath string, config *tunneler.Config) (*tunneler.Stats, error) {
+
+	r, ok := n.tunneler.(tunneler.StatsReader)
+	if !ok {
+		return nil, fmt.Errorf("tunnel %q does not support traffic statistics", config.TunnelType)
+	}
+
+	stats, err := r.Stats(nsPath, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic statistics of tunnel %q: %w", config.TunnelType, err)
+	}
+
+	return stats, nil
+}
+
 func (n *workerNode) Teardown(nsPath string, config *tunneler.Config) error {
 
 	hostNS, err := netops.OpenCurrentNamespace()
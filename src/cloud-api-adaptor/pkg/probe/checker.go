@@ -21,10 +21,11 @@ type Checker struct {
 	Clientset        kubernetes.Interface
 	RuntimeclassName string
 	SocketPath       string
+	NodeName         string
 }
 
 func (c *Checker) GetNodeName() string {
-	return os.Getenv("NODE_NAME")
+	return c.NodeName
 }
 
 func (c *Checker) GetAllPods(selector string) (result *corev1.PodList, err error) {
@@ -0,0 +1,102 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/containerd/ttrpc"
+	pbHypervisor "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Check is a named check of the readiness or liveness of cloud-api-adaptor
+type Check interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewCheck returns a check calling fn
+func NewCheck(name string, fn func(ctx context.Context) error) Check {
+	return &check{name: name, fn: fn}
+}
+
+func (c *check) Name() string {
+	return c.name
+}
+
+func (c *check) Check(ctx context.Context) error {
+	return c.fn(ctx)
+}
+
+type cachedCheck struct {
+	check     Check
+	ttl       time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	lastCheck time.Time
+	lastErr   error
+}
+
+// NewCachedCheck returns a check reusing the result of an expensive check for ttl
+func NewCachedCheck(check Check, ttl time.Duration) Check {
+	return &cachedCheck{check: check, ttl: ttl, now: time.Now}
+}
+
+func (c *cachedCheck) Name() string {
+	return c.check.Name()
+}
+
+func (c *cachedCheck) Check(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if !c.lastCheck.IsZero() && now.Sub(c.lastCheck) < c.ttl {
+		return c.lastErr
+	}
+	err := c.check.Check(ctx)
+	if ctx.Err() != nil {
+		// A check cancelled by the probe timeout is not cached
+		return err
+	}
+	c.lastCheck, c.lastErr = now, err
+	return err
+}
+
+// TtrpcCheck checks that the hypervisor service of cloud-api-adaptor responds on socketPath
+func TtrpcCheck(socketPath string) Check {
+	return NewCheck("ttrpc", func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", socketPath)
+		if err != nil {
+			return err
+		}
+		client := ttrpc.NewClient(conn)
+		defer client.Close()
+
+		if _, err := pbHypervisor.NewHypervisorClient(client).Version(ctx, &pbHypervisor.VersionRequest{}); err != nil {
+			return fmt.Errorf("hypervisor service did not respond: %w", err)
+		}
+		return nil
+	})
+}
+
+// KubernetesCheck checks that the Kubernetes API server is accessible by getting the node of cloud-api-adaptor
+func KubernetesCheck(clientset kubernetes.Interface, nodeName string) Check {
+	return NewCheck("kubernetes", func(ctx context.Context) error {
+		_, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		return err
+	})
+}
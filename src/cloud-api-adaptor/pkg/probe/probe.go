@@ -4,21 +4,74 @@
 package probe
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var logger = log.New(log.Writer(), "[probe/probe] ", log.LstdFlags|log.Lmsgprefix)
-var podsReadizProbesDone bool
-var checker Checker
-var startTime time.Time
 
 const DEFAULT_CC_RUNTIMECLASS_NAME string = "kata-remote"
 
-func StartupHandler(w http.ResponseWriter, r *http.Request) {
-	opened, err := checker.IsSocketOpen()
+// DefaultCheckTimeout limits the time each check of a readiness or liveness probe may take
+const DefaultCheckTimeout = 5 * time.Second
+
+// CheckResult is the result of a check in the response of a readiness or liveness probe
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Response is the JSON response of a readiness or liveness probe
+type Response struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+// Server serves the startup, readiness and liveness probes of cloud-api-adaptor
+type Server struct {
+	checker      *Checker
+	startTime    time.Time
+	readiness    []Check
+	liveness     []Check
+	checkTimeout time.Duration
+	// podsReady is set once all the peer pods on the node were ready after the start
+	podsReady bool
+	mutex     sync.Mutex
+}
+
+// NewServer returns a probe server. The startup probe and the ttrpc check use checker, and
+// the Kubernetes check uses the clientset of checker if it is set. The liveness probe only checks
+// the ttrpc server, and the readiness probe additionally runs the given readiness checks.
+func NewServer(checker *Checker, readiness ...Check) *Server {
+	liveness := []Check{TtrpcCheck(checker.SocketPath)}
+	readiness = append(append([]Check{}, liveness...), readiness...)
+	if checker.Clientset != nil {
+		readiness = append(readiness, KubernetesCheck(checker.Clientset, checker.NodeName))
+	}
+	return &Server{
+		checker:      checker,
+		startTime:    time.Now(),
+		readiness:    readiness,
+		liveness:     liveness,
+		checkTimeout: DefaultCheckTimeout,
+	}
+}
+
+func (s *Server) StartupHandler(w http.ResponseWriter, r *http.Request) {
+	opened, err := s.checker.IsSocketOpen()
 	if err != nil {
 		logger.Printf("UDS not opened, because %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -30,10 +83,12 @@ func StartupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !podsReadizProbesDone {
-		ret, err := checker.GetAllPeerPods(startTime)
-		podsReadizProbesDone = ret
-		if err != nil || !podsReadizProbesDone {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.podsReady {
+		ret, err := s.checker.GetAllPeerPods(s.startTime)
+		s.podsReady = ret
+		if err != nil || !s.podsReady {
 			logger.Printf("Not all PeerPods ready, because %s", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -43,28 +98,88 @@ func StartupHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func Start(socketPath string) {
-	startTime = time.Now()
+// ReadyzHandler responds with the results of the readiness checks
+func (s *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	s.serveChecks(w, r, s.readiness)
+}
+
+// LivezHandler responds with the results of the liveness checks
+func (s *Server) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	s.serveChecks(w, r, s.liveness)
+}
 
+func (s *Server) serveChecks(w http.ResponseWriter, r *http.Request, checks []Check) {
+	res := s.runChecks(r.Context(), checks)
+
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Printf("failed to write probe response: %v", err)
+	}
+}
+
+// runChecks runs checks concurrently, and fails if any of them fails
+func (s *Server) runChecks(ctx context.Context, checks []Check) *Response {
+	ctx, cancel := context.WithTimeout(ctx, s.checkTimeout)
+	defer cancel()
+
+	res := &Response{Status: statusOK, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			res.Checks[i] = CheckResult{Name: check.Name(), Status: statusOK}
+			if err := check.Check(ctx); err != nil {
+				res.Checks[i].Status = statusFailed
+				res.Checks[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range res.Checks {
+		if result.Status != statusOK {
+			logger.Printf("%s check failed: %s", result.Name, result.Error)
+			res.Status = statusFailed
+		}
+	}
+	return res
+}
+
+// Handler returns the handler of the probe and metrics endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/startup", s.StartupHandler)
+	mux.HandleFunc("/readyz", s.ReadyzHandler)
+	mux.HandleFunc("/livez", s.LivezHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// Start serves the probes of the hypervisor service on socketPath, with additional readiness checks
+func Start(socketPath string, readiness ...Check) {
 	port := os.Getenv("PROBE_PORT")
 	if port == "" {
 		port = "8000"
 	}
 	logger.Printf("Using port: %s", port)
-	podsReadizProbesDone = false
 
 	clientset, err := CreateClientset()
 	if err != nil {
 		logger.Printf("failed to CreateClientset, error %s", err)
 		return
 	}
-	checker = Checker{
+	s := NewServer(&Checker{
 		Clientset:        clientset,
 		RuntimeclassName: GetRuntimeclassName(),
 		SocketPath:       socketPath,
-	}
-	http.HandleFunc("/startup", StartupHandler)
-	err = http.ListenAndServe(":"+port, nil)
+		NodeName:         os.Getenv("NODE_NAME"),
+	}, readiness...)
+
+	err = http.ListenAndServe(":"+port, s.Handler())
 
 	if err != nil {
 		logger.Printf("failed to start startup probe server, error %s", err)
@@ -4,14 +4,19 @@
 package probe
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/containerd/ttrpc"
+	pbHypervisor "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	fakecorev1 "k8s.io/client-go/kubernetes/typed/core/v1/fake"
@@ -70,25 +75,26 @@ func getFakeClientSetWithParas(podnamePrefix, namespace, nodeName, runtimeClass
 }
 
 func Test_GetRuntimeclassName_Default(t *testing.T) {
-	os.Setenv("RUNTIMECLASS_NAME", "")
+	t.Setenv("RUNTIMECLASS_NAME", "")
 	ret := GetRuntimeclassName()
 	assert.Equal(t, ret, DEFAULT_CC_RUNTIMECLASS_NAME)
 }
 
 func Test_GetRuntimeclassName_Env(t *testing.T) {
-	os.Setenv("RUNTIMECLASS_NAME", "runtimeclass-customized")
+	t.Setenv("RUNTIMECLASS_NAME", "runtimeclass-customized")
 	ret := GetRuntimeclassName()
 	assert.Equal(t, ret, "runtimeclass-customized")
 }
 
 func Test_GetAllPeerPods_BeTrue(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionTrue, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       "",
+		NodeName:         "node-name-1",
 	}
 	result, err := checker.GetAllPeerPods(timeStart)
 
@@ -96,10 +102,11 @@ func Test_GetAllPeerPods_BeTrue(t *testing.T) {
 	assert.True(t, result)
 
 	clientset = getFakeClientSetWithParas("pod", "default", "node-name-1", "", corev1.ConditionTrue, timeAfter)
-	checker = Checker{
+	checker = &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       "",
+		NodeName:         "node-name-1",
 	}
 	result, err = checker.GetAllPeerPods(timeStart)
 
@@ -108,13 +115,14 @@ func Test_GetAllPeerPods_BeTrue(t *testing.T) {
 }
 
 func Test_GetAllPeerPods_BeFalse(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionFalse, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       "",
+		NodeName:         "node-name-1",
 	}
 	result, err := checker.GetAllPeerPods(timeStart)
 
@@ -123,13 +131,14 @@ func Test_GetAllPeerPods_BeFalse(t *testing.T) {
 }
 
 func Test_GetAllPeerPods_BeFalse_time_before(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionTrue, timeBefore)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       "",
+		NodeName:         "node-name-1",
 	}
 	result, err := checker.GetAllPeerPods(timeStart)
 
@@ -138,13 +147,14 @@ func Test_GetAllPeerPods_BeFalse_time_before(t *testing.T) {
 }
 
 func Test_GetAllPeerPods_BeError(t *testing.T) {
-	os.Setenv("NODE_NAME", "")
+	t.Parallel()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionFalse, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       "",
+		NodeName:         "",
 	}
 	result, err := checker.GetAllPeerPods(timeStart)
 
@@ -153,14 +163,16 @@ func Test_GetAllPeerPods_BeError(t *testing.T) {
 }
 
 func Test_IsSocketOpen_BeOpen(t *testing.T) {
-	socketPath := "/tmp/caa-probe-test-socket.sock"
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
 	socket, err := net.Listen("unix", socketPath)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer socket.Close()
 
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        nil,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
@@ -174,8 +186,10 @@ func Test_IsSocketOpen_BeOpen(t *testing.T) {
 }
 
 func Test_IsSocketOpen_BeNotOpen(t *testing.T) {
-	socketPath := "/tmp/caa-probe-test-socket.sock"
-	checker = Checker{
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
+	checker := &Checker{
 		Clientset:        nil,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
@@ -187,9 +201,9 @@ func Test_IsSocketOpen_BeNotOpen(t *testing.T) {
 }
 
 func Test_StartupHandler_BeReady(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
-	socketPath := "/tmp/caa-probe-test-socket.sock"
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
 	socket, err := net.Listen("unix", socketPath)
 	if err != nil {
 		t.Fatal(err)
@@ -197,10 +211,11 @@ func Test_StartupHandler_BeReady(t *testing.T) {
 	defer socket.Close()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionFalse, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
+		NodeName:         "node-name-1",
 	}
 
 	req, err := http.NewRequest("GET", "/startup", nil)
@@ -208,17 +223,19 @@ func Test_StartupHandler_BeReady(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	podsReadizProbesDone = true
+	s := NewServer(checker)
+	s.startTime = timeStart
+	s.podsReady = true
 	rr := httptest.NewRecorder()
-	http.HandlerFunc(StartupHandler).ServeHTTP(rr, req)
+	http.HandlerFunc(s.StartupHandler).ServeHTTP(rr, req)
 
 	assert.Equal(t, rr.Code, http.StatusOK)
 }
 
 func Test_StartupHandler_NotBeAllPodsReady(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
-	socketPath := "/tmp/caa-probe-test-socket.sock"
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
 	socket, err := net.Listen("unix", socketPath)
 	if err != nil {
 		t.Fatal(err)
@@ -226,10 +243,11 @@ func Test_StartupHandler_NotBeAllPodsReady(t *testing.T) {
 	defer socket.Close()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionFalse, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
+		NodeName:         "node-name-1",
 	}
 
 	req, err := http.NewRequest("GET", "/startup", nil)
@@ -237,17 +255,18 @@ func Test_StartupHandler_NotBeAllPodsReady(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	podsReadizProbesDone = false
+	s := NewServer(checker)
+	s.startTime = timeStart
 	rr := httptest.NewRecorder()
-	http.HandlerFunc(StartupHandler).ServeHTTP(rr, req)
+	http.HandlerFunc(s.StartupHandler).ServeHTTP(rr, req)
 
 	assert.Equal(t, rr.Code, http.StatusInternalServerError)
 }
 
 func Test_StartupHandler_BeAllPodsReady(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
-	socketPath := "/tmp/caa-probe-test-socket.sock"
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
 	socket, err := net.Listen("unix", socketPath)
 	if err != nil {
 		t.Fatal(err)
@@ -255,10 +274,11 @@ func Test_StartupHandler_BeAllPodsReady(t *testing.T) {
 	defer socket.Close()
 
 	clientset := getFakeClientSetWithParas("pod", "default", "node-name-1", DEFAULT_CC_RUNTIMECLASS_NAME, corev1.ConditionTrue, timeAfter)
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
+		NodeName:         "node-name-1",
 	}
 
 	req, err := http.NewRequest("GET", "/startup", nil)
@@ -266,17 +286,18 @@ func Test_StartupHandler_BeAllPodsReady(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	podsReadizProbesDone = false
+	s := NewServer(checker)
+	s.startTime = timeStart
 	rr := httptest.NewRecorder()
-	http.HandlerFunc(StartupHandler).ServeHTTP(rr, req)
+	http.HandlerFunc(s.StartupHandler).ServeHTTP(rr, req)
 
 	assert.Equal(t, rr.Code, http.StatusOK)
 }
 
 func Test_StartupHandler_BeErrorListPods(t *testing.T) {
-	os.Setenv("NODE_NAME", "node-name-1")
+	t.Parallel()
 
-	socketPath := "/tmp/caa-probe-test-socket.sock"
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
 	socket, err := net.Listen("unix", socketPath)
 	if err != nil {
 		t.Fatal(err)
@@ -288,10 +309,11 @@ func Test_StartupHandler_BeErrorListPods(t *testing.T) {
 		return true, nil, errors.New("Error creating secret")
 	})
 
-	checker = Checker{
+	checker := &Checker{
 		Clientset:        clientset,
 		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
 		SocketPath:       socketPath,
+		NodeName:         "node-name-1",
 	}
 
 	req, err := http.NewRequest("GET", "/startup", nil)
@@ -299,9 +321,178 @@ func Test_StartupHandler_BeErrorListPods(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	podsReadizProbesDone = false
+	s := NewServer(checker)
+	s.startTime = timeStart
 	rr := httptest.NewRecorder()
-	http.HandlerFunc(StartupHandler).ServeHTTP(rr, req)
+	http.HandlerFunc(s.StartupHandler).ServeHTTP(rr, req)
 
 	assert.Equal(t, rr.Code, http.StatusInternalServerError)
 }
+
+type mockHypervisorService struct {
+	pbHypervisor.HypervisorService
+}
+
+func (s *mockHypervisorService) Version(ctx context.Context, req *pbHypervisor.VersionRequest) (*pbHypervisor.VersionResponse, error) {
+	return &pbHypervisor.VersionResponse{Version: "test"}, nil
+}
+
+// startTtrpcServer starts a hypervisor service on a unix socket
+func startTtrpcServer(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "caa.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ttrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pbHypervisor.RegisterHypervisorService(server, &mockHypervisorService{})
+	go func() {
+		_ = server.Serve(context.Background(), listener)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return socketPath
+}
+
+func getProbeResponse(t *testing.T, handler http.HandlerFunc, path string) (int, *Response) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var res Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, &res
+}
+
+func Test_ReadyzHandler(t *testing.T) {
+	t.Parallel()
+
+	checker := &Checker{
+		Clientset:        fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-name-1"}}),
+		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
+		SocketPath:       startTtrpcServer(t),
+		NodeName:         "node-name-1",
+	}
+
+	s := NewServer(checker, NewCheck("provider", func(ctx context.Context) error { return nil }))
+	code, res := getProbeResponse(t, s.ReadyzHandler, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, &Response{
+		Status: "ok",
+		Checks: []CheckResult{
+			{Name: "ttrpc", Status: "ok"},
+			{Name: "provider", Status: "ok"},
+			{Name: "kubernetes", Status: "ok"},
+		},
+	}, res)
+
+	s = NewServer(checker, NewCheck("provider", func(ctx context.Context) error { return errors.New("unreachable") }))
+	code, res = getProbeResponse(t, s.ReadyzHandler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "failed", res.Status)
+	assert.Equal(t, CheckResult{Name: "provider", Status: "failed", Error: "unreachable"}, res.Checks[1])
+}
+
+func Test_ReadyzHandler_Timeout(t *testing.T) {
+	t.Parallel()
+
+	checker := &Checker{
+		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
+		SocketPath:       startTtrpcServer(t),
+	}
+	s := NewServer(checker, NewCheck("kbs", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	s.checkTimeout = 10 * time.Millisecond
+
+	code, res := getProbeResponse(t, s.ReadyzHandler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []CheckResult{
+		{Name: "ttrpc", Status: "ok"},
+		{Name: "kbs", Status: "failed", Error: context.DeadlineExceeded.Error()},
+	}, res.Checks)
+}
+
+func Test_LivezHandler(t *testing.T) {
+	t.Parallel()
+
+	// The liveness probe does not run readiness checks
+	checker := &Checker{
+		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
+		SocketPath:       startTtrpcServer(t),
+	}
+	s := NewServer(checker, NewCheck("provider", func(ctx context.Context) error { return errors.New("unreachable") }))
+	code, res := getProbeResponse(t, s.LivezHandler, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []CheckResult{{Name: "ttrpc", Status: "ok"}}, res.Checks)
+
+	checker = &Checker{
+		RuntimeclassName: DEFAULT_CC_RUNTIMECLASS_NAME,
+		SocketPath:       filepath.Join(t.TempDir(), "caa.sock"),
+	}
+	s = NewServer(checker)
+	code, res = getProbeResponse(t, s.LivezHandler, "/livez")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "failed", res.Checks[0].Status)
+	assert.NotEmpty(t, res.Checks[0].Error)
+}
+
+func Test_KubernetesCheck_BeError(t *testing.T) {
+	t.Parallel()
+
+	clientset := fake.NewSimpleClientset()
+	clientset.CoreV1().(*fakecorev1.FakeCoreV1).PrependReactor("get", "nodes", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	err := KubernetesCheck(clientset, "node-name-1").Check(context.Background())
+	assert.EqualError(t, err, "connection refused")
+}
+
+func Test_CachedCheck(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	checkErr := errors.New("unreachable")
+	now := timeStart
+	c := NewCachedCheck(NewCheck("provider", func(ctx context.Context) error {
+		calls++
+		return checkErr
+	}), time.Minute).(*cachedCheck)
+	c.now = func() time.Time { return now }
+
+	assert.Equal(t, "provider", c.Name())
+	assert.Equal(t, checkErr, c.Check(context.Background()))
+	assert.Equal(t, 1, calls)
+
+	// The result is reused within the ttl
+	now = now.Add(30 * time.Second)
+	checkErr = nil
+	assert.Error(t, c.Check(context.Background()))
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, c.Check(context.Background()))
+	assert.Equal(t, 2, calls)
+
+	// A cancelled check is not cached
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	now = now.Add(time.Minute)
+	checkErr = context.Canceled
+	assert.Error(t, c.Check(ctx))
+	checkErr = nil
+	assert.NoError(t, c.Check(context.Background()))
+	assert.Equal(t, 4, calls)
+}
@@ -2,6 +2,7 @@ package kubemgr
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"flag"
@@ -12,6 +13,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 	"golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
@@ -26,6 +28,14 @@ var KubeMgr *KubeMgrStruct
 
 const (
 	cocoNamespace = "confidential-containers-system"
+
+	// PodSecretLabel marks a secret holding the keys of a pod
+	PodSecretLabel = "confidentialcontainers.org/pod-secret"
+	// PodUIDLabel holds the UID of the pod of a pod secret
+	PodUIDLabel = "confidentialcontainers.org/pod-uid"
+	// PodNameAnnotation and PodNamespaceAnnotation identify the pod of a pod secret
+	PodNameAnnotation      = "confidentialcontainers.org/pod-name"
+	PodNamespaceAnnotation = "confidentialcontainers.org/pod-namespace"
 )
 
 type KubeMgrStruct struct {
@@ -35,6 +45,16 @@ type KubeMgrStruct struct {
 
 var SkipVerify bool
 
+// KeyType is the type of the keys generated for a secret
+type KeyType int
+
+const (
+	// RSAKeys are 4096 bits RSA keys
+	RSAKeys KeyType = iota
+	// Ed25519Keys are Ed25519 keys, as preferred by the QUIC transport
+	Ed25519Keys
+)
+
 func getKubeConfigInVitro() (*rest.Config, error) {
 	var kubeCfg *rest.Config
 	var err error
@@ -139,30 +159,89 @@ func (kubeMgr *KubeMgrStruct) DeleteSecret(secretName string) {
 	logger.Printf("DeleteSecret '%s'", secretName)
 }
 
-func (kubeMgr *KubeMgrStruct) CreateSecret(secretName string) (privateKey []byte, publicKey []byte, err error) {
+func generateKeys(keyType KeyType) (privateKey []byte, publicKey []byte, err error) {
+	if keyType == Ed25519Keys {
+		return generateEd25519Keys()
+	}
+
 	bitSize := 4096
 	clientPrivateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CreateSecret rsa.GenerateKey err: %w", err)
+		return nil, nil, fmt.Errorf("rsa.GenerateKey err: %w", err)
 	}
 
 	// Validate Private Key
 	err = clientPrivateKey.Validate()
 	if err != nil {
-		return nil, nil, fmt.Errorf("CreateSecret clientPrivateKey.Validate err: %w", err)
+		return nil, nil, fmt.Errorf("clientPrivateKey.Validate err: %w", err)
 	}
 
 	clientPublicKey, err := ssh.NewPublicKey(&clientPrivateKey.PublicKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CreateSecret ssh.NewPublicKey err: %w", err)
+		return nil, nil, fmt.Errorf("ssh.NewPublicKey err: %w", err)
 	}
 
 	publicKey = ssh.MarshalAuthorizedKey(clientPublicKey)
 
 	privateKey = sshutil.RsaPrivateKeyPEM(clientPrivateKey)
+	return
+}
 
-	secrets := kubeMgr.Client.CoreV1().Secrets(kubeMgr.CocoNamespace)
+func generateEd25519Keys() (privateKey []byte, publicKey []byte, err error) {
+	clientPublicKey, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ed25519.GenerateKey err: %w", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ssh.NewPublicKey err: %w", err)
+	}
+
+	publicKey = ssh.MarshalAuthorizedKey(sshPublicKey)
+
+	privateKey, err = sshutil.Ed25519PrivateKeyPEM(clientPrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Ed25519PrivateKeyPEM err: %w", err)
+	}
+	return
+}
+
+func (kubeMgr *KubeMgrStruct) CreateSecret(secretName string, keyType KeyType) (privateKey []byte, publicKey []byte, err error) {
+	return kubeMgr.createSecret(secretName, corev1.Secret{}, keyType)
+}
+
+// CreatePodSecret creates a secret holding the keys of a pod
+// The secret records the pod, such that SweepPodSecrets deletes it once the pod no longer exists.
+// Kubernetes does not allow owner references across namespaces, hence the pod is set as the owner of the secret
+// only when the pod is in the namespace of the secret.
+func (kubeMgr *KubeMgrStruct) CreatePodSecret(secretName, podName, podNamespace string, keyType KeyType) (privateKey []byte, publicKey []byte, err error) {
 	s := corev1.Secret{}
+	s.Labels = map[string]string{PodSecretLabel: "true"}
+	s.Annotations = map[string]string{
+		PodNameAnnotation:      podName,
+		PodNamespaceAnnotation: podNamespace,
+	}
+
+	pod, err := kubeMgr.Client.CoreV1().Pods(podNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if err != nil {
+		logger.Printf("CreatePodSecret '%s' failed to get pod %s/%s: %v", secretName, podNamespace, podName, err)
+	} else {
+		s.Labels[PodUIDLabel] = string(pod.UID)
+		if podNamespace == kubeMgr.CocoNamespace {
+			s.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(pod, corev1.SchemeGroupVersion.WithKind("Pod"))}
+		}
+	}
+	return kubeMgr.createSecret(secretName, s, keyType)
+}
+
+func (kubeMgr *KubeMgrStruct) createSecret(secretName string, s corev1.Secret, keyType KeyType) (privateKey []byte, publicKey []byte, err error) {
+	privateKey, publicKey, err = generateKeys(keyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CreateSecret %w", err)
+	}
+
+	secrets := kubeMgr.Client.CoreV1().Secrets(kubeMgr.CocoNamespace)
 	s.Name = secretName
 	s.Namespace = kubeMgr.CocoNamespace
 	s.Data = map[string][]byte{}
@@ -176,3 +255,63 @@ func (kubeMgr *KubeMgrStruct) CreateSecret(secretName string) (privateKey []byte
 	logger.Printf("CreateSecret '%s'", secretName)
 	return
 }
+
+// RotateSecret replaces the keys of an existing secret with newly generated keys
+func (kubeMgr *KubeMgrStruct) RotateSecret(secretName string, keyType KeyType) (privateKey []byte, publicKey []byte, err error) {
+	secrets := kubeMgr.Client.CoreV1().Secrets(kubeMgr.CocoNamespace)
+	s, err := secrets.Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("RotateSecret secrets.Get err: %w", err)
+	}
+
+	privateKey, publicKey, err = generateKeys(keyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("RotateSecret %w", err)
+	}
+
+	s.Data = map[string][]byte{}
+	s.Data["privateKey"] = privateKey
+	s.Data["publicKey"] = publicKey
+
+	_, err = secrets.Update(context.Background(), s, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("RotateSecret secrets.Update err: %w", err)
+	}
+	logger.Printf("RotateSecret '%s'", secretName)
+	return
+}
+
+// SweepPodSecrets deletes the pod secrets of pods which no longer exist, and returns the names of the deleted secrets
+func (kubeMgr *KubeMgrStruct) SweepPodSecrets() (deleted []string, err error) {
+	secrets := kubeMgr.Client.CoreV1().Secrets(kubeMgr.CocoNamespace)
+	list, err := secrets.List(context.Background(), metav1.ListOptions{LabelSelector: PodSecretLabel + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("SweepPodSecrets secrets.List err: %w", err)
+	}
+
+	for _, s := range list.Items {
+		podName := s.Annotations[PodNameAnnotation]
+		podNamespace := s.Annotations[PodNamespaceAnnotation]
+		if podName == "" || podNamespace == "" {
+			continue
+		}
+
+		pod, err := kubeMgr.Client.CoreV1().Pods(podNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Printf("SweepPodSecrets failed to get pod %s/%s of secret '%s': %v", podNamespace, podName, s.Name, err)
+			continue
+		}
+		// A pod recreated with the same name is a different pod
+		if err == nil && (s.Labels[PodUIDLabel] == "" || s.Labels[PodUIDLabel] == string(pod.UID)) {
+			continue
+		}
+
+		if err := secrets.Delete(context.Background(), s.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			logger.Printf("SweepPodSecrets failed to delete secret '%s': %v", s.Name, err)
+			continue
+		}
+		logger.Printf("SweepPodSecrets deleted secret '%s' of pod %s/%s", s.Name, podNamespace, podName)
+		deleted = append(deleted, s.Name)
+	}
+	return deleted, nil
+}
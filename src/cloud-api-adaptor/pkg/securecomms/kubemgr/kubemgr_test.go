@@ -1,14 +1,20 @@
 package kubemgr
 
 import (
+	"context"
 	"slices"
 	"testing"
+
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func TestSecrets(t *testing.T) {
 	InitKubeMgrMock()
 
-	privateKey1, publicKey1, err1 := KubeMgr.CreateSecret("XYZ")
+	privateKey1, publicKey1, err1 := KubeMgr.CreateSecret("XYZ", RSAKeys)
 	if err1 != nil {
 		t.Error(err1)
 	}
@@ -32,3 +38,110 @@ func TestSecrets(t *testing.T) {
 		t.Error("privateKey not equal")
 	}
 }
+
+func TestRotateSecret(t *testing.T) {
+	InitKubeMgrMock()
+
+	if _, _, err := KubeMgr.RotateSecret("XYZ", RSAKeys); err == nil {
+		t.Error("Expected error")
+	}
+
+	privateKey1, publicKey1, err := KubeMgr.CreateSecret("XYZ", RSAKeys)
+	if err != nil {
+		t.Error(err)
+	}
+
+	privateKey2, publicKey2, err := KubeMgr.RotateSecret("XYZ", Ed25519Keys)
+	if err != nil {
+		t.Error(err)
+	}
+
+	privateKey3, publicKey3, err := KubeMgr.ReadSecret("XYZ")
+	if err != nil {
+		t.Error(err)
+	}
+
+	KubeMgr.DeleteSecret("XYZ")
+
+	if slices.Equal(publicKey1, publicKey2) || slices.Equal(privateKey1, privateKey2) {
+		t.Error("keys not rotated")
+	}
+	if !slices.Equal(publicKey2, publicKey3) {
+		t.Error("publicKey not equal")
+	}
+	if !slices.Equal(privateKey2, privateKey3) {
+		t.Error("privateKey not equal")
+	}
+	if publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey3); err != nil || publicKey.Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("Expect an Ed25519 key, got %v", err)
+	}
+}
+
+func createPod(t *testing.T, name, namespace, uid string) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(uid)}}
+	if _, err := KubeMgr.Client.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deletePod(t *testing.T, name, namespace string) {
+	if err := KubeMgr.Client.CoreV1().Pods(namespace).Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepPodSecrets(t *testing.T) {
+	InitKubeMgrMock()
+
+	createPod(t, "alive", "default", "uid-alive")
+	createPod(t, "gone", "default", "uid-gone")
+	createPod(t, "recreated", "default", "uid-old")
+	createPod(t, "local", cocoNamespace, "uid-local")
+
+	for _, pod := range []struct{ secret, name, namespace string }{
+		{"pp-alive", "alive", "default"},
+		{"pp-gone", "gone", "default"},
+		{"pp-recreated", "recreated", "default"},
+		{"pp-local", "local", cocoNamespace},
+	} {
+		if _, _, err := KubeMgr.CreatePodSecret(pod.secret, pod.name, pod.namespace, RSAKeys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := KubeMgr.CreateSecret("XYZ", RSAKeys); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := KubeMgr.Client.CoreV1().Secrets(cocoNamespace).Get(context.Background(), "pp-alive", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Labels[PodUIDLabel] != "uid-alive" || len(secret.OwnerReferences) != 0 {
+		t.Errorf("Expect pod UID label and no owner reference across namespaces, got %v %v", secret.Labels, secret.OwnerReferences)
+	}
+	secret, err = KubeMgr.Client.CoreV1().Secrets(cocoNamespace).Get(context.Background(), "pp-local", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != "uid-local" {
+		t.Errorf("Expect pod owner reference, got %v", secret.OwnerReferences)
+	}
+
+	deletePod(t, "gone", "default")
+	deletePod(t, "recreated", "default")
+	createPod(t, "recreated", "default", "uid-new")
+
+	deleted, err := KubeMgr.SweepPodSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(deleted)
+	if !slices.Equal(deleted, []string{"pp-gone", "pp-recreated"}) {
+		t.Errorf("Expect pp-gone and pp-recreated deleted, got %v", deleted)
+	}
+	for _, name := range []string{"pp-alive", "pp-local", "XYZ"} {
+		if _, _, err := KubeMgr.ReadSecret(name); err != nil {
+			t.Errorf("Expect secret %s to be kept, got %v", name, err)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package ppssh
 
 import (
+	"sync"
 	"time"
 )
 
 type PpSecrets struct {
 	secrets   map[string][]byte
 	getSecret GetSecret
+	mutex     sync.Mutex
 }
 
 type GetSecret func(name string) ([]byte, error)
@@ -19,6 +21,8 @@ func NewPpSecrets(getSecret GetSecret) *PpSecrets {
 }
 
 func (sec *PpSecrets) AddKey(key string) {
+	sec.mutex.Lock()
+	defer sec.mutex.Unlock()
 	if _, ok := sec.secrets[key]; ok {
 		return
 	}
@@ -26,41 +30,67 @@ func (sec *PpSecrets) AddKey(key string) {
 }
 
 func (sec *PpSecrets) GetKey(key string) []byte {
+	sec.mutex.Lock()
+	defer sec.mutex.Unlock()
 	return sec.secrets[key]
 }
 
 func (sec *PpSecrets) SetKey(key string, keydata []byte) {
+	sec.mutex.Lock()
+	defer sec.mutex.Unlock()
 	sec.secrets[key] = keydata
 }
 
+// Refresh obtains all keys again
+// The current keys are kept until they are replaced
+func (sec *PpSecrets) Refresh() {
+	for _, key := range sec.keys(true) {
+		sec.SetKey(key, sec.obtain(key))
+	}
+}
+
+// Go obtains the keys which were not obtained yet
 func (sec *PpSecrets) Go() {
-	sleeptime := time.Duration(1)
+	for _, key := range sec.keys(false) {
+		sec.SetKey(key, sec.obtain(key))
+	}
+}
+
+// keys returns the names of the keys, or only of the keys which were not obtained yet
+func (sec *PpSecrets) keys(all bool) []string {
+	sec.mutex.Lock()
+	defer sec.mutex.Unlock()
 
+	var keys []string
 	for key, keydata := range sec.secrets {
-		if keydata != nil {
-			continue
+		if all || keydata == nil {
+			keys = append(keys, key)
 		}
-		logger.Printf("PpSecrets obtaining key %s", key)
+	}
+	return keys
+}
+
+// obtain loops until it gets a valid key
+func (sec *PpSecrets) obtain(key string) []byte {
+	sleeptime := time.Duration(1)
 
-		// loop until we get a valid key
-		for {
-			keydata, err := sec.getSecret(key)
-			if err == nil && len(keydata) > 0 {
-				logger.Printf("PpSecrets %s success", key)
-				sec.secrets[key] = keydata
-				break
-			}
-			if err != nil {
-				logger.Printf("PpSecrets %s getSecret err: %v", key, err)
-			} else {
-				logger.Printf("PpSecrets %s getSecret returned an empty secret", key)
-			}
+	logger.Printf("PpSecrets obtaining key %s", key)
+	for {
+		keydata, err := sec.getSecret(key)
+		if err == nil && len(keydata) > 0 {
+			logger.Printf("PpSecrets %s success", key)
+			return keydata
+		}
+		if err != nil {
+			logger.Printf("PpSecrets %s getSecret err: %v", key, err)
+		} else {
+			logger.Printf("PpSecrets %s getSecret returned an empty secret", key)
+		}
 
-			time.Sleep(sleeptime * time.Second)
-			sleeptime *= 2
-			if sleeptime > 30 {
-				sleeptime = 30
-			}
+		time.Sleep(sleeptime * time.Second)
+		sleeptime *= 2
+		if sleeptime > 30 {
+			sleeptime = 30
 		}
 	}
 }
@@ -3,16 +3,20 @@ package ppssh
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"sync"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
+	"github.com/quic-go/quic-go"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -32,8 +36,19 @@ type SshServer struct {
 	readyCh   chan struct{}
 	ppSecrets *PpSecrets
 	sshport   string
+	transport string
 	listener  net.Listener
-	ctx       context.Context
+	// quicListener replaces listener when the transport is QUIC
+	quicListener *quic.EarlyListener
+	ctx          context.Context
+	mutex        sync.Mutex
+	rotating     sync.Mutex
+	// kubernetesPhaseConfig is replaced when the keys are rotated
+	kubernetesPhaseConfig *ssh.ServerConfig
+	// kubernetesPhaseTLSConfig replaces kubernetesPhaseConfig when the transport is QUIC
+	kubernetesPhaseTLSConfig *tls.Config
+	// peer is the current Kubernetes phase peer
+	peer *sshproxy.SshPeer
 }
 
 // NewSshServer initializes an SSH Server at the PP
@@ -46,6 +61,7 @@ func NewSshServer(inbound_strings, outbounds_strings []string, ppSecrets *PpSecr
 	s := &SshServer{
 		ppSecrets: ppSecrets,
 		sshport:   sshport,
+		transport: sshproxy.SSH,
 		readyCh:   make(chan struct{}),
 	}
 	logger.Printf("Using PP SecureComms: InitSshServer version %s", sshutil.PpSecureCommsVersion)
@@ -63,35 +79,199 @@ func (s *SshServer) Ready() chan struct{} {
 	return s.readyCh
 }
 
-func (s *SshServer) kubernetesPhase(kubernetesPhaseConfig *ssh.ServerConfig) {
-	ctx, cancel := context.WithCancel(s.ctx)
-	defer cancel()
+// SetTransport sets the transport of client connections, either sshproxy.SSH or sshproxy.QUIC
+// The transport must be set before the server starts.
+func (s *SshServer) SetTransport(transport string) {
+	s.transport = transport
+}
 
-	var peer *sshproxy.SshPeer
-	for peer == nil && (ctx.Err() == nil) {
-		logger.Printf("Kubernetes phase: waiting for client to connect\n")
-		nConn, err := s.listener.Accept()
+func (s *SshServer) getKubernetesPhaseConfig() *ssh.ServerConfig {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.kubernetesPhaseConfig
+}
+
+func (s *SshServer) setKubernetesPhaseConfig(config *ssh.ServerConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.kubernetesPhaseConfig = config
+}
+
+func (s *SshServer) getKubernetesPhaseTLSConfig() *tls.Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.kubernetesPhaseTLSConfig
+}
+
+// initKubernetesPhaseConfig sets the Kubernetes phase configuration of the transport using the current keys
+func (s *SshServer) initKubernetesPhaseConfig() error {
+	if s.transport == sshproxy.QUIC {
+		config, err := initKubernetesPhaseTLSConfig(s.ppSecrets)
 		if err != nil {
-			logger.Fatal("failed to accept incoming connection (Kubernetes phase): ", err)
+			return err
 		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.kubernetesPhaseTLSConfig = config
+		return nil
+	}
+
+	config, err := initKubernetesPhaseSshConfig(s.ppSecrets)
+	if err != nil {
+		return err
+	}
+	s.setKubernetesPhaseConfig(config)
+	return nil
+}
+
+// quicTLSConfig selects the TLS configuration of a connecting QUIC client by the phase of the server
+func (s *SshServer) quicTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	if config := s.getKubernetesPhaseTLSConfig(); config != nil {
+		return config, nil
+	}
+	return initAttestationPhaseTLSConfig()
+}
+
+// acceptQuic accepts a QUIC client, and connects it as a peer of phase once the client is authenticated
+// Data sent by a resuming client ahead of the handshake is served only once the handshake completes.
+func (s *SshServer) acceptQuic(ctx context.Context, phase string) (*sshproxy.SshPeer, error) {
+	conn, err := s.quicListener.Accept(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		logger.Fatalf("%s phase: failed to accept incoming connection: %v", phase, err)
+	}
+	logger.Printf("%s phase: client connected\n", phase)
+
+	select {
+	case <-conn.HandshakeComplete():
+	case <-ctx.Done():
+	}
+	if err := conn.Context().Err(); err != nil {
+		return nil, fmt.Errorf("%s phase: failed to handshake: %v", phase, context.Cause(conn.Context()))
+	}
+	if ctx.Err() != nil {
+		_ = conn.CloseWithError(0, "closed")
+		return nil, ctx.Err()
+	}
+
+	state := conn.ConnectionState()
+	if key, err := ssh.NewPublicKey(state.TLS.PeerCertificates[0].PublicKey); err == nil {
+		logger.Printf("%s phase: logged-in with key %s (resumed %v)", phase, ssh.FingerprintSHA256(key), state.TLS.DidResume)
+	}
+
+	peer := sshproxy.NewQuicPeer(ctx, phase, conn, "")
+	if peer == nil {
+		return nil, fmt.Errorf("failed to connect to a quic peer")
+	}
+	return peer, nil
+}
+
+func (s *SshServer) acceptKubernetesPeer(ctx context.Context) (*sshproxy.SshPeer, error) {
+	if s.transport == sshproxy.QUIC {
+		return s.acceptQuic(ctx, sshproxy.KUBERNETES)
+	}
+
+	nConn, err := s.listener.Accept()
+	if err != nil {
+		logger.Fatal("failed to accept incoming connection (Kubernetes phase): ", err)
+	}
+
+	logger.Printf("Kubernetes client connected\n")
+	return kubernetesSShService(ctx, nConn, s.getKubernetesPhaseConfig())
+}
+
+func (s *SshServer) acceptAttestationPeer(ctx context.Context) (*sshproxy.SshPeer, error) {
+	if s.transport == sshproxy.QUIC {
+		return s.acceptQuic(ctx, sshproxy.ATTESTATION)
+	}
+
+	nConn, err := s.listener.Accept()
+	if err != nil {
+		logger.Fatal("Attestation phase: failed to accept incoming connection: ", err)
+	}
+
+	logger.Printf("Attestation phase: client connected\n")
+	return attestationSShService(ctx, nConn)
+}
+
+// kubernetesPhase accepts clients until ctx is done
+// A newly connected client replaces the current one, which is drained to keep its open tunnels alive
+func (s *SshServer) kubernetesPhase() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
 
-		logger.Printf("Kubernetes client connected\n")
-		peer, err = kubernetesSShService(ctx, nConn, kubernetesPhaseConfig)
+	for ctx.Err() == nil {
+		logger.Printf("Kubernetes phase: waiting for client to connect\n")
+		peer, err := s.acceptKubernetesPeer(ctx)
 		if err != nil {
 			logger.Printf("Retrying after Kubernetes phase failed with: %s", err)
-			peer = nil
 			continue
 		}
 
+		peer.HandleRequest(sshproxy.ROTATE, s.rotateKeys)
+		peer.HandleRequest(sshproxy.TUNNELS, s.updateTunnels)
+
+		s.mutex.Lock()
 		peer.AddTags(s.inbounds, s.outbounds)
 		peer.Ready()
+		current := s.peer
+		s.peer = peer
+		s.mutex.Unlock()
 
-		peer.Wait()
-		logger.Printf("KubernetesSShService exiting")
+		if current != nil {
+			current.Drain()
+		}
 	}
 }
 
-func (s *SshServer) attestationPhase() *ssh.ServerConfig {
+// updateTunnels adds and removes tunnels when the client requests it
+// The tunnels are kept for clients connecting later on
+func (s *SshServer) updateTunnels(payload []byte) error {
+	var tunnels sshproxy.Tunnels
+	if err := ssh.Unmarshal(payload, &tunnels); err != nil {
+		return fmt.Errorf("updateTunnels failed to parse payload: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := tunnels.Apply(&s.inbounds, &s.outbounds, nil, &s.wg, s.peer); err != nil {
+		return err
+	}
+	logger.Printf("Kubernetes phase: tunnels updated - added inbounds %v outbounds %v removed %v\n", tunnels.Inbounds, tunnels.Outbounds, tunnels.Remove)
+	return nil
+}
+
+// rotateKeys replaces the Kubernetes phase keys when the client requests a key rotation
+// The new keys are delivered in the payload, or else obtained from KBS
+// Clients connecting after the rotation must use the new keys
+func (s *SshServer) rotateKeys(payload []byte) error {
+	s.rotating.Lock()
+	defer s.rotating.Unlock()
+
+	if len(payload) > 0 {
+		var keys sshproxy.RotateKeys
+		if err := ssh.Unmarshal(payload, &keys); err != nil {
+			return fmt.Errorf("rotateKeys failed to parse payload: %w", err)
+		}
+		s.ppSecrets.SetKey(PP_PRIVATE_KEY, keys.PpPrivateKey)
+		s.ppSecrets.SetKey(WN_PUBLIC_KEY, keys.WnPublicKey)
+	} else {
+		logger.Printf("Kubernetes phase: getting rotated keys from KBS\n")
+		s.ppSecrets.Refresh()
+	}
+
+	if err := s.initKubernetesPhaseConfig(); err != nil {
+		return err
+	}
+	logger.Printf("Kubernetes phase: keys rotated\n")
+	return nil
+}
+
+// attestationPhase serves a single attestation phase client, and reports whether the client was upgraded to the Kubernetes phase
+// The Kubernetes phase configuration is set before upgrading, such that the client may reconnect right away.
+func (s *SshServer) attestationPhase() bool {
 	// Singleton - accept an unproven connection for attestation
 	ctx, cancel := context.WithCancel(s.ctx)
 	defer cancel()
@@ -99,14 +279,8 @@ func (s *SshServer) attestationPhase() *ssh.ServerConfig {
 	var peer *sshproxy.SshPeer
 	for (peer == nil) && (ctx.Err() == nil) {
 		logger.Printf("Attestation phase: waiting for client to connect\n")
-		nConn, err := s.listener.Accept()
-		if err != nil {
-			logger.Fatal("Attestation phase: failed to accept incoming connection: ", err)
-		}
-
-		logger.Printf("Attestation phase: client connected\n")
-
-		peer, err = attestationSShService(ctx, nConn)
+		var err error
+		peer, err = s.acceptAttestationPeer(ctx)
 		if err != nil {
 			logger.Print(err.Error())
 			peer = nil
@@ -120,37 +294,41 @@ func (s *SshServer) attestationPhase() *ssh.ServerConfig {
 	for ctx.Err() == nil {
 		logger.Printf("Attestation phase: getting keys from KBS\n")
 		s.ppSecrets.Go() // wait for the keys
-		config, err := initKubernetesPhaseSshConfig(s.ppSecrets)
+		err := s.initKubernetesPhaseConfig()
 		if err == nil {
 			logger.Printf("Attestation phase: InitKubernetesPhaseSshConfig is ready\n")
 			peer.Upgrade()
-			return config
+			return true
 		}
 		logger.Printf("Attestation phase: failed getting keys from KBS: %v\n", err)
 	}
-	return nil
+	return false
 }
 
 func (s *SshServer) Start(ctx context.Context) error {
 	var err error
 
-	logger.Printf("SSH service starting on port: %s", s.sshport)
+	logger.Printf("SSH service starting on port: %s (transport %s)", s.sshport, s.transport)
 	s.ctx = ctx
-	s.listener, err = net.Listen("tcp", "0.0.0.0:"+s.sshport)
+	var listener io.Closer
+	if s.transport == sshproxy.QUIC {
+		s.quicListener, err = quic.ListenAddrEarly("0.0.0.0:"+s.sshport, &tls.Config{GetConfigForClient: s.quicTLSConfig}, sshproxy.QuicConfig())
+		listener = s.quicListener
+	} else {
+		s.listener, err = net.Listen("tcp", "0.0.0.0:"+s.sshport)
+		listener = s.listener
+	}
 	if err != nil {
 		logger.Fatal("Failed to listen for connection: ", err)
 	}
 	close(s.readyCh) // notify systemd that the service is ready
 
 	go func() {
-		kubernetesPhaseConfig := s.attestationPhase()
-		if kubernetesPhaseConfig == nil {
+		if !s.attestationPhase() {
 			logger.Fatal("Attestation phase failed")
 		}
-		for ctx.Err() == nil {
-			s.kubernetesPhase(kubernetesPhaseConfig)
-		}
-		s.listener.Close()
+		s.kubernetesPhase()
+		listener.Close()
 	}()
 	return nil
 }
@@ -243,6 +421,43 @@ func initAttestationPhaseSshConfig() (*ssh.ServerConfig, error) {
 	return config, nil
 }
 
+// initAttestationPhaseTLSConfig creates a TLS configuration using an ephemeral Ed25519 key
+// The client is authenticated by the unproven WN public key if one was provided.
+func initAttestationPhaseTLSConfig() (*tls.Config, error) {
+	_, ppPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("attestation phase: failed to generate key: %w", err)
+	}
+	ppPrivateKeyBytes, err := sshutil.Ed25519PrivateKeyPEM(ppPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("attestation phase: failed to encode key: %w", err)
+	}
+
+	var tePublicKey ssh.PublicKey
+	if tePublicKeyBytes, err := os.ReadFile(UNPROVEN_WN_PUBLIC_KEY_PATH); err == nil {
+		if tePublicKey, _, _, _, err = ssh.ParseAuthorizedKey(tePublicKeyBytes); err != nil {
+			return nil, fmt.Errorf("unable to parse public key: %w", err)
+		}
+	} else {
+		logger.Printf("Attestation phase: QUIC server initialized without client key")
+	}
+	return sshproxy.QuicTLSConfig(ppPrivateKeyBytes, tePublicKey)
+}
+
+func initKubernetesPhaseTLSConfig(ppSecrets *PpSecrets) (*tls.Config, error) {
+	ppPrivateKeyBytes := ppSecrets.GetKey(PP_PRIVATE_KEY)
+	wnPublicKeyBytes := ppSecrets.GetKey(WN_PUBLIC_KEY)
+
+	if len(ppPrivateKeyBytes) == 0 || len(wnPublicKeyBytes) == 0 {
+		return nil, fmt.Errorf("kubernetes phase: missing QUIC server key") // should never happen
+	}
+	wnPublicKey, _, _, _, err := ssh.ParseAuthorizedKey(wnPublicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %w", err)
+	}
+	return sshproxy.QuicTLSConfig(ppPrivateKeyBytes, wnPublicKey)
+}
+
 func initKubernetesPhaseSshConfig(ppSecrets *PpSecrets) (*ssh.ServerConfig, error) {
 	config := &ssh.ServerConfig{}
 
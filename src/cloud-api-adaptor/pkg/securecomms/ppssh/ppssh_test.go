@@ -14,6 +14,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -238,3 +239,29 @@ func TestPpssh(t *testing.T) {
 	conn.Close()
 	cancel()
 }
+
+func TestPpSecretsRefresh(t *testing.T) {
+	var version atomic.Int32
+	ppSecrets := NewPpSecrets(func(name string) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s-%d", name, version.Load())), nil
+	})
+	ppSecrets.AddKey(PP_PRIVATE_KEY)
+	ppSecrets.Go()
+	if e, a := PP_PRIVATE_KEY+"-0", string(ppSecrets.GetKey(PP_PRIVATE_KEY)); e != a {
+		t.Fatalf("Expect %s, got %s", e, a)
+	}
+
+	version.Store(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ppSecrets.Refresh()
+	}()
+	// The current key remains readable while the keys are refreshed
+	for key := ppSecrets.GetKey(PP_PRIVATE_KEY); string(key) != PP_PRIVATE_KEY+"-1"; key = ppSecrets.GetKey(PP_PRIVATE_KEY) {
+		if key == nil {
+			t.Fatal("Expect a key during refresh, got nil")
+		}
+	}
+	<-done
+}
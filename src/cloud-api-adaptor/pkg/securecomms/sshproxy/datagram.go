@@ -0,0 +1,280 @@
+package sshproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxDatagram is the size of the largest UDP datagram carried by a tunnel
+	maxDatagram = 65535
+	// udpIdleTimeout closes the tunnel channel of a UDP client once no datagrams were exchanged for a while
+	udpIdleTimeout = 2 * time.Minute
+	// udpQueueSize is the number of datagrams queued per UDP client before datagrams are dropped
+	udpQueueSize = 64
+	// udpAcceptQueueSize is the number of new UDP clients queued for Accept before new clients are dropped
+	udpAcceptQueueSize = 16
+)
+
+// datagramStream carries datagrams over the byte stream of an SSH channel
+// Each datagram is framed by a 2 bytes big endian length followed by the datagram.
+type datagramStream struct {
+	readDatagram  func(p []byte) (int, error)
+	writeDatagram func(p []byte) error
+	buf           []byte // a datagram framed for reading
+	out           []byte // part of buf not yet read
+	in            []byte // written bytes not yet forming a complete datagram
+}
+
+func newDatagramStream(readDatagram func(p []byte) (int, error), writeDatagram func(p []byte) error) datagramStream {
+	return datagramStream{
+		readDatagram:  readDatagram,
+		writeDatagram: writeDatagram,
+		buf:           make([]byte, 2+maxDatagram),
+	}
+}
+
+// Read returns the next framed datagram
+func (s *datagramStream) Read(p []byte) (int, error) {
+	if len(s.out) == 0 {
+		n, err := s.readDatagram(s.buf[2:])
+		if err != nil {
+			return 0, err
+		}
+		binary.BigEndian.PutUint16(s.buf, uint16(n))
+		s.out = s.buf[:2+n]
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// Write sends every complete framed datagram in p, and keeps the rest until the following writes complete it
+func (s *datagramStream) Write(p []byte) (int, error) {
+	s.in = append(s.in, p...)
+	off := 0
+	for len(s.in)-off >= 2 {
+		size := int(binary.BigEndian.Uint16(s.in[off:]))
+		if len(s.in)-off < 2+size {
+			break
+		}
+		if err := s.writeDatagram(s.in[off+2 : off+2+size]); err != nil {
+			return 0, err
+		}
+		off += 2 + size
+	}
+	s.in = s.in[:copy(s.in, s.in[off:])]
+	return len(p), nil
+}
+
+// datagramConn frames the datagrams of a connected UDP socket at the outbound side of a tunnel
+type datagramConn struct {
+	datagramStream
+	conn net.Conn
+}
+
+func newDatagramConn(conn net.Conn) *datagramConn {
+	c := &datagramConn{conn: conn}
+	c.datagramStream = newDatagramStream(c.readDatagram, c.writeDatagram)
+	return c
+}
+
+func (c *datagramConn) readDatagram(p []byte) (int, error) {
+	for {
+		n, err := c.conn.Read(p)
+		// The server port may be unreachable for a while, as with any UDP service
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *datagramConn) writeDatagram(p []byte) error {
+	if _, err := c.conn.Write(p); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return nil
+}
+
+func (c *datagramConn) Close() error {
+	return c.conn.Close()
+}
+
+// udpListener accepts a udpSession for each UDP client sending datagrams to the inbound side of a tunnel
+type udpListener struct {
+	conn      *net.UDPConn
+	sessions  map[string]*udpSession
+	accepted  chan *udpSession
+	closed    chan bool
+	closeOnce sync.Once
+	mutex     sync.Mutex
+}
+
+func newUdpListener(conn *net.UDPConn, wg *sync.WaitGroup) *udpListener {
+	l := &udpListener{
+		conn:     conn,
+		sessions: make(map[string]*udpSession),
+		accepted: make(chan *udpSession, udpAcceptQueueSize),
+		closed:   make(chan bool),
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer l.Close()
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			s, isNew := l.session(addr)
+			// New clients are queued without waiting for Accept, such that the datagrams of other clients keep flowing
+			if isNew {
+				select {
+				case l.accepted <- s:
+				default:
+					logger.Printf("udpListener %s dropped new client %s - too many clients waiting to be accepted", conn.LocalAddr(), addr)
+					s.Close()
+					continue
+				}
+			}
+			select {
+			case s.datagrams <- append([]byte(nil), buf[:n]...):
+			default:
+				logger.Printf("udpListener %s dropped a datagram from %s", conn.LocalAddr(), addr)
+			}
+		}
+	}()
+	return l
+}
+
+func (l *udpListener) session(addr *net.UDPAddr) (s *udpSession, isNew bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if s = l.sessions[addr.String()]; s != nil {
+		return s, false
+	}
+	s = &udpSession{
+		listener:  l,
+		addr:      addr,
+		datagrams: make(chan []byte, udpQueueSize),
+		closed:    make(chan bool),
+	}
+	s.datagramStream = newDatagramStream(s.readDatagram, s.writeDatagram)
+	s.touch()
+	l.sessions[addr.String()] = s
+	return s, true
+}
+
+// Accept waits for the next UDP client
+func (l *udpListener) Accept() (net.Conn, error) {
+	select {
+	case s := <-l.accepted:
+		return s, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *udpListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close stops listening and closes the sessions of all UDP clients
+func (l *udpListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.conn.Close()
+		l.mutex.Lock()
+		sessions := l.sessions
+		l.sessions = map[string]*udpSession{}
+		l.mutex.Unlock()
+		for _, s := range sessions {
+			s.Close()
+		}
+	})
+	return err
+}
+
+// udpSession is a UDP client of the inbound side of a tunnel, carried by a single tunnel channel
+type udpSession struct {
+	datagramStream
+	listener   *udpListener
+	addr       *net.UDPAddr
+	datagrams  chan []byte
+	closed     chan bool
+	closeOnce  sync.Once
+	lastActive atomic.Int64
+}
+
+func (s *udpSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (s *udpSession) readDatagram(p []byte) (int, error) {
+	timer := time.NewTimer(udpIdleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case datagram := <-s.datagrams:
+			s.touch()
+			return copy(p, datagram), nil
+		case <-s.closed:
+			return 0, io.EOF
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, s.lastActive.Load()))
+			if idle < udpIdleTimeout {
+				timer.Reset(udpIdleTimeout - idle)
+				continue
+			}
+			logger.Printf("udpSession %s idle - closing", s.addr)
+			return 0, io.EOF
+		}
+	}
+}
+
+func (s *udpSession) writeDatagram(p []byte) error {
+	s.touch()
+	_, err := s.listener.conn.WriteToUDP(p, s.addr)
+	return err
+}
+
+func (s *udpSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.listener.mutex.Lock()
+		defer s.listener.mutex.Unlock()
+		if s.listener.sessions[s.addr.String()] == s {
+			delete(s.listener.sessions, s.addr.String())
+		}
+	})
+	return nil
+}
+
+func (s *udpSession) LocalAddr() net.Addr {
+	return s.listener.conn.LocalAddr()
+}
+
+func (s *udpSession) RemoteAddr() net.Addr {
+	return s.addr
+}
+
+func (s *udpSession) SetDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (s *udpSession) SetReadDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (s *udpSession) SetWriteDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
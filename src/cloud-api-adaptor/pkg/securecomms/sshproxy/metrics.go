@@ -0,0 +1,253 @@
+package sshproxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	metricsNamespace = "secure_comms"
+
+	// minRateBurst is the smallest burst of a rate limited tunnel, such that reads and writes are not split to tiny pieces
+	minRateBurst = 4096
+	// maxPriorityWait limits the time a channel waits for writes of priority channels, in case the priority peer is not reading
+	maxPriorityWait = 100 * time.Millisecond
+)
+
+var tunnelLabels = []string{"tunnel", "phase"}
+
+var (
+	tunnelConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_connections_total",
+		Help:      "Number of connections carried by a secure comms tunnel",
+	}, tunnelLabels)
+
+	tunnelActiveConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_active_connections",
+		Help:      "Number of open connections carried by a secure comms tunnel",
+	}, tunnelLabels)
+
+	tunnelSentBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_sent_bytes_total",
+		Help:      "Number of bytes sent to the peer over a secure comms tunnel",
+	}, tunnelLabels)
+
+	tunnelReceivedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_received_bytes_total",
+		Help:      "Number of bytes received from the peer over a secure comms tunnel",
+	}, tunnelLabels)
+
+	tunnelThrottledSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_throttled_seconds_total",
+		Help:      "Time connections of a secure comms tunnel waited for the rate limit of the tunnel",
+	}, tunnelLabels)
+)
+
+// RegisterMetrics registers the secure comms tunnel metrics
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(tunnelConnections, tunnelActiveConnections, tunnelSentBytes, tunnelReceivedBytes, tunnelThrottledSeconds)
+}
+
+// RateLimits maps tunnel names to the maximum rate of the tunnel in bytes per second
+type RateLimits map[string]int64
+
+// ParseRateLimits parses comma separated rate limits structured as <Name>:<Rate>
+// Rate is a quantity of bytes per second, such as 500Ki or 10M.
+// The KATAAGENT tunnel cannot be rate limited, as it has priority over other tunnels.
+func ParseRateLimits(s string) (RateLimits, error) {
+	limits := RateLimits{}
+	for _, limit := range strings.Split(s, ",") {
+		limit = strings.TrimSpace(limit)
+		if limit == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(limit, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("illegal rate limit: %s", limit)
+		}
+		if name == sshutil.KATAAGENT {
+			return nil, fmt.Errorf("tunnel %s cannot be rate limited", name)
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("illegal rate limit '%s' - err: %v", limit, err)
+		}
+		if quantity.Value() <= 0 {
+			return nil, fmt.Errorf("illegal rate limit '%s' - rate must be positive", limit)
+		}
+		limits[name] = quantity.Value()
+	}
+	return limits, nil
+}
+
+// SetRateLimits limits the rate of tunnels of the peer
+// Each limit is shared by the connections of a tunnel, and applies to the bytes sent and received together.
+// Limiting the bytes read from a channel also limits the peer sending them, by SSH flow control.
+func (peer *SshPeer) SetRateLimits(limits RateLimits) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	peer.limiters = make(map[string]*rate.Limiter)
+	for name, limit := range limits {
+		peer.limiters[name] = rate.NewLimiter(rate.Limit(limit), max(int(limit), minRateBurst))
+	}
+}
+
+func (peer *SshPeer) limiter(name string) *rate.Limiter {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	return peer.limiters[name]
+}
+
+// priorityGate lets writes of priority channels go ahead of writes of other channels
+type priorityGate struct {
+	pending int
+	idle    chan bool
+	mutex   sync.Mutex
+}
+
+func (g *priorityGate) begin() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.pending == 0 {
+		g.idle = make(chan bool)
+	}
+	g.pending++
+}
+
+func (g *priorityGate) end() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.pending--
+	if g.pending == 0 {
+		close(g.idle)
+	}
+}
+
+// wait waits until no priority writes are pending, up to maxPriorityWait
+func (g *priorityGate) wait(done chan bool) {
+	g.mutex.Lock()
+	if g.pending == 0 {
+		g.mutex.Unlock()
+		return
+	}
+	idle := g.idle
+	g.mutex.Unlock()
+
+	timer := time.NewTimer(maxPriorityWait)
+	defer timer.Stop()
+	select {
+	case <-idle:
+	case <-timer.C:
+	case <-done:
+	}
+}
+
+// meteredChannel counts the bytes of a tunnel channel, and enforces the rate limit and priority of the tunnel
+type meteredChannel struct {
+	ssh.Channel
+	peer      *SshPeer
+	limiter   *rate.Limiter
+	priority  bool
+	sent      prometheus.Counter
+	received  prometheus.Counter
+	throttled prometheus.Counter
+	labels    prometheus.Labels
+}
+
+// meterChannel wraps a tunnel channel of the tunnel named name
+func (peer *SshPeer) meterChannel(name string, ch ssh.Channel) *meteredChannel {
+	labels := prometheus.Labels{"tunnel": name, "phase": peer.phase}
+	tunnelConnections.With(labels).Inc()
+	tunnelActiveConnections.With(labels).Inc()
+	return &meteredChannel{
+		Channel:   ch,
+		peer:      peer,
+		limiter:   peer.limiter(name),
+		priority:  name == sshutil.KATAAGENT,
+		sent:      tunnelSentBytes.With(labels),
+		received:  tunnelReceivedBytes.With(labels),
+		throttled: tunnelThrottledSeconds.With(labels),
+		labels:    labels,
+	}
+}
+
+// wait waits for the rate limit of the tunnel to allow n bytes
+func (c *meteredChannel) wait(n int) error {
+	if c.limiter == nil {
+		return nil
+	}
+	r := c.limiter.ReserveN(time.Now(), n)
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	c.throttled.Add(delay.Seconds())
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.peer.done:
+		r.Cancel()
+		return fmt.Errorf("tunnel %s closed while rate limited", c.labels["tunnel"])
+	}
+}
+
+func (c *meteredChannel) Read(p []byte) (int, error) {
+	if c.limiter != nil {
+		p = p[:min(len(p), c.limiter.Burst())]
+	}
+	n, err := c.Channel.Read(p)
+	c.received.Add(float64(n))
+	if waitErr := c.wait(n); err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+func (c *meteredChannel) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if c.limiter != nil {
+			chunk = p[:min(len(p), c.limiter.Burst())]
+		}
+		if err := c.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		if c.priority {
+			c.peer.priority.begin()
+		} else {
+			c.peer.priority.wait(c.peer.done)
+		}
+		n, err := c.Channel.Write(chunk)
+		if c.priority {
+			c.peer.priority.end()
+		}
+		c.sent.Add(float64(n))
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// closed is called once the channel is closed
+func (c *meteredChannel) closed() {
+	tunnelActiveConnections.With(c.labels).Dec()
+}
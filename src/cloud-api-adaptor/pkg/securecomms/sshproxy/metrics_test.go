@@ -0,0 +1,144 @@
+package sshproxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  string
+		want    RateLimits
+		wantErr bool
+	}{
+		{name: "empty", limits: "", want: RateLimits{}},
+		{name: "limits", limits: "DEBUG:1Mi, LOGS:500, ", want: RateLimits{"DEBUG": 1024 * 1024, "LOGS": 500}},
+		{name: "missing rate", limits: "DEBUG", wantErr: true},
+		{name: "illegal rate", limits: "DEBUG:fast", wantErr: true},
+		{name: "zero rate", limits: "DEBUG:0", wantErr: true},
+		{name: "KATAAGENT", limits: "KATAAGENT:1Mi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRateLimits(tt.limits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRateLimits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRateLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSshProxyRateLimit(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clientSshPeer, serverSshPeer := getPeers(t)
+
+	outbounds := Outbounds{}
+	if err := outbounds.AddTags([]string{"ATTESTATION_PHASE:BULK:127.0.0.1:7042"}); err != nil {
+		t.Fatal(err)
+	}
+	inboundPorts := map[string]string{}
+	inbounds := Inbounds{}
+	if err := inbounds.AddTags([]string{"ATTESTATION_PHASE:BULK:7043"}, inboundPorts, &wg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit applies to the bytes sent and received together
+	clientSshPeer.SetRateLimits(RateLimits{"BULK": 64 * 1024})
+	serverSshPeer.AddOutbounds(outbounds)
+	clientSshPeer.AddInbounds(inbounds)
+
+	clientSshPeer.Ready()
+	serverSshPeer.Ready()
+
+	go test.Server("7042")
+	time.Sleep(100 * time.Millisecond)
+
+	labels := prometheus.Labels{"tunnel": "BULK", "phase": ATTESTATION}
+	sentBefore := testutil.ToFloat64(tunnelSentBytes.With(labels))
+	receivedBefore := testutil.ToFloat64(tunnelReceivedBytes.With(labels))
+	connectionsBefore := testutil.ToFloat64(tunnelConnections.With(labels))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:7043")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("x"), 48*1024)
+	start := time.Now()
+	go func() {
+		_, _ = conn.Write(data)
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, len(data))); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+
+	// 96Ki bytes with a burst of 64Ki bytes at 64Ki bytes per second
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expect tunnel to be rate limited, transferred in %s", elapsed)
+	}
+	// Both peers count the data sent and received
+	if sent := testutil.ToFloat64(tunnelSentBytes.With(labels)) - sentBefore; sent != float64(2*len(data)) {
+		t.Errorf("Expect %d bytes sent, got %v", 2*len(data), sent)
+	}
+	if received := testutil.ToFloat64(tunnelReceivedBytes.With(labels)) - receivedBefore; received != float64(2*len(data)) {
+		t.Errorf("Expect %d bytes received, got %v", 2*len(data), received)
+	}
+	if connections := testutil.ToFloat64(tunnelConnections.With(labels)) - connectionsBefore; connections != 2 {
+		t.Errorf("Expect 2 connections, got %v", connections)
+	}
+
+	serverSshPeer.Close("Test Finish")
+	clientSshPeer.Wait()
+	inbounds.DelAll()
+	if active := testutil.ToFloat64(tunnelActiveConnections.With(labels)); active != 0 {
+		t.Errorf("Expect no active connections, got %v", active)
+	}
+}
+
+func TestPriorityGate(t *testing.T) {
+	var g priorityGate
+	done := make(chan bool)
+
+	// No priority writes pending
+	start := time.Now()
+	g.wait(done)
+	if time.Since(start) > maxPriorityWait/2 {
+		t.Error("Expect no wait without priority writes")
+	}
+
+	g.begin()
+	go func() {
+		time.Sleep(maxPriorityWait / 4)
+		g.end()
+	}()
+	start = time.Now()
+	g.wait(done)
+	if elapsed := time.Since(start); elapsed < maxPriorityWait/8 || elapsed >= maxPriorityWait {
+		t.Errorf("Expect to wait for the priority write, waited %s", elapsed)
+	}
+
+	// A priority write which does not complete delays other writes by maxPriorityWait at most
+	g.begin()
+	start = time.Now()
+	g.wait(done)
+	if elapsed := time.Since(start); elapsed < maxPriorityWait || elapsed > 10*maxPriorityWait {
+		t.Errorf("Expect to wait %s, waited %s", maxPriorityWait, elapsed)
+	}
+	g.end()
+}
@@ -0,0 +1,436 @@
+package sshproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Transports of secure comms
+	SSH  = "ssh"
+	QUIC = "quic"
+
+	// QuicALPN is the application protocol negotiated by QUIC peers
+	QuicALPN = "coco-secure-comms"
+
+	// quicMaxStreams is the number of requests and channels a QUIC peer may have open at once
+	quicMaxStreams = 4096
+	// quicHeaderTimeout limits the time to receive the header of a newly opened stream
+	quicHeaderTimeout = 10 * time.Second
+	// maxQuicFrame is the size of the largest header or reply of a stream
+	maxQuicFrame = 1 << 20
+
+	// Kinds of QUIC streams
+	quicRequestStream = "request"
+	quicChannelStream = "channel"
+)
+
+// ParseTransport validates the name of a secure comms transport, where an empty name selects SSH
+func ParseTransport(transport string) (string, error) {
+	switch transport {
+	case "", SSH:
+		return SSH, nil
+	case QUIC:
+		return QUIC, nil
+	}
+	return "", fmt.Errorf("illegal secure comms transport '%s' - use %s or %s", transport, SSH, QUIC)
+}
+
+// QuicConfig returns the QUIC configuration of secure comms peers
+// Keep-alives detect a lost peer quickly, and 0-RTT lets a client reconnect without waiting for a handshake round trip.
+func QuicConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout: 10 * time.Second,
+		MaxIdleTimeout:       30 * time.Second,
+		KeepAlivePeriod:      10 * time.Second,
+		MaxIncomingStreams:   quicMaxStreams,
+		Allow0RTT:            true,
+	}
+}
+
+// QuicTLSConfig returns the mutual TLS configuration of a QUIC peer
+// privateKey is a PEM encoded Ed25519, ECDSA or RSA private key, presented to the peer in a self-signed certificate.
+// The peer is authenticated by pinning its public key peerPublicKey, unless peerPublicKey is nil as in the attestation phase.
+// Each configuration encrypts session tickets using its own key, such that replacing the configuration
+// when keys are rotated invalidates tickets of previous keys.
+func QuicTLSConfig(privateKey []byte, peerPublicKey ssh.PublicKey) (*tls.Config, error) {
+	key, err := ssh.ParseRawPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("QuicTLSConfig unable to parse private key: %w", err)
+	}
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("QuicTLSConfig unsupported private key type %T", key)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "secure-comms"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(100, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("QuicTLSConfig unable to create certificate: %w", err)
+	}
+	var ticketKey [32]byte
+	if _, err := rand.Read(ticketKey[:]); err != nil {
+		return nil, fmt.Errorf("QuicTLSConfig unable to create session ticket key: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: signer}},
+		NextProtos:   []string{QuicALPN},
+		ClientAuth:   tls.RequireAnyClientCert,
+		// Certificates are self-signed - peers are verified by their pinned public keys instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return verifyPeerKey(cs, peerPublicKey)
+		},
+	}
+	config.SetSessionTicketKeys([][32]byte{ticketKey})
+	return config, nil
+}
+
+// verifyPeerKey verifies the public key of the peer certificate, including when a session is resumed
+func verifyPeerKey(cs tls.ConnectionState, peerPublicKey ssh.PublicKey) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("peer presented no certificate")
+	}
+	if peerPublicKey == nil {
+		return nil
+	}
+	key, err := ssh.NewPublicKey(cs.PeerCertificates[0].PublicKey)
+	if err != nil {
+		return fmt.Errorf("unsupported peer key: %w", err)
+	}
+	if !bytes.Equal(key.Marshal(), peerPublicKey.Marshal()) {
+		return fmt.Errorf("peer key mismatch - %s", key.Type())
+	}
+	return nil
+}
+
+// NewQuicPeer creates a peer over a QUIC connection
+// The connection must have completed its handshake, such that the peer is authenticated.
+func NewQuicPeer(ctx context.Context, phase string, conn quic.Connection, sid string) *SshPeer {
+	c := &quicConn{
+		conn:  conn,
+		reqs:  make(chan *Request),
+		chans: make(chan ssh.NewChannel),
+	}
+	peer := newPeer(ctx, phase, c, sid)
+	peer.wg.Add(1)
+	go func() {
+		defer peer.wg.Done()
+		c.serve()
+	}()
+	return peer.start(c.chans, c.reqs)
+}
+
+// quicConn carries the global requests and channels of a peer over a QUIC connection
+// Each request and each channel is a QUIC stream, which starts with a header describing it.
+// The peer replies to the header of a request, or to the header of a channel before the channel data follows.
+type quicConn struct {
+	conn  quic.Connection
+	reqs  chan *Request
+	chans chan ssh.NewChannel
+}
+
+type quicHeader struct {
+	Kind      string
+	Type      string
+	WantReply bool
+	Data      []byte
+}
+
+type quicReply struct {
+	OK      bool
+	Reason  uint32
+	Payload []byte
+}
+
+// writeFrame writes msg preceded by its 4 bytes big endian length
+func writeFrame(w io.Writer, msg any) error {
+	data := ssh.Marshal(msg)
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+func readFrame(r io.Reader, msg any) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxQuicFrame {
+		return fmt.Errorf("frame of %d bytes exceeds %d bytes", n, maxQuicFrame)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return ssh.Unmarshal(data, msg)
+}
+
+func abortStream(stream quic.Stream) {
+	stream.CancelRead(0)
+	stream.CancelWrite(0)
+}
+
+// serve delivers the requests and channels opened by the peer until the connection is closed
+func (c *quicConn) serve() {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		close(c.reqs)
+		close(c.chans)
+	}()
+	for {
+		stream, err := c.conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.handleStream(stream)
+		}()
+	}
+}
+
+func (c *quicConn) handleStream(stream quic.Stream) {
+	var header quicHeader
+	_ = stream.SetReadDeadline(time.Now().Add(quicHeaderTimeout))
+	if err := readFrame(stream, &header); err != nil {
+		logger.Printf("quicConn failed to read stream header: %v", err)
+		abortStream(stream)
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+
+	switch header.Kind {
+	case quicRequestStream:
+		req := &Request{
+			Type:      header.Type,
+			WantReply: header.WantReply,
+			Payload:   header.Data,
+			reply: func(ok bool, payload []byte) error {
+				defer stream.Close()
+				return writeFrame(stream, &quicReply{OK: ok, Payload: payload})
+			},
+		}
+		if !header.WantReply {
+			stream.Close()
+		}
+		select {
+		case c.reqs <- req:
+		case <-c.conn.Context().Done():
+		}
+	case quicChannelStream:
+		ch := &quicNewChannel{stream: stream, channelType: header.Type, extraData: header.Data}
+		select {
+		case c.chans <- ch:
+		case <-c.conn.Context().Done():
+			abortStream(stream)
+		}
+	default:
+		logger.Printf("quicConn rejected stream of unknown kind %s", header.Kind)
+		abortStream(stream)
+	}
+}
+
+func (c *quicConn) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	stream, err := c.conn.OpenStreamSync(c.conn.Context())
+	if err != nil {
+		return false, nil, err
+	}
+	if err := writeFrame(stream, &quicHeader{Kind: quicRequestStream, Type: name, WantReply: wantReply, Data: payload}); err != nil {
+		abortStream(stream)
+		return false, nil, err
+	}
+	stream.Close()
+	if !wantReply {
+		stream.CancelRead(0)
+		return false, nil, nil
+	}
+	var reply quicReply
+	if err := readFrame(stream, &reply); err != nil {
+		stream.CancelRead(0)
+		return false, nil, err
+	}
+	return reply.OK, reply.Payload, nil
+}
+
+func (c *quicConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	stream, err := c.conn.OpenStreamSync(c.conn.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeFrame(stream, &quicHeader{Kind: quicChannelStream, Type: name, Data: data}); err != nil {
+		abortStream(stream)
+		return nil, nil, err
+	}
+	var reply quicReply
+	if err := readFrame(stream, &reply); err != nil {
+		abortStream(stream)
+		return nil, nil, err
+	}
+	if !reply.OK {
+		abortStream(stream)
+		return nil, nil, &ssh.OpenChannelError{Reason: ssh.RejectionReason(reply.Reason), Message: string(reply.Payload)}
+	}
+	ch := newQuicChannel(stream)
+	return ch, ch.reqs, nil
+}
+
+func (c *quicConn) Close() error {
+	return c.conn.CloseWithError(0, "closed")
+}
+
+// quicNewChannel is a channel opened by the peer, waiting to be accepted or rejected
+type quicNewChannel struct {
+	stream      quic.Stream
+	channelType string
+	extraData   []byte
+}
+
+func (ch *quicNewChannel) Accept() (ssh.Channel, <-chan *ssh.Request, error) {
+	if err := writeFrame(ch.stream, &quicReply{OK: true}); err != nil {
+		abortStream(ch.stream)
+		return nil, nil, err
+	}
+	c := newQuicChannel(ch.stream)
+	return c, c.reqs, nil
+}
+
+func (ch *quicNewChannel) Reject(reason ssh.RejectionReason, message string) error {
+	err := writeFrame(ch.stream, &quicReply{Reason: uint32(reason), Payload: []byte(message)})
+	ch.stream.Close()
+	ch.stream.CancelRead(0)
+	return err
+}
+
+func (ch *quicNewChannel) ChannelType() string {
+	return ch.channelType
+}
+
+func (ch *quicNewChannel) ExtraData() []byte {
+	return ch.extraData
+}
+
+// quicChannel is a channel carried by a QUIC stream
+// Channels carry no requests over QUIC. The request channel is closed once the channel is closed by either side,
+// or once its write side is closed, as the stream offers no other indication of the peer closing the channel.
+type quicChannel struct {
+	stream    quic.Stream
+	reqs      chan *ssh.Request
+	closed    chan bool
+	closeOnce sync.Once
+	readDone  chan bool
+	readOnce  sync.Once
+}
+
+// newQuicChannel returns a channel of stream
+// Its requests are closed once both directions of the stream are finished, as with an SSH channel.
+// The context of the stream only tells that the write direction is finished.
+func newQuicChannel(stream quic.Stream) *quicChannel {
+	ch := &quicChannel{
+		stream:   stream,
+		reqs:     make(chan *ssh.Request),
+		closed:   make(chan bool),
+		readDone: make(chan bool),
+	}
+	go func() {
+		defer close(ch.reqs)
+		select {
+		case <-stream.Context().Done():
+		case <-ch.closed:
+			return
+		}
+		select {
+		case <-ch.readDone:
+		case <-ch.closed:
+		}
+	}()
+	return ch
+}
+
+func (ch *quicChannel) Read(p []byte) (int, error) {
+	n, err := ch.stream.Read(p)
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) && streamErr.Remote {
+		// The peer closed the channel without draining it
+		err = io.EOF
+	}
+	if err != nil {
+		ch.finishRead()
+	}
+	return n, err
+}
+
+// finishRead tells that the read direction of the channel is finished
+func (ch *quicChannel) finishRead() {
+	ch.readOnce.Do(func() {
+		close(ch.readDone)
+	})
+}
+
+func (ch *quicChannel) Write(p []byte) (int, error) {
+	return ch.stream.Write(p)
+}
+
+// Close closes both directions of the channel
+func (ch *quicChannel) Close() error {
+	ch.closeOnce.Do(func() {
+		close(ch.closed)
+		ch.stream.Close()
+		ch.stream.CancelRead(0)
+	})
+	return nil
+}
+
+func (ch *quicChannel) CloseWrite() error {
+	return ch.stream.Close()
+}
+
+func (ch *quicChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return false, nil
+}
+
+func (ch *quicChannel) Stderr() io.ReadWriter {
+	return noStderr{}
+}
+
+// noStderr is the stderr of a quicChannel, which carries no extended data
+type noStderr struct{}
+
+func (noStderr) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (noStderr) Write(p []byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,334 @@
+package sshproxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/crypto/ssh"
+)
+
+func getQuicKey(t *testing.T) ([]byte, ssh.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyBytes, err := sshutil.Ed25519PrivateKeyPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKeyBytes, sshPublicKey
+}
+
+func getQuicTLSConfig(t *testing.T, privateKey []byte, peerPublicKey ssh.PublicKey) *tls.Config {
+	config, err := QuicTLSConfig(privateKey, peerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// quicServer serves QUIC clients using the TLS configuration set by setConfig
+type quicServer struct {
+	listener *quic.EarlyListener
+	config   atomic.Pointer[tls.Config]
+}
+
+func newQuicServer(t *testing.T, config *tls.Config) *quicServer {
+	s := &quicServer{}
+	s.config.Store(config)
+	listener, err := quic.ListenAddrEarly("127.0.0.1:0", &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.config.Load(), nil
+		},
+	}, QuicConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = listener
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// accept returns the next client which completes its handshake, skipping clients which fail to authenticate
+func (s *quicServer) accept(ctx context.Context) (quic.Connection, error) {
+	for {
+		conn, err := s.listener.Accept(ctx)
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-conn.HandshakeComplete():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if conn.Context().Err() == nil {
+			return conn, nil
+		}
+	}
+}
+
+func getQuicPeers(t *testing.T, server *quicServer, clientConfig *tls.Config) (clientSshPeer, serverSshPeer *SshPeer) {
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		conn, err := server.accept(context.Background())
+		if err != nil {
+			t.Errorf("failed to accept quic client: %v", err)
+			return
+		}
+		serverSshPeer = NewQuicPeer(context.Background(), ATTESTATION, conn, "")
+	}()
+
+	conn, err := quic.DialAddrEarly(context.Background(), server.listener.Addr().String(), clientConfig, QuicConfig())
+	if err != nil {
+		t.Fatalf("failed to dial quic server: %v", err)
+	}
+	clientSshPeer = NewQuicPeer(context.Background(), ATTESTATION, conn, "")
+	<-done
+	if clientSshPeer == nil || serverSshPeer == nil {
+		t.Fatal("failed to create quic peers")
+	}
+	return
+}
+
+func TestParseTransport(t *testing.T) {
+	for transport, want := range map[string]string{"": SSH, "ssh": SSH, "quic": QUIC} {
+		if got, err := ParseTransport(transport); err != nil || got != want {
+			t.Errorf("ParseTransport(%q) = %q, %v, want %q", transport, got, err, want)
+		}
+	}
+	if _, err := ParseTransport("tcp"); err == nil {
+		t.Error("Expect error for an illegal transport")
+	}
+}
+
+func TestSshProxyQuic(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clientKey, clientPublicKey := getQuicKey(t)
+	serverKey, serverPublicKey := getQuicKey(t)
+	server := newQuicServer(t, getQuicTLSConfig(t, serverKey, clientPublicKey))
+	clientSshPeer, serverSshPeer := getQuicPeers(t, server, getQuicTLSConfig(t, clientKey, serverPublicKey))
+
+	outbounds := Outbounds{}
+	if err := outbounds.AddTags([]string{"ATTESTATION_PHASE:ABC:127.0.0.1:7044"}); err != nil {
+		t.Fatal(err)
+	}
+	inboundPorts := map[string]string{}
+	inbounds := Inbounds{}
+	if err := inbounds.AddTags([]string{"ATTESTATION_PHASE:ABC:7045"}, inboundPorts, &wg); err != nil {
+		t.Fatal(err)
+	}
+
+	serverSshPeer.HandleRequest(TUNNELS, func(payload []byte) error {
+		if string(payload) != "tunnels" {
+			return errors.New("unexpected payload")
+		}
+		return nil
+	})
+	serverSshPeer.AddOutbounds(outbounds)
+	clientSshPeer.AddInbounds(inbounds)
+
+	clientSshPeer.Ready()
+	serverSshPeer.Ready()
+
+	s := test.HttpServer("7044")
+	if s == nil {
+		t.Fatal("Failed - could not create server")
+	}
+	for i := 0; i < 3; i++ {
+		if !test.HttpClient("http://127.0.0.1:7045") {
+			t.Error("Failed - not successful")
+		}
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if err := clientSshPeer.SendRequest(TUNNELS, []byte("tunnels")); err != nil {
+		t.Errorf("Expect request to be acknowledged: %v", err)
+	}
+	if err := clientSshPeer.SendRequest(TUNNELS, []byte("other")); err == nil {
+		t.Error("Expect request to be rejected")
+	}
+	if err := clientSshPeer.SendRequest(ROTATE, nil); err == nil {
+		t.Error("Expect request without handler to be rejected")
+	}
+
+	serverSshPeer.Upgrade()
+	serverSshPeer.Close("Test Finish")
+
+	clientSshPeer.Wait()
+	if !clientSshPeer.IsUpgraded() {
+		t.Errorf("attestation phase closed without being upgraded")
+	}
+	inbounds.DelAll()
+}
+
+func TestQuicChannelHalfClose(t *testing.T) {
+	clientKey, clientPublicKey := getQuicKey(t)
+	serverKey, serverPublicKey := getQuicKey(t)
+	server := newQuicServer(t, getQuicTLSConfig(t, serverKey, clientPublicKey))
+
+	accepted := make(chan quic.Stream)
+	go func() {
+		conn, err := server.accept(context.Background())
+		if err != nil {
+			t.Errorf("failed to accept quic client: %v", err)
+			close(accepted)
+			return
+		}
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			t.Errorf("failed to accept stream: %v", err)
+			close(accepted)
+			return
+		}
+		accepted <- stream
+	}()
+
+	conn, err := quic.DialAddrEarly(context.Background(), server.listener.Addr().String(), getQuicTLSConfig(t, clientKey, serverPublicKey), QuicConfig())
+	if err != nil {
+		t.Fatalf("failed to dial quic server: %v", err)
+	}
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	serverStream, ok := <-accepted
+	if !ok {
+		t.FailNow()
+	}
+	client := newQuicChannel(stream)
+	serverChannel := newQuicChannel(serverStream)
+	defer client.Close()
+	defer serverChannel.Close()
+
+	// The channel keeps receiving once its write direction is closed
+	if err := client.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-client.reqs:
+		t.Fatal("Expect the requests to stay open while the channel is receiving")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := serverChannel.Write([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(client, buf); err != nil || buf[0] != 'b' {
+		t.Fatalf("Expect to receive b, got %q, %v", buf, err)
+	}
+
+	if err := serverChannel.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Read(buf); err != io.EOF {
+		t.Fatalf("Expect EOF, got %v", err)
+	}
+	select {
+	case <-client.reqs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect the requests to be closed once both directions are finished")
+	}
+}
+
+func TestQuicKeyPinning(t *testing.T) {
+	clientKey, clientPublicKey := getQuicKey(t)
+	serverKey, serverPublicKey := getQuicKey(t)
+	_, otherPublicKey := getQuicKey(t)
+
+	// connect returns whether both the client and the server completed the handshake
+	connect := func(serverConfig, clientConfig *tls.Config) (clientOK, serverOK bool) {
+		t.Helper()
+		server := newQuicServer(t, serverConfig)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		accepted := make(chan bool, 1)
+		go func() {
+			conn, err := server.accept(ctx)
+			if err == nil {
+				defer conn.CloseWithError(0, "")
+			}
+			accepted <- err == nil
+		}()
+		conn, err := quic.DialAddr(ctx, server.listener.Addr().String(), clientConfig, QuicConfig())
+		if err == nil {
+			defer conn.CloseWithError(0, "")
+		}
+		return err == nil, <-accepted
+	}
+
+	// The client rejects a server presenting another key
+	if clientOK, _ := connect(getQuicTLSConfig(t, serverKey, clientPublicKey), getQuicTLSConfig(t, clientKey, otherPublicKey)); clientOK {
+		t.Error("Expect client to reject the server key")
+	}
+
+	// The server rejects a client presenting another key
+	if _, serverOK := connect(getQuicTLSConfig(t, serverKey, otherPublicKey), getQuicTLSConfig(t, clientKey, serverPublicKey)); serverOK {
+		t.Error("Expect server to reject the client key")
+	}
+
+	// Without a pinned key, the attestation phase server accepts any client
+	if clientOK, serverOK := connect(getQuicTLSConfig(t, serverKey, nil), getQuicTLSConfig(t, clientKey, serverPublicKey)); !clientOK || !serverOK {
+		t.Errorf("Expect server to accept any client key: client %v, server %v", clientOK, serverOK)
+	}
+}
+
+func TestQuicResumption(t *testing.T) {
+	clientKey, clientPublicKey := getQuicKey(t)
+	serverKey, serverPublicKey := getQuicKey(t)
+	server := newQuicServer(t, getQuicTLSConfig(t, serverKey, clientPublicKey))
+	clientConfig := getQuicTLSConfig(t, clientKey, serverPublicKey)
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(4)
+
+	connect := func() (didResume bool) {
+		t.Helper()
+		clientSshPeer, serverSshPeer := getQuicPeers(t, server, clientConfig)
+		didResume = clientSshPeer.sshConn.(*quicConn).conn.ConnectionState().TLS.DidResume
+		// A request round trip lets the client receive the session ticket of the server
+		serverSshPeer.HandleRequest(TUNNELS, func(payload []byte) error { return nil })
+		if err := clientSshPeer.SendRequest(TUNNELS, nil); err != nil {
+			t.Error(err)
+		}
+		clientSshPeer.Close("Test Finish")
+		serverSshPeer.Wait()
+		return
+	}
+
+	if connect() {
+		t.Error("Expect first connection to use a full handshake")
+	}
+	if !connect() {
+		t.Error("Expect reconnection to resume the session")
+	}
+
+	// Sessions of previous keys are not resumed once keys are rotated
+	serverKey, serverPublicKey = getQuicKey(t)
+	server.config.Store(getQuicTLSConfig(t, serverKey, clientPublicKey))
+	clientConfig = getQuicTLSConfig(t, clientKey, serverPublicKey)
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(4)
+	if connect() {
+		t.Error("Expect connection with rotated keys to use a full handshake")
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +19,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -29,6 +32,13 @@ const (
 	BOTH_PHASES       = "BOTH_PHASES"
 	PHASE             = "Phase"
 	UPGRADE           = "Upgrade"
+	ROTATE            = "Rotate"
+	TUNNELS           = "Tunnels"
+
+	// Protocols of tags
+	TCP  = "tcp"
+	UDP  = "udp"
+	UNIX = "unix"
 )
 
 var logger = sshutil.Logger
@@ -36,7 +46,7 @@ var logger = sshutil.Logger
 type SshPeer struct {
 	sid            string
 	phase          string
-	sshConn        ssh.Conn
+	sshConn        PeerConn
 	ctx            context.Context
 	done           chan bool
 	outbounds      map[string]*Outbound
@@ -45,22 +55,70 @@ type SshPeer struct {
 	upgrade        bool
 	outboundsReady chan bool
 	closeOnce      sync.Once
+	handlers       map[string]RequestHandler
+	draining       chan bool
+	drainOnce      sync.Once
+	channels       int
+	limiters       map[string]*rate.Limiter
+	priority       priorityGate
+	mutex          sync.Mutex
+}
+
+// PeerConn is the connection to a peer, carrying global requests and channels
+// An ssh.Conn is a PeerConn, as is a QuicConn.
+type PeerConn interface {
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+	OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error)
+	Close() error
+}
+
+// Request is a global request from the peer
+type Request struct {
+	Type      string
+	WantReply bool
+	Payload   []byte
+	reply     func(ok bool, payload []byte) error
+}
+
+// Reply responds to a request which wants a reply
+func (req *Request) Reply(ok bool, payload []byte) error {
+	if !req.WantReply {
+		return nil
+	}
+	return req.reply(ok, payload)
+}
+
+// RequestHandler handles a global request from the peer. The request is acknowledged if the handler returns no error.
+type RequestHandler func(payload []byte) error
+
+// RotateKeys is the payload of a ROTATE request when keys are not delivered by Trustee
+type RotateKeys struct {
+	PpPrivateKey []byte
+	WnPublicKey  []byte
+}
+
+// Tunnels is the payload of a TUNNELS request, and describes tunnels to add to and remove from a running peer
+type Tunnels struct {
+	Inbounds  []string // Inbound tags to add
+	Outbounds []string // Outbound tags to add
+	Remove    []string // Names of Inbounds and Outbounds to remove
 }
 
-// Inbound side of the Tunnel - incoming tcp connections from local clients
+// Inbound side of the Tunnel - incoming connections from local clients
 type Inbound struct {
-	// tcp peers
 	Name        string
-	TcpListener *net.TCPListener
+	Protocol    string           // TCP, UDP, UNIX
+	TcpListener *net.TCPListener // set for TCP inbounds
 	Connections chan *net.Conn
 	Phase       string // ATTESTATION_PHASE, KUBERNETES_PHASE, BOTH_PHASES
+	listener    io.Closer
 }
 
 type Outbound struct {
-	// tcp peers
-	Name    string
-	OutAddr string
-	Phase   string // ATTESTATION_PHASE, KUBERNETES_PHASE, BOTH_PHASES
+	Name     string
+	Protocol string // TCP, UDP, UNIX
+	OutAddr  string // <host>:<port>, or a socket path for UNIX outbounds
+	Phase    string // ATTESTATION_PHASE, KUBERNETES_PHASE, BOTH_PHASES
 }
 
 type Outbounds struct {
@@ -77,23 +135,49 @@ func (outbounds *Outbounds) AddTags(tags []string) error {
 		if tag == "" {
 			continue
 		}
-		inPort, host, name, phase, err := ParseTag(tag)
+		protocol, inPort, host, name, phase, err := ParseProtocolTag(tag)
 		if err != nil {
 			return fmt.Errorf("failed to parse outbound tag %s: %v", tag, err)
 		}
+		if protocol == UNIX {
+			outbounds.add(protocol, host, name, phase)
+			continue
+		}
 		if host == "" {
 			host = "127.0.0.1"
 		}
-		outbounds.Add(inPort, host, name, phase)
+		outbounds.add(protocol, net.JoinHostPort(host, strconv.Itoa(inPort)), name, phase)
 	}
 	return nil
 }
 
+// Has reports whether an Outbound named name exists
+func (outbounds *Outbounds) Has(name string) bool {
+	for _, outbound := range outbounds.list {
+		if outbound.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Del removes the Outbound named name
+func (outbounds *Outbounds) Del(name string) {
+	outbounds.list = slices.DeleteFunc(outbounds.list, func(outbound *Outbound) bool {
+		return outbound.Name == name
+	})
+}
+
 func (outbounds *Outbounds) Add(port int, host, name, phase string) {
+	outbounds.add(TCP, fmt.Sprintf("%s:%d", host, port), name, phase)
+}
+
+func (outbounds *Outbounds) add(protocol, outAddr, name, phase string) {
 	outbound := &Outbound{
-		Phase:   phase,
-		Name:    name,
-		OutAddr: fmt.Sprintf("%s:%d", host, port),
+		Phase:    phase,
+		Name:     name,
+		Protocol: protocol,
+		OutAddr:  outAddr,
 	}
 	outbounds.list = append(outbounds.list, outbound)
 }
@@ -104,11 +188,19 @@ func (inbounds *Inbounds) AddTags(tags []string, inboundPorts map[string]string,
 		if tag == "" {
 			continue
 		}
-		inPort, namespace, name, phase, err := ParseTag(tag)
+		protocol, inPort, namespace, name, phase, err := ParseProtocolTag(tag)
 		if err != nil {
 			return fmt.Errorf("failed to parse inbound tag %s: %v", tag, err)
 		}
-		retPort, err := inbounds.Add(namespace, inPort, name, phase, wg)
+		var retPort string
+		switch protocol {
+		case UDP:
+			retPort, err = inbounds.addUdp(namespace, inPort, name, phase, wg)
+		case UNIX:
+			retPort, err = inbounds.addUnix(namespace, name, phase, wg)
+		default:
+			retPort, err = inbounds.Add(namespace, inPort, name, phase, wg)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to add inbound: %v", err)
 		}
@@ -119,26 +211,23 @@ func (inbounds *Inbounds) AddTags(tags []string, inboundPorts map[string]string,
 	return nil
 }
 
-func (inbounds *Inbounds) listen(namespace string, tcpAddr *net.TCPAddr, name string) (tcpListener *net.TCPListener, err error) {
+// listen runs listen in the network namespace of the inbound, or in the current network namespace if namespace is empty
+func (inbounds *Inbounds) listen(namespace string, name string, listen func() error) error {
 	if namespace == "" {
-		return net.ListenTCP("tcp", tcpAddr)
+		return listen()
 	}
 
 	var ns netops.Namespace
 	ns, netopsErr := netops.OpenNamespace(filepath.Join("/run/netns", namespace))
 	if netopsErr != nil {
-		return nil, fmt.Errorf("inbound %s failed to OpenNamespace '%s': %w", name, namespace, netopsErr)
+		return fmt.Errorf("inbound %s failed to OpenNamespace '%s': %w", name, namespace, netopsErr)
 	}
 	defer ns.Close()
 
-	netopsErr = ns.Run(func() error {
-		tcpListener, err = net.ListenTCP("tcp", tcpAddr)
-		return err
-	})
-	if netopsErr != nil {
-		return nil, fmt.Errorf("inbound %s failed to ListenTCP '%s': %w", name, namespace, netopsErr)
+	if netopsErr = ns.Run(listen); netopsErr != nil {
+		return fmt.Errorf("inbound %s failed to listen in namespace '%s': %w", name, namespace, netopsErr)
 	}
-	return
+	return nil
 }
 
 func (inbounds *Inbounds) Add(namespace string, inPort int, name, phase string, wg *sync.WaitGroup) (string, error) {
@@ -146,7 +235,11 @@ func (inbounds *Inbounds) Add(namespace string, inPort int, name, phase string,
 		IP:   net.IPv4(127, 0, 0, 1),
 		Port: inPort,
 	}
-	tcpListener, err := inbounds.listen(namespace, tcpAddr, name)
+	var tcpListener *net.TCPListener
+	err := inbounds.listen(namespace, name, func() (err error) {
+		tcpListener, err = net.ListenTCP("tcp", tcpAddr)
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("inbound failed to listen to host: %s port '%d' - err: %v", name, inPort, err)
 	}
@@ -158,35 +251,171 @@ func (inbounds *Inbounds) Add(namespace string, inPort int, name, phase string,
 
 	inbound := &Inbound{
 		Phase:       phase,
+		Protocol:    TCP,
 		TcpListener: tcpListener,
-		Connections: make(chan *net.Conn),
 		Name:        name,
 	}
+	inbounds.serve(inbound, tcpListener, wg)
+	return retPort, nil
+}
+
+// addUdp creates a UDP Inbound. Datagrams of each UDP client are carried by a separate tunnel channel.
+func (inbounds *Inbounds) addUdp(namespace string, inPort int, name, phase string, wg *sync.WaitGroup) (string, error) {
+	udpAddr := &net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: inPort,
+	}
+	var udpConn *net.UDPConn
+	err := inbounds.listen(namespace, name, func() (err error) {
+		udpConn, err = net.ListenUDP("udp", udpAddr)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("inbound failed to listen to host: %s udp port '%d' - err: %v", name, inPort, err)
+	}
+	_, retPort, err := net.SplitHostPort(udpConn.LocalAddr().String())
+	if err != nil {
+		panic(err)
+	}
+	logger.Printf("Inbound listening to udp port %s in namespace %s", retPort, namespace)
+
+	inbound := &Inbound{
+		Phase:    phase,
+		Protocol: UDP,
+		Name:     name,
+	}
+	inbounds.serve(inbound, newUdpListener(udpConn, wg), wg)
+	return retPort, nil
+}
+
+// addUnix creates a Unix-domain socket Inbound listening at path
+func (inbounds *Inbounds) addUnix(path string, name, phase string, wg *sync.WaitGroup) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("inbound %s failed to create directory of socket %s - err: %v", name, path, err)
+	}
+	// Remove a socket left behind by a previous run
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return "", fmt.Errorf("inbound failed to listen to host: %s socket %s - err: %v", name, path, err)
+	}
+	logger.Printf("Inbound listening to socket %s", path)
+
+	inbound := &Inbound{
+		Phase:    phase,
+		Protocol: UNIX,
+		Name:     name,
+	}
+	inbounds.serve(inbound, unixListener, wg)
+	return path, nil
+}
+
+// serve passes connections accepted by listener to the Inbound, and adds the Inbound
+func (inbounds *Inbounds) serve(inbound *Inbound, listener net.Listener, wg *sync.WaitGroup) {
+	inbound.listener = listener
+	inbound.Connections = make(chan *net.Conn)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for {
-			tcpConn, err := tcpListener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
 				close(inbound.Connections)
 				return
 			}
-			inbound.Connections <- &tcpConn
+			inbound.Connections <- &conn
 		}
 	}()
 	inbounds.list = append(inbounds.list, inbound)
-	return retPort, nil
+}
+
+// Has reports whether an Inbound named name exists
+func (inbounds *Inbounds) Has(name string) bool {
+	for _, inbound := range inbounds.list {
+		if inbound.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Del stops listening to the Inbound named name and removes it
+func (inbounds *Inbounds) Del(name string) {
+	inbounds.list = slices.DeleteFunc(inbounds.list, func(inbound *Inbound) bool {
+		if inbound.Name != name {
+			return false
+		}
+		inbound.listener.Close()
+		return true
+	})
 }
 
 // NewInbound create an Inbound and listen to incoming client connections
 func (inbounds *Inbounds) DelAll() {
 	for _, inbound := range inbounds.list {
-		inbound.TcpListener.Close()
+		inbound.listener.Close()
 	}
 	inbounds.list = [](*Inbound){}
 }
 
-// ParseTag() parses an inbound or outbound tag
+// ParseTag() parses an inbound or outbound tag of any protocol, see ParseProtocolTag()
+func ParseTag(tag string) (port int, host, name, phase string, err error) {
+	_, port, host, name, phase, err = ParseProtocolTag(tag)
+	return
+}
+
+// ParseProtocolTag() parses an inbound or outbound tag, which may start with a protocol prefix
+// Tags with structure [tcp:]<Phase>:<Name>:[<Host|Namespace>:]<Port>
+//
+//	are TCP tags, as described by parsePortTag()
+//
+// Tags with structure udp:<Phase>:<Name>:[<Host|Namespace>:]<Port>
+//
+//	are UDP tags, interpreted as TCP tags
+//
+// Tags with structure unix:<Phase>:<Name>:<Path>
+//
+//	are Unix-domain socket tags, returning <Path> as host.
+//	Outbounds approach the socket at <Path>, Inbounds serve a socket at <Path>
+func ParseProtocolTag(tag string) (protocol string, port int, host, name, phase string, err error) {
+	protocol = TCP
+	for _, p := range []string{TCP, UDP, UNIX} {
+		if strings.HasPrefix(tag, p+":") {
+			protocol = p
+			tag = strings.TrimPrefix(tag, p+":")
+			break
+		}
+	}
+	if protocol != UNIX {
+		port, host, name, phase, err = parsePortTag(tag)
+		return
+	}
+
+	splits := strings.SplitN(tag, ":", 3)
+	if len(splits) != 3 {
+		err = fmt.Errorf("illegal tag: %s", tag)
+		return
+	}
+	phase = splits[0]
+	name = splits[1]
+	host = splits[2]
+	if !filepath.IsAbs(host) {
+		err = fmt.Errorf("illegal tag path '%s'", host)
+		return
+	}
+	if phase != ATTESTATION_PHASE && phase != KUBERNETES_PHASE && phase != BOTH_PHASES {
+		err = fmt.Errorf("illegal tag phase '%s'", phase)
+		return
+	}
+	if name == "" {
+		err = fmt.Errorf("illegal tag name '%s'", name)
+	}
+	return
+}
+
+// parsePortTag() parses an inbound or outbound tag without a protocol prefix
 // Outbound tags with structure <Phase>:<Name>:<Port>
 //
 //	are interperted to approach 127.0.0.1:<Port>
@@ -202,7 +431,7 @@ func (inbounds *Inbounds) DelAll() {
 // Inbound tags with structure <Phase>:<Name>:<Namespace>:<Port>
 //
 //	are interperted to serve 127.0.0.1:<Port> on <Namespace> network namepsace
-func ParseTag(tag string) (port int, host, name, phase string, err error) {
+func parsePortTag(tag string) (port int, host, name, phase string, err error) {
 	var inPort string
 	var uint64port uint64
 
@@ -223,42 +452,68 @@ func ParseTag(tag string) (port int, host, name, phase string, err error) {
 
 	if uint64port, err = strconv.ParseUint(inPort, 10, 16); err != nil {
 		err = fmt.Errorf("illegal tag port '%s' - err: %v", inPort, err)
-	} else {
-		port = int(uint64port)
+		return
 	}
+	port = int(uint64port)
 
 	if phase != ATTESTATION_PHASE && phase != KUBERNETES_PHASE && phase != BOTH_PHASES {
 		err = fmt.Errorf("illegal tag phase '%s'", phase)
+		return
 	}
 	if name == "" {
-		err = fmt.Errorf("illegal tag name '%s'", phase)
+		err = fmt.Errorf("illegal tag name '%s'", name)
 	}
 	return
 }
 
 // NewSshPeer
 func NewSshPeer(ctx context.Context, phase string, sshConn ssh.Conn, chans <-chan ssh.NewChannel, sshReqs <-chan *ssh.Request, sid string) *SshPeer {
-	peer := &SshPeer{
+	if chans == nil || sshReqs == nil {
+		logger.Fatalf("NewSshPeer with illegal parameters chans %v sshReqs %v", chans, sshReqs)
+	}
+
+	peer := newPeer(ctx, phase, sshConn, sid)
+	reqs := make(chan *Request)
+	peer.wg.Add(1)
+	go func() {
+		defer peer.wg.Done()
+		defer close(reqs)
+		for req := range sshReqs {
+			select {
+			case reqs <- &Request{Type: req.Type, WantReply: req.WantReply, Payload: req.Payload, reply: req.Reply}:
+			case <-peer.done:
+				_ = req.Reply(false, nil)
+			}
+		}
+	}()
+	return peer.start(chans, reqs)
+}
+
+func newPeer(ctx context.Context, phase string, conn PeerConn, sid string) *SshPeer {
+	return &SshPeer{
 		sid:            sid,
 		phase:          phase,
-		sshConn:        sshConn,
+		sshConn:        conn,
 		ctx:            ctx,
 		done:           make(chan bool, 1),
 		outbounds:      make(map[string]*Outbound),
 		inbounds:       make(map[string]*Inbound),
 		outboundsReady: make(chan bool),
+		handlers:       make(map[string]RequestHandler),
+		draining:       make(chan bool),
 	}
+}
 
-	if chans == nil || sshReqs == nil {
-		logger.Fatalf("NewSshPeer with illegal parameters chans %v sshReqs %v", chans, sshReqs)
-	}
+// start serves the requests and channels of the peer, and verifies that the peer is in the same phase
+func (peer *SshPeer) start(chans <-chan ssh.NewChannel, reqs <-chan *Request) *SshPeer {
+	ctx, phase, sid := peer.ctx, peer.phase, peer.sid
 
 	peer.wg.Add(1)
 	go func() {
 		defer peer.wg.Done()
 		for {
 			select {
-			case req := <-sshReqs:
+			case req := <-reqs:
 				if req == nil {
 					peer.Close("sshReqs closed")
 					return
@@ -275,6 +530,19 @@ func NewSshPeer(ctx context.Context, phase string, sshConn ssh.Conn, chans <-cha
 						peer.upgrade = true
 						continue
 					}
+					if handler := peer.handler(req.Type); handler != nil {
+						peer.wg.Add(1)
+						go func(req *Request) {
+							defer peer.wg.Done()
+							if err := handler(req.Payload); err != nil {
+								logger.Printf("%s phase: %s request failed: %v", phase, req.Type, err)
+								_ = req.Reply(false, nil)
+								return
+							}
+							_ = req.Reply(true, nil)
+						}(req)
+						continue
+					}
 					_ = req.Reply(false, nil)
 				}
 
@@ -293,7 +561,7 @@ func NewSshPeer(ctx context.Context, phase string, sshConn ssh.Conn, chans <-cha
 				case "tunnel":
 					name := string(ch.ExtraData())
 					<-peer.outboundsReady
-					outbound := peer.outbounds[name]
+					outbound := peer.outbound(name)
 					if outbound == nil || (outbound.Phase == ATTESTATION_PHASE && phase != ATTESTATION) || (outbound.Phase == KUBERNETES_PHASE && phase != KUBERNETES) {
 						logger.Printf("%s phase: NewSshPeer rejected tunnel channel: %s", phase, name)
 						_ = ch.Reject(ssh.UnknownChannelType, fmt.Sprintf("%s phase: NewSshPeer rejected tunnel channel - port not allowed: %s", phase, name))
@@ -305,6 +573,7 @@ func NewSshPeer(ctx context.Context, phase string, sshConn ssh.Conn, chans <-cha
 						peer.Close("Accept failed")
 					}
 					logger.Printf("%s phase: NewSshPeer - peer requested a tunnel channel for %s", phase, name)
+					chChan, chReqs = peer.trackChannel(name, chChan, chReqs)
 					if outbound.Name == sshutil.KBS {
 						outbound.acceptProxy(chChan, chReqs, sid, &peer.wg)
 					} else {
@@ -345,6 +614,82 @@ func (peer *SshPeer) Close(who string) {
 	})
 }
 
+// HandleRequest sets a handler of global requests of reqType from the peer
+func (peer *SshPeer) HandleRequest(reqType string, handler RequestHandler) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	peer.handlers[reqType] = handler
+}
+
+func (peer *SshPeer) handler(reqType string) RequestHandler {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	return peer.handlers[reqType]
+}
+
+// SendRequest sends a global request to the peer and waits for the peer to acknowledge it
+func (peer *SshPeer) SendRequest(reqType string, payload []byte) error {
+	ok, _, err := peer.sshConn.SendRequest(reqType, true, payload)
+	if err != nil {
+		return fmt.Errorf("%s phase: %s request failed: %w", peer.phase, reqType, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s phase: %s request was rejected by peer", peer.phase, reqType)
+	}
+	return nil
+}
+
+// Drain stops serving new inbound connections, and closes the peer once all its tunnel channels are closed.
+// A draining peer is replaced by a new peer without dropping the tunnels it carries.
+func (peer *SshPeer) Drain() {
+	peer.drainOnce.Do(func() {
+		logger.Printf("%s phase: peer draining", peer.phase)
+		close(peer.draining)
+	})
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	if peer.channels == 0 {
+		peer.Close("Drained")
+	}
+}
+
+// trackChannel counts a tunnel channel of the tunnel named name as open until its request channel is closed
+// The returned channel is metered and limited by the rate limit of the tunnel
+func (peer *SshPeer) trackChannel(name string, ch ssh.Channel, chReqs <-chan *ssh.Request) (ssh.Channel, <-chan *ssh.Request) {
+	peer.mutex.Lock()
+	peer.channels++
+	peer.mutex.Unlock()
+	metered := peer.meterChannel(name, ch)
+
+	tracked := make(chan *ssh.Request)
+	peer.wg.Add(1)
+	go func() {
+		defer peer.wg.Done()
+		defer close(tracked)
+		for req := range chReqs {
+			select {
+			case tracked <- req:
+			case <-peer.done:
+				if req.WantReply {
+					_ = req.Reply(false, nil)
+				}
+			}
+		}
+		metered.closed()
+		peer.mutex.Lock()
+		defer peer.mutex.Unlock()
+		peer.channels--
+		select {
+		case <-peer.draining:
+			if peer.channels == 0 {
+				peer.Close("Drained")
+			}
+		default:
+		}
+	}()
+	return metered, tracked
+}
+
 func (peer *SshPeer) IsUpgraded() bool {
 	return peer.upgrade
 }
@@ -385,12 +730,16 @@ func (peer *SshPeer) AddInbound(inbound *Inbound) {
 				}
 				logger.Printf("%s phase: Inbound accept: %s", peer.phase, inbound.Name)
 				NewInboundInstance(*conn, peer, inbound)
+			case <-peer.draining:
+				return
 			case <-peer.done:
 				return
 			}
 		}
 	}()
+	peer.mutex.Lock()
 	peer.inbounds[inbound.Name] = inbound
+	peer.mutex.Unlock()
 }
 
 func NewInboundInstance(tcpConn io.ReadWriteCloser, peer *SshPeer, inbound *Inbound) {
@@ -400,6 +749,7 @@ func NewInboundInstance(tcpConn io.ReadWriteCloser, peer *SshPeer, inbound *Inbo
 		return
 	}
 	logger.Printf("%s phase: NewInboundInstance OpenChannel opening tunnel for: %s", peer.phase, inbound.Name)
+	sshChan, channelReqs = peer.trackChannel(inbound.Name, sshChan, channelReqs)
 
 	peer.wg.Add(1)
 	go func() {
@@ -463,9 +813,129 @@ func (peer *SshPeer) AddInbounds(inbounds Inbounds) {
 
 // NewOutbound create an outbound and connect to an outgoing server
 func (peer *SshPeer) AddOutbound(outbound *Outbound) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
 	peer.outbounds[outbound.Name] = outbound
 }
 
+func (peer *SshPeer) outbound(name string) *Outbound {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	return peer.outbounds[name]
+}
+
+// DelTunnel stops accepting new channels of the Inbound or Outbound named name
+// Channels already open are kept until they close
+func (peer *SshPeer) DelTunnel(name string) {
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	delete(peer.inbounds, name)
+	delete(peer.outbounds, name)
+}
+
+// Apply adds and removes the Inbounds and Outbounds described by tunnels, and updates peer if it is not nil
+// Tags are parsed and phases are enforced as with tags set at startup. The KATAAGENT and KBS tunnels cannot be changed.
+func (tunnels *Tunnels) Apply(inbounds *Inbounds, outbounds *Outbounds, inboundPorts map[string]string, wg *sync.WaitGroup, peer *SshPeer) error {
+	removed := map[string]bool{}
+	for _, name := range tunnels.Remove {
+		if name == sshutil.KATAAGENT || name == sshutil.KBS {
+			return fmt.Errorf("tunnel %s cannot be removed", name)
+		}
+		removed[name] = true
+	}
+	for _, tag := range append(slices.Clone(tunnels.Inbounds), tunnels.Outbounds...) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		_, _, name, _, err := ParseTag(tag)
+		if err != nil {
+			return fmt.Errorf("failed to parse tag %s: %v", tag, err)
+		}
+		if name == sshutil.KATAAGENT || name == sshutil.KBS {
+			return fmt.Errorf("tunnel %s cannot be added", name)
+		}
+		if !removed[name] && (inbounds.Has(name) || outbounds.Has(name)) {
+			return fmt.Errorf("tunnel %s already exists", name)
+		}
+	}
+
+	for name := range removed {
+		inbounds.Del(name)
+		outbounds.Del(name)
+		if inboundPorts != nil {
+			delete(inboundPorts, name)
+		}
+		if peer != nil {
+			peer.DelTunnel(name)
+		}
+		logger.Printf("Tunnel %s removed", name)
+	}
+
+	var addedInbounds Inbounds
+	var addedOutbounds Outbounds
+	if err := addedInbounds.AddTags(tunnels.Inbounds, inboundPorts, wg); err != nil {
+		addedInbounds.DelAll()
+		return err
+	}
+	if err := addedOutbounds.AddTags(tunnels.Outbounds); err != nil {
+		addedInbounds.DelAll()
+		return err
+	}
+	inbounds.list = append(inbounds.list, addedInbounds.list...)
+	outbounds.list = append(outbounds.list, addedOutbounds.list...)
+	if peer != nil {
+		peer.AddTags(addedInbounds, addedOutbounds)
+	}
+	return nil
+}
+
+// DiffTunnels returns the change from the prev tunnels to the next tunnels
+// Tunnels whose tags are not in next are removed, and tags which are not in prev are added,
+// such that a changed tag replaces the tunnel of the same name.
+func DiffTunnels(prev, next Tunnels) (Tunnels, error) {
+	var diff Tunnels
+	var err error
+
+	removed := map[string]bool{}
+	if diff.Inbounds, err = diffTags(prev.Inbounds, next.Inbounds, removed); err != nil {
+		return Tunnels{}, err
+	}
+	if diff.Outbounds, err = diffTags(prev.Outbounds, next.Outbounds, removed); err != nil {
+		return Tunnels{}, err
+	}
+	for name := range removed {
+		diff.Remove = append(diff.Remove, name)
+	}
+	slices.Sort(diff.Remove)
+	return diff, nil
+}
+
+// diffTags adds the names of the prev tags which are not in next to removed, and returns the next tags which are not in prev
+func diffTags(prev, next []string, removed map[string]bool) (added []string, err error) {
+	for _, tag := range prev {
+		if slices.Contains(next, tag) {
+			continue
+		}
+		_, _, name, _, err := ParseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tag %s: %v", tag, err)
+		}
+		removed[name] = true
+	}
+	for _, tag := range next {
+		if !slices.Contains(prev, tag) {
+			added = append(added, tag)
+		}
+	}
+	return added, nil
+}
+
+// IsEmpty reports whether tunnels describes no change
+func (tunnels *Tunnels) IsEmpty() bool {
+	return len(tunnels.Inbounds) == 0 && len(tunnels.Outbounds) == 0 && len(tunnels.Remove) == 0
+}
+
 type SID string
 
 func (sid SID) urlModifier(path string) string {
@@ -545,12 +1015,16 @@ func (outbound *Outbound) acceptProxy(chChan ssh.Channel, chReqs <-chan *ssh.Req
 }
 
 func (outbound *Outbound) accept(chChan ssh.Channel, chReqs <-chan *ssh.Request, wg *sync.WaitGroup) {
-	tcpConn, err := net.Dial("tcp", outbound.OutAddr)
+	conn, err := net.Dial(outbound.Protocol, outbound.OutAddr)
 	if err != nil {
 		logger.Printf("Outbound %s accept dial address %s err: %s - closing channel", outbound.Name, outbound.OutAddr, err)
 		chChan.Close()
 		return
 	}
+	var tcpConn io.ReadWriteCloser = conn
+	if outbound.Protocol == UDP {
+		tcpConn = newDatagramConn(conn)
+	}
 
 	logger.Printf("Outbound %s accept dial success - connected to %s", outbound.Name, outbound.OutAddr)
 
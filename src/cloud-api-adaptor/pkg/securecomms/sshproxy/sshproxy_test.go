@@ -4,7 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -266,6 +270,330 @@ func TestSshProxyReverseKBS(t *testing.T) {
 	}
 }
 
+func TestTunnelsApply(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clientSshPeer, serverSshPeer := getPeers(t)
+
+	inboundPorts := map[string]string{}
+	inbounds := Inbounds{}
+	outbounds := Outbounds{}
+	serverInbounds := Inbounds{}
+	serverOutbounds := Outbounds{}
+
+	serverSshPeer.HandleRequest(TUNNELS, func(payload []byte) error {
+		var tunnels Tunnels
+		if err := ssh.Unmarshal(payload, &tunnels); err != nil {
+			return err
+		}
+		return tunnels.Apply(&serverInbounds, &serverOutbounds, nil, &wg, serverSshPeer)
+	})
+	clientSshPeer.Ready()
+	serverSshPeer.Ready()
+
+	s := test.HttpServer("7023")
+	if s == nil {
+		t.Error("Failed - could not create server")
+	}
+
+	if err := clientSshPeer.SendRequest(TUNNELS, ssh.Marshal(&Tunnels{Outbounds: []string{"ATTESTATION_PHASE:DEF:127.0.0.1:7023"}})); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	tunnels := Tunnels{Inbounds: []string{"ATTESTATION_PHASE:DEF:7013"}}
+	if err := tunnels.Apply(&inbounds, &outbounds, inboundPorts, &wg, clientSshPeer); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if inboundPorts["DEF"] != "7013" {
+		t.Errorf("Expect inbound port 7013, got %q", inboundPorts["DEF"])
+	}
+	if !test.HttpClient("http://127.0.0.1:7013") {
+		t.Error("Failed - not successful")
+	}
+
+	for _, tunnels := range []Tunnels{
+		{Inbounds: []string{"ATTESTATION_PHASE:DEF:7014"}},
+		{Inbounds: []string{"ATTESTATION_PHASE:KATAAGENT:7014"}},
+		{Outbounds: []string{"ATTESTATION_PHASE:KBS:127.0.0.1:7014"}},
+		{Inbounds: []string{"NO_PHASE:GHI:7014"}},
+		{Remove: []string{"KATAAGENT"}},
+	} {
+		if err := tunnels.Apply(&inbounds, &outbounds, inboundPorts, &wg, clientSshPeer); err == nil {
+			t.Errorf("Expect error applying %v", tunnels)
+		}
+	}
+	if err := clientSshPeer.SendRequest(TUNNELS, ssh.Marshal(&Tunnels{Outbounds: []string{"ATTESTATION_PHASE:DEF:127.0.0.1:7023"}})); err == nil {
+		t.Error("Expect a duplicate outbound to be rejected")
+	}
+
+	if err := clientSshPeer.SendRequest(TUNNELS, ssh.Marshal(&Tunnels{Remove: []string{"DEF"}})); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if serverOutbounds.Has("DEF") {
+		t.Error("Expect outbound DEF to be removed")
+	}
+	tunnels = Tunnels{Remove: []string{"DEF"}}
+	if err := tunnels.Apply(&inbounds, &outbounds, inboundPorts, &wg, clientSshPeer); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if conn, err := net.Dial("tcp", "127.0.0.1:7013"); err == nil {
+		conn.Close()
+		t.Error("Expect inbound DEF to be removed")
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	serverSshPeer.Close("Test Finish")
+	clientSshPeer.Wait()
+	inbounds.DelAll()
+}
+
+func TestDiffTunnels(t *testing.T) {
+	prev := Tunnels{
+		Inbounds:  []string{"KUBERNETES_PHASE:ABC:7001", "KUBERNETES_PHASE:DEF:7002"},
+		Outbounds: []string{"KUBERNETES_PHASE:GHI:127.0.0.1:7003"},
+	}
+	next := Tunnels{
+		Inbounds:  []string{"KUBERNETES_PHASE:ABC:7001", "KUBERNETES_PHASE:DEF:7012", "KUBERNETES_PHASE:JKL:7004"},
+		Outbounds: []string{},
+	}
+
+	diff, err := DiffTunnels(prev, next)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !slices.Equal(diff.Inbounds, []string{"KUBERNETES_PHASE:DEF:7012", "KUBERNETES_PHASE:JKL:7004"}) {
+		t.Errorf("Expect DEF and JKL inbounds to be added, got %v", diff.Inbounds)
+	}
+	if len(diff.Outbounds) != 0 {
+		t.Errorf("Expect no outbounds to be added, got %v", diff.Outbounds)
+	}
+	if !slices.Equal(diff.Remove, []string{"DEF", "GHI"}) {
+		t.Errorf("Expect DEF and GHI to be removed, got %v", diff.Remove)
+	}
+
+	if diff, err = DiffTunnels(next, next); err != nil || !diff.IsEmpty() {
+		t.Errorf("Expect no change, got %v, %v", diff, err)
+	}
+	if _, err = DiffTunnels(Tunnels{Inbounds: []string{"NO_PHASE:ABC:7001"}}, Tunnels{}); err == nil {
+		t.Error("Expect an error removing an illegal tag")
+	}
+}
+
+func TestSshProxyUdpWithNamespace(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clientSshPeer, serverSshPeer := getPeers(t)
+
+	testNs, testNsStr := tuntest.NewNamedNS(t, "test-TestSshProxyUdpWithNamespace")
+	defer tuntest.DeleteNamedNS(t, testNs)
+
+	outbounds := Outbounds{}
+	if err := outbounds.AddTags([]string{"udp:ATTESTATION_PHASE:DNS:127.0.0.1:7041"}); err != nil {
+		t.Error(err)
+		return
+	}
+	inboundPorts := map[string]string{}
+	inbounds := Inbounds{}
+	if err := inbounds.AddTags([]string{"udp:ATTESTATION_PHASE:DNS:" + testNsStr + ":7040"}, inboundPorts, &wg); err != nil {
+		t.Error(err)
+		return
+	}
+
+	serverSshPeer.AddOutbounds(outbounds)
+	clientSshPeer.AddInbounds(inbounds)
+
+	clientSshPeer.Ready()
+	serverSshPeer.Ready()
+
+	s := test.UdpServer("7041")
+	if s == nil {
+		t.Error("Failed - could not create server")
+		return
+	}
+	defer s.Close()
+	datagrams := [][]byte{[]byte("a"), {}, make([]byte, 40000), []byte("last")}
+	if !test.UdpClient("127.0.0.1:7040", testNs.Path(), datagrams) {
+		t.Error("Failed - not successful")
+		return
+	}
+	// A second client is carried by its own channel
+	if !test.UdpClient("127.0.0.1:7040", testNs.Path(), datagrams[:1]) {
+		t.Error("Failed - not successful")
+		return
+	}
+
+	serverSshPeer.Upgrade()
+	serverSshPeer.Close("Test Finish")
+
+	clientSshPeer.Wait()
+	if !clientSshPeer.IsUpgraded() {
+		t.Errorf("attestation phase closed without being upgraded")
+		return
+	}
+	inbounds.DelAll()
+}
+
+func TestSshProxyUnix(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clientSshPeer, serverSshPeer := getPeers(t)
+
+	dir := t.TempDir()
+	serverPath := filepath.Join(dir, "server.sock")
+	inboundPath := filepath.Join(dir, "inbound", "client.sock")
+
+	outbounds := Outbounds{}
+	if err := outbounds.AddTags([]string{"unix:ATTESTATION_PHASE:AA:" + serverPath}); err != nil {
+		t.Error(err)
+		return
+	}
+	inboundPorts := map[string]string{}
+	inbounds := Inbounds{}
+	if err := inbounds.AddTags([]string{"unix:ATTESTATION_PHASE:AA:" + inboundPath}, inboundPorts, &wg); err != nil {
+		t.Error(err)
+		return
+	}
+	if inboundPorts["AA"] != inboundPath {
+		t.Errorf("Expect inbound at %s, got %q", inboundPath, inboundPorts["AA"])
+	}
+
+	serverSshPeer.AddOutbounds(outbounds)
+	clientSshPeer.AddInbounds(inbounds)
+
+	clientSshPeer.Ready()
+	serverSshPeer.Ready()
+
+	s := test.UnixHttpServer(serverPath)
+	if s == nil {
+		t.Error("Failed - could not create server")
+		return
+	}
+	success := test.HttpClientUnix(inboundPath)
+	if !success {
+		t.Error("Failed - not successful")
+		return
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	serverSshPeer.Upgrade()
+	serverSshPeer.Close("Test Finish")
+
+	clientSshPeer.Wait()
+	if !clientSshPeer.IsUpgraded() {
+		t.Errorf("attestation phase closed without being upgraded")
+		return
+	}
+	inbounds.DelAll()
+	if _, err := os.Stat(inboundPath); err == nil {
+		t.Error("Expect inbound socket to be removed")
+	}
+}
+
+func TestDatagramStream(t *testing.T) {
+	var received [][]byte
+	datagrams := [][]byte{[]byte("abc"), {}, make([]byte, maxDatagram)}
+	next := 0
+	stream := newDatagramStream(
+		func(p []byte) (int, error) {
+			if next == len(datagrams) {
+				return 0, io.EOF
+			}
+			next++
+			return copy(p, datagrams[next-1]), nil
+		},
+		func(p []byte) error {
+			received = append(received, slices.Clone(p))
+			return nil
+		})
+
+	framed, err := io.ReadAll(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write the framed datagrams in pieces which do not align with datagram boundaries
+	for len(framed) > 0 {
+		n := min(len(framed), 3)
+		if _, err := stream.Write(framed[:n]); err != nil {
+			t.Fatal(err)
+		}
+		framed = framed[n:]
+	}
+	if len(received) != len(datagrams) {
+		t.Fatalf("Expect %d datagrams, got %d", len(datagrams), len(received))
+	}
+	for i := range datagrams {
+		if !slices.Equal(received[i], datagrams[i]) {
+			t.Errorf("Expect datagram %d of %d bytes, got %d bytes", i, len(datagrams[i]), len(received[i]))
+		}
+	}
+}
+
+func TestUdpListenerNewClients(t *testing.T) {
+	var wg sync.WaitGroup
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := newUdpListener(conn, &wg)
+	defer wg.Wait()
+	defer listener.Close()
+
+	dial := func() net.Conn {
+		client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+
+	first := dial()
+	if _, err := first.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	session, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New clients which are not accepted do not hold back the datagrams of the first client
+	for i := 0; i < udpAcceptQueueSize+2; i++ {
+		if _, err := dial().Write([]byte("b")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := first.Write([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []byte)
+	go func() {
+		buf := make([]byte, maxDatagram)
+		var got []byte
+		for len(got) < 2 {
+			n, err := session.(*udpSession).readDatagram(buf)
+			if err != nil {
+				break
+			}
+			got = append(got, buf[:n]...)
+		}
+		received <- got
+	}()
+	select {
+	case got := <-received:
+		if string(got) != "ac" {
+			t.Errorf("Expect datagrams \"ac\", got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect the datagrams of the first client to be received")
+	}
+}
+
 func TestParseTag(t *testing.T) {
 
 	tests := []struct {
@@ -306,3 +634,52 @@ func TestParseTag(t *testing.T) {
 		})
 	}
 }
+
+func TestParseProtocolTag(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		tag          string
+		wantProtocol string
+		wantPort     int
+		wantHost     string
+		wantName     string
+		wantErr      bool
+	}{
+		{name: "<Phase>:<Name>:<Port>", tag: "KUBERNETES_PHASE:nn:12", wantProtocol: TCP, wantPort: 12, wantName: "nn"},
+		{name: "tcp:<Phase>:<Name>:<Host>:<Port>", tag: "tcp:KUBERNETES_PHASE:nn:host:12", wantProtocol: TCP, wantPort: 12, wantHost: "host", wantName: "nn"},
+		{name: "udp:<Phase>:<Name>:<Port>", tag: "udp:KUBERNETES_PHASE:nn:53", wantProtocol: UDP, wantPort: 53, wantName: "nn"},
+		{name: "udp:<Phase>:<Name>:<Host>:<Port>", tag: "udp:KUBERNETES_PHASE:nn:10.0.0.1:53", wantProtocol: UDP, wantPort: 53, wantHost: "10.0.0.1", wantName: "nn"},
+		{name: "unix:<Phase>:<Name>:<Path>", tag: "unix:KUBERNETES_PHASE:nn:/run/a:b.sock", wantProtocol: UNIX, wantHost: "/run/a:b.sock", wantName: "nn"},
+		{name: "unix:<Phase>:<Name>:<Relative Path>", tag: "unix:KUBERNETES_PHASE:nn:a.sock", wantProtocol: UNIX, wantHost: "a.sock", wantName: "nn", wantErr: true},
+		{name: "unix:<Bad Phase>:<Name>:<Path>", tag: "unix:MY_PHASE:nn:/a.sock", wantProtocol: UNIX, wantHost: "/a.sock", wantName: "nn", wantErr: true},
+		{name: "unix:<Phase>:<Path>", tag: "unix:KUBERNETES_PHASE:/a.sock", wantProtocol: UNIX, wantErr: true},
+		{name: "unix:<Phase>:<Empty Name>:<Path>", tag: "unix:KUBERNETES_PHASE::/a.sock", wantProtocol: UNIX, wantErr: true},
+		{name: "<Phase>:<Empty Name>:<Port>", tag: "KUBERNETES_PHASE::12", wantProtocol: TCP, wantErr: true},
+		{name: "sctp:<Phase>:<Name>:<Port>", tag: "sctp:KUBERNETES_PHASE:nn:12", wantProtocol: TCP, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotProtocol, gotPort, gotHost, gotName, _, err := ParseProtocolTag(tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseProtocolTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotProtocol != tt.wantProtocol {
+				t.Errorf("ParseProtocolTag() gotProtocol = %v, want %v", gotProtocol, tt.wantProtocol)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotPort != tt.wantPort {
+				t.Errorf("ParseProtocolTag() gotPort = %v, want %v", gotPort, tt.wantPort)
+			}
+			if gotHost != tt.wantHost {
+				t.Errorf("ParseProtocolTag() gotHost = %v, want %v", gotHost, tt.wantHost)
+			}
+			if gotName != tt.wantName {
+				t.Errorf("ParseProtocolTag() gotName = %v, want %v", gotName, tt.wantName)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sshutil
 
 import (
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -10,6 +11,7 @@ import (
 const SSHPORT = "2222"
 const PpSecureCommsVersion = "v0.2"
 const KBS = "KBS"
+const KATAAGENT = "KATAAGENT"
 const KBS_CLIENT_SECRET = "kbs-client"
 const ADAPTOR_SSH_SECRET = "sshclient"
 
@@ -23,3 +25,16 @@ func RsaPrivateKeyPEM(pKey *rsa.PrivateKey) []byte {
 		Bytes:   x509.MarshalPKCS1PrivateKey(pKey),
 	})
 }
+
+// Ed25519PrivateKeyPEM return a PEM for the Ed25519 Private Key
+func Ed25519PrivateKeyPEM(pKey ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(pKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: nil,
+		Bytes:   der,
+	}), nil
+}
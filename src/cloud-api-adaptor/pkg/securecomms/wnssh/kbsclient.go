@@ -2,26 +2,85 @@ package wnssh
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/avast/retry-go/v4"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// kbsRequestTimeout limits each attempt of a request to Trustee, and the lifetime of the token used by the attempt
+	kbsRequestTimeout = 30 * time.Second
+	kbsAttempts       = 5
+	kbsRetryDelay     = time.Second
+	kbsMaxRetryDelay  = 10 * time.Second
+)
+
 type KbsClient struct {
-	secretKey crypto.PrivateKey
-	url       string
+	secretKey  crypto.PrivateKey
+	url        string
+	client     *http.Client
+	attempts   uint
+	retryDelay time.Duration
 }
 
+// InitKbsClient initializes a client of the Trustee KBS resource API
+// address is "<host>:<port>" or a URL. HTTP is used unless the URL scheme is https or a CA is set.
 func InitKbsClient(address string) *KbsClient {
+	url := address
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
 	return &KbsClient{
-		url: "http://" + address,
+		url:        strings.TrimSuffix(url, "/"),
+		client:     &http.Client{Timeout: kbsRequestTimeout},
+		attempts:   kbsAttempts,
+		retryDelay: kbsRetryDelay,
 	}
 }
 
+// KbsHostPort returns the "<host>:<port>" of a KBS address, which is "<host>:<port>" or a URL, for use in a tunnel tag
+// The port of a URL defaults to the port of its scheme. IPv6 hosts cannot be expressed in a tag.
+func KbsHostPort(address string) (string, error) {
+	var host, port string
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		var err error
+		if host, port, err = net.SplitHostPort(address); err != nil {
+			return "", fmt.Errorf("invalid KBS address %q: %w", address, err)
+		}
+	} else {
+		u, err := url.Parse(address)
+		if err != nil {
+			return "", fmt.Errorf("invalid KBS address %q: %w", address, err)
+		}
+		host, port = u.Hostname(), u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+	}
+	if host == "" {
+		return "", fmt.Errorf("invalid KBS address %q: no host", address)
+	}
+	if strings.Contains(host, ":") {
+		return "", fmt.Errorf("invalid KBS address %q: IPv6 hosts are not supported", address)
+	}
+	return host + ":" + port, nil
+}
+
 func (kc *KbsClient) SetPemSecret(keyBytes []byte) error {
 	key, err := jwt.ParseEdPrivateKeyFromPEM(keyBytes)
 	if err != nil {
@@ -31,13 +90,30 @@ func (kc *KbsClient) SetPemSecret(keyBytes []byte) error {
 	return nil
 }
 
+// SetCA makes the client use HTTPS and verify Trustee using the PEM encoded CA certificates in caCert
+func (kc *KbsClient) SetCA(caCert []byte) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return fmt.Errorf("SetCA no valid PEM certificate found")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	kc.client.Transport = transport
+	kc.url = "https://" + strings.TrimPrefix(strings.TrimPrefix(kc.url, "http://"), "https://")
+	return nil
+}
+
+// addToken adds a token which is valid for the duration of a single request attempt
 func (kc *KbsClient) addToken(req *http.Request) error {
 	now := time.Now()
 	//Ed25519KeyPair
 	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA,
 		jwt.MapClaims{
 			"issued_at":      now.Unix(),
-			"expires_at":     now.Add(time.Hour * 24).Unix(),
+			"expires_at":     now.Add(kbsRequestTimeout).Unix(),
 			"invalid_before": now.Unix(),
 			"audiences":      "",
 			"issuer":         "",
@@ -56,31 +132,107 @@ func (kc *KbsClient) addToken(req *http.Request) error {
 	return nil
 }
 
-func (kc *KbsClient) PostResource(path string, data []byte) error {
+// do sends a resource request to Trustee and returns the response body
+// Requests are idempotent and are retried with backoff on connection errors and server errors
+func (kc *KbsClient) do(method, path string, data []byte) (body []byte, err error) {
 	url := fmt.Sprintf("%s/kbs/v0/resource/%s", kc.url, path)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	err = retry.Do(
+		func() error {
+			req, err := http.NewRequest(method, url, bytes.NewReader(data))
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("KbsClient failed to create a %s request - %w", method, err))
+			}
+			if err := kc.addToken(req); err != nil {
+				return retry.Unrecoverable(fmt.Errorf("KbsClient: %w", err))
+			}
+			req.Header.Add("Accept", "application/octet-stream")
+
+			resp, err := kc.client.Do(req)
+			if err != nil {
+				return fmt.Errorf("KbsClient failed to send %s request to Trustee - %w", method, err)
+			}
+			defer resp.Body.Close()
+
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("KbsClient while reading the response bytes - %w", err)
+			}
+			if resp.StatusCode == http.StatusOK { // Success
+				return nil
+			}
+			err = &kbsError{status: resp.Status, statusCode: resp.StatusCode, body: string(body)}
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return retry.Unrecoverable(err)
+			}
+			return err
+		},
+		retry.Attempts(kc.attempts),
+		retry.Delay(kc.retryDelay),
+		retry.MaxDelay(kbsMaxRetryDelay),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(n uint, err error) {
+			logger.Printf("KbsClient %s %s retrying after error: %v", method, path, err)
+		}),
+	)
 	if err != nil {
-		return fmt.Errorf("KbsClient failed to create a Post request - %w", err)
+		return nil, err
+	}
+	return body, nil
+}
+
+type kbsError struct {
+	status     string
+	statusCode int
+	body       string
+}
+
+func (e *kbsError) Error() string {
+	return fmt.Sprintf("KbsClient request failed at Trustee: %s %s", e.status, e.body)
+}
+
+// PostResource sets a resource at Trustee
+func (kc *KbsClient) PostResource(path string, data []byte) error {
+	if _, err := kc.do(http.MethodPost, path, data); err != nil {
+		return fmt.Errorf("KbsClient failed to set secret %s: %w", path, err)
 	}
-	err = kc.addToken(req)
+	return nil
+}
+
+// GetResource reads a resource from Trustee
+func (kc *KbsClient) GetResource(path string) ([]byte, error) {
+	data, err := kc.do(http.MethodGet, path, nil)
 	if err != nil {
-		return fmt.Errorf("KbsClient: %w", err)
+		return nil, fmt.Errorf("KbsClient failed to get secret %s: %w", path, err)
 	}
-	req.Header.Add("Accept", "application/octet-stream")
+	return data, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Ping checks that Trustee responds to a request for the WN public key, without retries.
+// Only server errors fail, since Trustee may require attestation to read resources.
+func (kc *KbsClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/kbs/v0/resource/%s", kc.url, wnSecretPath), nil)
+	if err != nil {
+		return fmt.Errorf("KbsClient failed to create a GET request - %w", err)
+	}
+	resp, err := kc.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("KbsClient failed to send set-resource request to Trustee - %w", err)
+		return fmt.Errorf("KbsClient failed to reach Trustee - %w", err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == 200 { // Success
-		return nil
+
+	if resp.StatusCode >= 500 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &kbsError{status: resp.Status, statusCode: resp.StatusCode, body: string(body)}
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("KbsClient while reading the response bytes - %w", err)
+	return nil
+}
+
+// DeleteResource deletes a resource from Trustee. Deleting a resource which does not exist succeeds.
+func (kc *KbsClient) DeleteResource(path string) error {
+	var kErr *kbsError
+	if _, err := kc.do(http.MethodDelete, path, nil); err != nil && !(errors.As(err, &kErr) && kErr.statusCode == http.StatusNotFound) {
+		return fmt.Errorf("KbsClient failed to delete secret %s: %w", path, err)
 	}
-	return fmt.Errorf("KbsClient failed to set secret at Trustee: %s %s", resp.Status, string([]byte(body)))
+	return nil
 }
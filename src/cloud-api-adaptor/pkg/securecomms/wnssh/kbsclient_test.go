@@ -0,0 +1,181 @@
+package wnssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKbsClient(t *testing.T, address string) *KbsClient {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey err: %v", err)
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey err: %v", err)
+	}
+	kc := InitKbsClient(address)
+	if err := kc.SetPemSecret(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})); err != nil {
+		t.Fatalf("SetPemSecret err: %v", err)
+	}
+	kc.retryDelay = 10 * time.Millisecond
+	return kc
+}
+
+func TestKbsClient(t *testing.T) {
+	if s := test.KBSServer("9006"); s == nil {
+		t.Fatal("Failed - could not create server")
+	}
+	kc := newTestKbsClient(t, "127.0.0.1:9006")
+
+	if err := kc.PostResource("default/pp-abc/privateKey", []byte("secret")); err != nil {
+		t.Fatalf("PostResource: %v", err)
+	}
+	data, err := kc.GetResource("default/pp-abc/privateKey")
+	if err != nil {
+		t.Fatalf("GetResource: %v", err)
+	}
+	if !slices.Equal(data, []byte("secret")) {
+		t.Errorf("Expect %q, got %q", "secret", data)
+	}
+
+	if err := kc.DeleteResource("default/pp-abc/privateKey"); err != nil {
+		t.Fatalf("DeleteResource: %v", err)
+	}
+	if test.KBSHasResource("default/pp-abc/privateKey") {
+		t.Error("Expect resource to be deleted")
+	}
+	if err := kc.DeleteResource("default/pp-abc/privateKey"); err != nil {
+		t.Errorf("Expect no error deleting a missing resource, got %v", err)
+	}
+	if _, err := kc.GetResource("default/pp-abc/privateKey"); err == nil {
+		t.Error("Expect error reading a deleted resource")
+	}
+}
+
+func TestKbsClientTLS(t *testing.T) {
+	s, caCert := test.KBSServerTLS("9007")
+	if s == nil {
+		t.Fatal("Failed - could not create server")
+	}
+
+	kc := newTestKbsClient(t, "127.0.0.1:9007")
+	kc.attempts = 1
+	if err := kc.PostResource("default/sshclient/publicKey", []byte("key")); err == nil {
+		t.Error("Expect error using HTTP with an HTTPS server")
+	}
+
+	if err := kc.SetCA([]byte("not a certificate")); err == nil {
+		t.Error("Expect error setting an invalid CA")
+	}
+	if err := kc.SetCA(caCert); err != nil {
+		t.Fatalf("SetCA: %v", err)
+	}
+	if err := kc.PostResource("default/sshclient/publicKey", []byte("key")); err != nil {
+		t.Fatalf("PostResource: %v", err)
+	}
+	if !test.KBSHasResource("default/sshclient/publicKey") {
+		t.Error("Expect resource to be set")
+	}
+}
+
+func TestKbsClientRetry(t *testing.T) {
+	if s := test.KBSServer("9008"); s == nil {
+		t.Fatal("Failed - could not create server")
+	}
+	kc := newTestKbsClient(t, "127.0.0.1:9008")
+
+	test.KBSFailRequests(kbsAttempts - 1)
+	if err := kc.PostResource("default/pp-abc/privateKey", []byte("secret")); err != nil {
+		t.Fatalf("Expect success after retries, got %v", err)
+	}
+
+	test.KBSFailRequests(kbsAttempts)
+	if err := kc.PostResource("default/pp-abc/privateKey", []byte("secret")); err == nil {
+		t.Error("Expect error after all attempts failed")
+	}
+	test.KBSFailRequests(0)
+
+	// client errors are not retried
+	kc.retryDelay = time.Minute
+	start := time.Now()
+	if _, err := kc.GetResource("default/pp-xyz/privateKey"); err == nil {
+		t.Error("Expect error reading a missing resource")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("Expect no retries reading a missing resource")
+	}
+}
+
+func TestKbsClientToken(t *testing.T) {
+	kc := newTestKbsClient(t, "kbs-service:8080")
+
+	req, _ := http.NewRequest(http.MethodPost, "http://kbs-service:8080", nil)
+	if err := kc.addToken(req); err != nil {
+		t.Fatalf("addToken: %v", err)
+	}
+	tokenString := req.Header.Get("Authorization")[len("Bearer "):]
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	lifetime := time.Duration(claims["expires_at"].(float64)-claims["issued_at"].(float64)) * time.Second
+	if lifetime != kbsRequestTimeout {
+		t.Errorf("Expect token lifetime %s, got %s", kbsRequestTimeout, lifetime)
+	}
+}
+
+func TestKbsClientPing(t *testing.T) {
+	if s := test.KBSServer("9010"); s == nil {
+		t.Fatal("Failed - could not create server")
+	}
+	kc := newTestKbsClient(t, "127.0.0.1:9010")
+
+	// A missing resource is a client error, which shows Trustee is reachable
+	if err := kc.Ping(context.Background()); err != nil {
+		t.Errorf("Expect Trustee to be reachable, got %v", err)
+	}
+
+	test.KBSFailRequests(1)
+	if err := kc.Ping(context.Background()); err == nil {
+		t.Error("Expect error on a server error")
+	}
+	test.KBSFailRequests(0)
+
+	if err := newTestKbsClient(t, "127.0.0.1:1").Ping(context.Background()); err == nil {
+		t.Error("Expect error with an unreachable Trustee")
+	}
+}
+
+func TestKbsHostPort(t *testing.T) {
+	for address, e := range map[string]string{
+		"127.0.0.1:8080":                 "127.0.0.1:8080",
+		"kbs.example.com:8080":           "kbs.example.com:8080",
+		"http://kbs.example.com:8080/":   "kbs.example.com:8080",
+		"http://kbs.example.com":         "kbs.example.com:80",
+		"https://kbs.example.com/prefix": "kbs.example.com:443",
+	} {
+		hostPort, err := KbsHostPort(address)
+		if err != nil {
+			t.Errorf("KbsHostPort(%q) err: %v", address, err)
+		} else if hostPort != e {
+			t.Errorf("KbsHostPort(%q) expected %s, got %s", address, e, hostPort)
+		}
+	}
+
+	for _, address := range []string{"kbs.example.com", ":8080", "http://", "https://:8080", "https://[2001:db8::1]:8443"} {
+		if _, err := KbsHostPort(address); err == nil {
+			t.Errorf("KbsHostPort(%q) expected an error", address)
+		}
+	}
+}
@@ -3,10 +3,13 @@ package wnssh
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,18 +17,34 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
+	"github.com/quic-go/quic-go"
 	"golang.org/x/crypto/ssh"
 )
 
 var logger = sshutil.Logger
 
+// quicSessionCacheSize is the number of QUIC sessions a PP connection may resume
+const quicSessionCacheSize = 4
+
+// wnSecretPath is the Trustee resource of the WN public key
+const wnSecretPath = "default/sshclient/publicKey"
+
+// PpSecretSweepInterval is the interval of sweeps of the PP Secrets of deleted pods.
+// Pods outside the namespace of the Adaptor cannot own their PP Secret, so these are deleted only by the sweeps.
+const PpSecretSweepInterval = 10 * time.Minute
+
 type SshClient struct {
 	kc              *KbsClient
 	wnSigner        *ssh.Signer
+	wnPrivateKey    []byte
 	inboundStrings  []string
 	outboundStrings []string
 	sshport         string
 	wnPublicKey     []byte
+	instances       map[string]*SshClientInstance
+	rateLimits      sshproxy.RateLimits
+	transport       string
+	mutex           sync.Mutex
 }
 
 type SshClientInstance struct {
@@ -40,26 +59,47 @@ type SshClientInstance struct {
 	outbounds       sshproxy.Outbounds
 	inboundPorts    map[string]string
 	wg              sync.WaitGroup
+	wnSigner        ssh.Signer
+	wnPrivateKey    []byte
+	sessionCache    tls.ClientSessionCache
+	peer            *sshproxy.SshPeer
+	mutex           sync.Mutex
+	// ppTunnels are tunnels to add to and remove from the PP once connected
+	ppTunnels sshproxy.Tunnels
+}
+
+// CheckKbs checks that Trustee is reachable. It succeeds without Trustee.
+func (c *SshClient) CheckKbs(ctx context.Context) error {
+	if c.kc == nil {
+		return nil
+	}
+	return c.kc.Ping(ctx)
 }
 
 func PpSecretName(sid string) string {
 	return "pp-" + sid
 }
 
+func ppSecretPath(sid string) string {
+	return fmt.Sprintf("default/pp-%s/privateKey", sid)
+}
+
 // InitSshClient initializes an SSH Client at the WN
 // inbound_strings is a slice of strings where each string is an inbound tag
 // outbounds_strings is a slice of strings where each string is an outbound tag
 // Structure of an inbound tag: "<MyPort>:<InboundName>:<phase>"
 // Structure of an outbound tag: "<DesPort>:<DesHost>:<outboundName>:<phase>"
 // Phase may be "A" (Attestation), "K" (Kubernetes), or "B" (Both)
-func InitSshClient(inbound_strings, outbound_strings []string, secureCommsTrustee bool, kbsAddress string, sshport string) (*SshClient, error) {
+// kbsCACert is a PEM encoded CA certificate used to verify an HTTPS Trustee service, or nil to use HTTP
+// transport is the transport of connections to PPs, either sshproxy.SSH or sshproxy.QUIC, and sets the type of the generated keys
+func InitSshClient(inbound_strings, outbound_strings []string, secureCommsTrustee bool, kbsAddress string, kbsCACert []byte, sshport, transport string) (*SshClient, error) {
 	logger.Printf("Using PP SecureComms: InitSshClient version %s", sshutil.PpSecureCommsVersion)
 
 	// Read WN Secret
 	wnPrivateKey, wnPublicKey, err := kubemgr.KubeMgr.ReadSecret(sshutil.ADAPTOR_SSH_SECRET)
 	if err != nil {
 		// auto-create a secret
-		wnPrivateKey, wnPublicKey, err = kubemgr.KubeMgr.CreateSecret(sshutil.ADAPTOR_SSH_SECRET)
+		wnPrivateKey, wnPublicKey, err = kubemgr.KubeMgr.CreateSecret(sshutil.ADAPTOR_SSH_SECRET, keyType(transport))
 		if err != nil {
 			return nil, fmt.Errorf("failed to auto create WN secret: %w", err)
 		}
@@ -85,8 +125,12 @@ func InitSshClient(inbound_strings, outbound_strings []string, secureCommsTruste
 		if err != nil {
 			return nil, fmt.Errorf("KbsClient - %v", err)
 		}
+		if kbsCACert != nil {
+			if err := kc.SetCA(kbsCACert); err != nil {
+				return nil, fmt.Errorf("KbsClient - %v", err)
+			}
+		}
 
-		wnSecretPath := "default/sshclient/publicKey"
 		logger.Printf("Updating KBS with secret for: %s", wnSecretPath)
 		err = kc.PostResource(wnSecretPath, wnPublicKey)
 		if err != nil {
@@ -97,16 +141,42 @@ func InitSshClient(inbound_strings, outbound_strings []string, secureCommsTruste
 	sshClient := &SshClient{
 		kc:              kc,
 		wnSigner:        &signer,
+		wnPrivateKey:    wnPrivateKey,
 		inboundStrings:  inbound_strings,
 		outboundStrings: outbound_strings,
 		sshport:         sshport,
 		wnPublicKey:     wnPublicKey,
+		instances:       make(map[string]*SshClientInstance),
+		transport:       transport,
 	}
 
 	return sshClient, nil
 }
 
+// keyType returns the type of the keys of a transport, as QUIC peers authenticate using Ed25519 keys
+func keyType(transport string) kubemgr.KeyType {
+	if transport == sshproxy.QUIC {
+		return kubemgr.Ed25519Keys
+	}
+	return kubemgr.RSAKeys
+}
+
+// SetRateLimits limits the rate of tunnels of SSH channels connected from now on
+func (c *SshClient) SetRateLimits(limits sshproxy.RateLimits) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rateLimits = limits
+}
+
+func (c *SshClient) getRateLimits() sshproxy.RateLimits {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rateLimits
+}
+
 func (ci *SshClientInstance) GetPort(name string) string {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
 	var ok bool
 	var inPort string
 	inPort, ok = ci.inboundPorts[name]
@@ -117,22 +187,135 @@ func (ci *SshClientInstance) GetPort(name string) string {
 }
 func (ci *SshClientInstance) DisconnectPP(sid string) {
 
+	ci.mutex.Lock()
 	ci.inbounds.DelAll()
+	ci.mutex.Unlock()
 
 	// Cancel the VM connection
 	ci.cancel()
 	ci.wg.Wait()
 	logger.Print("SshClientInstance DisconnectPP success")
 
+	ci.sshClient.mutex.Lock()
+	delete(ci.sshClient.instances, sid)
+	ci.sshClient.mutex.Unlock()
+
 	// Remove peerPod Secret named peerPodId
 	kubemgr.KubeMgr.DeleteSecret(PpSecretName(sid))
+
+	if kc := ci.sshClient.kc; kc != nil {
+		sidSecretPath := ppSecretPath(sid)
+		if err := kc.DeleteResource(sidSecretPath); err != nil {
+			logger.Printf("Failed to DeleteResource PP Secret: %v", err)
+			return
+		}
+		logger.Printf("Deleted KBS secret for: %s", sidSecretPath)
+	}
+}
+
+// SweepPpSecrets deletes the PP Secrets of pods which no longer exist, together with their keys at KBS
+func (c *SshClient) SweepPpSecrets() {
+	deleted, err := kubemgr.KubeMgr.SweepPodSecrets()
+	if err != nil {
+		logger.Printf("Failed to sweep PP secrets: %v", err)
+		return
+	}
+	for _, secretName := range deleted {
+		if c.kc == nil || !strings.HasPrefix(secretName, PpSecretName("")) {
+			continue
+		}
+		sidSecretPath := ppSecretPath(strings.TrimPrefix(secretName, PpSecretName("")))
+		if err := c.kc.DeleteResource(sidSecretPath); err != nil {
+			logger.Printf("Failed to DeleteResource PP Secret: %v", err)
+		}
+	}
+	logger.Printf("Swept %d PP secrets of deleted pods", len(deleted))
+}
+
+// StartPpSecretSweep sweeps the PP Secrets of deleted pods now and every interval until ctx is done
+func (c *SshClient) StartPpSecretSweep(ctx context.Context, interval time.Duration) {
+	c.SweepPpSecrets()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.SweepPpSecrets()
+			}
+		}
+	}()
 }
 
 func (c *SshClient) GetWnPublicKey() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.wnPublicKey
 }
 
-func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstance, ppPrivateKey []byte) {
+// StartKeyRotation rotates the WN keys and the keys of all PPs every interval until ctx is done
+func (c *SshClient) StartKeyRotation(ctx context.Context, interval time.Duration) {
+	logger.Printf("Key rotation every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.RotateKeys(); err != nil {
+					logger.Printf("Key rotation failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// RotateKeys replaces the WN keys and the keys of all connected PPs
+// Each PP is reconnected with the new keys while tunnels open on the previous connection are kept until they close
+func (c *SshClient) RotateKeys() error {
+	wnPrivateKey, wnPublicKey, err := kubemgr.KubeMgr.RotateSecret(sshutil.ADAPTOR_SSH_SECRET, keyType(c.transport))
+	if err != nil {
+		return fmt.Errorf("failed to rotate WN secret: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(wnPrivateKey)
+	if err != nil {
+		return fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	if c.kc != nil {
+		logger.Printf("Updating KBS with secret for: %s", wnSecretPath)
+		if err := c.kc.PostResource(wnSecretPath, wnPublicKey); err != nil {
+			return fmt.Errorf("failed to PostResource WN Secret: %v", err)
+		}
+	}
+
+	c.mutex.Lock()
+	c.wnSigner = &signer
+	c.wnPrivateKey = wnPrivateKey
+	c.wnPublicKey = wnPublicKey
+	instances := make([]*SshClientInstance, 0, len(c.instances))
+	for _, ci := range c.instances {
+		instances = append(instances, ci)
+	}
+	c.mutex.Unlock()
+
+	var errs []error
+	for _, ci := range instances {
+		if err := ci.rotateKeys(signer, wnPrivateKey, wnPublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("PP %s: %w", ci.sid, err))
+		}
+	}
+	logger.Printf("Key rotation of %d PPs done with %d failures", len(instances), len(errs))
+	return errors.Join(errs...)
+}
+
+// InitPP initializes the connection to a PP of a pod
+// The PP Secret is deleted by SweepPpSecrets once the pod no longer exists
+func (c *SshClient) InitPP(ctx context.Context, sid, podName, podNamespace string) (ci *SshClientInstance, ppPrivateKey []byte) {
 	// Create peerPod Secret named peerPodId
 	var ppPublicKey []byte
 	var err error
@@ -142,7 +325,7 @@ func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstan
 	logger.Printf("InitPP read/create PP secret named: %s", PpSecretName(sid))
 	ppPrivateKey, ppPublicKey, err = kubemgr.KubeMgr.ReadSecret(PpSecretName(sid))
 	if err != nil {
-		ppPrivateKey, ppPublicKey, err = kubemgr.KubeMgr.CreateSecret(PpSecretName(sid))
+		ppPrivateKey, ppPublicKey, err = kubemgr.KubeMgr.CreatePodSecret(PpSecretName(sid), podName, podNamespace, keyType(c.transport))
 		if err != nil {
 			logger.Printf("Failed to create PP secret: %v", err)
 			return
@@ -154,7 +337,7 @@ func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstan
 
 	if c.kc != nil {
 		// >>> Update the KBS about the SID's Secret !!! <<<
-		sidSecretPath := fmt.Sprintf("default/pp-%s/privateKey", sid)
+		sidSecretPath := ppSecretPath(sid)
 		logger.Printf("Updating KBS with secret for: %s", sidSecretPath)
 		err = c.kc.PostResource(sidSecretPath, ppPrivateKey)
 		if err != nil {
@@ -174,6 +357,9 @@ func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstan
 		ppSshPublicKeyBytes = ppSshPublicKey.Marshal()
 	}
 
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	ctx, cancel := context.WithCancel(ctx)
 	ci = &SshClientInstance{
 		sid:             sid,
@@ -183,6 +369,9 @@ func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstan
 		cancel:          cancel,
 		inboundPorts:    make(map[string]string),
 		kubernetesPhase: kubernetesPhase,
+		wnSigner:        *c.wnSigner,
+		wnPrivateKey:    c.wnPrivateKey,
+		sessionCache:    tls.NewLRUClientSessionCache(quicSessionCacheSize),
 	}
 
 	if err := ci.inbounds.AddTags(c.inboundStrings, ci.inboundPorts, &ci.wg); err != nil {
@@ -193,9 +382,124 @@ func (c *SshClient) InitPP(ctx context.Context, sid string) (ci *SshClientInstan
 		logger.Fatalf("Failed to parse outbound tag %v: %v", c.outboundStrings, err)
 	}
 
+	c.instances[sid] = ci
 	return
 }
 
+func (ci *SshClientInstance) getPeer() *sshproxy.SshPeer {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+	return ci.peer
+}
+
+// connect makes peer the current Kubernetes phase peer, and returns the previous one
+func (ci *SshClientInstance) connect(peer *sshproxy.SshPeer) (prev *sshproxy.SshPeer) {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+	peer.AddTags(ci.inbounds, ci.outbounds)
+	peer.Ready()
+	prev, ci.peer = ci.peer, peer
+
+	if !ci.ppTunnels.IsEmpty() {
+		if err := peer.SendRequest(sshproxy.TUNNELS, ssh.Marshal(&ci.ppTunnels)); err != nil {
+			logger.Printf("Kubernetes phase: failed to update PP tunnels: %v", err)
+			return
+		}
+		ci.ppTunnels = sshproxy.Tunnels{}
+	}
+	return
+}
+
+// UpdateTunnels adds and removes tunnels at the WN and at the PP
+// PP tunnels are updated through the current connection, or once the PP is connected.
+func (ci *SshClientInstance) UpdateTunnels(wnTunnels, ppTunnels sshproxy.Tunnels) error {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	if !ppTunnels.IsEmpty() {
+		if ci.peer != nil {
+			if err := ci.peer.SendRequest(sshproxy.TUNNELS, ssh.Marshal(&ppTunnels)); err != nil {
+				return fmt.Errorf("failed to update PP tunnels: %w", err)
+			}
+		} else {
+			// Queued tunnels which are removed again are not added
+			for _, name := range ppTunnels.Remove {
+				ci.ppTunnels.Inbounds = dropTags(ci.ppTunnels.Inbounds, name)
+				ci.ppTunnels.Outbounds = dropTags(ci.ppTunnels.Outbounds, name)
+			}
+			ci.ppTunnels.Inbounds = append(ci.ppTunnels.Inbounds, ppTunnels.Inbounds...)
+			ci.ppTunnels.Outbounds = append(ci.ppTunnels.Outbounds, ppTunnels.Outbounds...)
+			ci.ppTunnels.Remove = append(ci.ppTunnels.Remove, ppTunnels.Remove...)
+		}
+	}
+
+	if err := wnTunnels.Apply(&ci.inbounds, &ci.outbounds, ci.inboundPorts, &ci.wg, ci.peer); err != nil {
+		return fmt.Errorf("failed to update WN tunnels: %w", err)
+	}
+	return nil
+}
+
+// dropTags returns the tags which are not tags of the tunnel name
+func dropTags(tags []string, name string) []string {
+	return slices.DeleteFunc(tags, func(tag string) bool {
+		_, _, tagName, _, err := sshproxy.ParseTag(tag)
+		return err == nil && tagName == name
+	})
+}
+
+// rotateKeys replaces the PP keys and reconnects to the PP using the new keys
+// The PP is sent its new keys directly, unless it obtains them from KBS
+func (ci *SshClientInstance) rotateKeys(wnSigner ssh.Signer, wnPrivateKey, wnPublicKey []byte) error {
+	peer := ci.getPeer()
+	if peer == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ppPrivateKey, ppPublicKey, err := kubemgr.KubeMgr.RotateSecret(PpSecretName(ci.sid), keyType(ci.sshClient.transport))
+	if err != nil {
+		return fmt.Errorf("failed to rotate PP secret: %w", err)
+	}
+	ppSshPublicKey, _, _, _, err := ssh.ParseAuthorizedKey(ppPublicKey)
+	if err != nil {
+		return fmt.Errorf("unable to ParseAuthorizedKey serverPublicKey: %v", err)
+	}
+
+	var payload []byte
+	if kc := ci.sshClient.kc; kc != nil {
+		sidSecretPath := ppSecretPath(ci.sid)
+		logger.Printf("Updating KBS with secret for: %s", sidSecretPath)
+		if err := kc.PostResource(sidSecretPath, ppPrivateKey); err != nil {
+			return fmt.Errorf("failed to PostResource PP Secret: %v", err)
+		}
+	} else {
+		payload = ssh.Marshal(&sshproxy.RotateKeys{
+			PpPrivateKey: ppPrivateKey,
+			WnPublicKey:  wnPublicKey,
+		})
+	}
+
+	if err := peer.SendRequest(sshproxy.ROTATE, payload); err != nil {
+		return err
+	}
+
+	ci.mutex.Lock()
+	ci.ppPublicKey = ppSshPublicKey.Marshal()
+	ci.wnSigner = wnSigner
+	ci.wnPrivateKey = wnPrivateKey
+	// Sessions of the previous keys cannot be resumed
+	ci.sessionCache = tls.NewLRUClientSessionCache(quicSessionCacheSize)
+	ci.mutex.Unlock()
+
+	newPeer := ci.StartSshClient(ci.ctx, sshproxy.KUBERNETES, ppSshPublicKey.Marshal(), ci.sid)
+	if newPeer == nil {
+		return fmt.Errorf("kubernetes phase: failed StartSshClient with rotated keys")
+	}
+	// The previous connection serves its open tunnels until they close
+	ci.connect(newPeer).Drain()
+	logger.Printf("Kubernetes phase: keys rotated")
+	return nil
+}
+
 func (ci *SshClientInstance) Start(ipAddr []netip.Addr) error {
 	ppAddr := make([]string, len(ipAddr))
 	for i, ip := range ipAddr {
@@ -240,17 +544,26 @@ func (ci *SshClientInstance) Start(ipAddr []netip.Addr) error {
 func (ci *SshClientInstance) StartKubernetes() error {
 	ctx, cancel := context.WithCancel(ci.ctx)
 	defer cancel()
-	peer := ci.StartSshClient(ctx, sshproxy.KUBERNETES, ci.ppPublicKey, ci.sid)
+	ci.mutex.Lock()
+	ppPublicKey := ci.ppPublicKey
+	ci.mutex.Unlock()
+	peer := ci.StartSshClient(ctx, sshproxy.KUBERNETES, ppPublicKey, ci.sid)
 	if peer == nil {
 
 		return fmt.Errorf("kubernetes phase: failed StartSshClient")
 	}
 
-	peer.AddTags(ci.inbounds, ci.outbounds)
+	ci.connect(peer)
 
-	peer.Ready()
-	peer.Wait()
-	return nil
+	// A key rotation replaces the peer, wait for the latest peer
+	for {
+		peer.Wait()
+		next := ci.getPeer()
+		if next == peer {
+			return nil
+		}
+		peer = next
+	}
 }
 
 func (ci *SshClientInstance) StartAttestation() error {
@@ -271,23 +584,31 @@ func (ci *SshClientInstance) StartAttestation() error {
 }
 
 func (ci *SshClientInstance) StartSshClient(ctx context.Context, phase string, publicKey []byte, sid string) *sshproxy.SshPeer {
+	if ci.sshClient.transport == sshproxy.QUIC {
+		return ci.startQuicClient(ctx, phase, publicKey, sid)
+	}
+
+	ci.mutex.Lock()
+	wnSigner := ci.wnSigner
+	ci.mutex.Unlock()
+
 	config := &ssh.ClientConfig{
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			if len(publicKey) == 0 {
 				logger.Printf("%s phase: ssh skipped validating server's host key (type %s) during attestation", phase, key.Type())
 				return nil
 			}
-			if !bytes.Equal(key.Marshal(), ci.ppPublicKey) {
+			if !bytes.Equal(key.Marshal(), publicKey) {
 				logger.Printf("%s phase: ssh host key mismatch - %s", phase, key.Type())
 				return fmt.Errorf("%s phase: ssh host key mismatch", phase)
 			}
 			logger.Printf("%s phase: ssh host key match - %s", phase, key.Type())
 			return nil
 		},
-		HostKeyAlgorithms: []string{"rsa-sha2-256", "rsa-sha2-512"},
+		HostKeyAlgorithms: []string{"rsa-sha2-256", "rsa-sha2-512", ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256},
 		Auth: []ssh.AuthMethod{
 			// Use the PublicKeys method for remote authentication.
-			ssh.PublicKeys(*ci.sshClient.wnSigner),
+			ssh.PublicKeys(wnSigner),
 		},
 		Timeout: 5 * time.Minute,
 	}
@@ -310,6 +631,63 @@ func (ci *SshClientInstance) StartSshClient(ctx context.Context, phase string, p
 					continue
 				}
 				peer = sshproxy.NewSshPeer(ctx, phase, netConn, chans, sshReqs, sid)
+				if peer != nil {
+					peer.SetRateLimits(ci.sshClient.getRateLimits())
+				}
+				return nil
+			}
+			return errors.New("Retry")
+		},
+		retry.Attempts(100),
+		retry.Context(ctx),
+		retry.MaxDelay(5*time.Second),
+	)
+	return peer
+}
+
+// startQuicClient connects to the PP over QUIC using mutual TLS
+// Kubernetes phase sessions are resumed when reconnecting, such that requests are sent without waiting for a handshake round trip.
+func (ci *SshClientInstance) startQuicClient(ctx context.Context, phase string, publicKey []byte, sid string) *sshproxy.SshPeer {
+	ci.mutex.Lock()
+	wnPrivateKey := ci.wnPrivateKey
+	sessionCache := ci.sessionCache
+	ci.mutex.Unlock()
+
+	var ppPublicKey ssh.PublicKey
+	if len(publicKey) > 0 {
+		var err error
+		if ppPublicKey, err = ssh.ParsePublicKey(publicKey); err != nil {
+			logger.Printf("%s phase: unable to parse PP public key: %v", phase, err)
+			return nil
+		}
+	} else {
+		logger.Printf("%s phase: quic skips validating server's key during attestation", phase)
+	}
+	tlsConfig, err := sshproxy.QuicTLSConfig(wnPrivateKey, ppPublicKey)
+	if err != nil {
+		logger.Printf("%s phase: %v", phase, err)
+		return nil
+	}
+	if phase == sshproxy.KUBERNETES {
+		tlsConfig.ClientSessionCache = sessionCache
+	}
+
+	var peer *sshproxy.SshPeer
+	_ = retry.Do(
+		func() error {
+			for _, ppAddr := range ci.ppAddr {
+				conn, err := quic.DialAddrEarly(ctx, ppAddr, tlsConfig, sshproxy.QuicConfig())
+				if err != nil {
+					logger.Printf("%s phase: unable to connect to %s: %v", phase, ppAddr, err)
+					continue
+				}
+				logger.Printf("%s phase: quic connected - %s (0-RTT %v)", phase, conn.RemoteAddr(), conn.ConnectionState().Used0RTT)
+				peer = sshproxy.NewQuicPeer(ctx, phase, conn, sid)
+				if peer == nil {
+					// The PP may reject 0-RTT data of a session it cannot resume, the session is renewed when retrying
+					continue
+				}
+				peer.SetRateLimits(ci.sshClient.getRateLimits())
 				return nil
 			}
 			return errors.New("Retry")
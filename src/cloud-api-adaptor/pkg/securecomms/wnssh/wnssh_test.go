@@ -1,15 +1,21 @@
 package wnssh
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/ppssh"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSshProxyReverseKBS(t *testing.T) {
@@ -26,7 +32,7 @@ func TestSshProxyReverseKBS(t *testing.T) {
 	test.CreatePKCS8Secret(t)
 
 	// CAA Initialization
-	sshClient, err := InitSshClient([]string{"KUBERNETES_PHASE:KATAAGENT:0"}, []string{"BOTH_PHASES:KBS:9001", "KUBERNETES_PHASE:KUBEAPI:26443", "KUBERNETES_PHASE:DNS:8053"}, true, "127.0.0.1:9001", sshport)
+	sshClient, err := InitSshClient([]string{"KUBERNETES_PHASE:KATAAGENT:0"}, []string{"BOTH_PHASES:KBS:9001", "KUBERNETES_PHASE:KUBEAPI:26443", "KUBERNETES_PHASE:DNS:8053"}, true, "127.0.0.1:9001", nil, sshport, sshproxy.SSH)
 	if err != nil {
 		log.Fatalf("InitSshClient %v", err)
 	}
@@ -34,7 +40,7 @@ func TestSshProxyReverseKBS(t *testing.T) {
 	////////// CAA StartVM
 	ipAddr, _ := netip.ParseAddr("127.0.0.1") // ipAddr of the VM
 	ipAddrs := []netip.Addr{ipAddr}
-	ci, _ := sshClient.InitPP(context.Background(), "sid")
+	ci, _ := sshClient.InitPP(context.Background(), "sid", "", "")
 	if ci == nil {
 		log.Fatalf("failed InitiatePeerPodTunnel")
 	}
@@ -70,3 +76,181 @@ func TestSshProxyReverseKBS(t *testing.T) {
 	ci.DisconnectPP("sid")
 	cancel2()
 }
+
+// echo writes msg to conn and expects to read it back
+func echo(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !bytes.HasPrefix(buf[:n], []byte(msg)) {
+		t.Fatalf("Expect %q, got %q", msg, buf[:n])
+	}
+}
+
+// dialWithWnKey tries to login to the PP using a WN private key
+func dialWithWnKey(addr string, wnPrivateKey []byte) error {
+	signer, err := ssh.ParsePrivateKey(wnPrivateKey)
+	if err != nil {
+		return err
+	}
+	config := &ssh.ClientConfig{
+		HostKeyCallback:   ssh.InsecureIgnoreHostKey(),
+		HostKeyAlgorithms: []string{"rsa-sha2-256", "rsa-sha2-512"},
+		Auth:              []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		Timeout:           10 * time.Second,
+	}
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func testKeyRotation(t *testing.T, trustee bool, sshport, kbsPort, ppKbsPort, agentPort, sid string) {
+	kubemgr.InitKubeMgrMock()
+
+	var outbounds []string
+	if trustee {
+		if s := test.KBSServer(kbsPort); s == nil {
+			t.Fatal("Failed - could not create server")
+		}
+		test.CreatePKCS8Secret(t)
+		outbounds = append(outbounds, "BOTH_PHASES:KBS:"+kbsPort)
+	}
+	go test.Server(agentPort)
+
+	// CAA Initialization
+	sshClient, err := InitSshClient([]string{"KUBERNETES_PHASE:KATAAGENT:0"}, outbounds, trustee, "127.0.0.1:"+kbsPort, nil, sshport, sshproxy.SSH)
+	if err != nil {
+		t.Fatalf("InitSshClient %v", err)
+	}
+
+	////////// CAA StartVM
+	ipAddr, _ := netip.ParseAddr("127.0.0.1") // ipAddr of the VM
+	ci, ppPrivateKey := sshClient.InitPP(context.Background(), sid, "", "")
+	if ci == nil {
+		t.Fatalf("failed InitiatePeerPodTunnel")
+	}
+	inPort := ci.GetPort("KATAAGENT")
+
+	// create a podvm
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ppSecrets := ppssh.NewPpSecrets(ppssh.GetSecret(test.NewGetKeyClient(ppKbsPort).GetKey))
+	if trustee {
+		ppSecrets.AddKey(ppssh.WN_PUBLIC_KEY)
+		ppSecrets.AddKey(ppssh.PP_PRIVATE_KEY)
+	} else {
+		ppSecrets.SetKey(ppssh.WN_PUBLIC_KEY, sshClient.GetWnPublicKey())
+		ppSecrets.SetKey(ppssh.PP_PRIVATE_KEY, ppPrivateKey)
+	}
+	sshServer := ppssh.NewSshServer([]string{"BOTH_PHASES:KBS:" + ppKbsPort}, []string{"KUBERNETES_PHASE:KATAAGENT:127.0.0.1:" + agentPort}, ppSecrets, sshport)
+	_ = sshServer.Start(ctx)
+
+	if err := ci.Start([]netip.Addr{ipAddr}); err != nil {
+		t.Fatalf("failed ci.Start: %s", err)
+	}
+
+	// the agent connection is kept open during the key rotation
+	agentConn, err := net.Dial("tcp", "127.0.0.1:"+inPort)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer agentConn.Close()
+	echo(t, agentConn, "before rotation")
+
+	oldWnPrivateKey, _, err := kubemgr.KubeMgr.ReadSecret(sshutil.ADAPTOR_SSH_SECRET)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	oldPeer := ci.getPeer()
+
+	if err := sshClient.RotateKeys(); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if ci.getPeer() == oldPeer {
+		t.Fatal("Expect a new peer after rotation")
+	}
+	echo(t, agentConn, "after rotation")
+
+	newConn, err := net.Dial("tcp", "127.0.0.1:"+inPort)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	echo(t, newConn, "new connection")
+	newConn.Close()
+
+	if err := dialWithWnKey("127.0.0.1:"+sshport, oldWnPrivateKey); err == nil {
+		t.Error("Expect the previous WN key to be rejected")
+	}
+
+	// the previous peer is closed once the agent connection is closed
+	// with Trustee, the idle KBS connections of the PP keep the previous peer open
+	agentConn.Close()
+	if trustee {
+		ci.DisconnectPP(sid)
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		oldPeer.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Error("Expect the previous peer to be closed")
+	}
+
+	////////// CAA StopVM
+	ci.DisconnectPP(sid)
+}
+
+func TestKeyRotationKBS(t *testing.T) {
+	testKeyRotation(t, true, "6004", "9005", "7032", "7122", "rotate-kbs")
+}
+
+func TestKeyRotation(t *testing.T) {
+	testKeyRotation(t, false, "6005", "", "7033", "7123", "rotate")
+}
+
+func TestStartPpSecretSweep(t *testing.T) {
+	kubemgr.InitKubeMgrMock()
+	sshClient := &SshClient{}
+
+	if _, _, err := kubemgr.KubeMgr.CreatePodSecret(PpSecretName("sid-1"), "gone-1", "default", kubemgr.RSAKeys); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sshClient.StartPpSecretSweep(ctx, 10*time.Millisecond)
+
+	if _, _, err := kubemgr.KubeMgr.ReadSecret(PpSecretName("sid-1")); err == nil {
+		t.Error("Expect the PP secret of a deleted pod to be swept on start")
+	}
+
+	if _, _, err := kubemgr.KubeMgr.CreatePodSecret(PpSecretName("sid-2"), "gone-2", "default", kubemgr.RSAKeys); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	for i := 0; ; i++ {
+		if _, _, err := kubemgr.KubeMgr.ReadSecret(PpSecretName("sid-2")); err != nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Expect the PP secret of a deleted pod to be swept periodically")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
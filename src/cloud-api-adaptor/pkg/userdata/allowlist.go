@@ -0,0 +1,60 @@
+package userdata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AllowlistPath is the file baked into the pod VM image that overrides the files process-user-data writes
+const AllowlistPath = "/etc/peerpod/user-data-allowlist.yaml"
+
+// Allowlist lists the files process-user-data writes. Lists which are not set keep their defaults.
+type Allowlist struct {
+	// WriteFiles are the write_files of the user data which are written
+	WriteFiles []string `yaml:"write_files"`
+	// InitdataFiles are the files of the initdata which are written
+	InitdataFiles []string `yaml:"initdata_files"`
+	// SecretFiles are written with 0600 permissions unless the user data sets their permissions
+	SecretFiles []string `yaml:"secret_files"`
+}
+
+// LoadAllowlist overrides the files written by process-user-data with the lists of an allowlist file.
+// A missing allowlist file keeps the defaults.
+func (c *Config) LoadAllowlist(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Printf("Allowlist %s not found, using the default allowlist.\n", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist: %w", err)
+	}
+
+	var allowlist Allowlist
+	if err := yaml.UnmarshalStrict(data, &allowlist); err != nil {
+		return fmt.Errorf("failed to parse allowlist %s: %w", path, err)
+	}
+	for _, list := range [][]string{allowlist.WriteFiles, allowlist.InitdataFiles, allowlist.SecretFiles} {
+		for _, file := range list {
+			if !filepath.IsAbs(file) || filepath.Clean(file) != file {
+				return fmt.Errorf("allowlist %s has invalid path %q, paths must be absolute and clean", path, file)
+			}
+		}
+	}
+
+	if allowlist.WriteFiles != nil {
+		c.writeFiles = allowlist.WriteFiles
+	}
+	if allowlist.InitdataFiles != nil {
+		c.initdataFiles = allowlist.InitdataFiles
+	}
+	if allowlist.SecretFiles != nil {
+		c.secretFiles = allowlist.SecretFiles
+	}
+	logger.Printf("Loaded allowlist %s\n", path)
+	return nil
+}
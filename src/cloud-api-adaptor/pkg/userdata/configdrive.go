@@ -0,0 +1,162 @@
+package userdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kdomanski/iso9660"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ConfigDriveLabelDir = "/dev/disk/by-label"
+	// Ref: https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
+	NoCloudUserData = "user-data"
+	NoCloudMetaData = "meta-data"
+	// Ref: https://cloudinit.readthedocs.io/en/latest/reference/datasources/configdrive.html
+	OpenStackUserData = "openstack/latest/user_data"
+	OpenStackMetaData = "openstack/latest/meta_data.json"
+)
+
+// configDriveLabels are the labels of cloud-init NoCloud and OpenStack config drives
+var configDriveLabels = []string{"cidata", "CIDATA", "config-2", "CONFIG-2"}
+
+// configDrive is a block device holding cloud-init user data and meta data
+type configDrive struct {
+	device   string
+	label    string
+	userData string
+	metaData string
+}
+
+// findConfigDrive returns the first config drive found in the label directory
+func findConfigDrive(labelDir string) (*configDrive, error) {
+	for _, label := range configDriveLabels {
+		device := filepath.Join(labelDir, label)
+		if _, err := os.Stat(device); err != nil {
+			continue
+		}
+		if strings.EqualFold(label, "config-2") {
+			return &configDrive{device: device, label: label, userData: OpenStackUserData, metaData: OpenStackMetaData}, nil
+		}
+		return &configDrive{device: device, label: label, userData: NoCloudUserData, metaData: NoCloudMetaData}, nil
+	}
+	return nil, fmt.Errorf("no config drive found in %s", labelDir)
+}
+
+// configDriveHostname returns the hostname of the config drive meta data
+func configDriveHostname(metaData []byte) string {
+	var md struct {
+		LocalHostname string `yaml:"local-hostname" json:"local-hostname"`
+		Hostname      string `yaml:"hostname" json:"hostname"`
+	}
+	// OpenStack meta data is JSON, NoCloud meta data is YAML
+	if err := json.Unmarshal(metaData, &md); err != nil {
+		if err := yaml.Unmarshal(metaData, &md); err != nil {
+			return ""
+		}
+	}
+	if md.LocalHostname != "" {
+		return md.LocalHostname
+	}
+	return md.Hostname
+}
+
+// mountFunc mounts a block device read-only and returns the mount point and a function to unmount it
+type mountFunc func(ctx context.Context, device string) (string, func(), error)
+
+// mountReadOnly mounts a block device read-only at a temporary mount point
+func mountReadOnly(ctx context.Context, device string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "config-drive-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create mount point: %s", err)
+	}
+	if out, err := exec.CommandContext(ctx, "mount", "-o", "ro", device, dir).CombinedOutput(); err != nil {
+		os.Remove(dir)
+		return "", nil, fmt.Errorf("failed to mount %s: %s: %s", device, err, out)
+	}
+	unmount := func() {
+		if out, err := exec.Command("umount", dir).CombinedOutput(); err != nil {
+			logger.Printf("failed to unmount %s: %s: %s\n", dir, err, out)
+			return
+		}
+		os.Remove(dir)
+	}
+	return dir, unmount, nil
+}
+
+// readISOFile reads a file of an ISO9660 image, matching names as the Linux isofs driver does
+func readISOFile(image *iso9660.Image, path string) ([]byte, error) {
+	file, err := image.RootDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(path, "/") {
+		children, err := file.GetChildren()
+		if err != nil {
+			return nil, err
+		}
+		file = nil
+		for _, child := range children {
+			if strings.EqualFold(child.Name(), name) {
+				file = child
+				break
+			}
+		}
+		if file == nil {
+			return nil, os.ErrNotExist
+		}
+	}
+	if file.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	return io.ReadAll(file.Reader())
+}
+
+// readConfigDrive reads files of a config drive block device.
+// ISO9660 drives are parsed directly, other drives such as vfat ones are mounted read-only.
+// Files which do not exist are returned as nil.
+func readConfigDrive(ctx context.Context, device string, paths []string, mount mountFunc) ([][]byte, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config drive: %s", err)
+	}
+	defer f.Close()
+
+	files := make([][]byte, len(paths))
+	if image, err := iso9660.OpenImage(f); err == nil {
+		for i, path := range paths {
+			data, err := readISOFile(image, path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read %s: %s", path, err)
+			}
+			files[i] = data
+		}
+		return files, nil
+	}
+
+	if mount == nil {
+		mount = mountReadOnly
+	}
+	dir, unmount, err := mount(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	defer unmount()
+
+	for i, path := range paths {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read file: %s", err)
+		}
+		files[i] = data
+	}
+	return files, nil
+}
@@ -0,0 +1,124 @@
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maxUserDataSize limits the size of decompressed user data
+const maxUserDataSize = 16 * 1024 * 1024
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decodeContent decodes a user data or write_files content using the encodings supported by cloud-init
+func decodeContent(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(value), nil
+	case "base64", "b64":
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode b64 encoded userData: %s", err)
+		}
+		return decoded, nil
+	case "gzip+base64", "gz+b64", "gzip+b64", "gz+base64":
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode b64 encoded userData: %s", err)
+		}
+		return gunzip(decoded)
+	default:
+		return nil, fmt.Errorf("unsupported userData encoding: %s", encoding)
+	}
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip userData: %s", err)
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(r, maxUserDataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip userData: %s", err)
+	}
+	if len(decompressed) > maxUserDataSize {
+		return nil, fmt.Errorf("decompressed userData exceeds %d bytes", maxUserDataSize)
+	}
+	return decompressed, nil
+}
+
+// decompressUserData decompresses gzipped user data, which cloud-init detects by the gzip magic number
+func decompressUserData(userData []byte) ([]byte, error) {
+	if !bytes.HasPrefix(userData, gzipMagic) {
+		return userData, nil
+	}
+	return gunzip(userData)
+}
+
+// isMultiPart checks if user data is a MIME multi-part message
+func isMultiPart(userData []byte) bool {
+	header := strings.ToLower(string(userData[:min(len(userData), 64)]))
+	return strings.HasPrefix(header, "content-type: multipart/") || strings.HasPrefix(header, "mime-version:")
+}
+
+// parseMultiPart merges the write_files of the cloud-config parts of MIME multi-part user data
+// https://cloudinit.readthedocs.io/en/latest/explanation/format.html#mime-multi-part-archive
+func parseMultiPart(userData []byte) (*CloudConfig, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(userData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multi-part userData: %s", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multi-part userData content type: %s", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unsupported userData content type: %s", mediaType)
+	}
+
+	var cc CloudConfig
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multi-part userData: %s", err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multi-part userData: %s", err)
+		}
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			if content, err = decodeContent(string(content), "base64"); err != nil {
+				return nil, err
+			}
+		}
+		if content, err = decompressUserData(content); err != nil {
+			return nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if partType != "text/cloud-config" && !bytes.HasPrefix(content, []byte("#cloud-config")) {
+			logger.Printf("Skipped userData part of type %s\n", partType)
+			continue
+		}
+		var partConfig CloudConfig
+		if err := yaml.Unmarshal(content, &partConfig); err != nil {
+			return nil, err
+		}
+		cc.WriteFiles = append(cc.WriteFiles, partConfig.WriteFiles...)
+	}
+	return &cc, nil
+}
@@ -0,0 +1,25 @@
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// guestInfoReader reads guestinfo variables set in the vSphere VM configuration
+type guestInfoReader interface {
+	get(ctx context.Context, key string) (string, error)
+}
+
+// rpcToolReader reads guestinfo variables using the VMware backdoor interface of open-vm-tools
+type rpcToolReader struct{}
+
+func (rpcToolReader) get(ctx context.Context, key string) (string, error) {
+	out, err := exec.CommandContext(ctx, VSphereRpcTool, "info-get "+key).Output()
+	if err != nil {
+		// vmware-rpctool fails when the variable is not set
+		return "", fmt.Errorf("failed to get %s: %s", key, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
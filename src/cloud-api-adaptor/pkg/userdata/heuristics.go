@@ -3,6 +3,7 @@ package userdata
 import (
 	"context"
 	"os"
+	"runtime"
 
 	. "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
 	"github.com/klauspost/cpuid/v2"
@@ -12,6 +13,10 @@ func isAzureVM() bool {
 	return cpuid.CPU.HypervisorVendorID == cpuid.MSVM
 }
 
+func isVSphereVM() bool {
+	return cpuid.CPU.HypervisorVendorID == cpuid.VMware
+}
+
 func isAWSVM(ctx context.Context) bool {
 	if cpuid.CPU.HypervisorVendorID != cpuid.KVM {
 		return false
@@ -28,6 +33,23 @@ func isGCPVM(ctx context.Context) bool {
 	return err == nil
 }
 
+func isIBMCloudVM(ctx context.Context) bool {
+	// IBM Cloud VPC runs s390x VMs as well, which cpuid does not detect
+	if runtime.GOARCH != "s390x" && cpuid.CPU.HypervisorVendorID != cpuid.KVM {
+		return false
+	}
+	_, err := ibmcloudImdsToken(ctx, IBMCloudImdsTokenUrl)
+	return err == nil
+}
+
+func isIBMPowerVSVM() bool {
+	if runtime.GOARCH != "ppc64le" {
+		return false
+	}
+	_, err := os.Stat(IBMPowerVSConfigDrive)
+	return err == nil
+}
+
 func hasUserDataFile() bool {
 	_, err := os.Stat(UserDataPath)
 	if err != nil && os.IsNotExist(err) {
@@ -35,3 +57,8 @@ func hasUserDataFile() bool {
 	}
 	return true
 }
+
+func hasConfigDrive() bool {
+	_, err := findConfigDrive(ConfigDriveLabelDir)
+	return err == nil
+}
@@ -3,9 +3,11 @@ package userdata
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type kvPair struct {
@@ -14,6 +16,10 @@ type kvPair struct {
 }
 
 func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byte, error) {
+	return imdsRequest(ctx, http.MethodGet, url, "", b64, headers)
+}
+
+func imdsRequest(ctx context.Context, method, url, reqBody string, b64 bool, headers []kvPair) ([]byte, error) {
 	// If url is empty then return empty string
 	if url == "" {
 		return nil, fmt.Errorf("url is empty")
@@ -22,7 +28,11 @@ func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byt
 	// Create a new HTTP client
 	client := &http.Client{}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	var bodyReader io.Reader
+	if reqBody != "" {
+		bodyReader = strings.NewReader(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %s", err)
 
@@ -61,3 +71,46 @@ func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byt
 	}
 	return decoded, nil
 }
+
+// ibmcloudImdsToken exchanges the instance identity token used to access the IBM Cloud VPC metadata service
+func ibmcloudImdsToken(ctx context.Context, tokenUrl string) (string, error) {
+	body, err := imdsRequest(ctx, http.MethodPut, tokenUrl, `{"expires_in": 300}`, false, []kvPair{
+		{"Metadata-Flavor", "ibm"},
+		{"Content-Type", "application/json"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to parse instance identity token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("instance identity token is empty")
+	}
+	return token.AccessToken, nil
+}
+
+// ibmcloudImdsGetUserData gets the user data from the IBM Cloud VPC metadata service
+func ibmcloudImdsGetUserData(ctx context.Context, tokenUrl, userDataUrl string) ([]byte, error) {
+	token, err := ibmcloudImdsToken(ctx, tokenUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance identity token: %w", err)
+	}
+
+	body, err := imdsGet(ctx, userDataUrl, false, []kvPair{{"Authorization", "Bearer " + token}})
+	if err != nil {
+		return nil, err
+	}
+
+	var initialization struct {
+		UserData string `json:"user_data"`
+	}
+	if err := json.Unmarshal(body, &initialization); err != nil {
+		return nil, fmt.Errorf("failed to parse instance initialization: %s", err)
+	}
+	return []byte(initialization.UserData), nil
+}
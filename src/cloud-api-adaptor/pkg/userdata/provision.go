@@ -2,23 +2,24 @@ package userdata
 
 import (
 	"context"
-	"crypto/sha256"
-	"crypto/sha512"
-	"encoding/base64"
-	"encoding/hex"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/avast/retry-go/v4"
-	toml "github.com/pelletier/go-toml/v2"
 	"gopkg.in/yaml.v2"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	. "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/paths"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 const (
@@ -34,12 +35,24 @@ const (
 	// Ref: https://cloud.google.com/compute/docs/storing-retrieving-metadata
 	GcpImdsUrl         = "http://metadata.google.internal/computeMetadata/v1/instance"
 	GcpUserDataImdsUrl = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/user-data"
+	// Ref: https://cloudinit.readthedocs.io/en/latest/reference/datasources/vmware.html
+	VSphereRpcTool             = "vmware-rpctool"
+	VSphereUserDataKey         = "guestinfo.userdata"
+	VSphereUserDataEncodingKey = "guestinfo.userdata.encoding"
+	// Ref: https://cloud.ibm.com/docs/vpc?topic=vpc-imd-metadata-service-api
+	IBMCloudImdsTokenUrl    = "http://169.254.169.254/instance_identity/v1/token?version=2022-03-01"
+	IBMCloudUserDataImdsUrl = "http://169.254.169.254/metadata/v1/instance/initialization?version=2022-03-01"
+	// PowerVS attaches an OpenStack config drive
+	IBMPowerVSConfigDrive = "/dev/disk/by-label/config-2"
 )
 
 var logger = log.New(log.Writer(), "[userdata/provision] ", log.LstdFlags|log.Lmsgprefix)
 var WriteFilesList = []string{AACfgPath, CDHCfgPath, ForwarderCfgPath, AuthFilePath, InitDataPath}
 var InitdDataFilesList = []string{AACfgPath, CDHCfgPath, PolicyPath}
 
+// SecretFilesList are the files written with 0600 permissions unless the user data sets their permissions
+var SecretFilesList = []string{ForwarderCfgPath, AuthFilePath}
+
 type Config struct {
 	fetchTimeout  int
 	digestPath    string
@@ -47,6 +60,13 @@ type Config struct {
 	parentPath    string
 	writeFiles    []string
 	initdataFiles []string
+	secretFiles   []string
+	// verificationKey verifies the signature of the user data when set
+	verificationKey ed25519.PublicKey
+	// decryptionKey decrypts the sealed write_files when set
+	decryptionKey *ecdh.PrivateKey
+	// requireSigned refuses user data without a valid signature
+	requireSigned bool
 }
 
 func NewConfig(fetchTimeout int) *Config {
@@ -57,12 +77,47 @@ func NewConfig(fetchTimeout int) *Config {
 		digestPath:    DigestPath,
 		writeFiles:    WriteFilesList,
 		initdataFiles: InitdDataFilesList,
+		secretFiles:   SecretFilesList,
 	}
 }
 
+// SetUserDataKeys sets the keys verifying and decrypting the user data sealed by the cloud-api-adaptor.
+// With requireSigned, user data without a valid signature is refused.
+func (c *Config) SetUserDataKeys(verificationKeyPath, decryptionKeyPath string, requireSigned bool) error {
+	if requireSigned && verificationKeyPath == "" {
+		return fmt.Errorf("signed user data is required without a verification key")
+	}
+	c.requireSigned = requireSigned
+
+	if verificationKeyPath != "" {
+		data, err := os.ReadFile(verificationKeyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read verification key: %w", err)
+		}
+		if c.verificationKey, err = cloudinit.ParseVerificationKey(data); err != nil {
+			return fmt.Errorf("failed to parse verification key %s: %w", verificationKeyPath, err)
+		}
+	}
+
+	if decryptionKeyPath != "" {
+		data, err := os.ReadFile(decryptionKeyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read decryption key: %w", err)
+		}
+		if c.decryptionKey, err = cloudinit.ParseDecryptionKey(data); err != nil {
+			return fmt.Errorf("failed to parse decryption key %s: %w", decryptionKeyPath, err)
+		}
+	}
+	return nil
+}
+
 type WriteFile struct {
-	Path    string `yaml:"path"`
-	Content string `yaml:"content"`
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Owner       string `yaml:"owner,omitempty"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Encoding    string `yaml:"encoding,omitempty"`
+	Append      bool   `yaml:"append,omitempty"`
 }
 
 type CloudConfig struct {
@@ -105,6 +160,116 @@ func (g GCPUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
 	return imdsGet(ctx, url, true, []kvPair{{"Metadata-Flavor", "Google"}})
 }
 
+type VSphereUserDataProvider struct {
+	DefaultRetry
+	reader guestInfoReader
+}
+
+func (v VSphereUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	reader := v.reader
+	if reader == nil {
+		reader = rpcToolReader{}
+	}
+	logger.Printf("provider: vSphere, userDataKey: %s\n", VSphereUserDataKey)
+	userData, err := reader.get(ctx, VSphereUserDataKey)
+	if err != nil {
+		return nil, err
+	}
+	// The encoding is optional, plain user data has none
+	encoding, err := reader.get(ctx, VSphereUserDataEncodingKey)
+	if err != nil {
+		encoding = ""
+	}
+	return decodeContent(userData, encoding)
+}
+
+type IBMCloudUserDataProvider struct{ DefaultRetry }
+
+func (i IBMCloudUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	url := IBMCloudUserDataImdsUrl
+	logger.Printf("provider: IBM Cloud, userDataUrl: %s\n", url)
+	return ibmcloudImdsGetUserData(ctx, IBMCloudImdsTokenUrl, url)
+}
+
+type IBMPowerVSUserDataProvider struct {
+	DefaultRetry
+	device string
+	mount  mountFunc
+}
+
+func (i IBMPowerVSUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	device := i.device
+	if device == "" {
+		device = IBMPowerVSConfigDrive
+	}
+	logger.Printf("provider: IBM PowerVS, configDrive: %s\n", device)
+	files, err := readConfigDrive(ctx, device, []string{OpenStackUserData}, i.mount)
+	if err != nil {
+		return nil, err
+	}
+	if files[0] == nil {
+		return nil, fmt.Errorf("config drive %s has no %s", device, OpenStackUserData)
+	}
+	return files[0], nil
+}
+
+type ConfigDriveUserDataProvider struct {
+	DefaultRetry
+	labelDir string
+	mount    mountFunc
+}
+
+func (c ConfigDriveUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	labelDir := c.labelDir
+	if labelDir == "" {
+		labelDir = ConfigDriveLabelDir
+	}
+	drive, err := findConfigDrive(labelDir)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("provider: ConfigDrive, configDrive: %s, label: %s\n", drive.device, drive.label)
+	files, err := readConfigDrive(ctx, drive.device, []string{drive.userData, drive.metaData}, c.mount)
+	if err != nil {
+		return nil, err
+	}
+	if files[0] == nil {
+		return nil, fmt.Errorf("config drive %s has no %s", drive.device, drive.userData)
+	}
+	if hostname := configDriveHostname(files[1]); hostname != "" {
+		logger.Printf("config drive meta data hostname: %s\n", hostname)
+	}
+	return files[0], nil
+}
+
+// verifyingProvider verifies the signature of the user data of a provider
+type verifyingProvider struct {
+	UserDataProvider
+	verificationKey ed25519.PublicKey
+	requireSigned   bool
+}
+
+func (v verifyingProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	userData, err := v.UserDataProvider.GetUserData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The signature is part of gzipped user data
+	if userData, err = decompressUserData(userData); err != nil {
+		return nil, err
+	}
+	signed, err := cloudinit.Verify(userData, v.verificationKey)
+	if errors.Is(err, cloudinit.ErrUnsigned) && !v.requireSigned {
+		logger.Printf("user data is not signed, signed user data is not required\n")
+		return userData, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("user data signature verified\n")
+	return signed, nil
+}
+
 type FileUserDataProvider struct{ DefaultRetry }
 
 func (a FileUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
@@ -129,6 +294,19 @@ func newProvider(ctx context.Context) (UserDataProvider, error) {
 		return AzureUserDataProvider{}, nil
 	}
 
+	if isIBMPowerVSVM() {
+		return IBMPowerVSUserDataProvider{}, nil
+	}
+
+	// Config drives are found without http req as well, e.g. the cidata ISO of libvirt
+	if hasConfigDrive() {
+		return ConfigDriveUserDataProvider{}, nil
+	}
+
+	if isVSphereVM() {
+		return VSphereUserDataProvider{}, nil
+	}
+
 	if isAWSVM(ctx) {
 		return AWSUserDataProvider{}, nil
 	}
@@ -137,6 +315,10 @@ func newProvider(ctx context.Context) (UserDataProvider, error) {
 		return GCPUserDataProvider{}, nil
 	}
 
+	if isIBMCloudVM(ctx) {
+		return IBMCloudUserDataProvider{}, nil
+	}
+
 	return nil, fmt.Errorf("unsupported user data provider")
 }
 
@@ -174,30 +356,143 @@ func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*Cloud
 	return &cc, err
 }
 
+// parseUserData parses a cloud-config, which may be gzipped or a MIME multi-part message.
+// Modules other than write_files are ignored, as they are processed by cloud-init.
 func parseUserData(userData []byte) (*CloudConfig, error) {
-	var cc CloudConfig
-	err := yaml.UnmarshalStrict(userData, &cc)
+	userData, err := decompressUserData(userData)
 	if err != nil {
 		return nil, err
 	}
+	if isMultiPart(userData) {
+		return parseMultiPart(userData)
+	}
+	var cc CloudConfig
+	if err := yaml.Unmarshal(userData, &cc); err != nil {
+		return nil, err
+	}
 	return &cc, nil
 }
 
+// fileAttributes are the permissions, owner and append mode of a written file
+type fileAttributes struct {
+	mode   os.FileMode
+	owner  string
+	append bool
+}
+
 func writeFile(path string, bytes []byte) error {
+	return writeFileWithAttributes(path, bytes, fileAttributes{mode: 0644})
+}
+
+func writeFileWithAttributes(path string, bytes []byte, attrs fileAttributes) error {
 	// Ensure the parent directory exists
 	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	err = os.WriteFile(path, bytes, 0644)
+	uid, gid := -1, -1
+	if attrs.owner != "" {
+		if uid, gid, err = lookupOwner(attrs.owner); err != nil {
+			return fmt.Errorf("failed to look up owner of %s: %w", path, err)
+		}
+	}
+
+	var f *os.File
+	if attrs.append {
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, attrs.mode)
+	} else {
+		// Write a temporary file and rename it, such that the content is never readable with other permissions
+		f, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+		if err == nil {
+			defer os.Remove(f.Name())
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to write file %s: %w", path, err)
 	}
+	defer f.Close()
+
+	if err := f.Chmod(attrs.mode); err != nil {
+		return fmt.Errorf("failed to set permissions of file %s: %w", path, err)
+	}
+	if uid >= 0 {
+		if err := f.Chown(uid, gid); err != nil {
+			return fmt.Errorf("failed to set owner of file %s: %w", path, err)
+		}
+	}
+	if _, err := f.Write(bytes); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	if !attrs.append {
+		if err := os.Rename(f.Name(), path); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+	}
 	logger.Printf("Wrote %s\n", path)
 	return nil
 }
 
+// lookupOwner looks up the uid and gid of an owner in the user:group format of cloud-init.
+// Users and groups are names or ids, and the group defaults to the primary group of the user.
+func lookupOwner(owner string) (int, int, error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return -1, -1, fmt.Errorf("unknown user %s", userName)
+		}
+	}
+	gidStr := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return -1, -1, fmt.Errorf("unknown group %s", groupName)
+			}
+		}
+		gidStr = g.Gid
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, err
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return -1, -1, err
+	}
+	return uid, gid, nil
+}
+
+// parsePermissions parses the octal permissions of a file, such as 0644
+func parsePermissions(permissions string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.Trim(permissions, "'\""), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid permissions %s", permissions)
+	}
+	return os.FileMode(mode), nil
+}
+
+// fileAttributes returns the attributes of a file written from user data. Known secret files are only
+// readable by root unless the user data sets their permissions.
+func (c *Config) fileAttributes(wf WriteFile) (fileAttributes, error) {
+	attrs := fileAttributes{mode: 0644, owner: wf.Owner, append: wf.Append}
+	if isAllowed(wf.Path, c.secretFiles) {
+		attrs.mode = 0600
+	}
+	if wf.Permissions != "" {
+		mode, err := parsePermissions(wf.Permissions)
+		if err != nil {
+			return attrs, fmt.Errorf("file %s has %w", wf.Path, err)
+		}
+		attrs.mode = mode
+	}
+	return attrs, nil
+}
+
 func isAllowed(path string, filesList []string) bool {
 	for _, listedFile := range filesList {
 		if listedFile == path {
@@ -211,8 +506,32 @@ func processCloudConfig(cfg *Config, cc *CloudConfig) error {
 	for _, wf := range cc.WriteFiles {
 		path := wf.Path
 		bytes := []byte(wf.Content)
+		switch wf.Encoding {
+		case "":
+		case "base64", "b64", "gzip+base64", "gz+b64", "gzip+b64", "gz+base64":
+			decoded, err := decodeContent(wf.Content, wf.Encoding)
+			if err != nil {
+				return fmt.Errorf("failed to decode file %s: %w", path, err)
+			}
+			bytes = decoded
+		case cloudinit.SealedEncoding:
+			if cfg.decryptionKey == nil {
+				return fmt.Errorf("file %s is sealed without a decryption key", path)
+			}
+			plain, err := cloudinit.Unseal(wf.Content, path, cfg.decryptionKey)
+			if err != nil {
+				return fmt.Errorf("failed to unseal file %s: %w", path, err)
+			}
+			bytes = plain
+		default:
+			return fmt.Errorf("file %s has unsupported encoding %s", path, wf.Encoding)
+		}
 		if isAllowed(path, cfg.writeFiles) {
-			if err := writeFile(path, bytes); err != nil {
+			attrs, err := cfg.fileAttributes(wf)
+			if err != nil {
+				return err
+			}
+			if err := writeFileWithAttributes(path, bytes, attrs); err != nil {
 				return fmt.Errorf("failed to write config file %s: %w", path, err)
 			}
 		} else {
@@ -239,20 +558,17 @@ func extractInitdataAndHash(cfg *Config) error {
 		return fmt.Errorf("Error read initdata file: %w", err)
 	}
 
-	decodedBytes, err := base64.StdEncoding.DecodeString(string(dataBytes))
-	if err != nil {
-		return fmt.Errorf("Error base64 decode initdata: %w", err)
-	}
-	initdata := initdata.InitData{}
-	err = toml.Unmarshal(decodedBytes, &initdata)
+	// The initdata was checked strictly at CreateVM, so newer fields or versions are accepted here
+	decodedBytes, data, err := initdata.DecodeLenient(string(dataBytes))
 	if err != nil {
-		return fmt.Errorf("Error unmarshalling initdata: %w", err)
+		return fmt.Errorf("Error parsing initdata: %w", err)
 	}
 
-	for key, value := range initdata.Data {
+	for key, value := range data.Data {
 		path := filepath.Join(cfg.parentPath, key)
 		if isAllowed(path, cfg.initdataFiles) {
-			if err := writeFile(path, []byte(value)); err != nil {
+			attrs, _ := cfg.fileAttributes(WriteFile{Path: path})
+			if err := writeFileWithAttributes(path, []byte(value), attrs); err != nil {
 				return fmt.Errorf("Error write a file in initdata: %w", err)
 			}
 		} else {
@@ -260,19 +576,9 @@ func extractInitdataAndHash(cfg *Config) error {
 		}
 	}
 
-	checksumStr := ""
-	switch initdata.Algorithm {
-	case "sha256":
-		hash := sha256.Sum256(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	case "sha384":
-		hash := sha512.Sum384(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	case "sha512":
-		hash := sha512.Sum512(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	default:
-		return fmt.Errorf("Error creating initdata hash, the Algorithm %s not supported", initdata.Algorithm)
+	checksumStr, err := initdata.Digest(decodedBytes, data.Algorithm)
+	if err != nil {
+		return fmt.Errorf("Error creating initdata hash: %w", err)
 	}
 
 	err = writeFile(cfg.digestPath, []byte(checksumStr)) // the hash in digestPath will also be used by attester
@@ -293,7 +599,13 @@ func ProvisionFiles(cfg *Config) error {
 	// some providers rely on cloud-init provision config files
 	// all providers need extract files from initdata and calculate the hash value for attesters usage
 	provider, _ := newProvider(ctx)
+	if provider == nil && cfg.requireSigned {
+		return fmt.Errorf("signed user data is required with an unsupported user data provider")
+	}
 	if provider != nil {
+		if cfg.verificationKey != nil {
+			provider = verifyingProvider{UserDataProvider: provider, verificationKey: cfg.verificationKey, requireSigned: cfg.requireSigned}
+		}
 		cc, err := retrieveCloudConfig(ctx, provider)
 		if err != nil {
 			return fmt.Errorf("failed to retrieve cloud config: %w", err)
@@ -1,8 +1,16 @@
 package userdata
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +20,9 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/kdomanski/iso9660"
 )
 
 var testDaemonConfig string = `{
@@ -272,6 +283,220 @@ func TestInvalidGetUserDataEmptyUrl(t *testing.T) {
 	}
 }
 
+// startIBMCloudTestServer starts a server simulating the IBM Cloud VPC metadata service
+func startIBMCloudTestServer(t *testing.T, userData string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/instance_identity/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Metadata-Flavor") != "ibm" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "test-token", "expires_in": 300}`)
+	})
+	mux.HandleFunc("/metadata/v1/instance/initialization", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"user_data": userData}); err != nil {
+			t.Error(err)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestIBMCloudImdsGetUserData tests getting user data from the IBM Cloud VPC metadata service
+func TestIBMCloudImdsGetUserData(t *testing.T) {
+	userData := "#cloud-config\nwrite_files: []\n"
+	srv := startIBMCloudTestServer(t, userData)
+	tokenUrl := srv.URL + "/instance_identity/v1/token?version=2022-03-01"
+	userDataUrl := srv.URL + "/metadata/v1/instance/initialization?version=2022-03-01"
+
+	got, err := ibmcloudImdsGetUserData(context.Background(), tokenUrl, userDataUrl)
+	if err != nil {
+		t.Fatalf("failed to get user data: %v", err)
+	}
+	if string(got) != userData {
+		t.Errorf("got user data %q, want %q", got, userData)
+	}
+
+	// Token exchange fails
+	if _, err := ibmcloudImdsGetUserData(context.Background(), srv.URL+"/invalid", userDataUrl); err == nil {
+		t.Error("Expect error without instance identity token")
+	}
+
+	// User data requires the token
+	if _, err := imdsGet(context.Background(), userDataUrl, false, nil); err == nil {
+		t.Error("Expect error without authorization")
+	}
+}
+
+// TestIBMPowerVSUserDataProvider tests reading user data from a PowerVS config drive
+func TestIBMPowerVSUserDataProvider(t *testing.T) {
+	userData := "#cloud-config\nwrite_files: []\n"
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "openstack/latest"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, OpenStackUserData), []byte(userData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PowerVS config drive is not an ISO9660 image, such that it is mounted
+	device := filepath.Join(t.TempDir(), "config-2")
+	if err := os.WriteFile(device, []byte("vfat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mounted, unmounted string
+	mount := func(ctx context.Context, device string) (string, func(), error) {
+		mounted = device
+		return dir, func() { unmounted = device }, nil
+	}
+	provider := IBMPowerVSUserDataProvider{device: device, mount: mount}
+	got, err := provider.GetUserData(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get user data: %v", err)
+	}
+	if string(got) != userData {
+		t.Errorf("got user data %q, want %q", got, userData)
+	}
+	if mounted != device || unmounted != device {
+		t.Errorf("Expect config drive to be mounted and unmounted, mounted %q, unmounted %q", mounted, unmounted)
+	}
+
+	// The config drive is unmounted when user data is missing
+	unmounted = ""
+	if err := os.Remove(filepath.Join(dir, OpenStackUserData)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.GetUserData(context.Background()); err == nil {
+		t.Error("Expect error without user data")
+	}
+	if unmounted != device {
+		t.Error("Expect config drive to be unmounted")
+	}
+}
+
+// createConfigDriveISO creates a config drive ISO9660 image as the libvirt provider does
+func createConfigDriveISO(t *testing.T, path, label string, files map[string]string) {
+	writer, err := iso9660.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Cleanup() //nolint:errcheck
+	for name, content := range files {
+		if err := writer.AddFile(strings.NewReader(content), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := writer.WriteTo(f, label); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConfigDriveUserDataProvider tests discovering and reading config drives
+func TestConfigDriveUserDataProvider(t *testing.T) {
+	userData := "#cloud-config\nwrite_files: []\n"
+	noMount := func(ctx context.Context, device string) (string, func(), error) {
+		return "", nil, fmt.Errorf("unexpected mount of %s", device)
+	}
+
+	t.Run("cidata", func(t *testing.T) {
+		labelDir := t.TempDir()
+		createConfigDriveISO(t, filepath.Join(labelDir, "cidata"), "cidata", map[string]string{
+			NoCloudUserData: userData,
+			NoCloudMetaData: "local-hostname: podvm-test",
+		})
+		provider := ConfigDriveUserDataProvider{labelDir: labelDir, mount: noMount}
+		got, err := provider.GetUserData(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get user data: %v", err)
+		}
+		if string(got) != userData {
+			t.Errorf("got user data %q, want %q", got, userData)
+		}
+	})
+
+	t.Run("config-2", func(t *testing.T) {
+		labelDir := t.TempDir()
+		createConfigDriveISO(t, filepath.Join(labelDir, "config-2"), "config-2", map[string]string{
+			OpenStackUserData: userData,
+			OpenStackMetaData: `{"hostname": "podvm-test"}`,
+		})
+		provider := ConfigDriveUserDataProvider{labelDir: labelDir, mount: noMount}
+		got, err := provider.GetUserData(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get user data: %v", err)
+		}
+		if string(got) != userData {
+			t.Errorf("got user data %q, want %q", got, userData)
+		}
+	})
+
+	t.Run("vfat", func(t *testing.T) {
+		labelDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(labelDir, "CIDATA"), []byte("vfat"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, NoCloudUserData), []byte(userData), 0644); err != nil {
+			t.Fatal(err)
+		}
+		unmounted := false
+		mount := func(ctx context.Context, device string) (string, func(), error) {
+			return dir, func() { unmounted = true }, nil
+		}
+		provider := ConfigDriveUserDataProvider{labelDir: labelDir, mount: mount}
+		got, err := provider.GetUserData(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get user data: %v", err)
+		}
+		if string(got) != userData {
+			t.Errorf("got user data %q, want %q", got, userData)
+		}
+		if !unmounted {
+			t.Error("Expect config drive to be unmounted")
+		}
+	})
+
+	t.Run("missing user data", func(t *testing.T) {
+		labelDir := t.TempDir()
+		createConfigDriveISO(t, filepath.Join(labelDir, "cidata"), "cidata", map[string]string{
+			NoCloudMetaData: "local-hostname: podvm-test",
+		})
+		provider := ConfigDriveUserDataProvider{labelDir: labelDir, mount: noMount}
+		if _, err := provider.GetUserData(context.Background()); err == nil {
+			t.Error("Expect error without user data")
+		}
+	})
+
+	t.Run("no config drive", func(t *testing.T) {
+		provider := ConfigDriveUserDataProvider{labelDir: t.TempDir(), mount: noMount}
+		if _, err := provider.GetUserData(context.Background()); err == nil {
+			t.Error("Expect error without config drive")
+		}
+	})
+}
+
+func TestConfigDriveHostname(t *testing.T) {
+	for metaData, want := range map[string]string{
+		"local-hostname: podvm-test\ninstance-id: abc": "podvm-test",
+		`{"hostname": "podvm-test", "uuid": "abc"}`:    "podvm-test",
+		"": "",
+	} {
+		if got := configDriveHostname([]byte(metaData)); got != want {
+			t.Errorf("configDriveHostname(%q) = %q, want %q", metaData, got, want)
+		}
+	}
+}
+
 type TestProvider struct {
 	content  string
 	failNext bool
@@ -317,6 +542,287 @@ write_files:
 	}
 }
 
+type testGuestInfoReader map[string]string
+
+func (r testGuestInfoReader) get(ctx context.Context, key string) (string, error) {
+	value, ok := r[key]
+	if !ok {
+		return "", fmt.Errorf("failed to get %s: No value found", key)
+	}
+	return value, nil
+}
+
+func gzipBase64(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// TestVSphereUserDataProvider tests reading user data from vSphere guestinfo
+func TestVSphereUserDataProvider(t *testing.T) {
+	userData := "#cloud-config\nwrite_files: []\n"
+	tests := []struct {
+		name    string
+		reader  testGuestInfoReader
+		wantErr bool
+	}{
+		{name: "plain", reader: testGuestInfoReader{VSphereUserDataKey: userData}},
+		{name: "base64", reader: testGuestInfoReader{
+			VSphereUserDataKey:         base64.StdEncoding.EncodeToString([]byte(userData)),
+			VSphereUserDataEncodingKey: "base64",
+		}},
+		{name: "b64", reader: testGuestInfoReader{
+			VSphereUserDataKey:         base64.StdEncoding.EncodeToString([]byte(userData)),
+			VSphereUserDataEncodingKey: "b64",
+		}},
+		{name: "gzip+base64", reader: testGuestInfoReader{
+			VSphereUserDataKey:         gzipBase64(t, userData),
+			VSphereUserDataEncodingKey: "gzip+base64",
+		}},
+		{name: "gz+b64", reader: testGuestInfoReader{
+			VSphereUserDataKey:         gzipBase64(t, userData),
+			VSphereUserDataEncodingKey: "gz+b64",
+		}},
+		{name: "missing user data", reader: testGuestInfoReader{}, wantErr: true},
+		{name: "invalid base64", reader: testGuestInfoReader{
+			VSphereUserDataKey:         "%$#",
+			VSphereUserDataEncodingKey: "base64",
+		}, wantErr: true},
+		{name: "invalid gzip", reader: testGuestInfoReader{
+			VSphereUserDataKey:         base64.StdEncoding.EncodeToString([]byte(userData)),
+			VSphereUserDataEncodingKey: "gzip+base64",
+		}, wantErr: true},
+		{name: "unsupported encoding", reader: testGuestInfoReader{
+			VSphereUserDataKey:         userData,
+			VSphereUserDataEncodingKey: "rot13",
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := VSphereUserDataProvider{reader: tt.reader}
+			got, err := provider.GetUserData(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetUserData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != userData {
+				t.Errorf("GetUserData() = %q, want %q", got, userData)
+			}
+		})
+	}
+}
+
+func writeKeyPEM(t *testing.T, path, pemType string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSealedUserData tests verifying and decrypting user data sealed by the cloud-api-adaptor
+func TestSealedUserData(t *testing.T) {
+	tempDir := t.TempDir()
+	daemonPath := filepath.Join(tempDir, "daemon.json")
+	initdataPath := filepath.Join(tempDir, "initdata")
+
+	verificationKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptionKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verificationKeyPath := filepath.Join(tempDir, "verification.pem")
+	decryptionKeyPath := filepath.Join(tempDir, "decryption.pem")
+	der, err := x509.MarshalPKIXPublicKey(verificationKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPEM(t, verificationKeyPath, "PUBLIC KEY", der)
+	der, err = x509.MarshalPKCS8PrivateKey(decryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPEM(t, decryptionKeyPath, "PRIVATE KEY", der)
+
+	cloudConfig := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: daemonPath, Content: testDaemonConfig, Sensitive: true},
+			{Path: initdataPath, Content: "initdata\n"},
+		},
+	}
+	sealed := &cloudinit.SealedCloudConfig{CloudConfig: cloudConfig, SigningKey: signingKey, EncryptionKey: decryptionKey.PublicKey()}
+	userData, err := sealed.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := (&cloudinit.SealedCloudConfig{CloudConfig: cloudConfig}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retrieve := func(cfg *Config, content string) (*CloudConfig, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var provider UserDataProvider = &TestProvider{content: content}
+		if cfg.verificationKey != nil {
+			provider = verifyingProvider{UserDataProvider: provider, verificationKey: cfg.verificationKey, requireSigned: cfg.requireSigned}
+		}
+		return retrieveCloudConfig(ctx, provider)
+	}
+	newConfig := func() *Config {
+		return &Config{parentPath: tempDir, writeFiles: []string{daemonPath, initdataPath}}
+	}
+
+	cfg := newConfig()
+	if err := cfg.SetUserDataKeys(verificationKeyPath, decryptionKeyPath, true); err != nil {
+		t.Fatalf("failed to set user data keys: %v", err)
+	}
+	cc, err := retrieve(cfg, userData)
+	if err != nil {
+		t.Fatalf("couldn't retrieve sealed cloud config: %v", err)
+	}
+	if err := processCloudConfig(cfg, cc); err != nil {
+		t.Fatalf("failed to process sealed cloud config: %v", err)
+	}
+	if data, _ := os.ReadFile(daemonPath); string(data) != testDaemonConfig {
+		t.Fatalf("file content does not match daemon config fixture: got %q", data)
+	}
+
+	// Tampered and unsigned user data is refused
+	if _, err := retrieve(cfg, strings.Replace(userData, "initdata", "tampered", 1)); err == nil {
+		t.Fatal("Expect tampered user data to be refused")
+	}
+	if _, err := retrieve(cfg, unsigned); err == nil {
+		t.Fatal("Expect unsigned user data to be refused")
+	}
+
+	// Unsigned user data is accepted unless signed user data is required
+	cfg = newConfig()
+	if err := cfg.SetUserDataKeys(verificationKeyPath, decryptionKeyPath, false); err != nil {
+		t.Fatalf("failed to set user data keys: %v", err)
+	}
+	if _, err := retrieve(cfg, unsigned); err != nil {
+		t.Fatalf("couldn't retrieve unsigned cloud config: %v", err)
+	}
+
+	// Sealed files are refused without the decryption key
+	cfg = newConfig()
+	cc, err = retrieve(cfg, userData)
+	if err != nil {
+		t.Fatalf("couldn't retrieve signed cloud config without verification key: %v", err)
+	}
+	if err := processCloudConfig(cfg, cc); err == nil {
+		t.Fatal("Expect sealed file to be refused without decryption key")
+	}
+
+	if err := newConfig().SetUserDataKeys("", "", true); err == nil {
+		t.Fatal("Expect error requiring signed user data without verification key")
+	}
+}
+
+// TestEncodedUserData tests gzipped, multi-part and compressed user data generated by the cloud-api-adaptor
+func TestEncodedUserData(t *testing.T) {
+	tempDir := t.TempDir()
+	daemonPath := filepath.Join(tempDir, "daemon.json")
+	authPath := filepath.Join(tempDir, "auth.json")
+	initdataPath := filepath.Join(tempDir, "initdata")
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloudConfig := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: daemonPath, Content: testDaemonConfig},
+			{Path: initdataPath, Content: strings.Repeat("initdata\n", 1000)},
+		},
+	}
+	plain, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := cloudinit.UserDataLimit{Size: len(plain) / 2}
+	compressed, err := limit.Generate(cloudConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit.Gzip = true
+	gzipped, err := limit.Generate(cloudConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := limit.Generate(&cloudinit.SealedCloudConfig{CloudConfig: cloudConfig, SigningKey: signingKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiPart, err := (&cloudinit.MultiPartCloudConfig{Parts: []cloudinit.CloudConfigGenerator{
+		cloudConfig,
+		&cloudinit.CloudConfig{WriteFiles: []cloudinit.WriteFile{{Path: authPath, Content: testAuthJson, Compress: true}}},
+		stringGenerator("#!/bin/sh\necho ignored\n"),
+	}}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	extraModules := plain + "\nruncmd:\n  - echo ignored\n"
+
+	for name, tc := range map[string]struct {
+		userData string
+		files    map[string]string
+	}{
+		"compressed files": {userData: compressed},
+		"gzipped":          {userData: gzipped},
+		"signed gzipped":   {userData: signed},
+		"multi-part":       {userData: multiPart, files: map[string]string{authPath: testAuthJson}},
+		"extra modules":    {userData: extraModules},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{parentPath: tempDir, writeFiles: []string{daemonPath, authPath, initdataPath}}
+			if name == "signed gzipped" {
+				cfg.verificationKey = signingKey.Public().(ed25519.PublicKey)
+				cfg.requireSigned = true
+			}
+			var provider UserDataProvider = &TestProvider{content: tc.userData}
+			if cfg.verificationKey != nil {
+				provider = verifyingProvider{UserDataProvider: provider, verificationKey: cfg.verificationKey, requireSigned: cfg.requireSigned}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			cc, err := retrieveCloudConfig(ctx, provider)
+			if err != nil {
+				t.Fatalf("couldn't retrieve cloud config: %v", err)
+			}
+			if err := processCloudConfig(cfg, cc); err != nil {
+				t.Fatalf("failed to process cloud config: %v", err)
+			}
+			files := map[string]string{daemonPath: testDaemonConfig, initdataPath: cloudConfig.WriteFiles[1].Content}
+			for path, content := range tc.files {
+				files[path] = content
+			}
+			for path, content := range files {
+				if data, _ := os.ReadFile(path); string(data) != content {
+					t.Fatalf("file content of %s does not match: got %q", path, data)
+				}
+			}
+		})
+	}
+
+	if _, err := parseUserData([]byte("\x1f\x8bnot gzip")); err == nil {
+		t.Fatal("Expect error parsing invalid gzip user data")
+	}
+}
+
+type stringGenerator string
+
+func (s stringGenerator) Generate() (string, error) {
+	return string(s), nil
+}
+
 func indentTextBlock(text string, by int) string {
 	whiteSpace := strings.Repeat(" ", by)
 	split := strings.Split(text, "\n")
@@ -418,6 +924,120 @@ write_files:
 	}
 }
 
+// TestWriteFileAttributes tests the permissions, owner and append mode of files written from user data
+func TestWriteFileAttributes(t *testing.T) {
+	tempDir := t.TempDir()
+	daemonPath := filepath.Join(tempDir, "daemon.json")
+	aaPath := filepath.Join(tempDir, "aa.toml")
+	cdhPath := filepath.Join(tempDir, "cdh.toml")
+	policyPath := filepath.Join(tempDir, "policy.rego")
+	owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+	if err := writeFile(policyPath, []byte("package agent_policy\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	content := fmt.Sprintf(`#cloud-config
+write_files:
+- path: %s
+  content: |
+    {}
+- path: %s
+  permissions: '0640'
+  owner: %s
+  content: |
+    [token_configs]
+- path: %s
+  permissions: 0400
+  content: |
+    socket = 'unix:///run/cdh.sock'
+- path: %s
+  append: true
+  content: |
+    default ExecProcessRequest := false
+`, daemonPath, aaPath, owner, cdhPath, policyPath)
+
+	cc, err := parseUserData([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse user data: %v", err)
+	}
+	cfg := &Config{
+		parentPath:  tempDir,
+		writeFiles:  []string{daemonPath, aaPath, cdhPath, policyPath},
+		secretFiles: []string{daemonPath},
+	}
+	if err := processCloudConfig(cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config: %v", err)
+	}
+
+	for path, mode := range map[string]os.FileMode{daemonPath: 0600, aaPath: 0640, cdhPath: 0400, policyPath: 0644} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("Expect %s to have permissions %o, got %o", path, mode, info.Mode().Perm())
+		}
+	}
+	if data, _ := os.ReadFile(policyPath); string(data) != "package agent_policy\ndefault ExecProcessRequest := false\n" {
+		t.Fatalf("Expect content to be appended, got %q", data)
+	}
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 4 {
+		t.Fatalf("Expect no temporary files, got %d files", len(entries))
+	}
+
+	for _, wf := range []WriteFile{
+		{Path: aaPath, Content: "x", Permissions: "0999"},
+		{Path: aaPath, Content: "x", Permissions: "04755"},
+		{Path: aaPath, Content: "x", Owner: "no-such-user-exists"},
+	} {
+		if err := processCloudConfig(cfg, &CloudConfig{WriteFiles: []WriteFile{wf}}); err == nil {
+			t.Fatalf("Expect error writing %+v", wf)
+		}
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	tempDir := t.TempDir()
+	allowlistPath := filepath.Join(tempDir, "allowlist.yaml")
+
+	cfg := NewConfig(1)
+	if err := cfg.LoadAllowlist(filepath.Join(tempDir, "missing.yaml")); err != nil {
+		t.Fatalf("Expect missing allowlist to keep the defaults, got %v", err)
+	}
+	if len(cfg.writeFiles) != len(WriteFilesList) || len(cfg.secretFiles) != len(SecretFilesList) {
+		t.Fatalf("Expect default allowlist, got %v %v", cfg.writeFiles, cfg.secretFiles)
+	}
+
+	allowlist := "write_files:\n  - /run/peerpod/daemon.json\n  - /etc/extra.conf\nsecret_files: []\n"
+	if err := os.WriteFile(allowlistPath, []byte(allowlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadAllowlist(allowlistPath); err != nil {
+		t.Fatalf("failed to load allowlist: %v", err)
+	}
+	if !isAllowed("/etc/extra.conf", cfg.writeFiles) || isAllowed("/run/peerpod/auth.json", cfg.writeFiles) {
+		t.Fatalf("Expect write_files of the allowlist, got %v", cfg.writeFiles)
+	}
+	if len(cfg.initdataFiles) != len(InitdDataFilesList) || len(cfg.secretFiles) != 0 {
+		t.Fatalf("Expect default initdata files and no secret files, got %v %v", cfg.initdataFiles, cfg.secretFiles)
+	}
+
+	for _, allowlist := range []string{
+		"write_files:\n  - relative/path\n",
+		"write_files:\n  - /run/peerpod/../../etc/shadow\n",
+		"unknown_files:\n  - /etc/extra.conf\n",
+	} {
+		if err := os.WriteFile(allowlistPath, []byte(allowlist), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewConfig(1).LoadAllowlist(allowlistPath); err == nil {
+			t.Fatalf("Expect error loading allowlist %q", allowlist)
+		}
+	}
+}
+
 func TestProcessCloudConfigWithMalicious(t *testing.T) {
 	tempDir, _ := os.MkdirTemp("", "tmp_writefiles_root")
 	defer os.RemoveAll(tempDir)
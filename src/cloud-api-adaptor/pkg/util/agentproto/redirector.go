@@ -23,6 +23,8 @@ type Redirector interface {
 
 	Connect(ctx context.Context) error
 	Close() error
+	// Client returns the ttrpc client of the redirected connection, which can carry other services than the agent services
+	Client(ctx context.Context) (*ttrpc.Client, error)
 }
 
 type redirector struct {
@@ -83,6 +85,14 @@ func (s *redirector) Close() error {
 	return client.Close()
 }
 
+func (s *redirector) Client(ctx context.Context) (*ttrpc.Client, error) {
+
+	if err := s.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return s.ttrpcClient, nil
+}
+
 // AgentServiceService methods
 
 func (s *redirector) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (res *emptypb.Empty, err error) {
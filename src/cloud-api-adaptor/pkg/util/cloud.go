@@ -7,6 +7,33 @@ import (
 
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+)
+
+const (
+	IngressBandwidthAnnotation = "kubernetes.io/ingress-bandwidth"
+	EgressBandwidthAnnotation  = "kubernetes.io/egress-bandwidth"
+
+	// Secure comms tunnels of a pod, in addition to the tunnels configured for all pods
+	SecureCommsInboundsAnnotation    = "confidentialcontainers.org/secure-comms-inbounds"
+	SecureCommsOutboundsAnnotation   = "confidentialcontainers.org/secure-comms-outbounds"
+	SecureCommsPpInboundsAnnotation  = "confidentialcontainers.org/secure-comms-pp-inbounds"
+	SecureCommsPpOutboundsAnnotation = "confidentialcontainers.org/secure-comms-pp-outbounds"
+
+	// Requests a spot or preemptible pod VM, falling back to an on-demand pod VM without spot capacity
+	SpotInstanceAnnotation = "confidentialcontainers.org/spot-instance"
+
+	// Boot disk size of the pod VM, such as "50Gi"
+	DiskSizeAnnotation = "confidentialcontainers.org/disk-size"
+)
+
+const gib = 1024 * 1024 * 1024
+
+var (
+	minBandwidth = resource.MustParse("1k")
+	maxBandwidth = resource.MustParse("1P")
 )
 
 func GetPodName(annotations map[string]string) string {
@@ -90,7 +117,96 @@ func GetPodvmResourcesFromAnnotation(annotations map[string]string) (int64, int6
 
 // Method to get initdata from annotation
 func GetInitdataFromAnnotation(annotations map[string]string) string {
-	return annotations["io.katacontainers.config.runtime.cc_init_data"]
+	return annotations[initdata.AnnotationKey]
+}
+
+// Method to get ingress and egress bandwidth limits in bits per second from annotations.
+// The same annotations and limits as the CNI bandwidth plugin are used. Zero means no limit.
+func GetPodBandwidthFromAnnotation(annotations map[string]string) (uint64, uint64, error) {
+
+	ingress, err := parseBandwidth(annotations, IngressBandwidthAnnotation)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	egress, err := parseBandwidth(annotations, EgressBandwidthAnnotation)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ingress, egress, nil
+}
+
+func parseBandwidth(annotations map[string]string, key string) (uint64, error) {
+
+	value, ok := annotations[key]
+	if !ok {
+		return 0, nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation %q: %w", key, value, err)
+	}
+
+	if quantity.Cmp(minBandwidth) < 0 || quantity.Cmp(maxBandwidth) > 0 {
+		return 0, fmt.Errorf("invalid %s annotation %q: must be between %s and %s", key, value, minBandwidth.String(), maxBandwidth.String())
+	}
+
+	return uint64(quantity.Value()), nil
+}
+
+// Method to get the secure comms tags of the worker node and the pod VM from annotations.
+// Each annotation holds comma separated Inbound or Outbound tags.
+func GetSecureCommsTagsFromAnnotation(annotations map[string]string) (inbounds, outbounds, ppInbounds, ppOutbounds []string) {
+	return splitTags(annotations[SecureCommsInboundsAnnotation]),
+		splitTags(annotations[SecureCommsOutboundsAnnotation]),
+		splitTags(annotations[SecureCommsPpInboundsAnnotation]),
+		splitTags(annotations[SecureCommsPpOutboundsAnnotation])
+}
+
+func splitTags(value string) (tags []string) {
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Method to get whether a spot instance is requested from annotation
+func GetSpotInstanceFromAnnotation(annotations map[string]string) (bool, error) {
+
+	value, ok := annotations[SpotInstanceAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	spot, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation %q: %w", SpotInstanceAnnotation, value, err)
+	}
+
+	return spot, nil
+}
+
+// Method to get the boot disk size in GiB from annotation, rounded up. Zero means the default size.
+func GetDiskSizeFromAnnotation(annotations map[string]string) (int64, error) {
+
+	value, ok := annotations[DiskSizeAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation %q: %w", DiskSizeAnnotation, value, err)
+	}
+	if quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid %s annotation %q: must be positive", DiskSizeAnnotation, value)
+	}
+
+	return (quantity.Value() + gib - 1) / gib, nil
 }
 
 // Method to check if a string exists in a slice
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"reflect"
 	"testing"
 
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
@@ -189,3 +190,249 @@ func TestGetImageFromAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPodBandwidthFromAnnotation(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    uint64
+		want1   uint64
+		wantErr bool
+	}{
+		// Add test cases without bandwidth annotations
+		{
+			name: "no bandwidth",
+			args: args{
+				annotations: map[string]string{},
+			},
+			want:  0,
+			want1: 0,
+		},
+		// Add test cases with annotations for both ingress and egress bandwidth
+		{
+			name: "ingress and egress bandwidth",
+			args: args{
+				annotations: map[string]string{
+					IngressBandwidthAnnotation: "10M",
+					EgressBandwidthAnnotation:  "1G",
+				},
+			},
+			want:  10000000,
+			want1: 1000000000,
+		},
+		// Add test cases with annotations for only egress bandwidth
+		{
+			name: "egress bandwidth only",
+			args: args{
+				annotations: map[string]string{
+					EgressBandwidthAnnotation: "500k",
+				},
+			},
+			want:  0,
+			want1: 500000,
+		},
+		// Add test cases with annotations for invalid bandwidth value
+		{
+			name: "invalid bandwidth",
+			args: args{
+				annotations: map[string]string{
+					IngressBandwidthAnnotation: "fast",
+				},
+			},
+			wantErr: true,
+		},
+		// Add test cases with annotations for too small bandwidth value
+		{
+			name: "too small bandwidth",
+			args: args{
+				annotations: map[string]string{
+					EgressBandwidthAnnotation: "100",
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, err := GetPodBandwidthFromAnnotation(tt.args.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPodBandwidthFromAnnotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetPodBandwidthFromAnnotation() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("GetPodBandwidthFromAnnotation() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestGetSecureCommsTagsFromAnnotation(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  []string
+		want1 []string
+		want2 []string
+		want3 []string
+	}{
+		// Add test cases without secure comms annotations
+		{
+			name: "no tags",
+			args: args{
+				annotations: map[string]string{},
+			},
+		},
+		// Add test cases with annotations for worker node and pod VM tags
+		{
+			name: "worker node and pod VM tags",
+			args: args{
+				annotations: map[string]string{
+					SecureCommsInboundsAnnotation:    "KUBERNETES_PHASE:DEBUG:2022",
+					SecureCommsPpOutboundsAnnotation: "KUBERNETES_PHASE:DEBUG:127.0.0.1:22, ,KUBERNETES_PHASE:METRICS:9100",
+				},
+			},
+			want:  []string{"KUBERNETES_PHASE:DEBUG:2022"},
+			want3: []string{"KUBERNETES_PHASE:DEBUG:127.0.0.1:22", "KUBERNETES_PHASE:METRICS:9100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, got2, got3 := GetSecureCommsTagsFromAnnotation(tt.args.annotations)
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(got1, tt.want1) || !reflect.DeepEqual(got2, tt.want2) || !reflect.DeepEqual(got3, tt.want3) {
+				t.Errorf("GetSecureCommsTagsFromAnnotation() = %v %v %v %v, want %v %v %v %v", got, got1, got2, got3, tt.want, tt.want1, tt.want2, tt.want3)
+			}
+		})
+	}
+}
+
+func TestGetSpotInstanceFromAnnotation(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    bool
+		wantErr bool
+	}{
+		// Add test cases without spot instance annotation
+		{
+			name: "no spot instance",
+			args: args{
+				annotations: map[string]string{},
+			},
+			want: false,
+		},
+		// Add test cases with annotation requesting a spot instance
+		{
+			name: "spot instance",
+			args: args{
+				annotations: map[string]string{
+					SpotInstanceAnnotation: "true",
+				},
+			},
+			want: true,
+		},
+		// Add test cases with annotation for invalid spot instance value
+		{
+			name: "invalid spot instance",
+			args: args{
+				annotations: map[string]string{
+					SpotInstanceAnnotation: "maybe",
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetSpotInstanceFromAnnotation(tt.args.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSpotInstanceFromAnnotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetSpotInstanceFromAnnotation() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDiskSizeFromAnnotation(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int64
+		wantErr bool
+	}{
+		// Add test cases without disk size annotation
+		{
+			name: "no disk size",
+			args: args{
+				annotations: map[string]string{},
+			},
+			want: 0,
+		},
+		// Add test cases with annotation for disk size in GiB
+		{
+			name: "disk size",
+			args: args{
+				annotations: map[string]string{
+					DiskSizeAnnotation: "50Gi",
+				},
+			},
+			want: 50,
+		},
+		// Add test cases with annotation for disk size rounded up to GiB
+		{
+			name: "disk size rounded up",
+			args: args{
+				annotations: map[string]string{
+					DiskSizeAnnotation: "30G",
+				},
+			},
+			want: 28,
+		},
+		// Add test cases with annotation for invalid disk size value
+		{
+			name: "invalid disk size",
+			args: args{
+				annotations: map[string]string{
+					DiskSizeAnnotation: "large",
+				},
+			},
+			wantErr: true,
+		},
+		// Add test cases with annotation for zero disk size value
+		{
+			name: "zero disk size",
+			args: args{
+				annotations: map[string]string{
+					DiskSizeAnnotation: "0",
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetDiskSizeFromAnnotation(tt.args.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetDiskSizeFromAnnotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetDiskSizeFromAnnotation() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
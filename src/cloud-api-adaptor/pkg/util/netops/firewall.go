@@ -0,0 +1,162 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+)
+
+var logger = log.New(log.Writer(), "[util/netops] ", log.LstdFlags|log.Lmsgprefix)
+
+// Firewall manages packet filtering rules on a network namespace.
+//
+// Rules are grouped by their comment. A caller owns all the rules tagged with
+// a comment, and reconciles or deletes them as a group.
+type Firewall interface {
+	Backend() FirewallBackend
+	// RuleSync makes the rules tagged with comment exactly match the given rules.
+	// Missing rules are added, and stale rules are deleted.
+	// Calling RuleSync repeatedly with the same rules is a no-op.
+	RuleSync(comment string, rules []*FirewallRule) error
+	// RuleDel deletes all rules tagged with comment, and removes chains that become empty.
+	RuleDel(comment string) error
+	// RuleList gets a list of rules tagged with comment. If comment is empty, all rules are returned.
+	RuleList(comment string) ([]*FirewallRule, error)
+}
+
+type FirewallBackend string
+
+const (
+	FirewallBackendAuto     FirewallBackend = "auto"
+	FirewallBackendNFTables FirewallBackend = "nftables"
+	FirewallBackendIPTables FirewallBackend = "iptables"
+)
+
+type FirewallChain string
+
+const (
+	FirewallChainPrerouting FirewallChain = "PREROUTING"
+	FirewallChainOutput     FirewallChain = "OUTPUT"
+)
+
+// FirewallRule is a rule that exempts matching packets from connection tracking
+type FirewallRule struct {
+	Chain       FirewallChain
+	Protocol    string
+	Source      netip.Addr
+	Destination netip.Addr
+	DstPort     int
+	Comment     string
+}
+
+func (r *FirewallRule) String() string {
+
+	s := fmt.Sprintf("chain %s", r.Chain)
+	if r.Source.IsValid() {
+		s += fmt.Sprintf(" saddr %s", r.Source)
+	}
+	if r.Destination.IsValid() {
+		s += fmt.Sprintf(" daddr %s", r.Destination)
+	}
+	if r.Protocol != "" {
+		s += fmt.Sprintf(" %s", r.Protocol)
+	}
+	if r.DstPort != 0 {
+		s += fmt.Sprintf(" dport %d", r.DstPort)
+	}
+	return s + fmt.Sprintf(" notrack comment %q", r.Comment)
+}
+
+func (r *FirewallRule) equal(other *FirewallRule) bool {
+	return *r == *other
+}
+
+var firewallBackend = struct {
+	sync.Mutex
+	configured FirewallBackend
+	detected   FirewallBackend
+}{
+	configured: FirewallBackendAuto,
+}
+
+// SetFirewallBackend configures a firewall backend used by NewFirewall.
+// FirewallBackendAuto lets NewFirewall detect an available backend.
+func SetFirewallBackend(backend FirewallBackend) error {
+
+	switch backend {
+	case FirewallBackendAuto, FirewallBackendNFTables, FirewallBackendIPTables:
+	default:
+		return fmt.Errorf("unknown firewall backend: %q", backend)
+	}
+
+	firewallBackend.Lock()
+	defer firewallBackend.Unlock()
+
+	firewallBackend.configured = backend
+	firewallBackend.detected = ""
+
+	return nil
+}
+
+// DetectFirewallBackend returns nftables if the kernel of the given network namespace supports nf_tables, and iptables otherwise.
+func DetectFirewallBackend(ns Namespace) FirewallBackend {
+
+	if nftablesAvailable(ns) {
+		return FirewallBackendNFTables
+	}
+	return FirewallBackendIPTables
+}
+
+// NewFirewall returns a firewall of the given network namespace using the configured backend.
+// When the backend is auto, it is detected at the first call and reused afterwards.
+func NewFirewall(ns Namespace) (Firewall, error) {
+
+	firewallBackend.Lock()
+	backend := firewallBackend.configured
+	if backend == FirewallBackendAuto {
+		if firewallBackend.detected == "" {
+			firewallBackend.detected = DetectFirewallBackend(ns)
+			logger.Printf("firewall backend %s is detected", firewallBackend.detected)
+		}
+		backend = firewallBackend.detected
+	}
+	firewallBackend.Unlock()
+
+	switch backend {
+	case FirewallBackendNFTables:
+		return newNFTablesFirewall(ns), nil
+	case FirewallBackendIPTables:
+		return newIPTablesFirewall(ns), nil
+	}
+	return nil, fmt.Errorf("unknown firewall backend: %q", backend)
+}
+
+// syncRules computes rules to be added, and indexes of current rules to be deleted, to make current match desired
+func syncRules(current, desired []*FirewallRule) (add []*FirewallRule, del []int) {
+
+	contains := func(rules []*FirewallRule, rule *FirewallRule) bool {
+		for _, r := range rules {
+			if r.equal(rule) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range desired {
+		if !contains(current, r) && !contains(add, r) {
+			add = append(add, r)
+		}
+	}
+	for i, r := range current {
+		// Duplicated rules are deleted as well
+		if !contains(desired, r) || contains(current[:i], r) {
+			del = append(del, i)
+		}
+	}
+	return add, del
+}
@@ -0,0 +1,331 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+)
+
+const iptablesTable = "raw"
+
+var iptablesChains = map[FirewallChain]string{
+	FirewallChainPrerouting: "peerpod-PREROUTING",
+	FirewallChainOutput:     "peerpod-OUTPUT",
+}
+
+// iptablesFirewall manages rules in peerpod chains of the raw table using the iptables command
+type iptablesFirewall struct {
+	ns Namespace
+}
+
+func newIPTablesFirewall(ns Namespace) Firewall {
+	return &iptablesFirewall{ns: ns}
+}
+
+func (f *iptablesFirewall) Backend() FirewallBackend {
+	return FirewallBackendIPTables
+}
+
+func (f *iptablesFirewall) run(fn func(ipt *iptables.IPTables) error) error {
+
+	return f.ns.Run(func() error {
+
+		ipt, err := iptables.New(iptables.IPFamily(iptables.ProtocolIPv4))
+		if err != nil {
+			return fmt.Errorf("failed to initialize iptables: %w", err)
+		}
+
+		return fn(ipt)
+	})
+}
+
+func (f *iptablesFirewall) list(ipt *iptables.IPTables, comment string) ([]*FirewallRule, error) {
+
+	var rules []*FirewallRule
+
+	for base, chain := range iptablesChains {
+
+		exists, err := ipt.ChainExists(iptablesTable, chain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the existence of iptables chain %q: %w", chain, err)
+		}
+		if !exists {
+			continue
+		}
+
+		list, err := ipt.List(iptablesTable, chain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules in chain %s on table %s: %w", chain, iptablesTable, err)
+		}
+
+		for _, line := range list {
+			if !strings.HasPrefix(line, "-A ") {
+				continue
+			}
+			rule, err := iptablesParseRule(base, line)
+			if err != nil {
+				logger.Printf("ignoring iptables rule %q: %v", line, err)
+				continue
+			}
+			if comment != "" && rule.Comment != comment {
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (f *iptablesFirewall) RuleList(comment string) (rules []*FirewallRule, err error) {
+
+	err = f.run(func(ipt *iptables.IPTables) error {
+		rules, err = f.list(ipt, comment)
+		return err
+	})
+	return rules, err
+}
+
+func (f *iptablesFirewall) RuleSync(comment string, rules []*FirewallRule) error {
+
+	return f.run(func(ipt *iptables.IPTables) error {
+
+		current, err := f.list(ipt, comment)
+		if err != nil {
+			return err
+		}
+
+		add, del := syncRules(current, withComment(comment, rules))
+
+		for _, i := range del {
+			rule := current[i]
+			spec := iptablesSpec(rule)
+			if err := ipt.Delete(iptablesTable, iptablesChains[rule.Chain], spec...); err != nil {
+				return fmt.Errorf("failed to delete iptables rule \"-t %s -A %s %s\": %w", iptablesTable, iptablesChains[rule.Chain], strings.Join(spec, " "), err)
+			}
+		}
+
+		for _, rule := range add {
+
+			chain, ok := iptablesChains[rule.Chain]
+			if !ok {
+				return fmt.Errorf("unsupported iptables chain: %q", rule.Chain)
+			}
+
+			exists, err := ipt.ChainExists(iptablesTable, chain)
+			if err != nil {
+				return fmt.Errorf("failed to check the existence of iptables chain %q: %w", chain, err)
+			}
+
+			if !exists {
+				// Add "-N <chain>"
+				if err := ipt.NewChain(iptablesTable, chain); err != nil {
+					return fmt.Errorf("failed to create iptables chain %s on table %s: %w", chain, iptablesTable, err)
+				}
+			}
+			// Add "-A <base> -j <chain>"
+			if err := ipt.AppendUnique(iptablesTable, string(rule.Chain), "-j", chain); err != nil {
+				return fmt.Errorf("failed to add iptables rule \"-t %s -A %s -j %s\": %w", iptablesTable, rule.Chain, chain, err)
+			}
+
+			spec := iptablesSpec(rule)
+			if err := ipt.Append(iptablesTable, chain, spec...); err != nil {
+				return fmt.Errorf("failed to add iptables rule \"-t %s -A %s %s\": %w", iptablesTable, chain, strings.Join(spec, " "), err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (f *iptablesFirewall) RuleDel(comment string) error {
+
+	return f.run(func(ipt *iptables.IPTables) error {
+
+		current, err := f.list(ipt, comment)
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range current {
+			spec := iptablesSpec(rule)
+			if err := ipt.Delete(iptablesTable, iptablesChains[rule.Chain], spec...); err != nil {
+				return fmt.Errorf("failed to delete iptables rule \"-t %s -A %s %s\": %w", iptablesTable, iptablesChains[rule.Chain], strings.Join(spec, " "), err)
+			}
+		}
+
+		for base, chain := range iptablesChains {
+
+			exists, err := ipt.ChainExists(iptablesTable, chain)
+			if err != nil {
+				return fmt.Errorf("failed to check the existence of iptables chain %q: %w", chain, err)
+			}
+			if !exists {
+				continue
+			}
+
+			list, err := ipt.List(iptablesTable, chain)
+			if err != nil {
+				return fmt.Errorf("failed to list rules in chain %s on table %s: %w", chain, iptablesTable, err)
+			}
+
+			if len(list) > 1 {
+				// There are remaining rules other than "-N <chain>"
+				continue
+			}
+
+			// Delete "-A <base> -j <chain>"
+			if err := ipt.DeleteIfExists(iptablesTable, string(base), "-j", chain); err != nil {
+				return fmt.Errorf("failed to delete iptables rule \"-t %s -A %s -j %s\": %w", iptablesTable, base, chain, err)
+			}
+			// Delete "-N <chain>"
+			if err := ipt.DeleteChain(iptablesTable, chain); err != nil {
+				return fmt.Errorf("failed to delete iptables chain %s on table %s: %w", chain, iptablesTable, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func iptablesSpec(rule *FirewallRule) []string {
+
+	spec := []string{"-m", "comment", "--comment", rule.Comment}
+
+	if rule.Source.IsValid() {
+		spec = append(spec, "-s", rule.Source.String())
+	}
+	if rule.Destination.IsValid() {
+		spec = append(spec, "-d", rule.Destination.String())
+	}
+	if rule.Protocol != "" {
+		spec = append(spec, "-p", rule.Protocol, "-m", rule.Protocol)
+	}
+	if rule.DstPort != 0 {
+		spec = append(spec, "--dport", strconv.Itoa(rule.DstPort))
+	}
+
+	return append(spec, "-j", "NOTRACK")
+}
+
+// iptablesParseRule parses a line of "iptables -S" output generated from iptablesSpec
+func iptablesParseRule(chain FirewallChain, line string) (*FirewallRule, error) {
+
+	args, err := iptablesSplit(line)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &FirewallRule{Chain: chain}
+	var notrack bool
+
+	// Skip "-A <chain>"
+	for i := 2; i < len(args); i++ {
+
+		next := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing argument of %s", args[i])
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		var val string
+
+		switch args[i] {
+		case "-m":
+			_, err = next()
+		case "--comment":
+			rule.Comment, err = next()
+		case "-s", "-d":
+			opt := args[i]
+			if val, err = next(); err != nil {
+				break
+			}
+			// iptables -S shows addresses in the CIDR notation
+			var prefix netip.Prefix
+			if prefix, err = netip.ParsePrefix(val); err != nil {
+				break
+			}
+			if !prefix.IsSingleIP() {
+				err = fmt.Errorf("unsupported address range: %s", val)
+				break
+			}
+			if opt == "-s" {
+				rule.Source = prefix.Addr()
+			} else {
+				rule.Destination = prefix.Addr()
+			}
+		case "-p":
+			rule.Protocol, err = next()
+		case "--dport":
+			if val, err = next(); err == nil {
+				rule.DstPort, err = strconv.Atoi(val)
+			}
+		case "-j":
+			if val, err = next(); err == nil && val != "NOTRACK" {
+				err = fmt.Errorf("unsupported target: %s", val)
+			}
+			notrack = true
+		default:
+			err = fmt.Errorf("unsupported option: %s", args[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !notrack {
+		return nil, fmt.Errorf("no NOTRACK target")
+	}
+	if rule.Comment == "" {
+		return nil, fmt.Errorf("no comment")
+	}
+
+	return rule, nil
+}
+
+// iptablesSplit splits a line of "iptables -S" output into arguments. Double-quoted arguments may contain spaces.
+func iptablesSplit(line string) ([]string, error) {
+
+	var args []string
+	var arg strings.Builder
+	var quoted, escaped, inArg bool
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case c == ' ' && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote: %s", line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
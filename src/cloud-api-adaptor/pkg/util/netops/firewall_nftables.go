@@ -0,0 +1,393 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
+)
+
+const nftablesTableName = "peerpod"
+
+var nftablesHooks = map[FirewallChain]*nftables.ChainHook{
+	FirewallChainPrerouting: nftables.ChainHookPrerouting,
+	FirewallChainOutput:     nftables.ChainHookOutput,
+}
+
+var nftablesProtocols = map[string]byte{
+	"tcp": unix.IPPROTO_TCP,
+	"udp": unix.IPPROTO_UDP,
+}
+
+// nftablesFirewall manages rules in the "ip peerpod" table via netlink, without depending on the nft binary
+type nftablesFirewall struct {
+	ns *namespace
+}
+
+func newNFTablesFirewall(ns Namespace) Firewall {
+	return &nftablesFirewall{ns: ns.(*namespace)}
+}
+
+func nftablesAvailable(ns Namespace) bool {
+
+	conn, err := nftables.New(nftables.WithNetNSFd(ns.(*namespace).fd()))
+	if err != nil {
+		return false
+	}
+
+	if _, err := conn.ListTablesOfFamily(nftables.TableFamilyIPv4); err != nil {
+		return false
+	}
+	return true
+}
+
+func (f *nftablesFirewall) Backend() FirewallBackend {
+	return FirewallBackendNFTables
+}
+
+func (f *nftablesFirewall) conn() (*nftables.Conn, error) {
+
+	conn, err := nftables.New(nftables.WithNetNSFd(f.ns.fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a netlink connection for nftables (netns: %s): %w", f.ns.Path(), err)
+	}
+	return conn, nil
+}
+
+func (f *nftablesFirewall) table() *nftables.Table {
+	return &nftables.Table{
+		Name:   nftablesTableName,
+		Family: nftables.TableFamilyIPv4,
+	}
+}
+
+func (f *nftablesFirewall) chain(table *nftables.Table, name FirewallChain) *nftables.Chain {
+	return &nftables.Chain{
+		Name:     string(name),
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftablesHooks[name],
+		Priority: nftables.ChainPriorityRaw,
+	}
+}
+
+type nftablesRule struct {
+	rule   *FirewallRule
+	nfRule *nftables.Rule
+}
+
+// list gets rules in chains of the peerpod table. It returns no error if the table does not exist.
+func (f *nftablesFirewall) list(conn *nftables.Conn, comment string) ([]*nftablesRule, error) {
+
+	tables, err := conn.ListTablesOfFamily(nftables.TableFamilyIPv4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nftables tables (netns: %s): %w", f.ns.Path(), err)
+	}
+
+	var table *nftables.Table
+	for _, t := range tables {
+		if t.Name == nftablesTableName {
+			table = t
+			break
+		}
+	}
+	if table == nil {
+		return nil, nil
+	}
+
+	chains, err := conn.ListChainsOfTableFamily(nftables.TableFamilyIPv4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nftables chains (netns: %s): %w", f.ns.Path(), err)
+	}
+
+	var rules []*nftablesRule
+
+	for _, chain := range chains {
+		if chain.Table.Name != nftablesTableName {
+			continue
+		}
+		if _, ok := nftablesHooks[FirewallChain(chain.Name)]; !ok {
+			continue
+		}
+
+		nfRules, err := conn.GetRules(table, chain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nftables rules in chain %s (netns: %s): %w", chain.Name, f.ns.Path(), err)
+		}
+
+		for _, nfRule := range nfRules {
+			rule, err := nftablesParseRule(FirewallChain(chain.Name), nfRule)
+			if err != nil {
+				logger.Printf("ignoring nftables rule %d in chain %s: %v", nfRule.Handle, chain.Name, err)
+				continue
+			}
+			if comment != "" && rule.Comment != comment {
+				continue
+			}
+			rules = append(rules, &nftablesRule{rule: rule, nfRule: nfRule})
+		}
+	}
+
+	return rules, nil
+}
+
+func (f *nftablesFirewall) RuleList(comment string) ([]*FirewallRule, error) {
+
+	conn, err := f.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := f.list(conn, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*FirewallRule
+	for _, r := range current {
+		rules = append(rules, r.rule)
+	}
+	return rules, nil
+}
+
+func (f *nftablesFirewall) RuleSync(comment string, rules []*FirewallRule) error {
+
+	conn, err := f.conn()
+	if err != nil {
+		return err
+	}
+
+	current, err := f.list(conn, comment)
+	if err != nil {
+		return err
+	}
+
+	var currentRules []*FirewallRule
+	for _, r := range current {
+		currentRules = append(currentRules, r.rule)
+	}
+
+	add, del := syncRules(currentRules, withComment(comment, rules))
+	if len(add) == 0 && len(del) == 0 {
+		return nil
+	}
+
+	table := conn.AddTable(f.table())
+
+	chains := make(map[FirewallChain]*nftables.Chain)
+	for _, rule := range add {
+		chain, ok := chains[rule.Chain]
+		if !ok {
+			if _, ok := nftablesHooks[rule.Chain]; !ok {
+				return fmt.Errorf("unsupported nftables chain: %q", rule.Chain)
+			}
+			chain = conn.AddChain(f.chain(table, rule.Chain))
+			chains[rule.Chain] = chain
+		}
+
+		exprs, err := nftablesExprs(rule)
+		if err != nil {
+			return err
+		}
+
+		conn.AddRule(&nftables.Rule{
+			Table:    table,
+			Chain:    chain,
+			Exprs:    exprs,
+			UserData: userdata.AppendString(nil, userdata.TypeComment, comment),
+		})
+	}
+
+	for _, i := range del {
+		if err := conn.DelRule(current[i].nfRule); err != nil {
+			return fmt.Errorf("failed to delete nftables rule %q: %w", current[i].rule, err)
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to update nftables rules with comment %q (netns: %s): %w", comment, f.ns.Path(), err)
+	}
+
+	return nil
+}
+
+func (f *nftablesFirewall) RuleDel(comment string) error {
+
+	conn, err := f.conn()
+	if err != nil {
+		return err
+	}
+
+	current, err := f.list(conn, comment)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range current {
+		if err := conn.DelRule(r.nfRule); err != nil {
+			return fmt.Errorf("failed to delete nftables rule %q: %w", r.rule, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to delete nftables rules with comment %q (netns: %s): %w", comment, f.ns.Path(), err)
+	}
+
+	remaining, err := f.list(conn, "")
+	if err != nil {
+		return err
+	}
+	if current != nil && len(remaining) == 0 {
+		// Delete the table along with its empty chains
+		conn.DelTable(f.table())
+		if err := conn.Flush(); err != nil {
+			return fmt.Errorf("failed to delete nftables table %s (netns: %s): %w", nftablesTableName, f.ns.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+func withComment(comment string, rules []*FirewallRule) []*FirewallRule {
+
+	var list []*FirewallRule
+	for _, r := range rules {
+		rule := *r
+		rule.Comment = comment
+		list = append(list, &rule)
+	}
+	return list
+}
+
+// nftablesExprs generates expressions equivalent to "ip saddr <src> ip daddr <dst> <proto> dport <port> notrack"
+func nftablesExprs(rule *FirewallRule) ([]expr.Any, error) {
+
+	var exprs []expr.Any
+
+	if rule.Source.IsValid() {
+		if !rule.Source.Is4() {
+			return nil, fmt.Errorf("unsupported source address: %s", rule.Source)
+		}
+		src := rule.Source.As4()
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 12, Len: 4},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: src[:]},
+		)
+	}
+
+	if rule.Destination.IsValid() {
+		if !rule.Destination.Is4() {
+			return nil, fmt.Errorf("unsupported destination address: %s", rule.Destination)
+		}
+		dst := rule.Destination.As4()
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 16, Len: 4},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: dst[:]},
+		)
+	}
+
+	if rule.Protocol != "" {
+		proto, ok := nftablesProtocols[rule.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("unsupported protocol: %q", rule.Protocol)
+		}
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		)
+	}
+
+	if rule.DstPort != 0 {
+		if rule.Protocol == "" {
+			return nil, fmt.Errorf("destination port %d is specified without protocol", rule.DstPort)
+		}
+		port := binary.BigEndian.AppendUint16(nil, uint16(rule.DstPort))
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: port},
+		)
+	}
+
+	exprs = append(exprs, &expr.Counter{}, &expr.Notrack{})
+
+	return exprs, nil
+}
+
+// nftablesParseRule converts expressions generated by nftablesExprs back to a rule
+func nftablesParseRule(chain FirewallChain, nfRule *nftables.Rule) (*FirewallRule, error) {
+
+	rule := &FirewallRule{Chain: chain}
+
+	comment, ok := userdata.GetString(nfRule.UserData, userdata.TypeComment)
+	if !ok {
+		return nil, fmt.Errorf("no comment")
+	}
+	rule.Comment = comment
+
+	var loaded expr.Any
+	var notrack bool
+
+	for _, e := range nfRule.Exprs {
+		switch v := e.(type) {
+		case *expr.Payload, *expr.Meta:
+			loaded = v
+		case *expr.Cmp:
+			if v.Op != expr.CmpOpEq {
+				return nil, fmt.Errorf("unsupported comparison operator: %d", v.Op)
+			}
+			if err := nftablesParseMatch(rule, loaded, v.Data); err != nil {
+				return nil, err
+			}
+			loaded = nil
+		case *expr.Counter:
+		case *expr.Notrack:
+			notrack = true
+		default:
+			return nil, fmt.Errorf("unsupported expression: %T", e)
+		}
+	}
+
+	if !notrack {
+		return nil, fmt.Errorf("no notrack statement")
+	}
+
+	return rule, nil
+}
+
+func nftablesParseMatch(rule *FirewallRule, loaded expr.Any, data []byte) error {
+
+	switch v := loaded.(type) {
+	case *expr.Meta:
+		if v.Key != expr.MetaKeyL4PROTO || len(data) != 1 {
+			return fmt.Errorf("unsupported meta match: %d", v.Key)
+		}
+		for name, proto := range nftablesProtocols {
+			if proto == data[0] {
+				rule.Protocol = name
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported protocol: %d", data[0])
+
+	case *expr.Payload:
+		switch {
+		case v.Base == expr.PayloadBaseNetworkHeader && v.Offset == 12 && len(data) == 4:
+			rule.Source = netip.AddrFrom4([4]byte(data))
+		case v.Base == expr.PayloadBaseNetworkHeader && v.Offset == 16 && len(data) == 4:
+			rule.Destination = netip.AddrFrom4([4]byte(data))
+		case v.Base == expr.PayloadBaseTransportHeader && v.Offset == 2 && len(data) == 2:
+			rule.DstPort = int(binary.BigEndian.Uint16(data))
+		default:
+			return fmt.Errorf("unsupported payload match: base %d offset %d", v.Base, v.Offset)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("comparison without a loaded value")
+}
@@ -0,0 +1,151 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"net/netip"
+	"reflect"
+	"runtime"
+	"testing"
+
+	testutils "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/internal/testing"
+	"github.com/vishvananda/netns"
+)
+
+func TestIPTablesParseRule(t *testing.T) {
+
+	line := `-A peerpod-OUTPUT -d 192.168.0.2/32 -p udp -m comment --comment "peerpod [vni:555000]" -m udp --dport 4789 -j NOTRACK`
+
+	rule, err := iptablesParseRule(FirewallChainOutput, line)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	expected := &FirewallRule{
+		Chain:       FirewallChainOutput,
+		Protocol:    "udp",
+		Destination: netip.MustParseAddr("192.168.0.2"),
+		DstPort:     4789,
+		Comment:     "peerpod [vni:555000]",
+	}
+	if !reflect.DeepEqual(rule, expected) {
+		t.Fatalf("Expect %q, got %q", expected, rule)
+	}
+
+	for _, line := range []string{
+		`-A peerpod-OUTPUT -d 192.168.0.2/32 -p udp -m comment --comment "peerpod [vni:555000]" -j ACCEPT`,
+		`-A peerpod-OUTPUT -d 192.168.0.0/24 -m comment --comment "peerpod [vni:555000]" -j NOTRACK`,
+		`-A peerpod-OUTPUT -d 192.168.0.2/32 -j NOTRACK`,
+		`-A peerpod-OUTPUT -m comment --comment "peerpod`,
+	} {
+		if _, err := iptablesParseRule(FirewallChainOutput, line); err == nil {
+			t.Errorf("Expect error for %q, got no error", line)
+		}
+	}
+}
+
+func TestSyncRules(t *testing.T) {
+
+	r1 := &FirewallRule{Chain: FirewallChainOutput, Destination: netip.MustParseAddr("192.168.0.2"), Protocol: "udp", DstPort: 4789}
+	r2 := &FirewallRule{Chain: FirewallChainPrerouting, Source: netip.MustParseAddr("192.168.0.2"), Protocol: "udp", DstPort: 4789}
+	r3 := &FirewallRule{Chain: FirewallChainPrerouting, Source: netip.MustParseAddr("192.168.0.3"), Protocol: "udp", DstPort: 4789}
+
+	add, del := syncRules([]*FirewallRule{r1, r3, r1}, []*FirewallRule{r1, r2})
+
+	if !reflect.DeepEqual(add, []*FirewallRule{r2}) {
+		t.Errorf("Expect %q to be added, got %q", r2, add)
+	}
+	if !reflect.DeepEqual(del, []int{1, 2}) {
+		t.Errorf("Expect rules [1 2] to be deleted, got %v", del)
+	}
+
+	add, del = syncRules([]*FirewallRule{r1, r2}, []*FirewallRule{r1, r2})
+	if len(add) != 0 || len(del) != 0 {
+		t.Errorf("Expect no changes, got add: %q, del: %v", add, del)
+	}
+}
+
+func TestNFTablesFirewall(t *testing.T) {
+	testutils.SkipTestIfNotRoot(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	oldns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("Failed to get the current network namespace: %v", err)
+	}
+
+	testns, err := netns.New()
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer func() {
+		if err := netns.Set(oldns); err != nil {
+			t.Fatalf("Failed to set a network namespace: %v", err)
+		}
+		if err := testns.Close(); err != nil {
+			t.Fatalf("Failed to close a network namespace: %v", err)
+		}
+	}()
+
+	ns, err := OpenCurrentNamespace()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer ns.Close()
+
+	if DetectFirewallBackend(ns) != FirewallBackendNFTables {
+		t.Skip("nftables is not available. Skipping.")
+	}
+
+	fw := newNFTablesFirewall(ns)
+
+	const comment = "peerpod [vni:555000]"
+
+	rules := []*FirewallRule{
+		{Chain: FirewallChainOutput, Destination: netip.MustParseAddr("192.168.0.2"), Protocol: "udp", DstPort: 4789},
+		{Chain: FirewallChainPrerouting, Source: netip.MustParseAddr("192.168.0.2"), Protocol: "udp", DstPort: 4789},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := fw.RuleSync(comment, rules); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		list, err := fw.RuleList(comment)
+		if err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if len(list) != len(rules) {
+			t.Fatalf("Expect %d rules, got %q", len(rules), list)
+		}
+	}
+
+	// The pod node IP is changed
+	rules[0].Destination = netip.MustParseAddr("192.168.0.3")
+	if err := fw.RuleSync(comment, rules[:1]); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	list, err := fw.RuleList(comment)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	expected := withComment(comment, rules[:1])
+	if !reflect.DeepEqual(list, expected) {
+		t.Fatalf("Expect %q, got %q", expected, list)
+	}
+
+	if err := fw.RuleDel(comment); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	list, err = fw.RuleList("")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("Expect no rules, got %q", list)
+	}
+}
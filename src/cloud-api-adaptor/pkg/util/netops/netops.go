@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"time"
 
 	"golang.org/x/exp/maps"
 
@@ -29,6 +30,7 @@ type Namespace interface {
 	Path() string
 	RedirectAdd(src, dst string) error
 	RedirectDel(src string) error
+	RedirectGet(src string) (string, error)
 	RouteAdd(route *Route) error
 	RouteDel(route *Route) error
 	RouteList(filters ...*Route) ([]*Route, error)
@@ -37,7 +39,12 @@ type Namespace interface {
 	RuleList(rule *Rule) ([]*Rule, error)
 	NeighborAdd(neighbor *Neighbor) error
 	NeighborList(filters ...*Neighbor) ([]*Neighbor, error)
+	Ping(dst netip.Addr, timeout time.Duration) error
+	ProbeMTU(dst netip.Addr, size int, timeout time.Duration) error
 	Run(fn func() error) error
+	ShapingAdd(dev string, tb *TokenBucket) error
+	ShapingDel(dev string) error
+	ShapingGet(dev string) (uint64, error)
 }
 
 type namespace struct {
@@ -187,11 +194,25 @@ type Link interface {
 	GetMTU() (int, error)
 	SetMTU(mtu int) error
 	GetDevice() (Device, error)
+	GetStatistics() (*LinkStatistics, error)
 
 	SetMaster(master Link) error
 	SetNamespace(target Namespace) error
 	SetName(name string) error
 	SetUp() error
+	IsUp() bool
+}
+
+// LinkStatistics is a set of traffic counters of an interface
+type LinkStatistics struct {
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
 }
 
 type link struct {
@@ -251,6 +272,32 @@ func (l *link) SetMTU(mtu int) error {
 	return nil
 }
 
+// GetStatistics returns the current traffic counters of an interface
+func (l *link) GetStatistics() (*LinkStatistics, error) {
+
+	// Link attributes are a snapshot taken when the link was looked up, so get the latest counters
+	nlLink, err := l.ns.handle.LinkByIndex(l.nlLink.Attrs().Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface %s: %w", l.Name(), err)
+	}
+
+	stats := nlLink.Attrs().Statistics
+	if stats == nil {
+		return nil, fmt.Errorf("no statistics available for interface %s", l.Name())
+	}
+
+	return &LinkStatistics{
+		RxBytes:   stats.RxBytes,
+		RxPackets: stats.RxPackets,
+		RxErrors:  stats.RxErrors,
+		RxDropped: stats.RxDropped,
+		TxBytes:   stats.TxBytes,
+		TxPackets: stats.TxPackets,
+		TxErrors:  stats.TxErrors,
+		TxDropped: stats.TxDropped,
+	}, nil
+}
+
 func (l *link) GetHardwareAddr() (string, error) {
 
 	hwAddr := l.nlLink.Attrs().HardwareAddr.String()
@@ -309,6 +356,11 @@ func (l *link) SetUp() error {
 	return nil
 }
 
+func (l *link) IsUp() bool {
+
+	return l.nlLink.Attrs().Flags&net.FlagUp != 0
+}
+
 func (l *link) Delete() error {
 
 	if err := l.ns.handle.LinkDel(l.nlLink); err != nil {
@@ -1008,6 +1060,38 @@ func (ns *namespace) RedirectDel(src string) error {
 	return nil
 }
 
+// RedirectGet returns the name of an interface to which traffic from src is redirected. It returns an empty string if no redirect filter exists on src.
+func (ns *namespace) RedirectGet(src string) (string, error) {
+	srcLink, err := ns.handle.LinkByName(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to get interface %s: %w", src, err)
+	}
+
+	filters, err := ns.handle.FilterList(srcLink, netlink.MakeHandle(0xffff, 0))
+	if err != nil {
+		return "", fmt.Errorf("failed to get a list of filters on %s: %w", src, err)
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok {
+			continue
+		}
+		for _, action := range u32.Actions {
+			mirred, ok := action.(*netlink.MirredAction)
+			if !ok || mirred.MirredAction != netlink.TCA_EGRESS_REDIR {
+				continue
+			}
+			dstLink, err := ns.handle.LinkByIndex(mirred.Ifindex)
+			if err != nil {
+				return "", fmt.Errorf("failed to get a link with index %d redirected from %s: %w", mirred.Ifindex, src, err)
+			}
+			return dstLink.Attrs().Name, nil
+		}
+	}
+
+	return "", nil
+}
+
 func toAddr(ip net.IP) netip.Addr {
 
 	addr, _ := netip.AddrFromSlice(ip)
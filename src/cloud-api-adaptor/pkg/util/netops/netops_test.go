@@ -4,8 +4,10 @@
 package netops
 
 import (
+	"net/netip"
 	"runtime"
 	"testing"
+	"time"
 
 	testutils "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/internal/testing"
 	"github.com/vishvananda/netns"
@@ -54,3 +56,54 @@ func TestRouteList(t *testing.T) {
 		t.Logf("Route: dst:%s, gw:%s, dev:%s, prio: %d", route.Destination.String(), route.Gateway.String(), route.Device, route.Priority)
 	}
 }
+
+func TestLinkStatistics(t *testing.T) {
+	testutils.SkipTestIfNotRoot(t)
+
+	name := "test-link-stats"
+
+	nsPath, err := CreateNamedNamespace(name)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer func() {
+		if err := DeleteNamedNamespace(name); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+	}()
+
+	ns, err := OpenNamespace(nsPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer ns.Close()
+
+	lo, err := ns.LinkFind("lo")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if err := lo.SetUp(); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	before, err := lo.GetStatistics()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if err := ns.Ping(netip.MustParseAddr("127.0.0.1"), time.Second); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	after, err := lo.GetStatistics()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if after.RxPackets < before.RxPackets+2 || after.TxPackets < before.TxPackets+2 {
+		t.Fatalf("Expect counters to include an ICMP echo request and reply, got %#v before and %#v after", before, after)
+	}
+	if after.RxBytes <= before.RxBytes || after.TxBytes <= before.TxBytes {
+		t.Fatalf("Expect byte counters to increase, got %#v before and %#v after", before, after)
+	}
+}
@@ -0,0 +1,123 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ipv4HeaderLen = 20
+	icmpHeaderLen = 8
+)
+
+// Ping sends an ICMP echo request to dst from the network namespace, and waits for a reply until timeout
+func (ns *namespace) Ping(dst netip.Addr, timeout time.Duration) error {
+	return ns.ping(dst, 0, false, timeout)
+}
+
+// ProbeMTU sends an ICMP echo request of an IP packet size with the DF bit set to dst from the network namespace,
+// and waits for a reply until timeout. An error is returned if the packet is too large for the path to dst.
+func (ns *namespace) ProbeMTU(dst netip.Addr, size int, timeout time.Duration) error {
+
+	if size < ipv4HeaderLen+icmpHeaderLen {
+		return fmt.Errorf("failed to probe MTU %d to %s: too small", size, dst)
+	}
+
+	return ns.ping(dst, size-ipv4HeaderLen-icmpHeaderLen, true, timeout)
+}
+
+func (ns *namespace) ping(dst netip.Addr, payloadLen int, dontFragment bool, timeout time.Duration) error {
+
+	if !dst.Is4() {
+		return fmt.Errorf("failed to ping %s: not an IPv4 address", dst)
+	}
+
+	return ns.Run(func() error {
+
+		conn, err := net.ListenIP("ip4:icmp", &net.IPAddr{IP: net.IPv4zero})
+		if err != nil {
+			return fmt.Errorf("failed to open an ICMP socket on netns %s: %w", ns.Path(), err)
+		}
+		defer conn.Close()
+
+		if dontFragment {
+			if err := setDontFragment(conn); err != nil {
+				return err
+			}
+		}
+
+		id := os.Getpid() & 0xffff
+		seq := int(time.Now().UnixNano() & 0xffff)
+
+		data := []byte("peerpod")
+		if payloadLen > 0 {
+			data = make([]byte, payloadLen)
+		}
+
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: data},
+		}
+		req, err := msg.Marshal(nil)
+		if err != nil {
+			return fmt.Errorf("failed to create an ICMP echo request: %w", err)
+		}
+
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return fmt.Errorf("failed to set a deadline of ICMP socket: %w", err)
+		}
+
+		if _, err := conn.WriteTo(req, &net.IPAddr{IP: toIP(dst)}); err != nil {
+			return fmt.Errorf("failed to send an ICMP echo request of %d bytes to %s on netns %s: %w", len(req)+ipv4HeaderLen, dst, ns.Path(), err)
+		}
+
+		buf := make([]byte, 65536)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return fmt.Errorf("no ICMP echo reply from %s on netns %s: %w", dst, ns.Path(), err)
+			}
+			if peer.String() != dst.String() {
+				continue
+			}
+
+			reply, err := icmp.ParseMessage(ipv4.ICMPTypeEchoReply.Protocol(), buf[:n])
+			if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+				continue
+			}
+			if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+				return nil
+			}
+		}
+	})
+}
+
+func setDontFragment(conn *net.IPConn) error {
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("failed to get a raw ICMP socket: %w", err)
+	}
+
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+	}); err != nil {
+		return fmt.Errorf("failed to control a raw ICMP socket: %w", err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("failed to set the DF bit on an ICMP socket: %w", sockErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package netops
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// tbfLatency is the maximum time a packet can wait in a token bucket filter queue, in microseconds.
+// The CNI bandwidth plugin uses the same value.
+const tbfLatency = 25000
+
+// TokenBucket is a rate limit in bytes per second with a burst size in bytes
+type TokenBucket struct {
+	Rate  uint64
+	Burst uint32
+}
+
+// ShapingAdd replaces the root qdisc of dev with a token bucket filter to shape outgoing traffic
+func (ns *namespace) ShapingAdd(dev string, tb *TokenBucket) error {
+
+	link, err := ns.handle.LinkByName(dev)
+	if err != nil {
+		return fmt.Errorf("failed to get interface %s: %w", dev, err)
+	}
+
+	if tb.Rate == 0 {
+		return fmt.Errorf("failed to add a token bucket filter to %s: rate is zero", dev)
+	}
+
+	qdisc := &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   tb.Rate,
+		Limit:  uint32(tb.Rate*tbfLatency/netlink.TIME_UNITS_PER_SEC) + tb.Burst,
+		Buffer: netlink.Xmittime(tb.Rate, tb.Burst),
+	}
+
+	if err := ns.handle.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("failed to add a token bucket filter to %s: %w", dev, err)
+	}
+
+	return nil
+}
+
+// ShapingDel deletes a token bucket filter on dev if it exists
+func (ns *namespace) ShapingDel(dev string) error {
+
+	link, err := ns.handle.LinkByName(dev)
+	if err != nil {
+		return fmt.Errorf("failed to get interface %s: %w", dev, err)
+	}
+
+	qdisc, err := ns.findTBF(link)
+	if err != nil || qdisc == nil {
+		return err
+	}
+
+	if err := ns.handle.QdiscDel(qdisc); err != nil {
+		return fmt.Errorf("failed to delete a token bucket filter on %s: %w", dev, err)
+	}
+
+	return nil
+}
+
+// ShapingGet returns the rate in bytes per second of a token bucket filter on dev. It returns zero if no token bucket filter exists on dev.
+func (ns *namespace) ShapingGet(dev string) (uint64, error) {
+
+	link, err := ns.handle.LinkByName(dev)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get interface %s: %w", dev, err)
+	}
+
+	qdisc, err := ns.findTBF(link)
+	if err != nil || qdisc == nil {
+		return 0, err
+	}
+
+	return qdisc.Rate, nil
+}
+
+func (ns *namespace) findTBF(link netlink.Link) (*netlink.Tbf, error) {
+
+	qdiscs, err := ns.handle.QdiscList(link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a list of qdiscs on %s: %w", link.Attrs().Name, err)
+	}
+	for _, qdisc := range qdiscs {
+		if tbf, ok := qdisc.(*netlink.Tbf); ok && tbf.Parent == netlink.HANDLE_ROOT {
+			return tbf, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -130,6 +130,227 @@ func (x *GetInfoResponse) GetVMID() string {
 	return ""
 }
 
+type GetTunnelStatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PodName      string `protobuf:"bytes,1,opt,name=PodName,proto3" json:"PodName,omitempty"`
+	PodNamespace string `protobuf:"bytes,2,opt,name=PodNamespace,proto3" json:"PodNamespace,omitempty"`
+}
+
+func (x *GetTunnelStatsRequest) Reset() {
+	*x = GetTunnelStatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_podvminfo_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetTunnelStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTunnelStatsRequest) ProtoMessage() {}
+
+func (x *GetTunnelStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_podvminfo_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTunnelStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetTunnelStatsRequest) Descriptor() ([]byte, []int) {
+	return file_podvminfo_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetTunnelStatsRequest) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *GetTunnelStatsRequest) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+type GetTunnelStatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerNode *LinkStats `protobuf:"bytes,1,opt,name=WorkerNode,proto3" json:"WorkerNode,omitempty"`
+	PodVM      *LinkStats `protobuf:"bytes,2,opt,name=PodVM,proto3" json:"PodVM,omitempty"`
+}
+
+func (x *GetTunnelStatsResponse) Reset() {
+	*x = GetTunnelStatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_podvminfo_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetTunnelStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTunnelStatsResponse) ProtoMessage() {}
+
+func (x *GetTunnelStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_podvminfo_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTunnelStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetTunnelStatsResponse) Descriptor() ([]byte, []int) {
+	return file_podvminfo_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetTunnelStatsResponse) GetWorkerNode() *LinkStats {
+	if x != nil {
+		return x.WorkerNode
+	}
+	return nil
+}
+
+func (x *GetTunnelStatsResponse) GetPodVM() *LinkStats {
+	if x != nil {
+		return x.PodVM
+	}
+	return nil
+}
+
+type LinkStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Interface string `protobuf:"bytes,1,opt,name=Interface,proto3" json:"Interface,omitempty"`
+	RxBytes   uint64 `protobuf:"varint,2,opt,name=RxBytes,proto3" json:"RxBytes,omitempty"`
+	RxPackets uint64 `protobuf:"varint,3,opt,name=RxPackets,proto3" json:"RxPackets,omitempty"`
+	RxErrors  uint64 `protobuf:"varint,4,opt,name=RxErrors,proto3" json:"RxErrors,omitempty"`
+	RxDropped uint64 `protobuf:"varint,5,opt,name=RxDropped,proto3" json:"RxDropped,omitempty"`
+	TxBytes   uint64 `protobuf:"varint,6,opt,name=TxBytes,proto3" json:"TxBytes,omitempty"`
+	TxPackets uint64 `protobuf:"varint,7,opt,name=TxPackets,proto3" json:"TxPackets,omitempty"`
+	TxErrors  uint64 `protobuf:"varint,8,opt,name=TxErrors,proto3" json:"TxErrors,omitempty"`
+	TxDropped uint64 `protobuf:"varint,9,opt,name=TxDropped,proto3" json:"TxDropped,omitempty"`
+}
+
+func (x *LinkStats) Reset() {
+	*x = LinkStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_podvminfo_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LinkStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LinkStats) ProtoMessage() {}
+
+func (x *LinkStats) ProtoReflect() protoreflect.Message {
+	mi := &file_podvminfo_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LinkStats.ProtoReflect.Descriptor instead.
+func (*LinkStats) Descriptor() ([]byte, []int) {
+	return file_podvminfo_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LinkStats) GetInterface() string {
+	if x != nil {
+		return x.Interface
+	}
+	return ""
+}
+
+func (x *LinkStats) GetRxBytes() uint64 {
+	if x != nil {
+		return x.RxBytes
+	}
+	return 0
+}
+
+func (x *LinkStats) GetRxPackets() uint64 {
+	if x != nil {
+		return x.RxPackets
+	}
+	return 0
+}
+
+func (x *LinkStats) GetRxErrors() uint64 {
+	if x != nil {
+		return x.RxErrors
+	}
+	return 0
+}
+
+func (x *LinkStats) GetRxDropped() uint64 {
+	if x != nil {
+		return x.RxDropped
+	}
+	return 0
+}
+
+func (x *LinkStats) GetTxBytes() uint64 {
+	if x != nil {
+		return x.TxBytes
+	}
+	return 0
+}
+
+func (x *LinkStats) GetTxPackets() uint64 {
+	if x != nil {
+		return x.TxPackets
+	}
+	return 0
+}
+
+func (x *LinkStats) GetTxErrors() uint64 {
+	if x != nil {
+		return x.TxErrors
+	}
+	return 0
+}
+
+func (x *LinkStats) GetTxDropped() uint64 {
+	if x != nil {
+		return x.TxDropped
+	}
+	return 0
+}
+
 var File_podvminfo_proto protoreflect.FileDescriptor
 
 var file_podvminfo_proto_rawDesc = []byte{
@@ -143,13 +364,49 @@ var file_podvminfo_proto_rawDesc = []byte{
 	0x57, 0x61, 0x69, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x57, 0x61, 0x69, 0x74,
 	0x22, 0x25, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f,
 	0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x56, 0x4d, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x56, 0x4d, 0x49, 0x44, 0x32, 0x4f, 0x0a, 0x09, 0x50, 0x6f, 0x64, 0x56, 0x4d,
-	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x42, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12,
-	0x19, 0x2e, 0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x49,
-	0x6e, 0x66, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x70, 0x6f, 0x64,
-	0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x04, 0x5a, 0x02, 0x2e, 0x2f, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x09, 0x52, 0x04, 0x56, 0x4d, 0x49, 0x44, 0x22, 0x55, 0x0a, 0x15, 0x47, 0x65, 0x74, 0x54, 0x75,
+	0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x18, 0x0a, 0x07, 0x50, 0x6f, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x50, 0x6f, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x50, 0x6f,
+	0x64, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0c, 0x50, 0x6f, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x22, 0x7a,
+	0x0a, 0x16, 0x47, 0x65, 0x74, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x0a, 0x57, 0x6f, 0x72, 0x6b,
+	0x65, 0x72, 0x4e, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70,
+	0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x4c, 0x69, 0x6e, 0x6b, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x52, 0x0a, 0x57, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x2a,
+	0x0a, 0x05, 0x50, 0x6f, 0x64, 0x56, 0x4d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e,
+	0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x4c, 0x69, 0x6e, 0x6b, 0x53, 0x74,
+	0x61, 0x74, 0x73, 0x52, 0x05, 0x50, 0x6f, 0x64, 0x56, 0x4d, 0x22, 0x8d, 0x02, 0x0a, 0x09, 0x4c,
+	0x69, 0x6e, 0x6b, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x49, 0x6e, 0x74, 0x65,
+	0x72, 0x66, 0x61, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x49, 0x6e, 0x74,
+	0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x52, 0x78, 0x42, 0x79, 0x74, 0x65,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x52, 0x78, 0x42, 0x79, 0x74, 0x65, 0x73,
+	0x12, 0x1c, 0x0a, 0x09, 0x52, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x09, 0x52, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1a,
+	0x0a, 0x08, 0x52, 0x78, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x08, 0x52, 0x78, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x52, 0x78,
+	0x44, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x52,
+	0x78, 0x44, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x54, 0x78, 0x42, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x54, 0x78, 0x42, 0x79, 0x74,
+	0x65, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x54, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x54, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x54, 0x78, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x08, 0x54, 0x78, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x1c, 0x0a, 0x09,
+	0x54, 0x78, 0x44, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x09, 0x54, 0x78, 0x44, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x32, 0xa8, 0x01, 0x0a, 0x09, 0x50,
+	0x6f, 0x64, 0x56, 0x4d, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x42, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x49,
+	0x6e, 0x66, 0x6f, 0x12, 0x19, 0x2e, 0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e,
+	0x47, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a,
+	0x2e, 0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x49, 0x6e,
+	0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x57, 0x0a, 0x0e,
+	0x47, 0x65, 0x74, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x20,
+	0x2e, 0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x54, 0x75,
+	0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x21, 0x2e, 0x70, 0x6f, 0x64, 0x76, 0x6d, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x47, 0x65, 0x74,
+	0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x04, 0x5a, 0x02, 0x2e, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -164,19 +421,26 @@ func file_podvminfo_proto_rawDescGZIP() []byte {
 	return file_podvminfo_proto_rawDescData
 }
 
-var file_podvminfo_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_podvminfo_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_podvminfo_proto_goTypes = []interface{}{
-	(*GetInfoRequest)(nil),  // 0: podvminfo.GetInfoRequest
-	(*GetInfoResponse)(nil), // 1: podvminfo.GetInfoResponse
+	(*GetInfoRequest)(nil),         // 0: podvminfo.GetInfoRequest
+	(*GetInfoResponse)(nil),        // 1: podvminfo.GetInfoResponse
+	(*GetTunnelStatsRequest)(nil),  // 2: podvminfo.GetTunnelStatsRequest
+	(*GetTunnelStatsResponse)(nil), // 3: podvminfo.GetTunnelStatsResponse
+	(*LinkStats)(nil),              // 4: podvminfo.LinkStats
 }
 var file_podvminfo_proto_depIdxs = []int32{
-	0, // 0: podvminfo.PodVMInfo.GetInfo:input_type -> podvminfo.GetInfoRequest
-	1, // 1: podvminfo.PodVMInfo.GetInfo:output_type -> podvminfo.GetInfoResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	4, // 0: podvminfo.GetTunnelStatsResponse.WorkerNode:type_name -> podvminfo.LinkStats
+	4, // 1: podvminfo.GetTunnelStatsResponse.PodVM:type_name -> podvminfo.LinkStats
+	0, // 2: podvminfo.PodVMInfo.GetInfo:input_type -> podvminfo.GetInfoRequest
+	2, // 3: podvminfo.PodVMInfo.GetTunnelStats:input_type -> podvminfo.GetTunnelStatsRequest
+	1, // 4: podvminfo.PodVMInfo.GetInfo:output_type -> podvminfo.GetInfoResponse
+	3, // 5: podvminfo.PodVMInfo.GetTunnelStats:output_type -> podvminfo.GetTunnelStatsResponse
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_podvminfo_proto_init() }
@@ -209,6 +473,42 @@ func file_podvminfo_proto_init() {
 				return nil
 			}
 		}
+		file_podvminfo_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetTunnelStatsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_podvminfo_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetTunnelStatsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_podvminfo_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LinkStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -216,7 +516,7 @@ func file_podvminfo_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_podvminfo_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
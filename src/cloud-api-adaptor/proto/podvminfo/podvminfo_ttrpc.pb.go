@@ -9,6 +9,7 @@ import (
 
 type PodVMInfoService interface {
 	GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error)
+	GetTunnelStats(context.Context, *GetTunnelStatsRequest) (*GetTunnelStatsResponse, error)
 }
 
 func RegisterPodVMInfoService(srv *ttrpc.Server, svc PodVMInfoService) {
@@ -21,6 +22,13 @@ func RegisterPodVMInfoService(srv *ttrpc.Server, svc PodVMInfoService) {
 				}
 				return svc.GetInfo(ctx, &req)
 			},
+			"GetTunnelStats": func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+				var req GetTunnelStatsRequest
+				if err := unmarshal(&req); err != nil {
+					return nil, err
+				}
+				return svc.GetTunnelStats(ctx, &req)
+			},
 		},
 	})
 }
@@ -42,3 +50,11 @@ func (c *podvminfoClient) GetInfo(ctx context.Context, req *GetInfoRequest) (*Ge
 	}
 	return &resp, nil
 }
+
+func (c *podvminfoClient) GetTunnelStats(ctx context.Context, req *GetTunnelStatsRequest) (*GetTunnelStatsResponse, error) {
+	var resp GetTunnelStatsResponse
+	if err := c.client.Call(ctx, "podvminfo.PodVMInfo", "GetTunnelStats", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
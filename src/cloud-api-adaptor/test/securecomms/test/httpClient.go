@@ -64,3 +64,29 @@ func HttpClientInNamespace(dest string, nsPath string) bool {
 	fmt.Printf("HttpClient %s StatusCode %d Body : %s\n", dest, resp.StatusCode, body)
 	return (resp.StatusCode == 200)
 }
+
+// HttpClientUnix sends a request to an HTTP server at the Unix-domain socket at path
+func HttpClientUnix(path string) bool {
+	fmt.Printf("HttpClient start : %s\n", path)
+
+	c := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	resp, err := c.Get("http://unix/")
+	if err != nil {
+		fmt.Printf("HttpClient %s Get Error %s\n", path, err)
+		return false
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Printf("HttpClient %s ReadAll Error %s\n", path, err)
+		return false
+	}
+	fmt.Printf("HttpClient %s StatusCode %d Body : %s\n", path, resp.StatusCode, body)
+	return (resp.StatusCode == 200)
+}
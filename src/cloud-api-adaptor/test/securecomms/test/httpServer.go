@@ -39,3 +39,26 @@ func HttpServer(port string) *http.Server {
 	}()
 	return s
 }
+
+// UnixHttpServer serves HTTP on a Unix-domain socket at path
+func UnixHttpServer(path string) *http.Server {
+	p := myport(path)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.getRoot)
+	s := &http.Server{
+		Handler: mux,
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		fmt.Printf("Listen Error %v\n", err)
+		return nil
+	}
+
+	go func() {
+		err = s.Serve(ln)
+		if err != http.ErrServerClosed { // graceful shutdown
+			fmt.Printf("Serve Error %v\n", err)
+		}
+	}()
+	return s
+}
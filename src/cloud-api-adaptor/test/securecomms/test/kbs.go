@@ -2,19 +2,71 @@ package test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"html"
 	"io"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type kbsport string
 
-var keys map[string][]byte
+// keys and failures are the state of the KBS stand-in
+var (
+	keys     map[string][]byte
+	failures int
+	kbsMutex sync.Mutex
+)
+
+// checkToken verifies that a request carries a token which is valid now
+// The signature is not verified by the stand-in
+func checkToken(r *http.Request) error {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return fmt.Errorf("missing token")
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return fmt.Errorf("bad token: %w", err)
+	}
+	now := time.Now().Unix()
+	expiresAt, _ := claims["expires_at"].(float64)
+	invalidBefore, _ := claims["invalid_before"].(float64)
+	if int64(expiresAt) < now || int64(invalidBefore) > now {
+		return fmt.Errorf("token is not valid now")
+	}
+	return nil
+}
 
 func (p kbsport) getRoot(w http.ResponseWriter, r *http.Request) {
+	kbsMutex.Lock()
+	defer kbsMutex.Unlock()
+
+	if failures > 0 {
+		failures--
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method == "POST" || r.Method == "DELETE" {
+		if err := checkToken(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
 	if r.Method == "POST" {
 		keyMaterial, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -24,6 +76,14 @@ func (p kbsport) getRoot(w http.ResponseWriter, r *http.Request) {
 		keys[r.URL.Path] = keyMaterial
 		return
 	}
+	if r.Method == "DELETE" {
+		if _, ok := keys[r.URL.Path]; !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		delete(keys, r.URL.Path)
+		return
+	}
 	if r.Method == "GET" {
 		keyMaterial, ok := keys[r.URL.Path]
 		if !ok {
@@ -40,15 +100,49 @@ func (p kbsport) getRoot(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Not Found", http.StatusNotFound)
 }
 
+// KBSFailRequests makes the KBS stand-in fail the next n requests with a server error
+func KBSFailRequests(n int) {
+	kbsMutex.Lock()
+	defer kbsMutex.Unlock()
+	failures = n
+}
+
+// KBSHasResource reports whether the KBS stand-in holds a resource at path
+func KBSHasResource(path string) bool {
+	kbsMutex.Lock()
+	defer kbsMutex.Unlock()
+	_, ok := keys["/kbs/v0/resource/"+path]
+	return ok
+}
+
+// KBSServer starts a KBS stand-in serving HTTP
 func KBSServer(port string) *http.Server {
+	return kbsServer(port, nil)
+}
+
+// KBSServerTLS starts a KBS stand-in serving HTTPS, and returns the CA certificate of the stand-in
+func KBSServerTLS(port string) (*http.Server, []byte) {
+	cert, caCert, err := selfSignedCert()
+	if err != nil {
+		fmt.Printf("Certificate Error %v\n", err)
+		return nil, nil
+	}
+	return kbsServer(port, &tls.Config{Certificates: []tls.Certificate{cert}}), caCert
+}
+
+func kbsServer(port string, tlsConfig *tls.Config) *http.Server {
+	kbsMutex.Lock()
 	keys = map[string][]byte{}
+	failures = 0
+	kbsMutex.Unlock()
 
 	p := kbsport(port)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", p.getRoot)
 	s := &http.Server{
-		Addr:    "127.0.0.1:" + port,
-		Handler: mux,
+		Addr:      "127.0.0.1:" + port,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 
 	ln, err := net.Listen("tcp", s.Addr)
@@ -56,6 +150,9 @@ func KBSServer(port string) *http.Server {
 		fmt.Printf("Listen Error %v\n", err)
 		return nil
 	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
 
 	go func() {
 		err = s.Serve(ln)
@@ -67,6 +164,37 @@ func KBSServer(port string) *http.Server {
 	return s
 }
 
+// selfSignedCert creates a self signed certificate for 127.0.0.1
+func selfSignedCert() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kbs"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	return cert, certPEM, err
+}
+
 type GetKeyClient struct {
 	port string
 }
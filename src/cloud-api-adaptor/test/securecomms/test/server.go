@@ -1,8 +1,12 @@
 package test
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 )
 
 func Server(port string) {
@@ -49,3 +53,75 @@ func handleConnection(conn net.Conn, port string) {
 		fmt.Printf("Written: %s port %s\n", buf, port)
 	}
 }
+
+// UdpServer echoes datagrams received at port
+func UdpServer(port string) *net.UDPConn {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:"+port)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Received: %d bytes port %s\n", n, port)
+			if _, err = conn.WriteToUDP(buf[:n], addr); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}()
+	return conn
+}
+
+// UdpClient sends datagrams to dest in network namespace nsPath (or in the current namespace if nsPath is empty)
+// and reports whether each datagram was echoed back intact
+func UdpClient(dest string, nsPath string, datagrams [][]byte) bool {
+	var conn net.Conn
+	dial := func() (err error) {
+		conn, err = net.Dial("udp", dest)
+		return err
+	}
+	var err error
+	if nsPath == "" {
+		err = dial()
+	} else {
+		err = netops.RunAsNsPath(nsPath, dial)
+	}
+	if err != nil {
+		fmt.Printf("UdpClient %s Dial Error %s\n", dest, err)
+		return false
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for _, datagram := range datagrams {
+		if _, err := conn.Write(datagram); err != nil {
+			fmt.Printf("UdpClient %s Write Error %s\n", dest, err)
+			return false
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			return false
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			fmt.Printf("UdpClient %s Read Error %s\n", dest, err)
+			return false
+		}
+		if !bytes.Equal(buf[:n], datagram) {
+			fmt.Printf("UdpClient %s received %d bytes, expected %d bytes\n", dest, n, len(datagram))
+			return false
+		}
+	}
+	return true
+}
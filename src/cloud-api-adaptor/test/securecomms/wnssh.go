@@ -7,6 +7,7 @@ import (
 	"net/netip"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshproxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/sshutil"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/wnssh"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
@@ -21,7 +22,7 @@ func WN() bool {
 	test.HttpServer("26443")
 
 	// CAA Initialization
-	sshClient, err := wnssh.InitSshClient([]string{"KUBERNETES_PHASE:KATAAGENT:0"}, []string{"BOTH_PHASES:KBS:9004", "KUBERNETES_PHASE:KUBEAPI:26443", "KUBERNETES_PHASE:DNS:8053"}, true, "127.0.0.1:9004", sshutil.SSHPORT)
+	sshClient, err := wnssh.InitSshClient([]string{"KUBERNETES_PHASE:KATAAGENT:0"}, []string{"BOTH_PHASES:KBS:9004", "KUBERNETES_PHASE:KUBEAPI:26443", "KUBERNETES_PHASE:DNS:8053"}, true, "127.0.0.1:9004", nil, sshutil.SSHPORT, sshproxy.SSH)
 	if err != nil {
 		log.Fatalf("InitSshClient %v", err)
 	}
@@ -30,7 +31,7 @@ func WN() bool {
 	ipAddr, _ := netip.ParseAddr("127.0.0.1") // ipAddr of the VM
 	ipAddrs := []netip.Addr{ipAddr}
 	ctx := context.Background()
-	ci, _ := sshClient.InitPP(ctx, "sid")
+	ci, _ := sshClient.InitPP(ctx, "sid", "", "")
 	if ci == nil {
 		log.Fatalf("failed InitiatePeerPodTunnel")
 	}
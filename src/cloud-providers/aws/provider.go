@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
@@ -30,6 +31,9 @@ const (
 	maxInt32           = 1<<31 - 1
 )
 
+// EC2 limits the user data to 16KB before base64 encoding
+var userDataLimit = cloudinit.UserDataLimit{Size: 16 * 1024, Gzip: true}
+
 // Make ec2Client a mockable interface
 type ec2Client interface {
 	RunInstances(ctx context.Context,
@@ -155,7 +159,7 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	cloudConfigData, err := cloudConfig.Generate()
+	cloudConfigData, err := userDataLimit.Generate(cloudConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -275,9 +279,25 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		}
 	}
 
+	if spec.Spot {
+		input.InstanceMarketOptions = &types.InstanceMarketOptionsRequest{
+			MarketType: types.MarketTypeSpot,
+			SpotOptions: &types.SpotMarketOptions{
+				SpotInstanceType:             types.SpotInstanceTypeOneTime,
+				InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+			},
+		}
+	}
+
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
 	result, err := p.ec2Client.RunInstances(ctx, input)
+	if err != nil && input.InstanceMarketOptions != nil && isSpotCapacityError(err) {
+		logger.Printf("No spot capacity for instance %s, falling back to on-demand: %v", instanceName, err)
+		onDemandInput := *input
+		onDemandInput.InstanceMarketOptions = nil
+		result, err = p.ec2Client.RunInstances(ctx, &onDemandInput)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Creating instance (%v) returned error: %s", result, err)
 	}
@@ -334,6 +354,90 @@ func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) err
 
 }
 
+// CheckInstance returns an error wrapping provider.ErrInstancePreempted if the instance was interrupted
+func (p *awsProvider) CheckInstance(ctx context.Context, instanceID string) error {
+	output, err := p.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+		return fmt.Errorf("instance %s not found: %w", instanceID, provider.ErrInstancePreempted)
+	}
+	if err != nil {
+		return fmt.Errorf("describing instance %s: %w", instanceID, err)
+	}
+	if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+		return fmt.Errorf("instance %s not found: %w", instanceID, provider.ErrInstancePreempted)
+	}
+
+	instance := output.Reservations[0].Instances[0]
+	if instance.State == nil {
+		return nil
+	}
+	switch instance.State.Name {
+	case types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated, types.InstanceStateNameStopping, types.InstanceStateNameStopped:
+		reason := ""
+		if instance.StateReason != nil && instance.StateReason.Message != nil {
+			reason = *instance.StateReason.Message
+		}
+		return fmt.Errorf("instance %s is %s (%s): %w", instanceID, instance.State.Name, reason, provider.ErrInstancePreempted)
+	}
+	return nil
+}
+
+// GetInstanceIPs returns the current IP addresses of an instance
+func (p *awsProvider) GetInstanceIPs(ctx context.Context, instanceID string) ([]netip.Addr, error) {
+	output, err := p.ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing instance %s: %w", instanceID, err)
+	}
+	if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+		return nil, fmt.Errorf("instance %s not found", instanceID)
+	}
+
+	// Instances which are shutting down or terminated have no network interfaces
+	instance := output.Reservations[0].Instances[0]
+	if len(instance.NetworkInterfaces) == 0 {
+		return nil, fmt.Errorf("instance %s has no network interfaces", instanceID)
+	}
+	ips, err := getIPs(instance)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("instance %s has no IP addresses", instanceID)
+	}
+
+	if p.serviceConfig.UsePublicIP {
+		association := instance.NetworkInterfaces[0].Association
+		if association == nil || association.PublicIp == nil {
+			return nil, fmt.Errorf("instance %s has no public IP address", instanceID)
+		}
+		publicIP, err := netip.ParseAddr(*association.PublicIp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public IP %q: %w", *association.PublicIp, err)
+		}
+		ips[0] = publicIP
+	}
+
+	return ips, nil
+}
+
+// isSpotCapacityError checks if RunInstances failed because EC2 cannot fulfill a spot request
+func isSpotCapacityError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "InsufficientInstanceCapacity", "SpotMaxPriceTooLow", "MaxSpotInstanceCountExceeded", "UnfulfillableCapacity":
+		return true
+	}
+	return false
+}
+
 func (p *awsProvider) Teardown() error {
 	return nil
 }
@@ -346,6 +450,21 @@ func (p *awsProvider) ConfigVerifier() error {
 	return nil
 }
 
+// CheckHealth verifies the configuration and describes the pod VM image to check that the EC2 API is reachable
+func (p *awsProvider) CheckHealth(ctx context.Context) error {
+	if err := p.ConfigVerifier(); err != nil {
+		return err
+	}
+	output, err := p.ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{p.serviceConfig.ImageId}})
+	if err != nil {
+		return fmt.Errorf("describing image %s: %w", p.serviceConfig.ImageId, err)
+	}
+	if len(output.Images) == 0 {
+		return fmt.Errorf("image %s not found", p.serviceConfig.ImageId)
+	}
+	return nil
+}
+
 // Add SelectInstanceType method to select an instance type based on the memory and vcpu requirements
 func (p *awsProvider) selectInstanceType(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
 
@@ -5,6 +5,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
 	"reflect"
@@ -14,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
@@ -640,3 +642,167 @@ func TestConfigVerifier(t *testing.T) {
 		})
 	}
 }
+
+// Mock EC2 API without spot capacity
+type mockSpotEC2Client struct {
+	mockEC2Client
+	spotErr error
+	inputs  []*ec2.RunInstancesInput
+	state   types.InstanceStateName
+}
+
+func (m *mockSpotEC2Client) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	m.inputs = append(m.inputs, params)
+	if params.InstanceMarketOptions != nil && m.spotErr != nil {
+		return nil, m.spotErr
+	}
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+func (m *mockSpotEC2Client) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+
+	if m.state == "" {
+		return nil, &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound", Message: "not found"}
+	}
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{
+			{
+				Instances: []types.Instance{
+					{
+						InstanceId:  aws.String("i-1234567890abcdef0"),
+						State:       &types.InstanceState{Name: m.state},
+						StateReason: &types.StateReason{Message: aws.String("Server.SpotInstanceTermination")},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func TestCreateSpotInstance(t *testing.T) {
+	spec := provider.InstanceTypeSpec{InstanceType: "t2.small", Spot: true}
+
+	for name, tc := range map[string]struct {
+		spotErr  error
+		attempts int
+		wantErr  bool
+	}{
+		"spot":                   {attempts: 1},
+		"no spot capacity":       {spotErr: &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"}, attempts: 2},
+		"spot max price too low": {spotErr: &smithy.GenericAPIError{Code: "SpotMaxPriceTooLow"}, attempts: 2},
+		"other error":            {spotErr: &smithy.GenericAPIError{Code: "InvalidParameterValue"}, attempts: 1, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &mockSpotEC2Client{spotErr: tc.spotErr}
+			p := &awsProvider{
+				ec2Client:     client,
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: serviceConfig,
+			}
+
+			_, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("awsProvider.CreateInstance() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if len(client.inputs) != tc.attempts {
+				t.Fatalf("Expect %d RunInstances calls, got %d", tc.attempts, len(client.inputs))
+			}
+			if options := client.inputs[0].InstanceMarketOptions; options == nil || options.MarketType != types.MarketTypeSpot {
+				t.Errorf("Expect spot market options, got %v", options)
+			}
+			if tc.attempts > 1 && client.inputs[1].InstanceMarketOptions != nil {
+				t.Errorf("Expect on-demand fallback, got %v", client.inputs[1].InstanceMarketOptions)
+			}
+		})
+	}
+}
+
+func TestCheckInstance(t *testing.T) {
+	for state, preempted := range map[types.InstanceStateName]bool{
+		types.InstanceStateNameRunning:    false,
+		types.InstanceStateNameTerminated: true,
+		types.InstanceStateNameStopped:    true,
+		"":                                true,
+	} {
+		p := &awsProvider{ec2Client: &mockSpotEC2Client{state: state}}
+		err := p.CheckInstance(context.Background(), "i-1234567890abcdef0")
+		if e, a := preempted, errors.Is(err, provider.ErrInstancePreempted); e != a {
+			t.Errorf("Expect preempted %v in state %q, got %v", e, state, err)
+		}
+	}
+}
+
+// Mock EC2 API of a terminated instance, which has no network interfaces
+type mockTerminatedEC2Client struct {
+	mockEC2Client
+}
+
+func (m mockTerminatedEC2Client) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{
+			{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String("i-1234567890abcdef0"),
+						State:      &types.InstanceState{Name: types.InstanceStateNameTerminated},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func TestGetInstanceIPs(t *testing.T) {
+	for usePublicIP, e := range map[bool]string{false: "10.0.0.2", true: "192.168.100.1"} {
+		p := &awsProvider{ec2Client: &mockEC2Client{}, serviceConfig: &Config{UsePublicIP: usePublicIP}}
+		ips, err := p.GetInstanceIPs(context.Background(), "i-1234567890abcdef0")
+		if err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if len(ips) != 1 || ips[0].String() != e {
+			t.Errorf("Expect %s, got %v", e, ips)
+		}
+
+		p.ec2Client = &mockTerminatedEC2Client{}
+		if ips, err := p.GetInstanceIPs(context.Background(), "i-1234567890abcdef0"); err == nil {
+			t.Errorf("Expect error for an instance without network interfaces, got %v", ips)
+		}
+	}
+}
+
+// Mock EC2 API without the pod VM image
+type mockNoImageEC2Client struct {
+	mockEC2Client
+}
+
+func (m *mockNoImageEC2Client) DescribeImages(ctx context.Context,
+	params *ec2.DescribeImagesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+
+	return &ec2.DescribeImagesOutput{}, nil
+}
+
+func TestCheckHealth(t *testing.T) {
+	p := &awsProvider{ec2Client: &mockEC2Client{}, serviceConfig: serviceConfig}
+	if err := p.CheckHealth(context.Background()); err != nil {
+		t.Errorf("Expect no error, got %v", err)
+	}
+
+	p.ec2Client = &mockNoImageEC2Client{}
+	if err := p.CheckHealth(context.Background()); err == nil {
+		t.Error("Expect error for a missing image")
+	}
+
+	p = &awsProvider{ec2Client: &mockEC2Client{}, serviceConfig: serviceConfigEmptyImageId}
+	if err := p.CheckHealth(context.Background()); err == nil {
+		t.Error("Expect error for an empty ImageId")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"os"
 	"path/filepath"
@@ -32,6 +33,10 @@ const (
 	maxInstanceNameLen = 63
 )
 
+// Azure limits the base64 encoded user data to 64KB
+// Ref: https://learn.microsoft.com/en-us/azure/virtual-machines/user-data
+var userDataLimit = cloudinit.UserDataLimit{Size: cloudinit.Base64Size(64 * 1024), Gzip: true}
+
 type azureProvider struct {
 	azureClient   azcore.TokenCredential
 	serviceConfig *Config
@@ -205,7 +210,7 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	cloudConfigData, err := cloudConfig.Generate()
+	cloudConfigData, err := userDataLimit.Generate(cloudConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -246,9 +251,24 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 		return nil, err
 	}
 
+	if spec.Spot {
+		setSpotPriority(vmParameters)
+	}
+
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
 	vm, err := p.create(ctx, vmParameters)
+	if err != nil && spec.Spot && isSpotCapacityError(err) {
+		logger.Printf("No spot capacity for instance %s, falling back to regular priority: %v", instanceName, err)
+		// The priority of a VM left behind by the failed allocation cannot be changed
+		if err := p.deleteVM(ctx, instanceName); err != nil {
+			logger.Printf("deleting spot VM %s: %v", instanceName, err)
+		}
+		vmParameters.Properties.Priority = nil
+		vmParameters.Properties.EvictionPolicy = nil
+		vmParameters.Properties.BillingProfile = nil
+		vm, err = p.create(ctx, vmParameters)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Creating instance (%v): %s", vm, err)
 	}
@@ -269,20 +289,36 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 }
 
 func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) error {
-	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	vmName, err := vmNameFromID(instanceID)
 	if err != nil {
-		return fmt.Errorf("creating VM client: %w", err)
+		return err
+	}
+
+	if err := p.deleteVM(ctx, vmName); err != nil {
+		return err
 	}
 
-	// instanceID in the form of /subscriptions/<subID>/resourceGroups/<resource_name>/providers/Microsoft.Compute/virtualMachines/<VM_Name>.
+	logger.Printf("deleted VM successfully: %s", vmName)
+	return nil
+}
+
+// vmNameFromID returns the VM name of an instance ID in the form of
+// /subscriptions/<subID>/resourceGroups/<resource_name>/providers/Microsoft.Compute/virtualMachines/<VM_Name>.
+func vmNameFromID(instanceID string) (string, error) {
 	re := regexp.MustCompile(`^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/virtualMachines/(.*)$`)
 	match := re.FindStringSubmatch(instanceID)
 	if len(match) < 1 {
 		logger.Print("finding VM name using regexp:", match)
-		return errNotFound
+		return "", errNotFound
 	}
+	return match[1], nil
+}
 
-	vmName := match[1]
+func (p *azureProvider) deleteVM(ctx context.Context, vmName string) error {
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return fmt.Errorf("creating VM client: %w", err)
+	}
 
 	pollerResponse, err := vmClient.BeginDelete(ctx, p.serviceConfig.ResourceGroupName, vmName, nil)
 	if err != nil {
@@ -292,11 +328,93 @@ func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) e
 	if _, err = pollerResponse.PollUntilDone(ctx, nil); err != nil {
 		return fmt.Errorf("waiting for the VM deletion: %w", err)
 	}
+	return nil
+}
 
-	logger.Printf("deleted VM successfully: %s", vmName)
+// CheckInstance returns an error wrapping provider.ErrInstancePreempted if a spot VM was evicted
+func (p *azureProvider) CheckInstance(ctx context.Context, instanceID string) error {
+	vmName, err := vmNameFromID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return fmt.Errorf("creating VM client: %w", err)
+	}
+
+	resp, err := vmClient.Get(ctx, p.serviceConfig.ResourceGroupName, vmName, &armcompute.VirtualMachinesClientGetOptions{
+		Expand: to.Ptr(armcompute.InstanceViewTypesInstanceView),
+	})
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("VM %s not found: %w", vmName, provider.ErrInstancePreempted)
+	}
+	if err != nil {
+		return fmt.Errorf("getting VM %s: %w", vmName, err)
+	}
+
+	return checkPowerState(vmName, &resp.VirtualMachine)
+}
+
+// GetInstanceIPs returns the current IP addresses of a VM
+func (p *azureProvider) GetInstanceIPs(ctx context.Context, instanceID string) ([]netip.Addr, error) {
+	vmName, err := vmNameFromID(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating VM client: %w", err)
+	}
+
+	resp, err := vmClient.Get(ctx, p.serviceConfig.ResourceGroupName, vmName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting VM %s: %w", vmName, err)
+	}
+
+	return p.getIPs(ctx, &resp.VirtualMachine)
+}
+
+// checkPowerState returns an error wrapping provider.ErrInstancePreempted if a VM is stopped or deallocated
+func checkPowerState(vmName string, vm *armcompute.VirtualMachine) error {
+	if vm.Properties == nil || vm.Properties.InstanceView == nil {
+		return nil
+	}
+	for _, status := range vm.Properties.InstanceView.Statuses {
+		if status.Code == nil {
+			continue
+		}
+		switch *status.Code {
+		case "PowerState/stopping", "PowerState/stopped", "PowerState/deallocating", "PowerState/deallocated":
+			return fmt.Errorf("VM %s is in %s: %w", vmName, *status.Code, provider.ErrInstancePreempted)
+		}
+	}
 	return nil
 }
 
+// setSpotPriority makes a VM a spot VM, which is deleted when Azure evicts it
+func setSpotPriority(vm *armcompute.VirtualMachine) {
+	vm.Properties.Priority = to.Ptr(armcompute.VirtualMachinePriorityTypesSpot)
+	vm.Properties.EvictionPolicy = to.Ptr(armcompute.VirtualMachineEvictionPolicyTypesDelete)
+	// Pay up to the on-demand price, so that the VM is only evicted for capacity
+	vm.Properties.BillingProfile = &armcompute.BillingProfile{MaxPrice: to.Ptr(-1.0)}
+}
+
+// isSpotCapacityError checks if the creation of a spot VM failed because Azure cannot allocate it
+func isSpotCapacityError(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.ErrorCode {
+	case "SkuNotAvailable", "AllocationFailed", "ZonalAllocationFailed", "OverconstrainedAllocationRequest", "OverconstrainedZonalAllocationRequest":
+		return true
+	}
+	return false
+}
+
 func (p *azureProvider) Teardown() error {
 	return nil
 }
@@ -314,6 +432,23 @@ func (p *azureProvider) ConfigVerifier() error {
 	return nil
 }
 
+// CheckHealth verifies the configuration and lists the first page of VMs of the resource group
+// to check that the Azure API is reachable with the credentials
+func (p *azureProvider) CheckHealth(ctx context.Context) error {
+	if err := p.ConfigVerifier(); err != nil {
+		return err
+	}
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return fmt.Errorf("creating VM client: %w", err)
+	}
+	pager := vmClient.NewListPager(p.serviceConfig.ResourceGroupName, nil)
+	if _, err := pager.NextPage(ctx); err != nil {
+		return fmt.Errorf("listing VMs of resource group %s: %w", p.serviceConfig.ResourceGroupName, err)
+	}
+	return nil
+}
+
 // Add SelectInstanceType method to select an instance type based on the memory and vcpu requirements
 func (p *azureProvider) selectInstanceType(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
 
@@ -375,13 +510,6 @@ func (p *azureProvider) getResourceTags() map[string]*string {
 
 func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName, nicName string, imageId string) (*armcompute.VirtualMachine, error) {
 	userDataB64 := base64.StdEncoding.EncodeToString([]byte(cloudConfig))
-
-	// Azure limits the base64 encrypted userData to 64KB.
-	// Ref: https://learn.microsoft.com/en-us/azure/virtual-machines/user-data
-	// If the b64EncData is greater than 64KB then return an error
-	if len(userDataB64) > 64*1024 {
-		return nil, fmt.Errorf("base64 encoded userData is greater than 64KB")
-	}
 	var managedDiskParams *armcompute.ManagedDiskParameters
 	var securityProfile *armcompute.SecurityProfile
 	if !p.serviceConfig.DisableCVM {
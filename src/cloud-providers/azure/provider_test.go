@@ -0,0 +1,72 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestSpotPriority(t *testing.T) {
+	vm := &armcompute.VirtualMachine{Properties: &armcompute.VirtualMachineProperties{}}
+	setSpotPriority(vm)
+	if *vm.Properties.Priority != armcompute.VirtualMachinePriorityTypesSpot {
+		t.Errorf("Expect spot priority, got %s", *vm.Properties.Priority)
+	}
+	if *vm.Properties.EvictionPolicy != armcompute.VirtualMachineEvictionPolicyTypesDelete {
+		t.Errorf("Expect delete eviction policy, got %s", *vm.Properties.EvictionPolicy)
+	}
+
+	for code, expected := range map[string]bool{
+		"SkuNotAvailable":                  true,
+		"ZonalAllocationFailed":            true,
+		"InvalidParameter":                 false,
+		"OperationNotAllowed":              false,
+		"AllocationFailed":                 true,
+		"QuotaExceeded":                    false,
+		"OverconstrainedAllocationRequest": true,
+	} {
+		err := fmt.Errorf("waiting for the VM creation: %w", &azcore.ResponseError{ErrorCode: code})
+		if isSpotCapacityError(err) != expected {
+			t.Errorf("Expect spot capacity error %v for %s", expected, code)
+		}
+	}
+	if isSpotCapacityError(errors.New("AllocationFailed")) {
+		t.Error("Expect no spot capacity error without a response")
+	}
+}
+
+func TestCheckPowerState(t *testing.T) {
+	for code, preempted := range map[string]bool{
+		"PowerState/running":     false,
+		"PowerState/starting":    false,
+		"PowerState/deallocated": true,
+		"PowerState/stopped":     true,
+	} {
+		vm := &armcompute.VirtualMachine{
+			Properties: &armcompute.VirtualMachineProperties{
+				InstanceView: &armcompute.VirtualMachineInstanceView{
+					Statuses: []*armcompute.InstanceViewStatus{
+						{Code: to.Ptr("ProvisioningState/succeeded")},
+						{Code: to.Ptr(code)},
+					},
+				},
+			},
+		}
+		err := checkPowerState("podvm-test", vm)
+		if errors.Is(err, provider.ErrInstancePreempted) != preempted {
+			t.Errorf("Expect preempted %v in %s, got %v", preempted, code, err)
+		}
+	}
+
+	if name, err := vmNameFromID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/podvm-test"); err != nil || name != "podvm-test" {
+		t.Errorf("Expect podvm-test, got %q, %v", name, err)
+	}
+}
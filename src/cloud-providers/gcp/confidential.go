@@ -0,0 +1,176 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/googleapis/gax-go/v2"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// imagesClient gets pod VM images
+type imagesClient interface {
+	Get(ctx context.Context, req *computepb.GetImageRequest, opts ...gax.CallOption) (*computepb.Image, error)
+	GetFromFamily(ctx context.Context, req *computepb.GetFromFamilyImageRequest, opts ...gax.CallOption) (*computepb.Image, error)
+}
+
+// zonesClient gets the CPU platforms of zones
+type zonesClient interface {
+	Get(ctx context.Context, req *computepb.GetZoneRequest, opts ...gax.CallOption) (*computepb.Zone, error)
+}
+
+// confidentialTechnology describes the requirements of a Confidential VM technology
+type confidentialTechnology struct {
+	// machineFamilies are the machine families supporting the technology
+	machineFamilies []string
+	// cpuPlatforms are the CPU platforms of zones supporting the technology
+	cpuPlatforms []string
+	// minCpuPlatform is the CPU platform instances must be created on, if needed
+	minCpuPlatform string
+	// guestOsFeature is the feature of images supporting the technology
+	guestOsFeature string
+}
+
+// https://cloud.google.com/confidential-computing/confidential-vm/docs/supported-configurations
+var confidentialTechnologies = map[string]confidentialTechnology{
+	computepb.ConfidentialInstanceConfig_SEV.String(): {
+		machineFamilies: []string{"n2d", "c2d", "c3d"},
+		cpuPlatforms:    []string{"AMD Rome", "AMD Milan", "AMD Genoa"},
+		guestOsFeature:  computepb.GuestOsFeature_SEV_CAPABLE.String(),
+	},
+	computepb.ConfidentialInstanceConfig_SEV_SNP.String(): {
+		machineFamilies: []string{"n2d"},
+		cpuPlatforms:    []string{"AMD Milan"},
+		minCpuPlatform:  "AMD Milan",
+		guestOsFeature:  computepb.GuestOsFeature_SEV_SNP_CAPABLE.String(),
+	},
+	computepb.ConfidentialInstanceConfig_TDX.String(): {
+		machineFamilies: []string{"c3"},
+		cpuPlatforms:    []string{"Intel Sapphire Rapids"},
+		guestOsFeature:  computepb.GuestOsFeature_TDX_CAPABLE.String(),
+	},
+}
+
+// validateConfidentialType checks that the machine types support the Confidential VM technology
+func validateConfidentialType(config *Config) error {
+	if config.ConfidentialType == "" {
+		return nil
+	}
+	technology, ok := confidentialTechnologies[config.ConfidentialType]
+	if !ok {
+		return fmt.Errorf("unsupported confidential type %q, must be SEV, SEV_SNP or TDX", config.ConfidentialType)
+	}
+	machineTypes := config.MachineTypes
+	// The machine type is used by pods not requesting another one, unless it is only the default
+	// of the flag and machine types are set. Then the first of the machine types replaces it.
+	if len(machineTypes) == 0 || config.MachineType != defaultMachineType {
+		machineTypes = append([]string{config.MachineType}, machineTypes...)
+	}
+	for _, machineType := range machineTypes {
+		family, _, _ := strings.Cut(machineType, "-")
+		if !slices.Contains(technology.machineFamilies, family) {
+			return fmt.Errorf("machine type %s does not support %s, supported machine families are %s",
+				machineType, config.ConfidentialType, strings.Join(technology.machineFamilies, ", "))
+		}
+	}
+	return nil
+}
+
+// confidentialInstanceConfig returns the Confidential VM options of pod VMs
+func (p *gcpProvider) confidentialInstanceConfig() *computepb.ConfidentialInstanceConfig {
+	if p.serviceConfig.ConfidentialType == "" {
+		return nil
+	}
+	return &computepb.ConfidentialInstanceConfig{
+		ConfidentialInstanceType: proto.String(p.serviceConfig.ConfidentialType),
+	}
+}
+
+// minCpuPlatform returns the CPU platform required by the Confidential VM technology
+func (p *gcpProvider) minCpuPlatform() *string {
+	if platform := confidentialTechnologies[p.serviceConfig.ConfidentialType].minCpuPlatform; platform != "" {
+		return proto.String(platform)
+	}
+	return nil
+}
+
+// shieldedInstanceConfig returns the Shielded VM options of pod VMs, or nil for the defaults of GCP
+func (p *gcpProvider) shieldedInstanceConfig() *computepb.ShieldedInstanceConfig {
+	if !p.serviceConfig.EnableSecureBoot && !p.serviceConfig.DisableVtpm && !p.serviceConfig.DisableIntegrityMonitoring {
+		return nil
+	}
+	return &computepb.ShieldedInstanceConfig{
+		EnableSecureBoot:          proto.Bool(p.serviceConfig.EnableSecureBoot),
+		EnableVtpm:                proto.Bool(!p.serviceConfig.DisableVtpm),
+		EnableIntegrityMonitoring: proto.Bool(!p.serviceConfig.DisableIntegrityMonitoring),
+	}
+}
+
+// imagePath returns the path of an image, which is either "projects/<project>/global/images/<image>"
+// or "<image>" of the project of the pod VMs. The image may be "family/<family>".
+func (p *gcpProvider) imagePath(image string) string {
+	if strings.HasPrefix(image, "projects/") {
+		return image
+	}
+	return fmt.Sprintf("projects/%s/global/images/%s", p.serviceConfig.ProjectId, image)
+}
+
+// getImage gets the image of the pod VMs
+func (p *gcpProvider) getImage(ctx context.Context) (*computepb.Image, error) {
+	path := p.imagePath(p.serviceConfig.ImageName)
+	project, image, ok := strings.Cut(strings.TrimPrefix(path, "projects/"), "/global/images/")
+	if !ok {
+		return nil, fmt.Errorf("invalid image %s", path)
+	}
+	if family, ok := strings.CutPrefix(image, "family/"); ok {
+		return p.imagesClient.GetFromFamily(ctx, &computepb.GetFromFamilyImageRequest{Project: project, Family: family})
+	}
+	return p.imagesClient.Get(ctx, &computepb.GetImageRequest{Project: project, Image: image})
+}
+
+// verifyImage checks that the image of the pod VMs supports the Shielded VM and Confidential VM options
+func (p *gcpProvider) verifyImage(ctx context.Context) error {
+	image, err := p.getImage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get image %s: %w", p.serviceConfig.ImageName, err)
+	}
+
+	var required []string
+	if p.serviceConfig.EnableSecureBoot || p.serviceConfig.ConfidentialType != "" {
+		required = append(required, computepb.GuestOsFeature_UEFI_COMPATIBLE.String())
+	}
+	if p.serviceConfig.ConfidentialType != "" {
+		required = append(required, confidentialTechnologies[p.serviceConfig.ConfidentialType].guestOsFeature)
+	}
+	for _, feature := range required {
+		if !slices.ContainsFunc(image.GetGuestOsFeatures(), func(f *computepb.GuestOsFeature) bool { return f.GetType() == feature }) {
+			return fmt.Errorf("image %s does not have guest OS feature %s", image.GetName(), feature)
+		}
+	}
+	return nil
+}
+
+// verifyZone checks that the zone of the pod VMs has a CPU platform supporting the Confidential VM technology
+func (p *gcpProvider) verifyZone(ctx context.Context) error {
+	if p.serviceConfig.ConfidentialType == "" {
+		return nil
+	}
+	zone, err := p.zonesClient.Get(ctx, &computepb.GetZoneRequest{Project: p.serviceConfig.ProjectId, Zone: p.serviceConfig.Zone})
+	if err != nil {
+		return fmt.Errorf("failed to get zone %s: %w", p.serviceConfig.Zone, err)
+	}
+	technology := confidentialTechnologies[p.serviceConfig.ConfidentialType]
+	for _, platform := range zone.GetAvailableCpuPlatforms() {
+		if slices.Contains(technology.cpuPlatforms, platform) {
+			return nil
+		}
+	}
+	return fmt.Errorf("zone %s does not support %s, it has CPU platforms %s",
+		p.serviceConfig.Zone, p.serviceConfig.ConfidentialType, strings.Join(zone.GetAvailableCpuPlatforms(), ", "))
+}
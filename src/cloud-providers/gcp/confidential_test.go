@@ -0,0 +1,134 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+type mockImagesClient struct{}
+
+func guestOsFeatures(types ...computepb.GuestOsFeature_Type) (features []*computepb.GuestOsFeature) {
+	for _, t := range types {
+		features = append(features, &computepb.GuestOsFeature{Type: proto.String(t.String())})
+	}
+	return features
+}
+
+func (m mockImagesClient) Get(ctx context.Context, req *computepb.GetImageRequest, opts ...gax.CallOption) (*computepb.Image, error) {
+	switch req.Project + "/" + req.Image {
+	case "my-project/podvm":
+		return &computepb.Image{Name: proto.String(req.Image), GuestOsFeatures: guestOsFeatures(computepb.GuestOsFeature_UEFI_COMPATIBLE)}, nil
+	case "other-project/podvm-cvm":
+		return &computepb.Image{
+			Name:            proto.String(req.Image),
+			GuestOsFeatures: guestOsFeatures(computepb.GuestOsFeature_UEFI_COMPATIBLE, computepb.GuestOsFeature_SEV_SNP_CAPABLE, computepb.GuestOsFeature_TDX_CAPABLE),
+		}, nil
+	}
+	return nil, fmt.Errorf("image %s not found", req.Image)
+}
+
+func (m mockImagesClient) GetFromFamily(ctx context.Context, req *computepb.GetFromFamilyImageRequest, opts ...gax.CallOption) (*computepb.Image, error) {
+	if req.Family == "podvm-legacy" {
+		return &computepb.Image{Name: proto.String("podvm-legacy-1")}, nil
+	}
+	return nil, fmt.Errorf("image family %s not found", req.Family)
+}
+
+type mockZonesClient struct{}
+
+func (m mockZonesClient) Get(ctx context.Context, req *computepb.GetZoneRequest, opts ...gax.CallOption) (*computepb.Zone, error) {
+	switch req.Zone {
+	case "us-central1-a":
+		return &computepb.Zone{AvailableCpuPlatforms: []string{"Intel Sapphire Rapids", "AMD Milan", "AMD Rome"}}, nil
+	case "us-west1-b":
+		return &computepb.Zone{AvailableCpuPlatforms: []string{"Intel Cascade Lake", "AMD Rome"}}, nil
+	}
+	return nil, fmt.Errorf("zone %s not found", req.Zone)
+}
+
+func TestValidateConfidentialType(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "ordinary VM", config: Config{MachineType: "e2-medium"}},
+		{name: "SEV", config: Config{ConfidentialType: "SEV", MachineType: "n2d-standard-2", MachineTypes: machineTypes{"c2d-standard-4"}}},
+		{name: "SEV-SNP", config: Config{ConfidentialType: "SEV_SNP", MachineType: "n2d-standard-2"}},
+		{name: "TDX", config: Config{ConfidentialType: "TDX", MachineType: "c3-standard-4"}},
+		{name: "unsupported type", config: Config{ConfidentialType: "CCA", MachineType: "n2d-standard-2"}, wantErr: "unsupported confidential type"},
+		{name: "default machine type", config: Config{ConfidentialType: "SEV_SNP", MachineType: defaultMachineType, MachineTypes: machineTypes{"n2d-standard-2", "n2d-standard-4"}}},
+		{name: "default machine type only", config: Config{ConfidentialType: "SEV_SNP", MachineType: defaultMachineType}, wantErr: "machine type e2-medium does not support SEV_SNP"},
+		{name: "explicit machine type", config: Config{ConfidentialType: "SEV_SNP", MachineType: "e2-standard-2", MachineTypes: machineTypes{"n2d-standard-2"}}, wantErr: "machine type e2-standard-2 does not support SEV_SNP"},
+		{name: "unsupported machine type", config: Config{ConfidentialType: "TDX", MachineType: "c3-standard-4", MachineTypes: machineTypes{"n2d-standard-2"}}, wantErr: "machine type n2d-standard-2 does not support TDX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfidentialType(&tt.config)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expect error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "ordinary VM", config: Config{ImageName: "podvm"}},
+		{name: "no image", config: Config{}, wantErr: "ImageName is empty"},
+		{name: "missing image", config: Config{ImageName: "missing"}, wantErr: "failed to get image"},
+		{name: "secure boot", config: Config{ImageName: "podvm", EnableSecureBoot: true}},
+		{name: "secure boot without UEFI", config: Config{ImageName: "projects/my-project/global/images/family/podvm-legacy", EnableSecureBoot: true}, wantErr: "does not have guest OS feature UEFI_COMPATIBLE"},
+		{name: "TDX", config: Config{ImageName: "projects/other-project/global/images/podvm-cvm", ConfidentialType: "TDX", Zone: "us-central1-a"}},
+		{name: "image without TDX", config: Config{ImageName: "podvm", ConfidentialType: "TDX", Zone: "us-central1-a"}, wantErr: "does not have guest OS feature TDX_CAPABLE"},
+		{name: "zone without SEV-SNP", config: Config{ImageName: "projects/other-project/global/images/podvm-cvm", ConfidentialType: "SEV_SNP", Zone: "us-west1-b"}, wantErr: "zone us-west1-b does not support SEV_SNP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.ProjectId = "my-project"
+			p := &gcpProvider{serviceConfig: &tt.config, imagesClient: mockImagesClient{}, zonesClient: mockZonesClient{}}
+			err := p.ConfigVerifier()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expect error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInstanceConfigs(t *testing.T) {
+	p := &gcpProvider{serviceConfig: &Config{}}
+	if p.confidentialInstanceConfig() != nil || p.shieldedInstanceConfig() != nil || p.minCpuPlatform() != nil {
+		t.Fatal("Expect the defaults of GCP for ordinary VMs")
+	}
+
+	p.serviceConfig = &Config{ConfidentialType: "SEV_SNP", EnableSecureBoot: true, DisableIntegrityMonitoring: true}
+	if e, a := "SEV_SNP", p.confidentialInstanceConfig().GetConfidentialInstanceType(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if e, a := "AMD Milan", p.minCpuPlatform(); a == nil || e != *a {
+		t.Errorf("Expect %s, got %v", e, a)
+	}
+	shielded := p.shieldedInstanceConfig()
+	if !shielded.GetEnableSecureBoot() || !shielded.GetEnableVtpm() || shielded.GetEnableIntegrityMonitoring() {
+		t.Errorf("Expect secure boot and vTPM without integrity monitoring, got %v", shielded)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 var gcpcfg Config
 
+const defaultMachineType = "e2-medium"
+
 type Manager struct{}
 
 func init() {
@@ -23,13 +25,28 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&gcpcfg.ProjectId, "gcp-project-id", "", "GCP Project ID")
 	flags.StringVar(&gcpcfg.Zone, "zone", "", "Zone")
 	flags.StringVar(&gcpcfg.ImageName, "image-name", "", "Pod VM image name")
-	flags.StringVar(&gcpcfg.MachineType, "machine-type", "e2-medium", "Pod VM instance type")
+	flags.StringVar(&gcpcfg.MachineType, "machine-type", defaultMachineType, "Pod VM instance type")
+	flags.Var(&gcpcfg.MachineTypes, "machine-types", "Machine types to be used for the Pod VMs, comma separated")
+	flags.StringVar(&gcpcfg.AcceleratorType, "accelerator-type", "", "Accelerator type attached to Pod VMs requesting GPUs, such as nvidia-tesla-t4 (machine types with built-in GPUs are used if not set)")
 	flags.StringVar(&gcpcfg.Network, "network", "", "Network ID to be used for the Pod VMs")
+	flags.StringVar(&gcpcfg.Subnetwork, "subnetwork", "", "Subnetwork ID to be used for the Pod VMs, such as regions/us-central1/subnetworks/podvms")
+	flags.StringVar(&gcpcfg.NetworkTier, "network-tier", "STANDARD", "Network tier of the external IPs of the Pod VMs (STANDARD or PREMIUM)")
+	flags.Var(&gcpcfg.NetworkTags, "network-tags", "Network tags of the Pod VMs for firewall rules, comma separated")
+	flags.BoolVar(&gcpcfg.DisablePublicIP, "disable-public-ip", false, "Create the Pod VMs without external IPs, and connect to their internal IPs")
 	flags.StringVar(&gcpcfg.DiskType, "disk-type", "pd-standard", "Any GCP disk type (pd-standard, pd-ssd, pd-balanced or pd-extreme)")
+	flags.IntVar(&gcpcfg.DiskSize, "disk-size", 20, "Boot disk size (in GiB) for the Pod VMs")
+	flags.Var(&gcpcfg.Labels, "labels", "Custom labels (key=value pairs) to be used for the Pod VMs, comma separated")
+	flags.StringVar(&gcpcfg.ServiceAccount, "service-account", "", "Email of the service account of the Pod VMs, the Pod VMs have no service account if not set")
+	flags.Var(&gcpcfg.ServiceAccountScopes, "service-account-scopes", "OAuth scopes of the service account of the Pod VMs, comma separated")
+	flags.StringVar(&gcpcfg.ConfidentialType, "confidential-type", "", "Confidential VM technology of the Pod VMs (SEV, SEV_SNP or TDX), ordinary VMs are used if not set")
+	flags.BoolVar(&gcpcfg.EnableSecureBoot, "enable-secure-boot", false, "Enable Secure Boot of the Pod VMs")
+	flags.BoolVar(&gcpcfg.DisableVtpm, "disable-vtpm", false, "Disable the vTPM of the Pod VMs")
+	flags.BoolVar(&gcpcfg.DisableIntegrityMonitoring, "disable-integrity-monitoring", false, "Disable integrity monitoring of the Pod VMs")
 }
 
 func (_ *Manager) LoadEnv() {
 	provider.DefaultToEnv(&gcpcfg.GcpCredentials, "GCP_CREDENTIALS", "")
+	provider.DefaultToEnv(&gcpcfg.NodeName, "NODE_NAME", "")
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
@@ -6,17 +6,22 @@ package gcp
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"strings"
+	"unicode"
 
 	compute "cloud.google.com/go/compute/apiv1"
 	computepb "cloud.google.com/go/compute/apiv1/computepb"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/googleapis/gax-go/v2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	option "google.golang.org/api/option"
 	proto "google.golang.org/protobuf/proto"
 )
@@ -24,47 +29,185 @@ import (
 var logger = log.New(log.Writer(), "[adaptor/cloud/gcp] ", log.LstdFlags|log.Lmsgprefix)
 var computeScope = "https://www.googleapis.com/auth/compute"
 
-const maxInstanceNameLen = 63
+// defaultServiceAccountScope leaves the access of the service account of pod VMs to its IAM roles
+const defaultServiceAccountScope = "https://www.googleapis.com/auth/cloud-platform"
+
+const (
+	maxInstanceNameLen = 63
+	maxLabelValueLen   = 63
+)
+
+// Labels of the pod, namespace and node owning a pod VM
+const (
+	podNameLabel      = "peer-pod-name"
+	podNamespaceLabel = "peer-pod-namespace"
+	nodeNameLabel     = "peer-pod-node"
+)
+
+// GCP limits metadata values, such as the base64 encoded user data, to 256KB
+var userDataLimit = cloudinit.UserDataLimit{Size: cloudinit.Base64Size(256 * 1024), Gzip: true}
+
+// machineTypesClient gets the shapes of machine types
+type machineTypesClient interface {
+	Get(ctx context.Context, req *computepb.GetMachineTypeRequest, opts ...gax.CallOption) (*computepb.MachineType, error)
+}
 
 type gcpProvider struct {
-	serviceConfig   *Config
-	instancesClient *compute.InstancesClient
+	serviceConfig      *Config
+	instancesClient    *compute.InstancesClient
+	machineTypesClient machineTypesClient
+	imagesClient       imagesClient
+	zonesClient        zonesClient
 }
 
+// ConfigVerifier checks that the image and the zone support the Shielded VM and Confidential VM options
 func (p *gcpProvider) ConfigVerifier() error {
-	return nil
+	return p.CheckHealth(context.TODO())
+}
+
+// CheckHealth verifies the image and the zone like ConfigVerifier, getting them with ctx
+func (p *gcpProvider) CheckHealth(ctx context.Context) error {
+	if len(p.serviceConfig.ImageName) == 0 {
+		return fmt.Errorf("ImageName is empty")
+	}
+	if err := p.verifyImage(ctx); err != nil {
+		return err
+	}
+	return p.verifyZone(ctx)
 }
 
 func NewProvider(config *Config) (provider.Provider, error) {
 	logger.Printf("gcp config: %#v", config.Redact())
+	if err := validateConfidentialType(config); err != nil {
+		return nil, err
+	}
+	if config.ConfidentialType != "" && len(config.MachineTypes) > 0 && config.MachineType == defaultMachineType {
+		config.MachineType = config.MachineTypes[0]
+	}
 	provider := &gcpProvider{
 		serviceConfig:   config,
 		instancesClient: nil,
 	}
+	var opts []option.ClientOption
 	if config.GcpCredentials != "" {
 		creds, err := google.CredentialsFromJSON(context.TODO(), []byte(config.GcpCredentials), computeScope)
 		if err != nil {
 			return nil, fmt.Errorf("configuration error when using creds: %s", err)
 		}
-		provider.instancesClient, err = compute.NewInstancesRESTClient(context.TODO(), option.WithCredentials(creds))
+		opts = append(opts, option.WithCredentials(creds))
+	}
+	var err error
+	provider.instancesClient, err = compute.NewInstancesRESTClient(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("NewInstancesRESTClient error: %s", err)
+	}
+	provider.machineTypesClient, err = compute.NewMachineTypesRESTClient(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("NewMachineTypesRESTClient error: %s", err)
+	}
+	provider.imagesClient, err = compute.NewImagesRESTClient(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("NewImagesRESTClient error: %s", err)
+	}
+	provider.zonesClient, err = compute.NewZonesRESTClient(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("NewZonesRESTClient error: %s", err)
+	}
+	if err = provider.updateMachineTypeSpecList(context.TODO()); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// updateMachineTypeSpecList populates MachineTypeSpecList with the shapes of the machine types
+func (p *gcpProvider) updateMachineTypeSpecList(ctx context.Context) error {
+	machineTypes := p.serviceConfig.MachineTypes
+	if len(machineTypes) == 0 {
+		machineTypes = append(machineTypes, p.serviceConfig.MachineType)
+	}
+
+	var specList []provider.InstanceTypeSpec
+	for _, machineType := range machineTypes {
+		spec, err := p.getMachineTypeSpec(ctx, machineType)
 		if err != nil {
-			return nil, fmt.Errorf("NewInstancesRESTClient with credentials error: %s", err)
+			return err
 		}
-	} else {
-		var err error
-		provider.instancesClient, err = compute.NewInstancesRESTClient(context.TODO())
-		if err != nil {
-			return nil, fmt.Errorf("NewInstancesRESTClient error: %s", err)
+		specList = append(specList, spec)
+	}
+
+	p.serviceConfig.MachineTypeSpecList = provider.SortInstanceTypesOnResources(specList)
+	logger.Printf("MachineTypeSpecList (%v)", p.serviceConfig.MachineTypeSpecList)
+	return nil
+}
+
+// getMachineTypeSpec gets the vCPUs, memory and built-in GPUs of a machine type
+func (p *gcpProvider) getMachineTypeSpec(ctx context.Context, machineType string) (provider.InstanceTypeSpec, error) {
+	req := &computepb.GetMachineTypeRequest{
+		Project:     p.serviceConfig.ProjectId,
+		Zone:        p.serviceConfig.Zone,
+		MachineType: machineType,
+	}
+	info, err := p.machineTypesClient.Get(ctx, req)
+	if err != nil {
+		return provider.InstanceTypeSpec{}, fmt.Errorf("MachineTypes.Get error: %w, req: %v", err, req)
+	}
+
+	var gpus int64
+	for _, accelerator := range info.GetAccelerators() {
+		gpus += int64(accelerator.GetGuestAcceleratorCount())
+	}
+	return provider.InstanceTypeSpec{
+		InstanceType: machineType,
+		VCPUs:        int64(info.GetGuestCpus()),
+		Memory:       int64(info.GetMemoryMb()),
+		GPUs:         gpus,
+	}, nil
+}
+
+// selectMachineType selects a machine type for the resources of a pod. With an accelerator type,
+// GPU requests are met by attaching accelerators to a machine type without built-in GPUs.
+func (p *gcpProvider) selectMachineType(spec provider.InstanceTypeSpec) (string, []*computepb.AcceleratorConfig, error) {
+	var accelerators []*computepb.AcceleratorConfig
+	if spec.GPUs > 0 && p.serviceConfig.AcceleratorType != "" {
+		accelerators = append(accelerators, &computepb.AcceleratorConfig{
+			AcceleratorType:  proto.String(fmt.Sprintf("zones/%s/acceleratorTypes/%s", p.serviceConfig.Zone, p.serviceConfig.AcceleratorType)),
+			AcceleratorCount: proto.Int32(int32(spec.GPUs)),
+		})
+		spec.GPUs = 0
+	}
+
+	machineType, err := provider.SelectInstanceTypeToUse(spec, p.serviceConfig.MachineTypeSpecList, p.serviceConfig.MachineTypes, p.serviceConfig.MachineType)
+	if err != nil {
+		return "", nil, err
+	}
+	return machineType, accelerators, nil
+}
+
+// hasGPUs checks if an instance of a machine type has GPUs, either built-in or attached
+func (p *gcpProvider) hasGPUs(machineType string, accelerators []*computepb.AcceleratorConfig) bool {
+	if len(accelerators) > 0 {
+		return true
+	}
+	for _, spec := range p.serviceConfig.MachineTypeSpecList {
+		if spec.InstanceType == machineType {
+			return spec.GPUs > 0
 		}
 	}
-	return provider, nil
+	return false
 }
 
-func getIPs(instance *computepb.Instance) ([]netip.Addr, error) {
+// getIPs returns the external IPs of an instance, or its internal IPs without public IPs
+func getIPs(instance *computepb.Instance, disablePublicIP bool) ([]netip.Addr, error) {
 	var podNodeIPs []netip.Addr
 	for _, nic := range instance.GetNetworkInterfaces() {
-		for _, access := range nic.GetAccessConfigs() {
-			ipStr := access.GetNatIP()
+		ipStrs := []string{nic.GetNetworkIP()}
+		if !disablePublicIP {
+			ipStrs = nil
+			for _, access := range nic.GetAccessConfigs() {
+				ipStrs = append(ipStrs, access.GetNatIP())
+			}
+		}
+		for _, ipStr := range ipStrs {
 			ip, err := netip.ParseAddr(ipStr)
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse pod node IP %q: %w", ipStr, err)
@@ -76,12 +219,103 @@ func getIPs(instance *computepb.Instance) ([]netip.Addr, error) {
 	return podNodeIPs, nil
 }
 
+// networkInterface returns the network interface of pod VMs, with an external IP unless public IPs are disabled
+func (p *gcpProvider) networkInterface() *computepb.NetworkInterface {
+	nic := &computepb.NetworkInterface{
+		StackType: proto.String(computepb.NetworkInterface_IPV4_ONLY.String()),
+	}
+	if p.serviceConfig.Network != "" {
+		nic.Network = proto.String(p.serviceConfig.Network)
+	}
+	if p.serviceConfig.Subnetwork != "" {
+		nic.Subnetwork = proto.String(p.serviceConfig.Subnetwork)
+	}
+	if !p.serviceConfig.DisablePublicIP {
+		nic.AccessConfigs = []*computepb.AccessConfig{
+			{
+				Name:        proto.String("External NAT"),
+				NetworkTier: proto.String(p.serviceConfig.NetworkTier),
+			},
+		}
+	}
+	return nic
+}
+
+// labels returns the custom labels of pod VMs, and the labels of the pod, namespace and node owning a pod VM
+func (p *gcpProvider) labels(podName, podNamespace string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range p.serviceConfig.Labels {
+		labels[k] = v
+	}
+	for k, v := range map[string]string{
+		podNameLabel:      podName,
+		podNamespaceLabel: podNamespace,
+		nodeNameLabel:     p.serviceConfig.NodeName,
+	} {
+		if v != "" {
+			labels[k] = labelValue(v)
+		}
+	}
+	return labels
+}
+
+// labelValue converts a name to a label value, which has at most 63 lowercase letters, digits, underscores and dashes
+func labelValue(name string) string {
+	value := strings.Map(func(r rune) rune {
+		if unicode.IsLower(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+			return r
+		}
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, name)
+	// The limit counts characters, which may be multibyte lowercase letters
+	if runes := []rune(value); len(runes) > maxLabelValueLen {
+		value = string(runes[:maxLabelValueLen])
+	}
+	return value
+}
+
+// networkTags returns the network tags of pod VMs, which firewall rules apply to
+func (p *gcpProvider) networkTags() *computepb.Tags {
+	if len(p.serviceConfig.NetworkTags) == 0 {
+		return nil
+	}
+	return &computepb.Tags{Items: p.serviceConfig.NetworkTags}
+}
+
+// serviceAccounts returns the service account of pod VMs, if one is set, with the cloud-platform scope by default
+func (p *gcpProvider) serviceAccounts() []*computepb.ServiceAccount {
+	if p.serviceConfig.ServiceAccount == "" {
+		return nil
+	}
+	scopes := p.serviceConfig.ServiceAccountScopes
+	if len(scopes) == 0 {
+		scopes = []string{defaultServiceAccountScope}
+	}
+	return []*computepb.ServiceAccount{
+		{
+			Email:  proto.String(p.serviceConfig.ServiceAccount),
+			Scopes: scopes,
+		},
+	}
+}
+
+// diskSize returns the boot disk size in GiB of a pod VM, from the annotation of the pod or the config
+func (p *gcpProvider) diskSize(spec provider.InstanceTypeSpec) int64 {
+	if spec.DiskSize > 0 {
+		return spec.DiskSize
+	}
+	return int64(p.serviceConfig.DiskSize)
+}
+
 func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
-	userData, err := cloudConfig.Generate()
+	userData, err := userDataLimit.Generate(cloudConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -93,18 +327,20 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	// It's expected that the image from the annotation will follow the format
 	// "projects/<project>/global/images/<imageid>" or just the "<imageid>" if the
 	// image is present on the same project.
-	var srcImage *string
-	if strings.HasPrefix(p.serviceConfig.ImageName, "projects/") {
-		srcImage = proto.String(p.serviceConfig.ImageName)
-	} else {
-		srcImage = proto.String(fmt.Sprintf("projects/%s/global/images/%s", p.serviceConfig.ProjectId, p.serviceConfig.ImageName))
-	}
+	srcImage := proto.String(p.imagePath(p.serviceConfig.ImageName))
 
 	if spec.Image != "" {
 		logger.Printf("Choosing %s from annotation as the GCP image for the PodVM image", spec.Image)
 		srcImage = proto.String(spec.Image)
 	}
 
+	machineType, accelerators, err := p.selectMachineType(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Neither instances with GPUs nor Confidential VMs are live migrated on host maintenance
+	noMigration := p.hasGPUs(machineType, accelerators) || p.serviceConfig.ConfidentialType != ""
+
 	insertReq := &computepb.InsertInstanceRequest{
 		Project: p.serviceConfig.ProjectId,
 		Zone:    p.serviceConfig.Zone,
@@ -113,7 +349,7 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 			Disks: []*computepb.AttachedDisk{
 				{
 					InitializeParams: &computepb.AttachedDiskInitializeParams{
-						DiskSizeGb:  proto.Int64(20),
+						DiskSizeGb:  proto.Int64(p.diskSize(spec)),
 						SourceImage: srcImage,
 						DiskType:    proto.String(fmt.Sprintf("zones/%s/diskTypes/%s", p.serviceConfig.Zone, p.serviceConfig.DiskType)),
 					},
@@ -134,26 +370,33 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 					},
 				},
 			},
-			MachineType: proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", p.serviceConfig.Zone, p.serviceConfig.MachineType)),
-			NetworkInterfaces: []*computepb.NetworkInterface{
-				{
-					AccessConfigs: []*computepb.AccessConfig{
-						{
-							Name:        proto.String("External NAT"),
-							NetworkTier: proto.String("STANDARD"),
-						},
-					},
-					StackType: proto.String("IPV4_Only"),
-					Name:      proto.String(p.serviceConfig.Network),
-				},
-			},
+			MachineType:       proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", p.serviceConfig.Zone, machineType)),
+			GuestAccelerators: accelerators,
+			Scheduling:        scheduling(spec.Spot, noMigration),
+			MinCpuPlatform:    p.minCpuPlatform(),
+			NetworkInterfaces: []*computepb.NetworkInterface{p.networkInterface()},
+			Labels:            p.labels(podName, spec.PodNamespace),
+			Tags:              p.networkTags(),
+			ServiceAccounts:   p.serviceAccounts(),
+
+			ConfidentialInstanceConfig: p.confidentialInstanceConfig(),
+			ShieldedInstanceConfig:     p.shieldedInstanceConfig(),
 		},
 	}
+
 	op, err := p.instancesClient.Insert(ctx, insertReq)
 	if err != nil {
 		return nil, fmt.Errorf("Instances.Insert error: %s. req: %v", err, insertReq)
 	}
 	err = op.Wait(ctx)
+	if err != nil && spec.Spot && isSpotCapacityError(op.Proto()) {
+		logger.Printf("No spot capacity for instance %s, falling back to standard provisioning: %v", instanceName, err)
+		insertReq.InstanceResource.Scheduling = scheduling(false, noMigration)
+		if op, err = p.instancesClient.Insert(ctx, insertReq); err != nil {
+			return nil, fmt.Errorf("Instances.Insert error: %s. req: %v", err, insertReq)
+		}
+		err = op.Wait(ctx)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("waiting for Instances.Insert error: %s. req: %v", err, insertReq)
 	}
@@ -171,7 +414,7 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	}
 	logger.Printf("instance name %s, id %d", instance.GetName(), instance.GetId())
 
-	ips, err := getIPs(instance)
+	ips, err := getIPs(instance, p.serviceConfig.DisablePublicIP)
 	if err != nil {
 		logger.Printf("failed to get IPs for the instance: %v", err)
 		return nil, err
@@ -202,6 +445,82 @@ func (p *gcpProvider) DeleteInstance(ctx context.Context, instanceID string) err
 	return nil
 }
 
+// CheckInstance returns an error wrapping provider.ErrInstancePreempted if a spot instance was preempted
+func (p *gcpProvider) CheckInstance(ctx context.Context, instanceID string) error {
+	req := &computepb.GetInstanceRequest{
+		Project:  p.serviceConfig.ProjectId,
+		Zone:     p.serviceConfig.Zone,
+		Instance: instanceID,
+	}
+	instance, err := p.instancesClient.Get(ctx, req)
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) && gErr.Code == http.StatusNotFound {
+		return fmt.Errorf("instance %s not found: %w", instanceID, provider.ErrInstancePreempted)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get instance: %w, req: %v", err, req)
+	}
+	return checkStatus(instance)
+}
+
+// GetInstanceIPs returns the current IP addresses of an instance
+func (p *gcpProvider) GetInstanceIPs(ctx context.Context, instanceID string) ([]netip.Addr, error) {
+	req := &computepb.GetInstanceRequest{
+		Project:  p.serviceConfig.ProjectId,
+		Zone:     p.serviceConfig.Zone,
+		Instance: instanceID,
+	}
+	instance, err := p.instancesClient.Get(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get instance: %w, req: %v", err, req)
+	}
+	return getIPs(instance, p.serviceConfig.DisablePublicIP)
+}
+
+// checkStatus returns an error wrapping provider.ErrInstancePreempted if an instance is stopped
+func checkStatus(instance *computepb.Instance) error {
+	switch instance.GetStatus() {
+	case computepb.Instance_STOPPING.String(), computepb.Instance_TERMINATED.String(),
+		computepb.Instance_SUSPENDING.String(), computepb.Instance_SUSPENDED.String():
+		return fmt.Errorf("instance %s is %s: %w", instance.GetName(), instance.GetStatus(), provider.ErrInstancePreempted)
+	}
+	return nil
+}
+
+// scheduling returns the scheduling options of spot instances and of instances which cannot be live migrated
+func scheduling(spot, noMigration bool) *computepb.Scheduling {
+	if spot {
+		return spotScheduling()
+	}
+	if noMigration {
+		return &computepb.Scheduling{
+			OnHostMaintenance: proto.String(computepb.Scheduling_TERMINATE.String()),
+		}
+	}
+	return nil
+}
+
+// spotScheduling makes an instance a spot VM, which is deleted when it is preempted
+func spotScheduling() *computepb.Scheduling {
+	return &computepb.Scheduling{
+		ProvisioningModel:         proto.String(computepb.Scheduling_SPOT.String()),
+		InstanceTerminationAction: proto.String(computepb.Scheduling_DELETE.String()),
+		OnHostMaintenance:         proto.String(computepb.Scheduling_TERMINATE.String()),
+		AutomaticRestart:          proto.Bool(false),
+	}
+}
+
+// isSpotCapacityError checks if the insert operation of a spot instance failed for lack of spot capacity
+func isSpotCapacityError(op *computepb.Operation) bool {
+	for _, opErr := range op.GetError().GetErrors() {
+		switch opErr.GetCode() {
+		case "ZONE_RESOURCE_POOL_EXHAUSTED", "ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS", "QUOTA_EXCEEDED":
+			return true
+		}
+	}
+	return false
+}
+
 func (p *gcpProvider) Teardown() error {
 	return nil
 }
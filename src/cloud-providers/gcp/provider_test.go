@@ -0,0 +1,279 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+type mockMachineTypesClient struct{}
+
+func (m mockMachineTypesClient) Get(ctx context.Context, req *computepb.GetMachineTypeRequest, opts ...gax.CallOption) (*computepb.MachineType, error) {
+	switch req.MachineType {
+	case "e2-medium":
+		return &computepb.MachineType{GuestCpus: proto.Int32(2), MemoryMb: proto.Int32(4096)}, nil
+	case "n1-standard-4":
+		return &computepb.MachineType{GuestCpus: proto.Int32(4), MemoryMb: proto.Int32(15360)}, nil
+	case "e2-standard-8":
+		return &computepb.MachineType{GuestCpus: proto.Int32(8), MemoryMb: proto.Int32(32768)}, nil
+	case "g2-standard-8":
+		return &computepb.MachineType{
+			GuestCpus: proto.Int32(8),
+			MemoryMb:  proto.Int32(32768),
+			Accelerators: []*computepb.Accelerators{
+				{GuestAcceleratorType: proto.String("nvidia-l4"), GuestAcceleratorCount: proto.Int32(1)},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("machine type %s not found", req.MachineType)
+}
+
+func newMockProvider(config *Config) *gcpProvider {
+	return &gcpProvider{serviceConfig: config, machineTypesClient: mockMachineTypesClient{}}
+}
+
+func TestGetMachineTypeSpec(t *testing.T) {
+	p := newMockProvider(&Config{Zone: "us-central1-a"})
+	tests := []struct {
+		machineType string
+		want        provider.InstanceTypeSpec
+		wantErr     bool
+	}{
+		{
+			machineType: "e2-medium",
+			want:        provider.InstanceTypeSpec{InstanceType: "e2-medium", VCPUs: 2, Memory: 4096},
+		},
+		{
+			machineType: "g2-standard-8",
+			want:        provider.InstanceTypeSpec{InstanceType: "g2-standard-8", VCPUs: 8, Memory: 32768, GPUs: 1},
+		},
+		{
+			machineType: "mycustommachine",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.machineType, func(t *testing.T) {
+			got, err := p.getMachineTypeSpec(context.Background(), tt.machineType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMachineTypeSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getMachineTypeSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectMachineType(t *testing.T) {
+	config := &Config{
+		Zone:         "us-central1-a",
+		MachineType:  "e2-medium",
+		MachineTypes: machineTypes{"e2-medium", "e2-standard-8", "g2-standard-8", "n1-standard-4"},
+	}
+	p := newMockProvider(config)
+	if err := p.updateMachineTypeSpecList(context.Background()); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		spec             provider.InstanceTypeSpec
+		acceleratorType  string
+		want             string
+		wantAccelerators int32
+		wantGPUs         bool
+		wantErr          bool
+	}{
+		{name: "default", spec: provider.InstanceTypeSpec{}, want: "e2-medium"},
+		{name: "annotation", spec: provider.InstanceTypeSpec{InstanceType: "e2-standard-8"}, want: "e2-standard-8"},
+		{name: "invalid annotation", spec: provider.InstanceTypeSpec{InstanceType: "n2-standard-2"}, wantErr: true},
+		{name: "resources", spec: provider.InstanceTypeSpec{VCPUs: 4, Memory: 8192}, want: "n1-standard-4"},
+		{name: "too large", spec: provider.InstanceTypeSpec{VCPUs: 16, Memory: 65536}, wantErr: true},
+		{name: "built-in GPU", spec: provider.InstanceTypeSpec{GPUs: 1}, want: "g2-standard-8", wantGPUs: true},
+		{
+			name:             "attached GPUs",
+			spec:             provider.InstanceTypeSpec{VCPUs: 4, Memory: 8192, GPUs: 2},
+			acceleratorType:  "nvidia-tesla-t4",
+			want:             "n1-standard-4",
+			wantAccelerators: 2,
+			wantGPUs:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AcceleratorType = tt.acceleratorType
+			got, accelerators, err := p.selectMachineType(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectMachineType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectMachineType() = %v, want %v", got, tt.want)
+			}
+			var count int32
+			for _, accelerator := range accelerators {
+				count += accelerator.GetAcceleratorCount()
+				if e, a := "zones/us-central1-a/acceleratorTypes/"+tt.acceleratorType, accelerator.GetAcceleratorType(); e != a {
+					t.Errorf("Expect %s, got %s", e, a)
+				}
+			}
+			if count != tt.wantAccelerators {
+				t.Errorf("Expect %d accelerators, got %d", tt.wantAccelerators, count)
+			}
+			if err == nil && p.hasGPUs(got, accelerators) != tt.wantGPUs {
+				t.Errorf("Expect GPUs %v for %s", tt.wantGPUs, got)
+			}
+		})
+	}
+}
+
+func TestScheduling(t *testing.T) {
+	if scheduling(false, false) != nil {
+		t.Error("Expect no scheduling options")
+	}
+	if e, a := computepb.Scheduling_TERMINATE.String(), scheduling(false, true).GetOnHostMaintenance(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if e, a := computepb.Scheduling_SPOT.String(), scheduling(true, true).GetProvisioningModel(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+}
+
+func TestSpotScheduling(t *testing.T) {
+	scheduling := spotScheduling()
+	if e, a := computepb.Scheduling_SPOT.String(), scheduling.GetProvisioningModel(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if e, a := computepb.Scheduling_DELETE.String(), scheduling.GetInstanceTerminationAction(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+
+	for code, expected := range map[string]bool{
+		"ZONE_RESOURCE_POOL_EXHAUSTED":              true,
+		"ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS": true,
+		"QUOTA_EXCEEDED":                            true,
+		"INVALID_USAGE":                             false,
+	} {
+		op := &computepb.Operation{
+			Error: &computepb.Error{Errors: []*computepb.Errors{{Code: proto.String(code)}}},
+		}
+		if isSpotCapacityError(op) != expected {
+			t.Errorf("Expect spot capacity error %v for %s", expected, code)
+		}
+	}
+	if isSpotCapacityError(&computepb.Operation{}) {
+		t.Error("Expect no spot capacity error without errors")
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	for status, preempted := range map[computepb.Instance_Status]bool{
+		computepb.Instance_RUNNING:    false,
+		computepb.Instance_STAGING:    false,
+		computepb.Instance_STOPPING:   true,
+		computepb.Instance_TERMINATED: true,
+		computepb.Instance_SUSPENDED:  true,
+	} {
+		instance := &computepb.Instance{Name: proto.String("podvm"), Status: proto.String(status.String())}
+		if err := checkStatus(instance); errors.Is(err, provider.ErrInstancePreempted) != preempted {
+			t.Errorf("Expect preempted %v for %s, got %v", preempted, status, err)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	p := &gcpProvider{serviceConfig: &Config{
+		Labels:   provider.KeyValueFlag{"team": "coco", podNameLabel: "overridden"},
+		NodeName: "Worker.Example.com",
+	}}
+	labels := p.labels("my.pod-with-a-very-long-name-exceeding-the-limit-of-label-values-of-gcp", "default")
+	for k, v := range map[string]string{
+		"team":            "coco",
+		podNameLabel:      "my-pod-with-a-very-long-name-exceeding-the-limit-of-label-value",
+		podNamespaceLabel: "default",
+		nodeNameLabel:     "worker-example-com",
+	} {
+		if labels[k] != v {
+			t.Errorf("Expect label %s=%s, got %q", k, v, labels[k])
+		}
+	}
+	if len(labels[podNameLabel]) != maxLabelValueLen {
+		t.Errorf("Expect %d characters, got %d", maxLabelValueLen, len(labels[podNameLabel]))
+	}
+
+	value := labelValue(strings.Repeat("É", 70))
+	if e, a := strings.Repeat("é", maxLabelValueLen), value; e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if !utf8.ValidString(value) {
+		t.Errorf("Expect valid UTF-8, got %q", value)
+	}
+}
+
+func TestNetworkInterface(t *testing.T) {
+	p := &gcpProvider{serviceConfig: &Config{Network: "global/networks/podvms", NetworkTier: "PREMIUM"}}
+	nic := p.networkInterface()
+	if e, a := "global/networks/podvms", nic.GetNetwork(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if len(nic.GetAccessConfigs()) != 1 || nic.GetAccessConfigs()[0].GetNetworkTier() != "PREMIUM" {
+		t.Errorf("Expect an external IP of the premium tier, got %v", nic.GetAccessConfigs())
+	}
+
+	p.serviceConfig = &Config{Subnetwork: "regions/us-central1/subnetworks/podvms", DisablePublicIP: true}
+	nic = p.networkInterface()
+	if e, a := "regions/us-central1/subnetworks/podvms", nic.GetSubnetwork(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if nic.Network != nil || len(nic.GetAccessConfigs()) != 0 {
+		t.Errorf("Expect neither network nor external IP, got %v", nic)
+	}
+
+	instance := &computepb.Instance{
+		NetworkInterfaces: []*computepb.NetworkInterface{
+			{
+				NetworkIP:     proto.String("10.0.0.2"),
+				AccessConfigs: []*computepb.AccessConfig{{NatIP: proto.String("203.0.113.2")}},
+			},
+		},
+	}
+	for disablePublicIP, e := range map[bool]string{false: "203.0.113.2", true: "10.0.0.2"} {
+		ips, err := getIPs(instance, disablePublicIP)
+		if err != nil || len(ips) != 1 || ips[0].String() != e {
+			t.Errorf("Expect %s, got %v, %v", e, ips, err)
+		}
+	}
+}
+
+func TestInstanceOptions(t *testing.T) {
+	p := &gcpProvider{serviceConfig: &Config{DiskSize: 20}}
+	if p.networkTags() != nil || p.serviceAccounts() != nil {
+		t.Error("Expect neither network tags nor service account")
+	}
+	if e, a := int64(20), p.diskSize(provider.InstanceTypeSpec{}); e != a {
+		t.Errorf("Expect %d, got %d", e, a)
+	}
+	if e, a := int64(50), p.diskSize(provider.InstanceTypeSpec{DiskSize: 50}); e != a {
+		t.Errorf("Expect %d, got %d", e, a)
+	}
+
+	p.serviceConfig = &Config{NetworkTags: networkTags{"podvm", "allow-15150"}, ServiceAccount: "podvm@my-project.iam.gserviceaccount.com"}
+	if e, a := 2, len(p.networkTags().GetItems()); e != a {
+		t.Errorf("Expect %d network tags, got %d", e, a)
+	}
+	serviceAccounts := p.serviceAccounts()
+	if len(serviceAccounts) != 1 || serviceAccounts[0].GetScopes()[0] != defaultServiceAccountScope {
+		t.Errorf("Expect service account with the default scope, got %v", serviceAccounts)
+	}
+}
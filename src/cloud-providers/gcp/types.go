@@ -4,17 +4,81 @@
 package gcp
 
 import (
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
+type machineTypes []string
+
+func (i *machineTypes) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *machineTypes) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(machineTypes, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type networkTags []string
+
+func (i *networkTags) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *networkTags) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(networkTags, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type serviceAccountScopes []string
+
+func (i *serviceAccountScopes) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *serviceAccountScopes) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(serviceAccountScopes, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
 type Config struct {
-	GcpCredentials string
-	ProjectId      string
-	Zone           string
-	ImageName      string
-	MachineType    string
-	Network        string
-	DiskType       string
+	GcpCredentials             string
+	ProjectId                  string
+	Zone                       string
+	ImageName                  string
+	MachineType                string
+	MachineTypes               machineTypes
+	MachineTypeSpecList        []provider.InstanceTypeSpec
+	AcceleratorType            string
+	Network                    string
+	Subnetwork                 string
+	NetworkTier                string
+	NetworkTags                networkTags
+	DisablePublicIP            bool
+	DiskType                   string
+	DiskSize                   int
+	Labels                     provider.KeyValueFlag
+	ServiceAccount             string
+	ServiceAccountScopes       serviceAccountScopes
+	NodeName                   string
+	ConfidentialType           string
+	EnableSecureBoot           bool
+	DisableVtpm                bool
+	DisableIntegrityMonitoring bool
 }
 
 func (c Config) Redact() Config {
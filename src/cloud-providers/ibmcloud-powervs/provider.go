@@ -21,6 +21,9 @@ import (
 
 const maxInstanceNameLen = 63
 
+// Power VS limits the base64 encoded user data to 63KB
+var userDataLimit = cloudinit.UserDataLimit{Size: cloudinit.Base64Size(63 * 1024), Gzip: true}
+
 var logger = log.New(log.Writer(), "[adaptor/cloud/ibmcloud-powervs] ", log.LstdFlags|log.Lmsgprefix)
 
 type ibmcloudPowerVSProvider struct {
@@ -47,7 +50,7 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	userData, err := cloudConfig.Generate()
+	userData, err := userDataLimit.Generate(cloudConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +30,9 @@ var errNotReady = errors.New("address not ready")
 
 const maxInstanceNameLen = 63
 
+// IBM Cloud VPC limits the user data to 64KB, which is passed as a string and cannot be gzipped
+var userDataLimit = cloudinit.UserDataLimit{Size: 64 * 1024}
+
 type vpcV1 interface {
 	CreateInstanceWithContext(context.Context, *vpcv1.CreateInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
 	GetInstanceWithContext(context.Context, *vpcv1.GetInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
@@ -246,7 +249,7 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	userData, err := cloudConfig.Generate()
+	userData, err := userDataLimit.Generate(cloudConfig)
 	if err != nil {
 		return nil, err
 	}
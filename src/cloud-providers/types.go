@@ -20,6 +20,27 @@ type Provider interface {
 	ConfigVerifier() error
 }
 
+// ErrInstancePreempted is returned by CheckInstance if the cloud reclaimed a spot instance
+var ErrInstancePreempted = errors.New("spot instance was preempted")
+
+// InstanceChecker is implemented by providers of spot instances to detect preempted instances.
+// CheckInstance returns an error wrapping ErrInstancePreempted if the instance was stopped or deleted by the cloud.
+type InstanceChecker interface {
+	CheckInstance(ctx context.Context, instanceID string) error
+}
+
+// InstanceIPsGetter is implemented by providers which can look up the current IP addresses of an instance,
+// in the same order as the IPs of the Instance returned by CreateInstance
+type InstanceIPsGetter interface {
+	GetInstanceIPs(ctx context.Context, instanceID string) ([]netip.Addr, error)
+}
+
+// HealthChecker is implemented by providers which can check that the cloud API is reachable with their configuration.
+// CheckHealth is called by the readiness probe instead of ConfigVerifier, so it should make only cheap API calls.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 // keyValueFlag represents a flag of key-value pairs
 type KeyValueFlag map[string]string
 
@@ -67,4 +88,10 @@ type InstanceTypeSpec struct {
 	Arch         string
 	GPUs         int64
 	Image        string
+	// Spot requests a spot or preemptible instance, falling back to an on-demand instance without spot capacity
+	Spot bool
+	// DiskSize is the size of the boot disk in GiB, the default of the provider is used if it is zero
+	DiskSize int64
+	// PodNamespace is the namespace of the pod of the instance
+	PodNamespace string
 }
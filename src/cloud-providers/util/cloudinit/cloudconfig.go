@@ -5,6 +5,7 @@ package cloudinit
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"fmt"
 	"strings"
@@ -12,7 +13,8 @@ import (
 )
 
 const (
-	DefaultAuthfileLimit = 12288 // TODO: use a whole userdata limit mechanism instead of limiting authfile
+	// GzipBase64Encoding is the write_files encoding of gzip compressed and base64 encoded contents
+	GzipBase64Encoding = "gzip+base64"
 )
 
 // https://cloudinit.readthedocs.io/en/latest/topics/format.html#cloud-config-data
@@ -33,6 +35,10 @@ type WriteFile struct {
 	Permissions string `yaml:"permissions,omitempty"`
 	Encoding    string `yaml:"encoding,omitempty"`
 	Append      string `yaml:"append,omitempty"`
+	// Sensitive contents are encrypted to the pod VM key by SealedCloudConfig
+	Sensitive bool `yaml:"-"`
+	// Compress contents with the gzip+base64 encoding
+	Compress bool `yaml:"-"`
 }
 
 const cloudInitText = `{{/* Template for cloud-config */ -}}
@@ -85,15 +91,68 @@ func (config *CloudConfig) Generate() (string, error) {
 		return "", fmt.Errorf("Error initializing a template for cloudinit userdata: %w", err)
 	}
 
+	encoded, err := config.encode()
+	if err != nil {
+		return "", err
+	}
+
 	var buf bytes.Buffer
 
-	if err := tpl.Execute(&buf, config); err != nil {
+	if err := tpl.Execute(&buf, encoded); err != nil {
 		return "", fmt.Errorf("Error executing a template for cloudinit userdata: %w", err)
 	}
 
 	return buf.String(), nil
 }
 
+// encode returns a copy of the cloud-config whose contents to compress are gzip+base64 encoded
+func (config *CloudConfig) encode() (*CloudConfig, error) {
+	encoded := &CloudConfig{WriteFiles: make([]WriteFile, len(config.WriteFiles))}
+	for i, wf := range config.WriteFiles {
+		if wf.Compress && wf.Encoding == "" {
+			content, err := GzipBase64([]byte(wf.Content))
+			if err != nil {
+				return nil, fmt.Errorf("Error compressing %s: %w", wf.Path, err)
+			}
+			wf.Content = content
+			wf.Encoding = GzipBase64Encoding
+		}
+		encoded.WriteFiles[i] = wf
+	}
+	return encoded, nil
+}
+
+// compressed returns a copy of the cloud-config which compresses all contents without an encoding
+func (config *CloudConfig) compressed() CloudConfigGenerator {
+	compressed := &CloudConfig{WriteFiles: make([]WriteFile, len(config.WriteFiles))}
+	for i, wf := range config.WriteFiles {
+		wf.Compress = wf.Encoding == ""
+		compressed.WriteFiles[i] = wf
+	}
+	return compressed
+}
+
+// GzipBase64 compresses content with gzip and encodes it with base64
+func GzipBase64(content []byte) (string, error) {
+	compressed, err := gzipData(content)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(compressed), nil
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func AuthJSONToResourcesJSON(text string) string {
 	var buf bytes.Buffer
 	tpl := template.Must(template.New("cerdTpl").Parse("{\"default/credential/test\":\"{{.EncodedAuth}}\"}"))
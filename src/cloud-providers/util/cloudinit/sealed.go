@@ -0,0 +1,261 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// SealedEncoding is the write_files encoding of contents encrypted to the pod VM key
+	SealedEncoding = "coco-sealed"
+	// SignaturePrefix starts the comment line carrying the signature of the cloud-config
+	SignaturePrefix = "# coco-signature: "
+
+	sealedInfo = "coco-userdata-seal-v1"
+)
+
+// ErrUnsigned is returned when verifying a cloud-config without a signature
+var ErrUnsigned = errors.New("cloud-config is not signed")
+
+// SealedCloudConfig generates a cloud-config whose sensitive write_files are encrypted to
+// the pod VM key, and which is signed by the key of the cloud-api-adaptor
+type SealedCloudConfig struct {
+	CloudConfig *CloudConfig
+	// SigningKey signs the cloud-config when set
+	SigningKey ed25519.PrivateKey
+	// EncryptionKey encrypts the sensitive write_files when set
+	EncryptionKey *ecdh.PublicKey
+}
+
+func (s *SealedCloudConfig) Generate() (string, error) {
+	config := &CloudConfig{WriteFiles: make([]WriteFile, len(s.CloudConfig.WriteFiles))}
+	for i, wf := range s.CloudConfig.WriteFiles {
+		if wf.Sensitive && s.EncryptionKey != nil {
+			if wf.Encoding != "" {
+				return "", fmt.Errorf("Error sealing %s: encoding %s cannot be sealed", wf.Path, wf.Encoding)
+			}
+			content, err := Seal([]byte(wf.Content), wf.Path, s.EncryptionKey)
+			if err != nil {
+				return "", fmt.Errorf("Error sealing %s: %w", wf.Path, err)
+			}
+			wf.Content = content
+			wf.Encoding = SealedEncoding
+		}
+		config.WriteFiles[i] = wf
+	}
+
+	userData, err := config.Generate()
+	if err != nil {
+		return "", err
+	}
+	if s.SigningKey == nil {
+		return userData, nil
+	}
+	return Sign(userData, s.SigningKey), nil
+}
+
+// compressed returns a sealed cloud-config which compresses the contents that are not sealed
+func (s *SealedCloudConfig) compressed() CloudConfigGenerator {
+	return &SealedCloudConfig{
+		CloudConfig:   s.CloudConfig.compressed().(*CloudConfig),
+		SigningKey:    s.SigningKey,
+		EncryptionKey: s.EncryptionKey,
+	}
+}
+
+// sealingKey derives the AES-256 key of a sealed content from the X25519 shared secret
+func sealingKey(secret, ephemeralPublicKey, recipientPublicKey []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPublicKey...), recipientPublicKey...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(sealedInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal encrypts content to the X25519 public key of the pod VM, binding it to the file path.
+// The result is base64 of the ephemeral public key, the nonce and the AES-GCM ciphertext.
+func Seal(content []byte, path string, publicKey *ecdh.PublicKey) (string, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	secret, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return "", err
+	}
+	key, err := sealingKey(secret, ephemeral.PublicKey().Bytes(), publicKey.Bytes())
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := append(ephemeral.PublicKey().Bytes(), nonce...)
+	sealed = aead.Seal(sealed, nonce, content, []byte(path))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unseal decrypts a content sealed to the X25519 public key of privateKey for the file path
+func Unseal(content, path string, privateKey *ecdh.PrivateKey) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sealed content: %w", err)
+	}
+	keySize := len(privateKey.PublicKey().Bytes())
+	if len(sealed) < keySize {
+		return nil, fmt.Errorf("sealed content is too short")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:keySize])
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed content key: %w", err)
+	}
+	secret, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	key, err := sealingKey(secret, ephemeral.Bytes(), privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[keySize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed content is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sealed content: %w", err)
+	}
+	return plain, nil
+}
+
+// Sign appends a signature line of the cloud-config
+func Sign(userData string, privateKey ed25519.PrivateKey) string {
+	if len(userData) > 0 && userData[len(userData)-1] != '\n' {
+		userData += "\n"
+	}
+	signature := ed25519.Sign(privateKey, []byte(userData))
+	return userData + SignaturePrefix + base64.StdEncoding.EncodeToString(signature) + "\n"
+}
+
+// Verify checks the signature line of a cloud-config and returns the signed cloud-config.
+// ErrUnsigned is returned if the cloud-config has no signature line.
+func Verify(userData []byte, publicKey ed25519.PublicKey) ([]byte, error) {
+	trimmed := bytes.TrimRight(userData, "\n")
+	start := bytes.LastIndexByte(trimmed, '\n') + 1
+	line := trimmed[start:]
+	if !bytes.HasPrefix(line, []byte(SignaturePrefix)) {
+		return nil, ErrUnsigned
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(line[len(SignaturePrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cloud-config signature: %w", err)
+	}
+	signed := trimmed[:start]
+	if !ed25519.Verify(publicKey, signed, signature) {
+		return nil, fmt.Errorf("invalid cloud-config signature")
+	}
+	return signed, nil
+}
+
+// ParseSigningKey parses a PEM encoded PKCS #8 Ed25519 private key
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is %T, not an Ed25519 key", key)
+	}
+	return signingKey, nil
+}
+
+// ParseVerificationKey parses a PEM encoded PKIX Ed25519 public key
+func ParseVerificationKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	verificationKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("verification key is %T, not an Ed25519 key", key)
+	}
+	return verificationKey, nil
+}
+
+// ParseEncryptionKey parses a PEM encoded PKIX X25519 public key
+func ParseEncryptionKey(data []byte) (*ecdh.PublicKey, error) {
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, ok := key.(*ecdh.PublicKey)
+	if !ok || encryptionKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("encryption key is %T, not an X25519 key", key)
+	}
+	return encryptionKey, nil
+}
+
+// ParseDecryptionKey parses a PEM encoded PKCS #8 X25519 private key
+func ParseDecryptionKey(data []byte) (*ecdh.PrivateKey, error) {
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	decryptionKey, ok := key.(*ecdh.PrivateKey)
+	if !ok || decryptionKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("decryption key is %T, not an X25519 key", key)
+	}
+	return decryptionKey, nil
+}
+
+func parsePrivateKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
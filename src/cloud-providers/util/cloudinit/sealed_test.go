@@ -0,0 +1,161 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSealedCloudConfig(t *testing.T) {
+	verificationKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptionKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: "{\"tls-server-key\": \"secret\"}\n", Sensitive: true},
+			{Path: "/run/peerpod/initdata", Content: "initdata"},
+		},
+	}
+	sealed := &SealedCloudConfig{CloudConfig: cloudConfig, SigningKey: signingKey, EncryptionKey: decryptionKey.PublicKey()}
+	userData, err := sealed.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if strings.Contains(userData, "secret") {
+		t.Fatalf("Expect sensitive content to be encrypted, got %q", userData)
+	}
+	if cloudConfig.WriteFiles[0].Encoding != "" {
+		t.Fatal("Expect cloud config not to be modified")
+	}
+
+	signed, err := Verify([]byte(userData), verificationKey)
+	if err != nil {
+		t.Fatalf("Expect valid signature, got %v", err)
+	}
+	var output CloudConfig
+	if err := yaml.UnmarshalStrict(signed, &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := SealedEncoding, output.WriteFiles[0].Encoding; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	if e, a := "initdata\n", output.WriteFiles[1].Content; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	content, err := Unseal(output.WriteFiles[0].Content, forwarderConfigPath, decryptionKey)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := cloudConfig.WriteFiles[0].Content, string(content); e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	// Sealed contents are bound to their path
+	if _, err := Unseal(output.WriteFiles[0].Content, authJSONPath, decryptionKey); err == nil {
+		t.Fatal("Expect error unsealing content of another path")
+	}
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unseal(output.WriteFiles[0].Content, forwarderConfigPath, otherKey); err == nil {
+		t.Fatal("Expect error unsealing content with another key")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	verificationKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userData := "#cloud-config\n\nwrite_files:\n  - path: /123\n    content: |\n      Hello\n"
+	signed := Sign(userData, signingKey)
+
+	if got, err := Verify([]byte(signed), verificationKey); err != nil || string(got) != userData {
+		t.Fatalf("Expect %q, got %q, %v", userData, got, err)
+	}
+	// Providers may drop the trailing newline
+	if _, err := Verify([]byte(strings.TrimRight(signed, "\n")), verificationKey); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if _, err := Verify([]byte(userData), verificationKey); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("Expect %v, got %v", ErrUnsigned, err)
+	}
+	tampered := strings.Replace(signed, "Hello", "Hallo", 1)
+	if _, err := Verify([]byte(tampered), verificationKey); err == nil || errors.Is(err, ErrUnsigned) {
+		t.Fatalf("Expect invalid signature, got %v", err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify([]byte(signed), otherKey); err == nil {
+		t.Fatal("Expect error verifying with another key")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptionKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM := func(key any) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	publicPEM := func(key any) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	if key, err := ParseSigningKey(privatePEM(signingKey)); err != nil || !key.Equal(signingKey) {
+		t.Fatalf("Expect signing key, got %v", err)
+	}
+	if key, err := ParseVerificationKey(publicPEM(signingKey.Public())); err != nil || !key.Equal(signingKey.Public()) {
+		t.Fatalf("Expect verification key, got %v", err)
+	}
+	if key, err := ParseEncryptionKey(publicPEM(decryptionKey.PublicKey())); err != nil || !key.Equal(decryptionKey.PublicKey()) {
+		t.Fatalf("Expect encryption key, got %v", err)
+	}
+	if key, err := ParseDecryptionKey(privatePEM(decryptionKey)); err != nil || !key.Equal(decryptionKey) {
+		t.Fatalf("Expect decryption key, got %v", err)
+	}
+
+	// Keys of the wrong type are rejected
+	if _, err := ParseSigningKey(privatePEM(decryptionKey)); err == nil {
+		t.Fatal("Expect error parsing an X25519 signing key")
+	}
+	if _, err := ParseEncryptionKey(publicPEM(signingKey.Public())); err == nil {
+		t.Fatal("Expect error parsing an Ed25519 encryption key")
+	}
+	if _, err := ParseVerificationKey([]byte("not a key")); err == nil {
+		t.Fatal("Expect error parsing a non PEM key")
+	}
+}
@@ -0,0 +1,132 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// MergeType makes cloud-init append the write_files of the parts of multi-part user data
+// https://cloudinit.readthedocs.io/en/latest/reference/merging.html
+const MergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+
+// ErrUserDataTooLarge is returned when the user data exceeds the limit of a cloud provider
+var ErrUserDataTooLarge = errors.New("user data is too large")
+
+// compressible generators can generate smaller user data by compressing file contents
+type compressible interface {
+	compressed() CloudConfigGenerator
+}
+
+// UserDataLimit is the user data size limit of a cloud provider
+type UserDataLimit struct {
+	// Size is the maximum size of the user data in bytes, before the provider encodes it. Zero means no limit.
+	Size int
+	// Gzip allows gzipping the whole user data, for providers passing the user data base64 encoded
+	Gzip bool
+}
+
+// Base64Size returns the maximum size of data whose base64 encoding fits in size bytes
+func Base64Size(size int) int {
+	return size / 4 * 3
+}
+
+// Generate generates user data within the size limit. If the user data is too large,
+// the whole user data is gzipped if allowed, or else the file contents are compressed.
+func (l UserDataLimit) Generate(generator CloudConfigGenerator) (string, error) {
+	userData, err := generator.Generate()
+	if err != nil {
+		return "", err
+	}
+	if l.Size == 0 || len(userData) <= l.Size {
+		return userData, nil
+	}
+	size := len(userData)
+
+	if l.Gzip {
+		// cloud-init detects gzipped user data, which compresses better than each file content alone
+		compressed, err := gzipData([]byte(userData))
+		if err != nil {
+			return "", fmt.Errorf("Error compressing cloudinit userdata: %w", err)
+		}
+		if len(compressed) <= l.Size {
+			return string(compressed), nil
+		}
+	}
+
+	if c, ok := generator.(compressible); ok {
+		compressed, err := c.compressed().Generate()
+		if err != nil {
+			return "", err
+		}
+		if len(compressed) <= l.Size {
+			return compressed, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %d bytes exceed the limit of %d bytes", ErrUserDataTooLarge, size, l.Size)
+}
+
+// MultiPartCloudConfig generates MIME multi-part user data of cloud-configs or scripts.
+// cloud-init appends the write_files of the cloud-config parts.
+type MultiPartCloudConfig struct {
+	Parts []CloudConfigGenerator
+}
+
+func (m *MultiPartCloudConfig) Generate() (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for i, part := range m.Parts {
+		content, err := part.Generate()
+		if err != nil {
+			return "", err
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", partContentType(content)+`; charset="utf-8"`)
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="part-%03d"`, i+1))
+		header.Set("Merge-Type", MergeType)
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return "", fmt.Errorf("Error creating a part of multi-part userdata: %w", err)
+		}
+		if _, err := pw.Write([]byte(content)); err != nil {
+			return "", fmt.Errorf("Error writing a part of multi-part userdata: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("Error closing multi-part userdata: %w", err)
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\nMIME-Version: 1.0\n\n%s", w.Boundary(), body.String()), nil
+}
+
+func (m *MultiPartCloudConfig) compressed() CloudConfigGenerator {
+	compressed := &MultiPartCloudConfig{Parts: make([]CloudConfigGenerator, len(m.Parts))}
+	for i, part := range m.Parts {
+		if c, ok := part.(compressible); ok {
+			part = c.compressed()
+		}
+		compressed.Parts[i] = part
+	}
+	return compressed
+}
+
+// partContentType returns the MIME type of a part of multi-part user data
+// https://cloudinit.readthedocs.io/en/latest/explanation/format.html
+func partContentType(content string) string {
+	switch {
+	case strings.HasPrefix(content, "#cloud-config"):
+		return "text/cloud-config"
+	case strings.HasPrefix(content, "#!"):
+		return "text/x-shellscript"
+	default:
+		return "text/plain"
+	}
+}
@@ -0,0 +1,163 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expect gzip data, got %v", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	return string(plain)
+}
+
+func TestCompressedWriteFile(t *testing.T) {
+	content := strings.Repeat("Hello World\n", 100)
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: "/123", Content: content, Compress: true},
+			{Path: "/456", Content: "Hello\n"},
+		},
+	}
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !cloudConfig.WriteFiles[0].Compress || cloudConfig.WriteFiles[0].Encoding != "" {
+		t.Fatal("Expect cloud config not to be modified")
+	}
+
+	var output CloudConfig
+	if err := yaml.UnmarshalStrict([]byte(userData), &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := GzipBase64Encoding, output.WriteFiles[0].Encoding; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(output.WriteFiles[0].Content))
+	if err != nil {
+		t.Fatalf("Expect base64 content, got %v", err)
+	}
+	if e, a := content, gunzip(t, compressed); e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	if e, a := "", output.WriteFiles[1].Encoding; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+}
+
+func TestUserDataLimit(t *testing.T) {
+	content := strings.Repeat("Hello World\n", 1000)
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: "/123", Content: content},
+		},
+	}
+	plain, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	// User data within the limit is not modified
+	for _, limit := range []UserDataLimit{{}, {Size: len(plain)}, {Size: len(plain), Gzip: true}} {
+		if userData, err := limit.Generate(cloudConfig); err != nil || userData != plain {
+			t.Fatalf("Expect plain user data within %d bytes, got %v", limit.Size, err)
+		}
+	}
+
+	// File contents are compressed
+	userData, err := UserDataLimit{Size: 1024}.Generate(cloudConfig)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if len(userData) > 1024 || !strings.Contains(userData, "encoding: "+GzipBase64Encoding) {
+		t.Fatalf("Expect compressed file contents within 1024 bytes, got %q", userData)
+	}
+
+	// The whole user data is gzipped
+	userData, err = UserDataLimit{Size: 1024, Gzip: true}.Generate(cloudConfig)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := plain, gunzip(t, []byte(userData)); e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	// Incompressible contents exceed the limit
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	cloudConfig.WriteFiles[0].Content = base64.StdEncoding.EncodeToString(random)
+	if _, err := (UserDataLimit{Size: 4096, Gzip: true}).Generate(cloudConfig); !errors.Is(err, ErrUserDataTooLarge) {
+		t.Fatalf("Expect %v, got %v", ErrUserDataTooLarge, err)
+	}
+}
+
+func TestMultiPartCloudConfig(t *testing.T) {
+	parts := []CloudConfigGenerator{
+		&CloudConfig{WriteFiles: []WriteFile{{Path: "/123", Content: "Hello\n"}}},
+		&CloudConfig{WriteFiles: []WriteFile{{Path: "/456", Content: "World\n", Compress: true}}},
+	}
+	userData, err := (&MultiPartCloudConfig{Parts: parts}).Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(userData))
+	if err != nil {
+		t.Fatalf("Expect MIME message, got %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expect multipart/mixed, got %q, %v", mediaType, err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for i, path := range []string{"/123", "/456"} {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("Expect part %d, got %v", i, err)
+		}
+		if e, a := `text/cloud-config; charset="utf-8"`, part.Header.Get("Content-Type"); e != a {
+			t.Fatalf("Expect %q, got %q", e, a)
+		}
+		if e, a := MergeType, part.Header.Get("Merge-Type"); e != a {
+			t.Fatalf("Expect %q, got %q", e, a)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		var output CloudConfig
+		if err := yaml.UnmarshalStrict(content, &output); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if e, a := path, output.WriteFiles[0].Path; e != a {
+			t.Fatalf("Expect %q, got %q", e, a)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Fatalf("Expect two parts, got %v", err)
+	}
+}
@@ -30,6 +30,12 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&vspherecfg.Cluster, "cluster", "", "vCenter destination cluster name ")
 	flags.StringVar(&vspherecfg.DRS, "drs", "false", "Use DRS for clone placement in destination Vcenter cluster")
 	flags.StringVar(&vspherecfg.Host, "host", "", "vCenter host name of resource pool destination")
+	flags.StringVar(&vspherecfg.InstanceType, "instance-type", "", "Default instance type of the Pod VMs, the Pod VMs have the size of the template if not set")
+	flags.Var(&vspherecfg.InstanceTypes, "instance-types", "Instance types of the Pod VMs as name=<vCPUs>x<memory in MiB> pairs, comma separated")
+	flags.Int64Var(&vspherecfg.MinVCPUs, "min-vcpus", 1, "Minimum number of vCPUs of the Pod VMs")
+	flags.Int64Var(&vspherecfg.MaxVCPUs, "max-vcpus", 0, "Maximum number of vCPUs of the Pod VMs, unlimited if 0")
+	flags.Int64Var(&vspherecfg.MinMemory, "min-memory", 1024, "Minimum memory of the Pod VMs in MiB")
+	flags.Int64Var(&vspherecfg.MaxMemory, "max-memory", 0, "Maximum memory of the Pod VMs in MiB, unlimited if 0")
 }
 
 func (_ *Manager) LoadEnv() {
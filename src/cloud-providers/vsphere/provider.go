@@ -24,7 +24,11 @@ import (
 
 var logger = log.New(log.Writer(), "[adaptor/cloud/vsphere] ", log.LstdFlags|log.Lmsgprefix)
 
-const maxInstanceNameLen = 63
+const (
+	maxInstanceNameLen = 63
+	// vSphere requires the memory size of a VM to be a multiple of 4 MiB
+	memoryGranularity = 4
+)
 
 type vsphereProvider struct {
 	gclient       *govmomi.Client
@@ -57,6 +61,10 @@ func checkConfig(config *Config) error {
 
 	// Do some initial checks of the optional input values
 
+	if err := checkSizing(config); err != nil {
+		return err
+	}
+
 	if config.DRS == "true" {
 		if config.Cluster == "" {
 			return fmt.Errorf("Error: A cluster name is required with DRS")
@@ -74,15 +82,135 @@ func checkConfig(config *Config) error {
 	return nil
 }
 
+func checkSizing(config *Config) error {
+
+	if config.MaxVCPUs > 0 && config.MinVCPUs > config.MaxVCPUs {
+		return fmt.Errorf("Error: The minimum number of vCPUs %d is greater than the maximum %d", config.MinVCPUs, config.MaxVCPUs)
+	}
+	if config.MaxMemory > 0 && config.MinMemory > config.MaxMemory {
+		return fmt.Errorf("Error: The minimum memory %d MiB is greater than the maximum %d MiB", config.MinMemory, config.MaxMemory)
+	}
+
+	for _, spec := range config.InstanceTypes {
+		if spec.VCPUs < config.MinVCPUs || (config.MaxVCPUs > 0 && spec.VCPUs > config.MaxVCPUs) {
+			return fmt.Errorf("Error: The number of vCPUs of instance type %s is out of the allowed range", spec.InstanceType)
+		}
+		if spec.Memory < config.MinMemory || (config.MaxMemory > 0 && spec.Memory > config.MaxMemory) {
+			return fmt.Errorf("Error: The memory of instance type %s is out of the allowed range", spec.InstanceType)
+		}
+	}
+
+	if config.InstanceType != "" {
+		if _, ok := config.InstanceTypes.get(config.InstanceType); !ok {
+			return fmt.Errorf("Error: The default instance type %s is not one of the instance types", config.InstanceType)
+		}
+	}
+
+	return nil
+}
+
+// vmSize returns the number of vCPUs and the memory in MiB of a Pod VM. The vCPUs and memory
+// requested by the pod have precedence over its instance type. Zero values keep the size of the template.
+func (p *vsphereProvider) vmSize(spec provider.InstanceTypeSpec) (vcpus int64, memory int64, err error) {
+
+	if spec.VCPUs == 0 && spec.Memory == 0 {
+		instanceType := spec.InstanceType
+		if instanceType == "" {
+			instanceType = p.serviceConfig.InstanceType
+		}
+		if instanceType == "" {
+			return 0, 0, nil
+		}
+
+		shape, ok := p.serviceConfig.InstanceTypes.get(instanceType)
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown instance type %s", instanceType)
+		}
+		logger.Printf("Instance type %s selected with %d vCPUs and %d MiB of memory", instanceType, shape.VCPUs, shape.Memory)
+		vcpus, memory = shape.VCPUs, shape.Memory
+	} else {
+		vcpus, memory = spec.VCPUs, spec.Memory
+
+		if vcpus != 0 {
+			vcpus = max(vcpus, p.serviceConfig.MinVCPUs)
+			if p.serviceConfig.MaxVCPUs > 0 && vcpus > p.serviceConfig.MaxVCPUs {
+				return 0, 0, fmt.Errorf("requested %d vCPUs exceed the maximum of %d vCPUs", vcpus, p.serviceConfig.MaxVCPUs)
+			}
+		}
+		if memory != 0 {
+			memory = max(memory, p.serviceConfig.MinMemory)
+			if p.serviceConfig.MaxMemory > 0 && memory > p.serviceConfig.MaxMemory {
+				return 0, 0, fmt.Errorf("requested %d MiB of memory exceed the maximum of %d MiB", memory, p.serviceConfig.MaxMemory)
+			}
+		}
+	}
+
+	memory = (memory + memoryGranularity - 1) / memoryGranularity * memoryGranularity
+
+	return vcpus, memory, nil
+}
+
+// vmTemplate returns the template to clone a Pod VM from, which is selected by the image of the pod if set
+func (p *vsphereProvider) vmTemplate(spec provider.InstanceTypeSpec) string {
+	if spec.Image != "" {
+		logger.Printf("Choosing %s from annotation as the vSphere template for the PodVM image", spec.Image)
+		return spec.Image
+	}
+	return p.serviceConfig.Template
+}
+
 type VmConfig []types.BaseOptionValue
 
-func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, requirement provider.InstanceTypeSpec) (*provider.Instance, error) {
+// vmConfigSpec returns the configuration of a cloned Pod VM with the user data and, if not zero, the vCPUs and memory
+func vmConfigSpec(userData string, vcpus, memory int64) types.VirtualMachineConfigSpec {
+
+	//Convert userData to base64
+	userDataEnc := base64.StdEncoding.EncodeToString([]byte(userData))
+
+	var extraconfig VmConfig
+
+	extraconfig = append(extraconfig,
+		&types.OptionValue{
+			Key:   "guestinfo.userdata",
+			Value: userDataEnc,
+		},
+		&types.OptionValue{
+			Key:   "guestinfo.userdata.encoding",
+			Value: "base64",
+		},
+	)
+
+	configSpec := types.VirtualMachineConfigSpec{
+		ExtraConfig: extraconfig,
+	}
+
+	if vcpus > 0 {
+		// One core per socket, since the number of vCPUs must be a multiple of the cores per socket of the template
+		configSpec.NumCPUs = int32(vcpus)
+		configSpec.NumCoresPerSocket = 1
+	}
+	if memory > 0 {
+		configSpec.MemoryMB = memory
+	}
+
+	return configSpec
+}
+
+func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
 
 	vmname := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
 	logger.Printf("Start CreateInstance VM name %s", vmname)
 
-	err := CheckSessionWithRestore(ctx, p.serviceConfig, p.gclient)
+	vcpus, memory, err := p.vmSize(spec)
+	if err != nil {
+		logger.Printf("VM %s size error: %s", vmname, err)
+		return nil, err
+	}
+
+	templateName := p.vmTemplate(spec)
+
+	err = CheckSessionWithRestore(ctx, p.serviceConfig, p.gclient)
 	if err != nil {
 		logger.Printf("CreateInstance cannot find or create a new vcenter session")
 		return nil, err
@@ -98,20 +226,20 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 
 	finder.SetDatacenter(dc)
 
-	vm, err := finder.VirtualMachine(ctx, p.serviceConfig.Template)
+	vm, err := finder.VirtualMachine(ctx, templateName)
 	if err != nil {
-		logger.Printf("Cannot find VM template %s error: %s", p.serviceConfig.Template, err)
+		logger.Printf("Cannot find VM template %s error: %s", templateName, err)
 		return nil, err
 	}
 
 	template, err := vm.IsTemplate(ctx)
 	if err != nil {
-		logger.Printf("VM template %s error: %s", p.serviceConfig.Template, err)
+		logger.Printf("VM template %s error: %s", templateName, err)
 		return nil, err
 	}
 	if !template {
 		err = fmt.Errorf("template not valid")
-		logger.Printf("VM template %s error: %s", p.serviceConfig.Template, err)
+		logger.Printf("VM template %s error: %s", templateName, err)
 		return nil, err
 	}
 
@@ -253,25 +381,7 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 		return nil, err
 	}
 
-	//Convert userData to base64
-	userDataEnc := base64.StdEncoding.EncodeToString([]byte(userData))
-
-	var extraconfig VmConfig
-
-	extraconfig = append(extraconfig,
-		&types.OptionValue{
-			Key:   "guestinfo.userdata",
-			Value: userDataEnc,
-		},
-		&types.OptionValue{
-			Key:   "guestinfo.userdata.encoding",
-			Value: "base64",
-		},
-	)
-
-	configSpec := types.VirtualMachineConfigSpec{
-		ExtraConfig: extraconfig,
-	}
+	configSpec := vmConfigSpec(userData, vcpus, memory)
 
 	cloneSpec.Location = relocateSpec
 	cloneSpec.Config = &configSpec
@@ -0,0 +1,236 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+func TestInstanceTypes(t *testing.T) {
+	var instanceTypes instanceTypes
+	if err := instanceTypes.Set("small=2x4096, large=8x16384"); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := "small=2x4096,large=8x16384", instanceTypes.String(); e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if spec, ok := instanceTypes.get("large"); !ok || spec.VCPUs != 8 || spec.Memory != 16384 {
+		t.Errorf("Expect large instance type with 8 vCPUs and 16384 MiB, got %v", spec)
+	}
+	if _, ok := instanceTypes.get("medium"); ok {
+		t.Error("Expect no medium instance type")
+	}
+
+	for _, value := range []string{"small", "=2x4096", "small=2", "small=0x4096", "small=2x4GiB"} {
+		if err := instanceTypes.Set(value); err == nil {
+			t.Errorf("Expect error for instance type %q, got nil", value)
+		}
+	}
+}
+
+func TestCheckSizing(t *testing.T) {
+	instanceTypes := instanceTypes{{InstanceType: "small", VCPUs: 2, Memory: 4096}}
+
+	for name, config := range map[string]*Config{
+		"min vcpus":       {MinVCPUs: 4, MaxVCPUs: 2},
+		"min memory":      {MinMemory: 4096, MaxMemory: 2048},
+		"too small":       {MinVCPUs: 4, InstanceTypes: instanceTypes},
+		"too large":       {MaxMemory: 2048, InstanceTypes: instanceTypes},
+		"unknown default": {InstanceType: "large", InstanceTypes: instanceTypes},
+	} {
+		if err := checkSizing(config); err == nil {
+			t.Errorf("%s: Expect error, got nil", name)
+		}
+	}
+
+	if err := checkSizing(&Config{InstanceType: "small", InstanceTypes: instanceTypes, MinVCPUs: 1, MaxVCPUs: 8, MinMemory: 1024}); err != nil {
+		t.Errorf("Expect no error, got %v", err)
+	}
+}
+
+func TestVMSize(t *testing.T) {
+	p := &vsphereProvider{serviceConfig: &Config{
+		InstanceTypes: instanceTypes{{InstanceType: "small", VCPUs: 2, Memory: 4096}, {InstanceType: "large", VCPUs: 8, Memory: 16384}},
+		MinVCPUs:      1,
+		MaxVCPUs:      8,
+		MinMemory:     1024,
+		MaxMemory:     16384,
+	}}
+
+	for name, tc := range map[string]struct {
+		spec     provider.InstanceTypeSpec
+		instType string
+		vcpus    int64
+		memory   int64
+		err      bool
+	}{
+		"template":         {},
+		"default":          {instType: "small", vcpus: 2, memory: 4096},
+		"instance type":    {spec: provider.InstanceTypeSpec{InstanceType: "large"}, instType: "small", vcpus: 8, memory: 16384},
+		"unknown":          {spec: provider.InstanceTypeSpec{InstanceType: "medium"}, err: true},
+		"resources":        {spec: provider.InstanceTypeSpec{InstanceType: "large", VCPUs: 3, Memory: 3000}, vcpus: 3, memory: 3000},
+		"minimum":          {spec: provider.InstanceTypeSpec{VCPUs: 1, Memory: 512}, vcpus: 1, memory: 1024},
+		"rounded":          {spec: provider.InstanceTypeSpec{Memory: 2049}, memory: 2052},
+		"too many vcpus":   {spec: provider.InstanceTypeSpec{VCPUs: 16, Memory: 4096}, err: true},
+		"too large memory": {spec: provider.InstanceTypeSpec{VCPUs: 2, Memory: 32768}, err: true},
+	} {
+		p.serviceConfig.InstanceType = tc.instType
+		vcpus, memory, err := p.vmSize(tc.spec)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: Expect error, got nil", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Expect no error, got %v", name, err)
+		}
+		if vcpus != tc.vcpus || memory != tc.memory {
+			t.Errorf("%s: Expect %d vCPUs and %d MiB, got %d vCPUs and %d MiB", name, tc.vcpus, tc.memory, vcpus, memory)
+		}
+	}
+}
+
+func TestVMConfigSpec(t *testing.T) {
+	configSpec := vmConfigSpec("cloud config", 4, 8192)
+	if configSpec.NumCPUs != 4 || configSpec.NumCoresPerSocket != 1 || configSpec.MemoryMB != 8192 {
+		t.Errorf("Expect 4 vCPUs and 8192 MiB, got %d vCPUs and %d MiB", configSpec.NumCPUs, configSpec.MemoryMB)
+	}
+	if e, a := base64.StdEncoding.EncodeToString([]byte("cloud config")), configSpec.ExtraConfig[0].GetOptionValue().Value; e != a {
+		t.Errorf("Expect user data %s, got %s", e, a)
+	}
+
+	configSpec = vmConfigSpec("cloud config", 0, 0)
+	if configSpec.NumCPUs != 0 || configSpec.NumCoresPerSocket != 0 || configSpec.MemoryMB != 0 {
+		t.Errorf("Expect the size of the template, got %d vCPUs and %d MiB", configSpec.NumCPUs, configSpec.MemoryMB)
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	server := model.Service.NewServer()
+	defer server.Close()
+
+	password, _ := server.URL.User.Password()
+	config := &Config{
+		VcenterURL:   server.URL.String(),
+		UserName:     server.URL.User.Username(),
+		Password:     password,
+		Datacenter:   "DC0",
+		Cluster:      "DC0_C0",
+		Host:         "DC0_C0_H0",
+		Datastore:    "LocalDS_0",
+		Deployfolder: "peerpods",
+		Template:     "podvm-template",
+		MinVCPUs:     1,
+		MaxVCPUs:     4,
+	}
+	p, err := NewProvider(config)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer p.Teardown()
+	client := p.(*vsphereProvider).gclient.Client
+
+	finder := find.NewFinder(client)
+	dc, err := finder.Datacenter(ctx, "DC0")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	finder.SetDatacenter(dc)
+	template, err := finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	task, err := template.PowerOff(ctx)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if err := template.MarkAsTemplate(ctx); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if _, err := p.CreateInstance(ctx, "pod", "012345678", &mockCloudConfig{}, provider.InstanceTypeSpec{VCPUs: 8}); err == nil {
+		t.Error("Expect error for too many vCPUs, got nil")
+	}
+	if _, err := p.CreateInstance(ctx, "pod", "012345678", &mockCloudConfig{}, provider.InstanceTypeSpec{}); err == nil {
+		t.Error("Expect error for missing template, got nil")
+	}
+
+	// The simulated guest of the clone gets an IP address once the clone exists
+	go func() {
+		for ctx.Err() == nil {
+			if clone, err := finder.VirtualMachine(ctx, "podvm-pod-01234567"); err == nil {
+				if task, err := clone.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+					ExtraConfig: []types.BaseOptionValue{&types.OptionValue{Key: "SET.guest.ipAddress", Value: "192.0.2.10"}},
+				}); err == nil {
+					_ = task.Wait(ctx)
+				}
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	instance, err := p.CreateInstance(ctx, "pod", "012345678", &mockCloudConfig{}, provider.InstanceTypeSpec{Image: "DC0_C0_RP0_VM0", VCPUs: 2, Memory: 2048})
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := "podvm-pod-01234567", instance.Name; e != a {
+		t.Errorf("Expect %s, got %s", e, a)
+	}
+	if len(instance.IPs) != 1 || instance.IPs[0].String() != "192.0.2.10" {
+		t.Errorf("Expect IP 192.0.2.10, got %v", instance.IPs)
+	}
+
+	clone, err := finder.VirtualMachine(ctx, "peerpods/podvm-pod-01234567")
+	if err != nil {
+		t.Fatalf("Expect clone in the deploy folder, got %v", err)
+	}
+	var vm mo.VirtualMachine
+	if err := clone.Properties(ctx, clone.Reference(), []string{"config.extraConfig"}, &vm); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	userData := ""
+	for _, option := range vm.Config.ExtraConfig {
+		if option.GetOptionValue().Key == "guestinfo.userdata" {
+			userData = option.GetOptionValue().Value.(string)
+		}
+	}
+	if e, a := base64.StdEncoding.EncodeToString([]byte("cloud config")), userData; e != a {
+		t.Errorf("Expect user data %s, got %s", e, a)
+	}
+
+	if err := p.DeleteInstance(ctx, instance.ID); err != nil {
+		t.Errorf("Expect no error, got %v", err)
+	}
+	if _, err := finder.VirtualMachine(ctx, "peerpods/podvm-pod-01234567"); err == nil {
+		t.Error("Expect clone to be deleted")
+	}
+}
@@ -4,21 +4,75 @@
 package vsphere
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
+// instanceTypes are named shapes of the Pod VMs, set as comma separated name=<vCPUs>x<memory in MiB> pairs
+type instanceTypes []provider.InstanceTypeSpec
+
+func (i *instanceTypes) String() string {
+	var shapes []string
+	for _, spec := range *i {
+		shapes = append(shapes, fmt.Sprintf("%s=%dx%d", spec.InstanceType, spec.VCPUs, spec.Memory))
+	}
+	return strings.Join(shapes, ",")
+}
+
+func (i *instanceTypes) Set(value string) error {
+	for _, shape := range strings.Split(value, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(shape), "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid instance type %q, expected name=<vCPUs>x<memory in MiB>", shape)
+		}
+		vcpus, memory, ok := strings.Cut(size, "x")
+		if !ok {
+			return fmt.Errorf("invalid instance type %q, expected name=<vCPUs>x<memory in MiB>", shape)
+		}
+		spec := provider.InstanceTypeSpec{InstanceType: name}
+		var err error
+		if spec.VCPUs, err = strconv.ParseInt(vcpus, 10, 64); err != nil || spec.VCPUs <= 0 {
+			return fmt.Errorf("invalid number of vCPUs of instance type %q", name)
+		}
+		if spec.Memory, err = strconv.ParseInt(memory, 10, 64); err != nil || spec.Memory <= 0 {
+			return fmt.Errorf("invalid memory size of instance type %q", name)
+		}
+		*i = append(*i, spec)
+	}
+	return nil
+}
+
+func (i instanceTypes) get(name string) (provider.InstanceTypeSpec, bool) {
+	for _, spec := range i {
+		if spec.InstanceType == name {
+			return spec, true
+		}
+	}
+	return provider.InstanceTypeSpec{}, false
+}
+
 type Config struct {
-	VcenterURL   string
-	UserName     string
-	Password     string
-	Thumbprint   string
-	Datacenter   string
-	Cluster      string
-	Datastore    string
-	DRS          string
-	Deployfolder string
-	Template     string
-	Host         string
+	VcenterURL    string
+	UserName      string
+	Password      string
+	Thumbprint    string
+	Datacenter    string
+	Cluster       string
+	Datastore     string
+	DRS           string
+	Deployfolder  string
+	Template      string
+	Host          string
+	InstanceType  string
+	InstanceTypes instanceTypes
+	MinVCPUs      int64
+	MaxVCPUs      int64
+	MinMemory     int64
+	MaxMemory     int64
 }
 
 func (c Config) Redact() Config {